@@ -3,7 +3,7 @@
 PROTO_DIR=./proto
 THIRD_PARTY_DIR=./third_party
 OUT_DIR=./proto_generated
-OPENAPI_DIR=./api-docs
+OPENAPI_DIR=./services/api-gateway/internal/openapi/spec
 
 # Определяем пути для Google API
 GOOGLE_API_DIR="$THIRD_PARTY_DIR/google/api"
@@ -58,10 +58,11 @@ protoc $BASE \
   --plugin=protoc-gen-grpc-gateway=$PROTOC_GEN_GRPC_GATEWAY --grpc-gateway_out=$OUT_DIR --grpc-gateway_opt=paths=source_relative \
   $PROTO_DIR/smarthome/v1/*.proto
 
-# OpenAPI документация для всех сервисов
+# OpenAPI документация для всех сервисов (один файл, встраивается в API Gateway)
 echo "Генерация OpenAPI документации..."
 protoc $BASE \
   --plugin=protoc-gen-openapiv2=$PROTOC_GEN_OPENAPIV2 --openapiv2_out=$OPENAPI_DIR \
+  --openapiv2_opt=allow_merge=true,merge_file_name=smarthome \
   $PROTO_DIR/smarthome/v1/*.proto
 
 echo "Генерация завершена успешно!"
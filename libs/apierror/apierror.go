@@ -0,0 +1,227 @@
+// Package apierror описывает единую модель ошибок сервисов умного дома.
+//
+// Ошибка - это код gRPC, стабильная машиночитаемая причина (reason) и
+// сообщение для разработчика на английском. Причина и метаданные передаются
+// в деталях статуса как google.rpc.ErrorInfo, ошибки валидации полей - как
+// google.rpc.BadRequest. Шлюз отдает такие ошибки клиентам в виде
+// problem+json (RFC 7807).
+package apierror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domain - домен ErrorInfo для всех сервисов умного дома
+const Domain = "smarthome"
+
+// Причины ошибок. Значения стабильны: клиенты могут на них полагаться.
+const (
+	// Общие
+	ReasonValidationFailed = "VALIDATION_FAILED" // Некорректные поля запроса (детали в BadRequest)
+	ReasonInternal         = "INTERNAL"          // Внутренняя ошибка сервиса
+	ReasonUnavailable      = "UNAVAILABLE"       // Сервис временно недоступен
+	ReasonRouteNotFound    = "ROUTE_NOT_FOUND"   // Неизвестный HTTP-маршрут
+	ReasonMethodNotAllowed = "METHOD_NOT_ALLOWED"
+
+	// Аутентификация
+	ReasonTokenMissing       = "TOKEN_MISSING"       // Токен не передан
+	ReasonTokenInvalid       = "TOKEN_INVALID"       // Токен поврежден, подделан или отозван
+	ReasonTokenExpired       = "TOKEN_EXPIRED"       // Срок действия токена истек
+	ReasonInvalidCredentials = "INVALID_CREDENTIALS" // Неверное имя пользователя или пароль
+	ReasonUserNotFound       = "USER_NOT_FOUND"
+	ReasonRoleRequired       = "ROLE_REQUIRED" // У пользователя нет роли, нужной для операции
+
+	// Устройства
+	ReasonDeviceNotFound      = "DEVICE_NOT_FOUND"
+	ReasonDeviceOffline       = "DEVICE_OFFLINE"       // Команда отправлена устройству не в сети
+	ReasonActionNotSupported  = "ACTION_NOT_SUPPORTED" // Действие не поддерживается устройством
+	ReasonMissingParameter    = "MISSING_PARAMETER"    // Нет обязательного параметра команды
+	ReasonInvalidParameter    = "INVALID_PARAMETER"    // Параметр команды не подходит типу устройства
+	ReasonDeviceUpdateFailed  = "DEVICE_UPDATE_FAILED" // Не удалось сохранить состояние устройства
+	ReasonPreconditionFailed  = "PRECONDITION_FAILED"  // If-Match не совпал с текущим состоянием
+	ReasonDeviceConflict      = "DEVICE_CONFLICT"      // Устройство изменено параллельным запросом
+	ReasonDeviceServiceFailed = "DEVICE_SERVICE_ERROR" // Ошибка вызова Device Service из другого сервиса
+
+	// Комнаты
+	ReasonRoomNotFound      = "ROOM_NOT_FOUND"
+	ReasonRoomNotEmpty      = "ROOM_NOT_EMPTY"      // Удаление комнаты, к которой привязаны устройства
+	ReasonRoomAlreadyExists = "ROOM_ALREADY_EXISTS" // Имя или псевдоним уже занят другой комнатой
+
+	// Сцены
+	ReasonSceneNotFound      = "SCENE_NOT_FOUND"
+	ReasonSceneAlreadyExists = "SCENE_ALREADY_EXISTS" // Имя уже занято другой сценой
+
+	// Автоматизация
+	ReasonRuleNotFound     = "RULE_NOT_FOUND"
+	ReasonScheduleNotFound = "SCHEDULE_NOT_FOUND"
+
+	// Голосовое управление
+	ReasonAudioNotSupported    = "AUDIO_NOT_SUPPORTED"
+	ReasonInvalidInput         = "INVALID_INPUT"
+	ReasonIntentNotRecognized  = "INTENT_NOT_RECOGNIZED"
+	ReasonIntentNotImplemented = "INTENT_NOT_IMPLEMENTED"
+	ReasonMissingEntity        = "MISSING_ENTITY" // В команде не найдена нужная сущность (устройство, температура)
+
+	// Шлюз
+	ReasonRateLimited            = "RATE_LIMITED"
+	ReasonIdempotencyKeyReused   = "IDEMPOTENCY_KEY_REUSED"    // Ключ использован с другим запросом
+	ReasonIdempotencyKeyInFlight = "IDEMPOTENCY_KEY_IN_FLIGHT" // Запрос с этим ключом еще выполняется
+	ReasonWebhookNotFound        = "WEBHOOK_NOT_FOUND"
+	ReasonBatchItemSkipped       = "BATCH_ITEM_SKIPPED" // Подзапрос не выполнен из-за ошибки предыдущего
+	ReasonCORSRejected           = "CORS_REJECTED"      // Источник, метод или заголовок не разрешены политикой источников
+)
+
+// FieldViolation - ошибка в поле запроса
+type FieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// Error - ошибка с кодом gRPC, причиной и деталями
+type Error struct {
+	Code       codes.Code
+	Reason     string
+	Message    string
+	Metadata   map[string]string
+	Violations []FieldViolation
+}
+
+// New создает ошибку с кодом, причиной и сообщением
+func New(code codes.Code, reason, message string) *Error {
+	return &Error{Code: code, Reason: reason, Message: message}
+}
+
+// Newf создает ошибку с форматированным сообщением
+func Newf(code codes.Code, reason, format string, args ...interface{}) *Error {
+	return New(code, reason, fmt.Sprintf(format, args...))
+}
+
+// InvalidArgument создает ошибку валидации с нарушениями полей
+func InvalidArgument(message string, violations ...FieldViolation) *Error {
+	return &Error{
+		Code:       codes.InvalidArgument,
+		Reason:     ReasonValidationFailed,
+		Message:    message,
+		Violations: violations,
+	}
+}
+
+// WithMetadata добавляет метаданные ErrorInfo (например, device_id)
+func (e *Error) WithMetadata(key, value string) *Error {
+	if e.Metadata == nil {
+		e.Metadata = make(map[string]string)
+	}
+	e.Metadata[key] = value
+	return e
+}
+
+// WithViolation добавляет нарушение поля
+func (e *Error) WithViolation(field, description string) *Error {
+	e.Violations = append(e.Violations, FieldViolation{Field: field, Description: description})
+	return e
+}
+
+// Error возвращает сообщение ошибки
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// GRPCStatus возвращает статус с деталями ErrorInfo и BadRequest.
+// Благодаря этому методу *Error можно возвращать из gRPC-обработчиков напрямую.
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(e.Code, e.Message)
+
+	info := &errdetails.ErrorInfo{Reason: e.Reason, Domain: Domain, Metadata: e.Metadata}
+	if len(e.Violations) == 0 {
+		if withDetails, err := st.WithDetails(info); err == nil {
+			return withDetails
+		}
+		return st
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range e.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Description,
+		})
+	}
+	if withDetails, err := st.WithDetails(info, badRequest); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// FromError восстанавливает *Error из ошибки любого вида: *Error, статуса gRPC
+// (в том числе полученного от другого сервиса) или ошибки контекста. Если в
+// статусе нет ErrorInfo, причина выводится из кода gRPC.
+func FromError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return New(codes.DeadlineExceeded, DefaultReason(codes.DeadlineExceeded), "deadline exceeded")
+	case errors.Is(err, context.Canceled):
+		return New(codes.Canceled, DefaultReason(codes.Canceled), "request canceled")
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return New(codes.Unknown, DefaultReason(codes.Unknown), err.Error())
+	}
+
+	result := &Error{Code: st.Code(), Message: st.Message()}
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			result.Reason = d.Reason
+			if len(d.Metadata) > 0 {
+				result.Metadata = d.Metadata
+			}
+		case *errdetails.BadRequest:
+			for _, v := range d.FieldViolations {
+				result.Violations = append(result.Violations, FieldViolation{Field: v.Field, Description: v.Description})
+			}
+		}
+	}
+	if result.Reason == "" {
+		result.Reason = DefaultReason(st.Code())
+	}
+	return result
+}
+
+// Reason возвращает причину ошибки (пустую строку для nil)
+func Reason(err error) string {
+	if e := FromError(err); e != nil {
+		return e.Reason
+	}
+	return ""
+}
+
+// DefaultReason возвращает причину по коду gRPC: NotFound -> NOT_FOUND
+func DefaultReason(code codes.Code) string {
+	name := code.String()
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
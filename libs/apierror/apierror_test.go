@@ -0,0 +1,124 @@
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestError_RoundTripThroughStatus(t *testing.T) {
+	original := New(codes.InvalidArgument, ReasonMissingParameter, "level is required").
+		WithMetadata("device_id", "lamp-1").
+		WithViolation("command.parameters.level", "required for set_level")
+
+	// Так ошибку видит клиент на другой стороне gRPC-вызова
+	received := status.ErrorProto(status.Convert(original).Proto())
+
+	got := FromError(received)
+	if got.Code != codes.InvalidArgument || got.Reason != ReasonMissingParameter || got.Message != "level is required" {
+		t.Fatalf("Unexpected error: %+v", got)
+	}
+	if got.Metadata["device_id"] != "lamp-1" {
+		t.Errorf("Metadata lost: %v", got.Metadata)
+	}
+	if len(got.Violations) != 1 || got.Violations[0].Field != "command.parameters.level" {
+		t.Errorf("Violations lost: %v", got.Violations)
+	}
+}
+
+func TestFromError_DefaultReasons(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   codes.Code
+		reason string
+	}{
+		{status.Error(codes.NotFound, "not found"), codes.NotFound, "NOT_FOUND"},
+		{status.Error(codes.FailedPrecondition, "offline"), codes.FailedPrecondition, "FAILED_PRECONDITION"},
+		{context.DeadlineExceeded, codes.DeadlineExceeded, "DEADLINE_EXCEEDED"},
+		{errors.New("boom"), codes.Unknown, "UNKNOWN"},
+	}
+
+	for _, tt := range tests {
+		got := FromError(tt.err)
+		if got.Code != tt.code || got.Reason != tt.reason {
+			t.Errorf("%v: expected %s/%s, got %s/%s", tt.err, tt.code, tt.reason, got.Code, got.Reason)
+		}
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/test/Method"}
+
+	call := func(err error) error {
+		_, got := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, err
+		})
+		return got
+	}
+
+	// Внутренние подробности не попадают к клиенту
+	got := FromError(call(errors.New("sql: connection refused")))
+	if got.Code != codes.Internal || got.Reason != ReasonInternal || got.Message != "internal error" {
+		t.Errorf("Unexpected error for plain error: %+v", got)
+	}
+
+	// Обычный статус получает ErrorInfo с причиной по коду
+	st := status.Convert(call(status.Error(codes.NotFound, "missing")))
+	if len(st.Details()) != 1 || Reason(st.Err()) != "NOT_FOUND" {
+		t.Errorf("Expected ErrorInfo detail, got %v", st.Details())
+	}
+
+	if call(nil) != nil {
+		t.Error("Expected nil error")
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/devices/lamp-1/control", nil)
+	rec := httptest.NewRecorder()
+	WriteProblem(rec, req, New(codes.FailedPrecondition, ReasonDeviceOffline, "device lamp-1 is offline").
+		WithMetadata("device_id", "lamp-1"))
+
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Content-Type") != ContentType {
+		t.Fatalf("Unexpected response: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var problem Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Invalid problem document: %v", err)
+	}
+	want := Problem{
+		Type:     TypePrefix + ReasonDeviceOffline,
+		Title:    "Bad Request",
+		Status:   http.StatusBadRequest,
+		Detail:   "device lamp-1 is offline",
+		Instance: "/api/v1/devices/lamp-1/control",
+		Code:     "FAILED_PRECONDITION",
+		Reason:   ReasonDeviceOffline,
+		Domain:   Domain,
+	}
+	if problem.Metadata["device_id"] != "lamp-1" {
+		t.Errorf("Metadata lost: %v", problem.Metadata)
+	}
+	problem.Metadata = nil
+	if problem.Type != want.Type || problem.Title != want.Title || problem.Status != want.Status ||
+		problem.Detail != want.Detail || problem.Instance != want.Instance || problem.Code != want.Code ||
+		problem.Reason != want.Reason || problem.Domain != want.Domain {
+		t.Errorf("Expected %+v, got %+v", want, problem)
+	}
+
+	// Явный статус HTTP имеет приоритет над кодом gRPC
+	rec = httptest.NewRecorder()
+	WriteProblemStatus(rec, req, http.StatusPreconditionFailed, New(codes.FailedPrecondition, ReasonPreconditionFailed, "resource has changed"))
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412, got %d", rec.Code)
+	}
+}
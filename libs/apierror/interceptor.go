@@ -0,0 +1,47 @@
+package apierror
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// normalize приводит ошибку обработчика к статусу с ErrorInfo. Ошибки без
+// кода gRPC не раскрываются клиенту: они логируются и заменяются на INTERNAL.
+func normalize(method string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return FromError(err)
+	}
+	if _, ok := status.FromError(err); !ok {
+		log.Printf("%s: unexpected error: %v", method, err)
+		return New(codes.Internal, ReasonInternal, "internal error")
+	}
+	return FromError(err)
+}
+
+// UnaryServerInterceptor добавляет ErrorInfo к ошибкам унарных методов,
+// которые вернули обычный status.Error
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		return resp, normalize(info.FullMethod, err)
+	}
+}
+
+// StreamServerInterceptor делает то же для потоковых методов
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return normalize(info.FullMethod, handler(srv, ss))
+	}
+}
@@ -0,0 +1,118 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+// ContentType - тип содержимого problem-документа (RFC 7807)
+const ContentType = "application/problem+json"
+
+// TypePrefix - префикс URI типа проблемы, за ним следует причина
+const TypePrefix = "urn:smarthome:problem:"
+
+// Problem - JSON-документ ошибки по RFC 7807 с расширениями code, reason,
+// domain, metadata и invalid_params
+type Problem struct {
+	Type          string            `json:"type"`
+	Title         string            `json:"title"`
+	Status        int               `json:"status"`
+	Detail        string            `json:"detail,omitempty"`
+	Instance      string            `json:"instance,omitempty"`
+	Code          string            `json:"code"`
+	Reason        string            `json:"reason"`
+	Domain        string            `json:"domain"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	InvalidParams []FieldViolation  `json:"invalid_params,omitempty"`
+}
+
+// NewProblem формирует problem-документ для ошибки. Если httpStatus равен 0,
+// статус выводится из кода gRPC. instance - путь запроса.
+func NewProblem(err error, httpStatus int, instance string) Problem {
+	e := FromError(err)
+	if e == nil {
+		e = New(codes.Internal, ReasonInternal, "internal error")
+	}
+
+	if httpStatus == 0 {
+		httpStatus = HTTPStatus(e.Code)
+	}
+	title := http.StatusText(httpStatus)
+	if title == "" {
+		title = e.Code.String()
+	}
+	return Problem{
+		Type:          TypePrefix + e.Reason,
+		Title:         title,
+		Status:        httpStatus,
+		Detail:        e.Message,
+		Instance:      instance,
+		Code:          DefaultReason(e.Code),
+		Reason:        e.Reason,
+		Domain:        Domain,
+		Metadata:      e.Metadata,
+		InvalidParams: e.Violations,
+	}
+}
+
+// WriteProblem отвечает problem-документом. Статус HTTP выводится из кода gRPC.
+func WriteProblem(w http.ResponseWriter, r *http.Request, err error) {
+	WriteProblemStatus(w, r, 0, err)
+}
+
+// WriteProblemStatus отвечает problem-документом с заданным статусом HTTP.
+// Нужен для статусов без прямого аналога в gRPC: 412, 413, 424.
+func WriteProblemStatus(w http.ResponseWriter, r *http.Request, httpStatus int, err error) {
+	instance := ""
+	if r != nil {
+		instance = r.URL.Path
+	}
+	problem := NewProblem(err, httpStatus, instance)
+
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// IsProblem проверяет, что тип содержимого - problem+json
+func IsProblem(contentType string) bool {
+	return strings.HasPrefix(contentType, ContentType)
+}
+
+// HTTPStatus возвращает статус HTTP для кода gRPC (как в grpc-gateway)
+func HTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		// Как и grpc-gateway, отдаем 400: 412 зарезервирован за условными запросами
+		return http.StatusBadRequest
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,139 @@
+// Package sysstatus реализует SystemService для внутренних сервисов: версию
+// сборки, время работы экземпляра и проверки зависимостей (PostgreSQL, Redis,
+// хранилище). Версия задается при сборке:
+//
+//	go build -ldflags "-X github.com/velvetriddles/mini-smart-home/libs/sysstatus.Version=1.2.0"
+package sysstatus
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// CheckTimeout ограничивает время одной проверки зависимости
+const CheckTimeout = 2 * time.Second
+
+var (
+	// Version - версия сборки, задается через -ldflags
+	Version = "dev"
+
+	// Commit - ревизия исходного кода; если не задана через -ldflags,
+	// берется из информации о сборке Go (vcs.revision)
+	Commit = ""
+
+	startedAt = time.Now()
+)
+
+// StartedAt возвращает время запуска процесса
+func StartedAt() time.Time {
+	return startedAt
+}
+
+// Uptime возвращает время работы процесса
+func Uptime() time.Duration {
+	return time.Since(startedAt)
+}
+
+// Revision возвращает ревизию исходного кода сборки
+func Revision() string {
+	if Commit != "" {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return ""
+}
+
+// CheckFunc проверяет зависимость и возвращает дополнительные сведения о ней
+type CheckFunc func(ctx context.Context) (details map[string]string, err error)
+
+// Dependency - зависимость сервиса и ее проверка
+type Dependency struct {
+	Name  string
+	Check CheckFunc
+}
+
+// GRPCHealth проверяет сервис-зависимость через стандартный gRPC health-сервис
+func GRPCHealth(conn grpc.ClientConnInterface) CheckFunc {
+	client := healthpb.NewHealthClient(conn)
+	return func(ctx context.Context) (map[string]string, error) {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			return nil, err
+		}
+		details := map[string]string{"status": resp.Status.String()}
+		if resp.Status != healthpb.HealthCheckResponse_SERVING {
+			return details, fmt.Errorf("service is %s", resp.Status)
+		}
+		return details, nil
+	}
+}
+
+// Server реализует smarthomev1.SystemServiceServer
+type Server struct {
+	service      string
+	dependencies []Dependency
+}
+
+// NewServer создает SystemService для сервиса с указанными зависимостями
+func NewServer(service string, dependencies ...Dependency) *Server {
+	return &Server{service: service, dependencies: dependencies}
+}
+
+// GetSystemStatus параллельно проверяет зависимости и возвращает отчет.
+// Недоступная зависимость не является ошибкой вызова: она отмечается в отчете.
+func (s *Server) GetSystemStatus(ctx context.Context, _ *smarthomev1.Empty) (*smarthomev1.SystemStatus, error) {
+	dependencies := make([]*smarthomev1.DependencyStatus, len(s.dependencies))
+
+	var wg sync.WaitGroup
+	for i, dep := range s.dependencies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dependencies[i] = check(ctx, dep)
+		}()
+	}
+	wg.Wait()
+
+	return &smarthomev1.SystemStatus{
+		Service:       s.service,
+		Version:       Version,
+		Commit:        Revision(),
+		StartedAt:     timestamppb.New(startedAt),
+		UptimeSeconds: int64(Uptime().Seconds()),
+		Dependencies:  dependencies,
+	}, nil
+}
+
+// check выполняет проверку одной зависимости с таймаутом
+func check(ctx context.Context, dep Dependency) *smarthomev1.DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := dep.Check(ctx)
+
+	status := &smarthomev1.DependencyStatus{
+		Name:      dep.Name,
+		Healthy:   err == nil,
+		LatencyMs: time.Since(start).Milliseconds(),
+		Details:   details,
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
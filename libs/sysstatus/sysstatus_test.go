@@ -0,0 +1,48 @@
+package sysstatus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestServer_GetSystemStatus(t *testing.T) {
+	server := NewServer("device",
+		Dependency{Name: "store", Check: func(ctx context.Context) (map[string]string, error) {
+			return map[string]string{"devices": "3"}, nil
+		}},
+		Dependency{Name: "postgres", Check: func(ctx context.Context) (map[string]string, error) {
+			return nil, errors.New("connection refused")
+		}},
+		Dependency{Name: "slow", Check: func(ctx context.Context) (map[string]string, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}},
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	status, err := server.GetSystemStatus(ctx, nil)
+	if err != nil {
+		t.Fatalf("GetSystemStatus failed: %v", err)
+	}
+	if status.Service != "device" || status.Version != Version || status.StartedAt.AsTime() != StartedAt().UTC() {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+	if len(status.Dependencies) != 3 {
+		t.Fatalf("Expected 3 dependencies, got %d", len(status.Dependencies))
+	}
+
+	store, postgres, slow := status.Dependencies[0], status.Dependencies[1], status.Dependencies[2]
+	if store.Name != "store" || !store.Healthy || store.Details["devices"] != "3" {
+		t.Errorf("Unexpected store status: %+v", store)
+	}
+	if postgres.Healthy || postgres.Error != "connection refused" {
+		t.Errorf("Unexpected postgres status: %+v", postgres)
+	}
+	if slow.Healthy || slow.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("Unexpected slow status: %+v", slow)
+	}
+}
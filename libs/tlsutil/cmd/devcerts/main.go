@@ -0,0 +1,101 @@
+// Команда devcerts создает локальный CA и сертификаты сервисов, чтобы весь
+// стек можно было запустить с TLS и mTLS на одной машине:
+//
+//	go run ./libs/tlsutil/cmd/devcerts --out certs
+//
+// Существующий CA используется повторно (--force создает новый), поэтому
+// повторный запуск перевыпускает сертификаты сервисов с тем же доверием.
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/libs/tlsutil"
+)
+
+var (
+	outDir   = flag.String("out", "certs", "Output directory")
+	services = flag.String("services", "gateway,auth,device,voice", "Comma-separated services to issue certificates for")
+	hosts    = flag.String("hosts", "", "Comma-separated extra DNS names and IPs added to every certificate")
+	validFor = flag.Duration("valid-for", 365*24*time.Hour, "Certificate lifetime")
+	force    = flag.Bool("force", false, "Create a new CA even if one already exists")
+)
+
+func main() {
+	flag.Parse()
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		log.Fatalf("Failed to create %s: %v", *outDir, err)
+	}
+
+	ca, err := loadOrCreateCA()
+	if err != nil {
+		log.Fatalf("Failed to prepare CA: %v", err)
+	}
+
+	for _, service := range splitList(*services) {
+		// Имя сервиса совпадает с именем, которое шлюз использует при проверке сертификата
+		names := append([]string{service, "smarthome-" + service, "localhost", "127.0.0.1", "::1"}, splitList(*hosts)...)
+		pair, err := tlsutil.IssueCert(ca, service, names, *validFor)
+		if err != nil {
+			log.Fatalf("Failed to issue certificate for %s: %v", service, err)
+		}
+		if err := write(service, pair); err != nil {
+			log.Fatalf("Failed to write certificate for %s: %v", service, err)
+		}
+		log.Printf("Issued %s for %s", filepath.Join(*outDir, service+".pem"), strings.Join(names, ", "))
+	}
+}
+
+// loadOrCreateCA читает ca.pem и ca-key.pem или создает новый CA
+func loadOrCreateCA() (tlsutil.KeyPair, error) {
+	if !*force {
+		cert, certErr := os.ReadFile(filepath.Join(*outDir, "ca.pem"))
+		key, keyErr := os.ReadFile(filepath.Join(*outDir, "ca-key.pem"))
+		if certErr == nil && keyErr == nil {
+			log.Printf("Using existing CA %s", filepath.Join(*outDir, "ca.pem"))
+			return tlsutil.KeyPair{Cert: cert, Key: key}, nil
+		}
+		for _, err := range []error{certErr, keyErr} {
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return tlsutil.KeyPair{}, err
+			}
+		}
+	}
+
+	ca, err := tlsutil.GenerateCA("Smart Home Dev CA", *validFor)
+	if err != nil {
+		return tlsutil.KeyPair{}, err
+	}
+	if err := write("ca", ca); err != nil {
+		return tlsutil.KeyPair{}, err
+	}
+	log.Printf("Created CA %s", filepath.Join(*outDir, "ca.pem"))
+	return ca, nil
+}
+
+// write сохраняет <name>.pem и <name>-key.pem; ключ доступен только владельцу
+func write(name string, pair tlsutil.KeyPair) error {
+	if err := os.WriteFile(filepath.Join(*outDir, name+"-key.pem"), pair.Key, 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(*outDir, name+".pem"), pair.Cert, 0o644)
+}
+
+// splitList разбирает список значений, разделенных запятыми
+func splitList(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,102 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// KeyPair - сертификат и закрытый ключ в формате PEM
+type KeyPair struct {
+	Cert []byte
+	Key  []byte
+}
+
+// GenerateCA создает самоподписанный CA для локальной разработки
+func GenerateCA(commonName string, validFor time.Duration) (KeyPair, error) {
+	template, err := newTemplate(commonName, validFor)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	return encode(template, template, &key.PublicKey, key, key)
+}
+
+// IssueCert выпускает сертификат, подписанный CA, пригодный и для сервера,
+// и для клиента mTLS. hosts - DNS-имена и IP-адреса сервиса.
+func IssueCert(ca KeyPair, commonName string, hosts []string, validFor time.Duration) (KeyPair, error) {
+	caPair, err := tls.X509KeyPair(ca.Cert, ca.Key)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("invalid CA: %w", err)
+	}
+	caCert, err := x509.ParseCertificate(caPair.Certificate[0])
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("invalid CA: %w", err)
+	}
+
+	template, err := newTemplate(commonName, validFor)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	return encode(template, caCert, &key.PublicKey, caPair.PrivateKey, key)
+}
+
+// newTemplate создает шаблон сертификата со случайным серийным номером
+func newTemplate(commonName string, validFor time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Smart Home Dev"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validFor),
+	}, nil
+}
+
+// encode подписывает сертификат и кодирует его и ключ в PEM
+func encode(template, parent *x509.Certificate, pub, signer interface{}, key *ecdsa.PrivateKey) (KeyPair, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	return KeyPair{
+		Cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Key:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
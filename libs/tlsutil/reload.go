@@ -0,0 +1,102 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// reloadInterval - как часто проверяются изменения файлов сертификата
+var reloadInterval = 10 * time.Second
+
+// Reloader хранит сертификат и ключ и перечитывает их, когда меняется время
+// изменения файлов. Проверка выполняется при рукопожатии, не чаще
+// reloadInterval. Если новые файлы не читаются (например, записаны не до
+// конца), используется прежний сертификат, а проверка повторяется позже.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+	checked  time.Time
+}
+
+// NewReloader загружает сертификат и ключ. Ошибка чтения при создании
+// возвращается: сервис не должен стартовать с неверными файлами.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	modTimes, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTimes); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Certificate возвращает текущий сертификат, при необходимости перечитывая файлы
+func (r *Reloader) Certificate() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) < reloadInterval {
+		return r.cert, nil
+	}
+	r.checked = time.Now()
+
+	modTimes, err := r.stat()
+	if err != nil {
+		log.Printf("TLS: keeping current certificate: %v", err)
+		return r.cert, nil
+	}
+	if modTimes == r.modTimes {
+		return r.cert, nil
+	}
+	if err := r.load(modTimes); err != nil {
+		log.Printf("TLS: keeping current certificate: %v", err)
+		return r.cert, nil
+	}
+	log.Printf("TLS: reloaded certificate %s", r.certFile)
+	return r.cert, nil
+}
+
+// GetCertificate реализует tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate()
+}
+
+// GetClientCertificate реализует tls.Config.GetClientCertificate
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate()
+}
+
+// stat возвращает время изменения файлов сертификата и ключа
+func (r *Reloader) stat() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// load читает пару сертификат/ключ и запоминает время изменения файлов
+func (r *Reloader) load(modTimes [2]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate %s: %w", r.certFile, err)
+	}
+	r.cert = &cert
+	r.modTimes = modTimes
+	r.checked = time.Now()
+	return nil
+}
@@ -0,0 +1,195 @@
+// Package tlsutil настраивает TLS для внешнего HTTPS шлюза и mTLS для gRPC
+// между шлюзом и внутренними сервисами. Сертификаты всех сервисов подписаны
+// общим CA; сервер требует клиентский сертификат, клиент проверяет серверный.
+//
+// Сертификат и ключ перечитываются с диска при изменении файлов, поэтому
+// ротация сертификатов не требует перезапуска. Смена CA требует перезапуска.
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Config содержит файлы сертификатов сервиса для mTLS. Пустой Config
+// означает соединения без шифрования.
+type Config struct {
+	CAFile   string // Общий CA, которым подписаны сертификаты всех сервисов (PEM)
+	CertFile string // Сертификат сервиса (PEM)
+	KeyFile  string // Закрытый ключ сервиса (PEM)
+}
+
+// FromEnv читает Config из переменных окружения <prefix>TLS_CA_FILE,
+// <prefix>TLS_CERT_FILE и <prefix>TLS_KEY_FILE
+func FromEnv(prefix string) Config {
+	return Config{
+		CAFile:   os.Getenv(prefix + "TLS_CA_FILE"),
+		CertFile: os.Getenv(prefix + "TLS_CERT_FILE"),
+		KeyFile:  os.Getenv(prefix + "TLS_KEY_FILE"),
+	}
+}
+
+// RegisterFlags регистрирует флаги --<prefix>tls-ca, --<prefix>tls-cert и
+// --<prefix>tls-key. Значения по умолчанию берутся из переменных окружения
+// (см. FromEnv, префикс флага переводится в верхний регистр: grpc- -> GRPC_).
+func RegisterFlags(fs *flag.FlagSet, prefix string) *Config {
+	config := FromEnv(strings.ToUpper(strings.ReplaceAll(prefix, "-", "_")))
+	fs.StringVar(&config.CAFile, prefix+"tls-ca", config.CAFile, "CA certificate (PEM) shared by all services; enables mTLS for gRPC")
+	fs.StringVar(&config.CertFile, prefix+"tls-cert", config.CertFile, "Service certificate (PEM) for mTLS, reloaded on change")
+	fs.StringVar(&config.KeyFile, prefix+"tls-key", config.KeyFile, "Service private key (PEM) for mTLS, reloaded on change")
+	return &config
+}
+
+// Enabled возвращает true, если задан хотя бы один файл
+func (c Config) Enabled() bool {
+	return c.CAFile != "" || c.CertFile != "" || c.KeyFile != ""
+}
+
+// Validate проверяет, что для mTLS заданы все три файла
+func (c Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	var missing []string
+	if c.CAFile == "" {
+		missing = append(missing, "CA")
+	}
+	if c.CertFile == "" {
+		missing = append(missing, "certificate")
+	}
+	if c.KeyFile == "" {
+		missing = append(missing, "key")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("mTLS requires CA, certificate and key files, missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// ServerTLSConfig возвращает настройки HTTPS-сервера с перечитываемым
+// сертификатом (без проверки клиентских сертификатов)
+func ServerTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("TLS requires both certificate and key files")
+	}
+	reloader, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}, nil
+}
+
+// MutualServerTLSConfig возвращает настройки сервера, требующего клиентский
+// сертификат, подписанный общим CA
+func (c Config) MutualServerTLSConfig() (*tls.Config, error) {
+	pool, reloader, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      pool,
+	}, nil
+}
+
+// MutualClientTLSConfig возвращает настройки клиента, который проверяет
+// сертификат сервера по общему CA и предъявляет свой. Имя сервера для
+// проверки gRPC берет из адреса соединения.
+func (c Config) MutualClientTLSConfig() (*tls.Config, error) {
+	pool, reloader, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		RootCAs:              pool,
+		GetClientCertificate: reloader.GetClientCertificate,
+	}, nil
+}
+
+// ServerCredentials возвращает учетные данные gRPC-сервера: mTLS, если
+// Config задан, иначе соединения без шифрования
+func (c Config) ServerCredentials() (credentials.TransportCredentials, error) {
+	if !c.Enabled() {
+		return insecure.NewCredentials(), nil
+	}
+	config, err := c.MutualServerTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// ClientCredentials возвращает учетные данные gRPC-клиента: mTLS, если
+// Config задан, иначе соединения без шифрования
+func (c Config) ClientCredentials() (credentials.TransportCredentials, error) {
+	if !c.Enabled() {
+		return insecure.NewCredentials(), nil
+	}
+	config, err := c.MutualClientTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// ServerOption возвращает опцию grpc.NewServer с учетными данными ServerCredentials
+func (c Config) ServerOption() (grpc.ServerOption, error) {
+	creds, err := c.ServerCredentials()
+	if err != nil {
+		return nil, err
+	}
+	return grpc.Creds(creds), nil
+}
+
+// DialOption возвращает опцию grpc.NewClient с учетными данными ClientCredentials
+func (c Config) DialOption() (grpc.DialOption, error) {
+	creds, err := c.ClientCredentials()
+	if err != nil {
+		return nil, err
+	}
+	return grpc.WithTransportCredentials(creds), nil
+}
+
+// load читает CA и создает Reloader для сертификата сервиса
+func (c Config) load() (*x509.CertPool, *Reloader, error) {
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+	pool, err := LoadCertPool(c.CAFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	reloader, err := NewReloader(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pool, reloader, nil
+}
+
+// LoadCertPool читает сертификаты CA из PEM-файла
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+	}
+	return pool, nil
+}
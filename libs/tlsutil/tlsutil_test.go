@@ -0,0 +1,198 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// writePair сохраняет пару в dir и возвращает пути к сертификату и ключу
+func writePair(t *testing.T, dir, name string, pair KeyPair) (string, string) {
+	t.Helper()
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+"-key.pem")
+	if err := os.WriteFile(certFile, pair.Cert, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pair.Key, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// newConfig выпускает сертификат сервиса, подписанный ca
+func newConfig(t *testing.T, dir string, ca KeyPair, caFile, name string) Config {
+	t.Helper()
+	pair, err := IssueCert(ca, name, []string{name, "localhost", "127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatalf("IssueCert failed: %v", err)
+	}
+	certFile, keyFile := writePair(t, dir, name, pair)
+	return Config{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}
+}
+
+// startServer запускает gRPC health-сервер с mTLS и возвращает его адрес
+func startServer(t *testing.T, config Config) string {
+	t.Helper()
+	opt, err := config.ServerOption()
+	if err != nil {
+		t.Fatalf("ServerOption failed: %v", err)
+	}
+	server := grpc.NewServer(opt)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+// check выполняет health-запрос через клиента с опцией opt
+func check(t *testing.T, target string, opt grpc.DialOption) error {
+	t.Helper()
+	conn, err := grpc.NewClient(target, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	return err
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA("test CA", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateCA failed: %v", err)
+	}
+	caFile, _ := writePair(t, dir, "ca", ca)
+
+	addr := startServer(t, newConfig(t, dir, ca, caFile, "device"))
+	target := "localhost:" + addr[len("127.0.0.1:"):]
+
+	client := newConfig(t, dir, ca, caFile, "gateway")
+	opt, err := client.DialOption()
+	if err != nil {
+		t.Fatalf("DialOption failed: %v", err)
+	}
+	if err := check(t, target, opt); err != nil {
+		t.Fatalf("Expected mTLS call to succeed: %v", err)
+	}
+
+	// Без клиентского сертификата и без TLS сервер соединение не принимает
+	if err := check(t, target, grpc.WithTransportCredentials(insecure.NewCredentials())); err == nil {
+		t.Error("Expected plaintext call to fail")
+	}
+
+	// Сертификат, подписанный другим CA, не принимается
+	otherCA, err := GenerateCA("other CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherDir := t.TempDir()
+	otherCAFile, _ := writePair(t, otherDir, "ca", otherCA)
+	stranger := newConfig(t, otherDir, otherCA, otherCAFile, "gateway")
+	stranger.CAFile = caFile
+	opt, err = stranger.DialOption()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check(t, target, opt); err == nil {
+		t.Error("Expected call with certificate from another CA to fail")
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	if err := (Config{}).Validate(); err != nil {
+		t.Errorf("Empty config must be valid: %v", err)
+	}
+	if err := (Config{CertFile: "a.pem", KeyFile: "a-key.pem"}).Validate(); err == nil {
+		t.Error("Expected error without CA")
+	}
+	creds, err := (Config{}).ServerCredentials()
+	if err != nil || creds.Info().SecurityProtocol != "insecure" {
+		t.Errorf("Expected insecure credentials for empty config, got %v %v", creds, err)
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA("test CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := IssueCert(ca, "first", []string{"localhost"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := writePair(t, dir, "service", first)
+
+	reloader, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+	if name := commonName(t, reloader); name != "first" {
+		t.Fatalf("Expected first certificate, got %s", name)
+	}
+
+	second, err := IssueCert(ca, "second", []string{"localhost"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePair(t, dir, "service", second)
+	later := time.Now().Add(time.Minute)
+	for _, name := range []string{certFile, keyFile} {
+		if err := os.Chtimes(name, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// До истечения интервала проверки файлы не перечитываются
+	if name := commonName(t, reloader); name != "first" {
+		t.Fatalf("Expected cached certificate, got %s", name)
+	}
+
+	reloader.checked = time.Time{}
+	if name := commonName(t, reloader); name != "second" {
+		t.Fatalf("Expected reloaded certificate, got %s", name)
+	}
+
+	// Поврежденный файл не заменяет рабочий сертификат
+	if err := os.WriteFile(certFile, []byte("broken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	evenLater := later.Add(time.Minute)
+	os.Chtimes(certFile, evenLater, evenLater)
+	reloader.checked = time.Time{}
+	if name := commonName(t, reloader); name != "second" {
+		t.Fatalf("Expected previous certificate after failed reload, got %s", name)
+	}
+}
+
+func commonName(t *testing.T, reloader *Reloader) string {
+	t.Helper()
+	cert, err := reloader.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Subject.CommonName
+}
@@ -1,22 +1,86 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/velvetriddles/mini-smart-home/libs/tlsutil"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/cors"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/ratelimit"
 	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/server"
 )
 
 var (
 	httpPort = flag.Int("port", 8080, "HTTP server port")
 
-	// Адреса внутренних микросервисов
-	authServiceAddr   = flag.String("auth-service", "localhost:50051", "Auth service address")
-	deviceServiceAddr = flag.String("device-service", "localhost:50052", "Device service address")
-	voiceServiceAddr  = flag.String("voice-service", "localhost:50053", "Voice service address")
+	// HTTPS для внешних клиентов: сертификат перечитывается при изменении файлов
+	tlsCert = flag.String("tls-cert", "", "TLS certificate (PEM) for HTTPS; empty serves plain HTTP")
+	tlsKey  = flag.String("tls-key", "", "TLS private key (PEM) for HTTPS")
+
+	// mTLS с внутренними сервисами: --grpc-tls-ca, --grpc-tls-cert, --grpc-tls-key
+	// (или GRPC_TLS_CA_FILE, GRPC_TLS_CERT_FILE, GRPC_TLS_KEY_FILE)
+	backendTLS = tlsutil.RegisterFlags(flag.CommandLine, "grpc-")
+
+	// Таймауты HTTP-сервера и плавная остановка
+	readTimeout     = flag.Duration("read-timeout", 30*time.Second, "Maximum duration for reading an entire request")
+	writeTimeout    = flag.Duration("write-timeout", 65*time.Second, "Maximum duration before timing out writes of a response (keep above the 60s handler timeout)")
+	idleTimeout     = flag.Duration("idle-timeout", 120*time.Second, "Maximum time to wait for the next request on a keep-alive connection")
+	shutdownDelay   = flag.Duration("shutdown-delay", 5*time.Second, "How long /health reports not ready before the server stops accepting requests")
+	shutdownTimeout = flag.Duration("shutdown-timeout", 30*time.Second, "Maximum time to drain in-flight requests and connections on shutdown")
+
+	// Адреса внутренних микросервисов (несколько экземпляров через запятую или dns:///host:port)
+	authServiceAddr   = flag.String("auth-service", "localhost:50051", "Auth service address(es)")
+	deviceServiceAddr = flag.String("device-service", "localhost:50052", "Device service address(es)")
+	voiceServiceAddr  = flag.String("voice-service", "localhost:50053", "Voice service address(es)")
+
+	// Автоматический выключатель для внутренних сервисов
+	breakerThreshold = flag.Int("breaker-threshold", 5, "Consecutive backend failures before the circuit opens")
+	breakerCooldown  = flag.Duration("breaker-cooldown", 10*time.Second, "How long the circuit stays open before a probe request")
+
+	// Количество последних событий статусов, доступных для возобновления SSE по Last-Event-ID
+	sseReplayBuffer = flag.Int("sse-replay-buffer", 256, "Number of status events kept for SSE Last-Event-ID resume")
+
+	// Ограничение частоты запросов в формате <limit>/<period>[:<burst>], "off" - без ограничения
+	rateLimitAuth    = flag.String("rate-limit-auth", "20/m", "Rate limit for /api/v1/auth per client IP")
+	rateLimitAPI     = flag.String("rate-limit-api", "300/m:60", "Rate limit for protected /api/v1 routes per user")
+	rateLimitControl = flag.String("rate-limit-control", "60/m:10", "Rate limit for device control requests per user")
+	rateLimitRedis   = flag.String("rate-limit-redis", "", "Redis URL for rate limits shared between gateway replicas")
+
+	// Ключи идемпотентности для POST /api/v1/devices/{id}/control
+	idempotencyTTL   = flag.Duration("idempotency-ttl", 24*time.Hour, "How long responses to requests with Idempotency-Key are kept (0 disables)")
+	idempotencyRedis = flag.String("idempotency-redis", "", "Redis URL for idempotency keys shared between gateway replicas")
+
+	// Пакетные запросы POST /api/v1/batch
+	batchWorkers  = flag.Int("batch-workers", 8, "Concurrent sub-requests per batch request")
+	batchMaxItems = flag.Int("batch-max-items", 50, "Maximum number of sub-requests in a batch request")
+
+	// Вебхуки на изменения статусов устройств
+	webhookStore        = flag.String("webhook-store", "", "File to persist webhook subscriptions (empty keeps them in memory)")
+	webhookWorkers      = flag.Int("webhook-workers", 4, "Number of concurrent webhook deliveries")
+	webhookMaxAttempts  = flag.Int("webhook-max-attempts", 5, "Delivery attempts per webhook event")
+	webhookDisableAfter = flag.Int("webhook-disable-after", 10, "Consecutive failed deliveries before a webhook is disabled (0 never disables)")
+	webhookAllowPrivate = flag.Bool("webhook-allow-private", false, "Allow webhook URLs in private networks (10/8, 172.16/12, 192.168/16), e.g. Node-RED on the LAN")
+
+	// Период обновления метрики smarthome_gateway_backend_up
+	statusInterval = flag.Duration("status-interval", 30*time.Second, "How often backend status metrics are refreshed (0 refreshes only on /api/v1/admin/status)")
+
+	// Источники, которым разрешены запросы из браузера (CORS) и подключения WebSocket
+	corsOrigins     = flag.String("cors-origins", "", "Comma-separated origins allowed for CORS and WebSocket, e.g. https://home.example.com,https://*.example.com (empty allows same origin only)")
+	corsMethods     = flag.String("cors-methods", strings.Join(cors.DefaultMethods, ","), "Comma-separated methods allowed in CORS preflight")
+	corsHeaders     = flag.String("cors-headers", strings.Join(cors.DefaultHeaders, ","), "Comma-separated request headers allowed in CORS preflight (* allows any)")
+	corsExposed     = flag.String("cors-expose-headers", strings.Join(cors.DefaultExposed, ","), "Comma-separated response headers exposed to scripts")
+	corsCredentials = flag.Bool("cors-credentials", false, "Allow credentialed cross-origin requests (cookies); requires explicit origins")
+	corsMaxAge      = flag.Duration("cors-max-age", 10*time.Minute, "How long browsers may cache CORS preflight responses")
+
+	// Веб-интерфейс (сборка web/)
+	webDir        = flag.String("web", "", `Serve the web UI from a built web/dist directory, or "embed" for the bundle built into the binary (empty disables)`)
+	webAPIBaseURL = flag.String("web-api-base-url", "", "API base URL passed to the web UI in /config.js (empty means the gateway origin)")
 )
 
 func main() {
@@ -24,13 +88,66 @@ func main() {
 
 	log.Println("Starting API Gateway service")
 
+	rateLimits := server.RateLimitConfig{RedisURL: *rateLimitRedis}
+	for _, rl := range []struct {
+		flag  string
+		value string
+		rule  *ratelimit.Rule
+	}{
+		{"rate-limit-auth", *rateLimitAuth, &rateLimits.Auth},
+		{"rate-limit-api", *rateLimitAPI, &rateLimits.API},
+		{"rate-limit-control", *rateLimitControl, &rateLimits.Control},
+	} {
+		rule, err := ratelimit.ParseRule(rl.value)
+		if err != nil {
+			log.Fatalf("Invalid --%s: %v", rl.flag, err)
+		}
+		*rl.rule = rule
+	}
+
+	webhooks := server.WebhookConfig{
+		StorePath:    *webhookStore,
+		Workers:      *webhookWorkers,
+		MaxAttempts:  *webhookMaxAttempts,
+		DisableAfter: *webhookDisableAfter,
+		AllowPrivate: *webhookAllowPrivate,
+	}
+
 	// Инициализация HTTP сервера
-	httpServer := server.NewHTTPServer(server.HTTPConfig{
+	httpServer, err := server.NewHTTPServer(server.HTTPConfig{
 		Port:              *httpPort,
 		AuthServiceAddr:   *authServiceAddr,
 		DeviceServiceAddr: *deviceServiceAddr,
 		VoiceServiceAddr:  *voiceServiceAddr,
+		SSEReplayBuffer:   *sseReplayBuffer,
+		RateLimits:        rateLimits,
+		Idempotency:       server.IdempotencyConfig{TTL: *idempotencyTTL, RedisURL: *idempotencyRedis},
+		Webhooks:          webhooks,
+		Web:               server.WebConfig{Dir: *webDir, APIBaseURL: *webAPIBaseURL},
+		StatusInterval:    *statusInterval,
+		CORS: cors.Config{
+			AllowedOrigins:   splitList(*corsOrigins),
+			AllowedMethods:   splitList(*corsMethods),
+			AllowedHeaders:   splitList(*corsHeaders),
+			ExposedHeaders:   splitList(*corsExposed),
+			AllowCredentials: *corsCredentials,
+			MaxAge:           *corsMaxAge,
+		},
+		TLS:               server.TLSConfig{CertFile: *tlsCert, KeyFile: *tlsKey},
+		BackendTLS:        *backendTLS,
+		BatchWorkers:      *batchWorkers,
+		BatchMaxItems:     *batchMaxItems,
+		BreakerThreshold:  *breakerThreshold,
+		BreakerCooldown:   *breakerCooldown,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+		ShutdownDelay:     *shutdownDelay,
 	})
+	if err != nil {
+		log.Fatalf("Failed to initialize HTTP server: %v", err)
+	}
 
 	// Запуск HTTP сервера в горутине
 	go func() {
@@ -50,8 +167,31 @@ func main() {
 
 	log.Printf("Received signal %v, shutting down...", sig)
 
+	// Повторный сигнал прерывает плавную остановку
+	go func() {
+		sig := <-sigChan
+		log.Fatalf("Received signal %v again, exiting immediately", sig)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownDelay+*shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Printf("Graceful shutdown failed: %v", err)
+	}
+
 	// Закрытие соединений
 	httpServer.Close()
 
 	log.Println("API Gateway service stopped")
 }
+
+// splitList разбирает список значений, разделенных запятыми
+func splitList(s string) []string {
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,270 @@
+// Package admin реализует служебные эндпоинты шлюза для администраторов
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/velvetriddles/mini-smart-home/libs/sysstatus"
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// defaultTimeout ограничивает опрос одного сервиса
+const defaultTimeout = 3 * time.Second
+
+// Общее состояние системы в отчете
+const (
+	StatusOK       = "ok"       // Все сервисы и их зависимости доступны
+	StatusDegraded = "degraded" // Хотя бы один сервис или зависимость недоступны
+)
+
+// Target - внутренний сервис, состояние которого входит в отчет
+type Target struct {
+	Name    string
+	Conn    grpc.ClientConnInterface
+	Breaker func() string // Состояние выключателя шлюза для сервиса (nil - не показывать)
+}
+
+// Config содержит настройки отчета о состоянии системы
+type Config struct {
+	Targets    []Target
+	Timeout    time.Duration         // Таймаут опроса одного сервиса (0 - 3s)
+	Registerer prometheus.Registerer // Реестр метрик (nil - prometheus.DefaultRegisterer)
+}
+
+// Report - сводный отчет о состоянии шлюза и внутренних сервисов
+type Report struct {
+	Status    string          `json:"status"`
+	CheckedAt time.Time       `json:"checked_at"`
+	Gateway   GatewayStatus   `json:"gateway"`
+	Services  []ServiceStatus `json:"services"`
+}
+
+// GatewayStatus - сведения о самом шлюзе
+type GatewayStatus struct {
+	Version       string    `json:"version"`
+	Commit        string    `json:"commit,omitempty"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+}
+
+// ServiceStatus - состояние внутреннего сервиса. Health - ответ стандартного
+// gRPC health-сервиса, остальные поля заполняются из SystemService.
+type ServiceStatus struct {
+	Name          string             `json:"name"`
+	Healthy       bool               `json:"healthy"`
+	Health        string             `json:"health"`
+	Breaker       string             `json:"breaker,omitempty"`
+	LatencyMs     int64              `json:"latency_ms"`
+	Error         string             `json:"error,omitempty"`
+	Version       string             `json:"version,omitempty"`
+	Commit        string             `json:"commit,omitempty"`
+	StartedAt     *time.Time         `json:"started_at,omitempty"`
+	UptimeSeconds int64              `json:"uptime_seconds,omitempty"`
+	Dependencies  []DependencyStatus `json:"dependencies,omitempty"`
+}
+
+// DependencyStatus - состояние зависимости сервиса (PostgreSQL, Redis, хранилище)
+type DependencyStatus struct {
+	Name      string            `json:"name"`
+	Healthy   bool              `json:"healthy"`
+	Error     string            `json:"error,omitempty"`
+	LatencyMs int64             `json:"latency_ms"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// Status собирает отчет о состоянии системы и обновляет метрики
+type Status struct {
+	targets []Target
+	timeout time.Duration
+
+	backendUp    *prometheus.GaugeVec
+	dependencyUp *prometheus.GaugeVec
+}
+
+// NewStatus создает сборщик отчета и регистрирует его метрики
+func NewStatus(config Config) (*Status, error) {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	registerer := config.Registerer
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	s := &Status{
+		targets: config.Targets,
+		timeout: timeout,
+		backendUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "smarthome",
+			Subsystem: "gateway",
+			Name:      "backend_up",
+			Help:      "Whether the backend service reports SERVING in its gRPC health check (1) or not (0).",
+		}, []string{"service"}),
+		dependencyUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "smarthome",
+			Subsystem: "gateway",
+			Name:      "backend_dependency_up",
+			Help:      "Whether a dependency of the backend service is healthy (1) or not (0).",
+		}, []string{"service", "dependency"}),
+	}
+
+	for _, collector := range []prometheus.Collector{s.backendUp, s.dependencyUp} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Report параллельно опрашивает все сервисы
+func (s *Status) Report(ctx context.Context) *Report {
+	report := &Report{
+		Status:    StatusOK,
+		CheckedAt: time.Now().UTC(),
+		Gateway: GatewayStatus{
+			Version:       sysstatus.Version,
+			Commit:        sysstatus.Revision(),
+			StartedAt:     sysstatus.StartedAt().UTC(),
+			UptimeSeconds: int64(sysstatus.Uptime().Seconds()),
+		},
+		Services: make([]ServiceStatus, len(s.targets)),
+	}
+
+	var wg sync.WaitGroup
+	for i, target := range s.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Services[i] = s.check(ctx, target)
+		}()
+	}
+	wg.Wait()
+
+	for _, service := range report.Services {
+		if !service.Healthy {
+			report.Status = StatusDegraded
+		}
+		for _, dep := range service.Dependencies {
+			if !dep.Healthy {
+				report.Status = StatusDegraded
+			}
+		}
+	}
+	return report
+}
+
+// check опрашивает health-сервис и SystemService одного сервиса
+func (s *Status) check(ctx context.Context, target Target) ServiceStatus {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	result := ServiceStatus{
+		Name:   target.Name,
+		Health: healthpb.HealthCheckResponse_UNKNOWN.String(),
+	}
+	if target.Breaker != nil {
+		result.Breaker = target.Breaker()
+	}
+
+	var (
+		wg     sync.WaitGroup
+		health *healthpb.HealthCheckResponse
+		info   *smarthomev1.SystemStatus
+		errs   [2]error
+	)
+	start := time.Now()
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		health, errs[0] = healthpb.NewHealthClient(target.Conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	}()
+	go func() {
+		defer wg.Done()
+		info, errs[1] = smarthomev1.NewSystemServiceClient(target.Conn).GetSystemStatus(ctx, &smarthomev1.Empty{})
+	}()
+	wg.Wait()
+	result.LatencyMs = time.Since(start).Milliseconds()
+
+	if errs[0] != nil {
+		result.Error = status.Convert(errs[0]).Message()
+	} else {
+		result.Health = health.Status.String()
+		result.Healthy = health.Status == healthpb.HealthCheckResponse_SERVING
+	}
+	s.backendUp.WithLabelValues(target.Name).Set(gaugeValue(result.Healthy))
+
+	if errs[1] != nil {
+		// Состояние зависимостей неизвестно, старые значения не публикуются
+		s.dependencyUp.DeletePartialMatch(prometheus.Labels{"service": target.Name})
+
+		// Сервис без SystemService (старая версия) не считается неисправным
+		if result.Error == "" {
+			log.Printf("Admin status: %s system status: %v", target.Name, errs[1])
+		}
+		return result
+	}
+
+	result.Version = info.Version
+	result.Commit = info.Commit
+	if info.StartedAt != nil {
+		startedAt := info.StartedAt.AsTime()
+		result.StartedAt = &startedAt
+	}
+	result.UptimeSeconds = info.UptimeSeconds
+	for _, dep := range info.Dependencies {
+		result.Dependencies = append(result.Dependencies, DependencyStatus{
+			Name:      dep.Name,
+			Healthy:   dep.Healthy,
+			Error:     dep.Error,
+			LatencyMs: dep.LatencyMs,
+			Details:   dep.Details,
+		})
+		s.dependencyUp.WithLabelValues(target.Name, dep.Name).Set(gaugeValue(dep.Healthy))
+	}
+	return result
+}
+
+// Run обновляет метрики с интервалом interval, чтобы они не зависели от
+// обращений к отчету. Завершается при отмене ctx.
+func (s *Status) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.Report(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Handler возвращает обработчик GET /api/v1/admin/status
+func (s *Status) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := s.Report(r.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+func gaugeValue(ok bool) float64 {
+	if ok {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,145 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/velvetriddles/mini-smart-home/libs/sysstatus"
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startBackend запускает gRPC-сервер с health-сервисом и, если system не nil, SystemService
+func startBackend(t *testing.T, serving healthpb.HealthCheckResponse_ServingStatus, system *sysstatus.Server) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", serving)
+	healthpb.RegisterHealthServer(server, healthServer)
+	if system != nil {
+		smarthomev1.RegisterSystemServiceServer(server, system)
+	}
+
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial backend: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestStatus_Report(t *testing.T) {
+	auth := startBackend(t, healthpb.HealthCheckResponse_SERVING, sysstatus.NewServer("auth",
+		sysstatus.Dependency{Name: "postgres", Check: func(ctx context.Context) (map[string]string, error) {
+			return map[string]string{"open_connections": "2"}, nil
+		}},
+		sysstatus.Dependency{Name: "redis", Check: func(ctx context.Context) (map[string]string, error) {
+			return nil, errors.New("connection refused")
+		}},
+	))
+	device := startBackend(t, healthpb.HealthCheckResponse_NOT_SERVING, nil)
+
+	registry := prometheus.NewRegistry()
+	status, err := NewStatus(Config{
+		Targets: []Target{
+			{Name: "auth", Conn: auth, Breaker: func() string { return "closed" }},
+			{Name: "device", Conn: device},
+		},
+		Timeout:    time.Second,
+		Registerer: registry,
+	})
+	if err != nil {
+		t.Fatalf("NewStatus failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	status.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/status", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Unexpected response: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var report Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Invalid report: %v", err)
+	}
+	if report.Status != StatusDegraded || report.Gateway.Version != sysstatus.Version || len(report.Services) != 2 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+
+	authStatus := report.Services[0]
+	if authStatus.Name != "auth" || !authStatus.Healthy || authStatus.Health != "SERVING" || authStatus.Breaker != "closed" {
+		t.Errorf("Unexpected auth status: %+v", authStatus)
+	}
+	if authStatus.Version != sysstatus.Version || authStatus.StartedAt == nil || len(authStatus.Dependencies) != 2 {
+		t.Fatalf("Missing auth system status: %+v", authStatus)
+	}
+	if postgres := authStatus.Dependencies[0]; !postgres.Healthy || postgres.Details["open_connections"] != "2" {
+		t.Errorf("Unexpected postgres status: %+v", postgres)
+	}
+	if redis := authStatus.Dependencies[1]; redis.Healthy || redis.Error != "connection refused" {
+		t.Errorf("Unexpected redis status: %+v", redis)
+	}
+
+	// Сервис без SystemService показывает только health
+	deviceStatus := report.Services[1]
+	if deviceStatus.Healthy || deviceStatus.Health != "NOT_SERVING" || deviceStatus.Version != "" {
+		t.Errorf("Unexpected device status: %+v", deviceStatus)
+	}
+
+	expected := `
+# HELP smarthome_gateway_backend_up Whether the backend service reports SERVING in its gRPC health check (1) or not (0).
+# TYPE smarthome_gateway_backend_up gauge
+smarthome_gateway_backend_up{service="auth"} 1
+smarthome_gateway_backend_up{service="device"} 0
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "smarthome_gateway_backend_up"); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.ToFloat64(status.dependencyUp.WithLabelValues("auth", "redis")); got != 0 {
+		t.Errorf("Expected redis dependency gauge 0, got %v", got)
+	}
+}
+
+func TestStatus_UnreachableBackend(t *testing.T) {
+	conn := startBackend(t, healthpb.HealthCheckResponse_SERVING, nil)
+	conn.Close()
+
+	status, err := NewStatus(Config{
+		Targets:    []Target{{Name: "voice", Conn: conn}},
+		Timeout:    100 * time.Millisecond,
+		Registerer: prometheus.NewRegistry(),
+	})
+	if err != nil {
+		t.Fatalf("NewStatus failed: %v", err)
+	}
+
+	report := status.Report(context.Background())
+	voice := report.Services[0]
+	if report.Status != StatusDegraded || voice.Healthy || voice.Health != "UNKNOWN" || voice.Error == "" {
+		t.Errorf("Unexpected report for unreachable backend: %+v", report)
+	}
+	if got := testutil.ToFloat64(status.backendUp.WithLabelValues("voice")); got != 0 {
+		t.Errorf("Expected backend gauge 0, got %v", got)
+	}
+}
@@ -0,0 +1,219 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/health" // Клиентская проверка здоровья для healthCheckConfig
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+// MethodPolicy задает таймаут и политику повторов для методов сервиса
+type MethodPolicy struct {
+	Service string        // Полное имя gRPC-сервиса, например smarthome.v1.DeviceService
+	Methods []string      // Методы сервиса (пусто - все методы)
+	Timeout time.Duration // Таймаут вызова (0 - без таймаута, например для потоков)
+	Retry   bool          // Повторять при UNAVAILABLE (только для идемпотентных методов)
+}
+
+// Политики по умолчанию для внутренних сервисов
+var (
+	AuthPolicies = []MethodPolicy{
+		{Service: "smarthome.v1.AuthService", Timeout: 5 * time.Second},
+		{Service: "smarthome.v1.AuthService", Methods: []string{"ValidateToken", "CheckHealth"}, Timeout: 2 * time.Second, Retry: true},
+	}
+
+	DevicePolicies = []MethodPolicy{
+		// Все методы, в том числе новые: таймаут без повторов
+		{Service: "smarthome.v1.DeviceService", Timeout: 5 * time.Second},
+		// Поток статусов открыт, пока его не закроет клиент
+		{Service: "smarthome.v1.DeviceService", Methods: []string{"StreamStatuses"}},
+		// Идемпотентные чтения повторяются
+		{Service: "smarthome.v1.DeviceService", Methods: []string{
+			"GetDevice",
+			"ListDevices",
+			"ListDeviceTypes",
+			"GetDeviceHistory",
+			"ListRooms",
+			"GetRoom",
+			"GetRoomSummary",
+			"ListScenes",
+			"GetScene",
+			"ListRules",
+			"GetRule",
+			"ListRuleExecutions",
+			"ListSchedules",
+			"GetSchedule",
+		}, Timeout: 3 * time.Second, Retry: true},
+	}
+
+	VoicePolicies = []MethodPolicy{
+		{Service: "smarthome.v1.VoiceService", Methods: []string{"ListIntents"}, Timeout: 3 * time.Second, Retry: true},
+	}
+)
+
+// Config содержит настройки соединения с одним внутренним сервисом
+type Config struct {
+	Name             string                           // Имя сервиса для логов и ошибок
+	Addresses        []string                         // Адреса экземпляров сервиса
+	Policies         []MethodPolicy                   // Таймауты и повторы по методам
+	BreakerThreshold int                              // Количество отказов подряд до размыкания выключателя
+	BreakerCooldown  time.Duration                    // Время, на которое выключатель размыкается
+	Credentials      credentials.TransportCredentials // mTLS с сервисом (nil - без шифрования)
+	DialOptions      []grpc.DialOption
+}
+
+// Backend представляет управляемое соединение с внутренним сервисом:
+// балансировку между экземплярами с проверкой здоровья, таймауты,
+// повторы идемпотентных запросов и автоматический выключатель
+type Backend struct {
+	Name    string
+	Conn    *grpc.ClientConn
+	Breaker *Breaker
+}
+
+// ParseAddresses разбирает список адресов, разделенных запятыми
+func ParseAddresses(s string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(s, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// Dial создает соединение с сервисом. Соединение устанавливается лениво,
+// поэтому недоступность сервиса при старте шлюза не является ошибкой.
+func Dial(cfg Config) (*Backend, error) {
+	if len(cfg.Addresses) == 0 {
+		return nil, fmt.Errorf("no addresses configured for %s service", cfg.Name)
+	}
+
+	serviceConfig, err := buildServiceConfig(cfg.Policies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build service config for %s: %w", cfg.Name, err)
+	}
+
+	breaker := NewBreaker(cfg.Name, cfg.BreakerThreshold, cfg.BreakerCooldown)
+
+	// При статическом списке адресов имя сервиса (cfg.Name) становится
+	// authority соединения и проверяется в сертификате сервиса
+	creds := cfg.Credentials
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithChainUnaryInterceptor(breaker.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(breaker.StreamClientInterceptor()),
+	}
+
+	// Адрес с явной схемой (например, dns:///device:50052) передаем резолверу gRPC,
+	// список адресов - через статический резолвер
+	target := cfg.Addresses[0]
+	if len(cfg.Addresses) > 1 || !strings.Contains(target, ":///") {
+		r := manual.NewBuilderWithScheme("smarthome-" + cfg.Name)
+		state := resolver.State{}
+		for _, addr := range cfg.Addresses {
+			state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+		}
+		r.InitialState(state)
+
+		opts = append(opts, grpc.WithResolvers(r))
+		target = r.Scheme() + ":///" + cfg.Name
+	}
+
+	conn, err := grpc.NewClient(target, append(opts, cfg.DialOptions...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for %s service: %w", cfg.Name, err)
+	}
+
+	return &Backend{
+		Name:    cfg.Name,
+		Conn:    conn,
+		Breaker: breaker,
+	}, nil
+}
+
+// Close закрывает соединение с сервисом
+func (b *Backend) Close() error {
+	return b.Conn.Close()
+}
+
+// Структуры gRPC service config (https://github.com/grpc/grpc/blob/master/doc/service_config.md)
+type serviceConfig struct {
+	LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig"`
+	HealthCheckConfig   healthCheckConfig     `json:"healthCheckConfig"`
+	MethodConfig        []methodConfig        `json:"methodConfig,omitempty"`
+}
+
+type healthCheckConfig struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type methodName struct {
+	Service string `json:"service"`
+	Method  string `json:"method,omitempty"`
+}
+
+type methodConfig struct {
+	Name        []methodName `json:"name"`
+	Timeout     string       `json:"timeout,omitempty"`
+	RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+}
+
+type retryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+// buildServiceConfig формирует JSON service config: round robin между
+// здоровыми экземплярами и настройки методов из политик
+func buildServiceConfig(policies []MethodPolicy) (string, error) {
+	cfg := serviceConfig{
+		LoadBalancingConfig: []map[string]struct{}{{"round_robin": {}}},
+	}
+
+	for _, policy := range policies {
+		mc := methodConfig{}
+		if len(policy.Methods) == 0 {
+			mc.Name = append(mc.Name, methodName{Service: policy.Service})
+		}
+		for _, method := range policy.Methods {
+			mc.Name = append(mc.Name, methodName{Service: policy.Service, Method: method})
+		}
+
+		if policy.Timeout > 0 {
+			mc.Timeout = fmt.Sprintf("%.3fs", policy.Timeout.Seconds())
+		}
+		if policy.Retry {
+			mc.RetryPolicy = &retryPolicy{
+				MaxAttempts:          3,
+				InitialBackoff:       "0.1s",
+				MaxBackoff:           "1s",
+				BackoffMultiplier:    2,
+				RetryableStatusCodes: []string{"UNAVAILABLE"},
+			}
+		}
+
+		cfg.MethodConfig = append(cfg.MethodConfig, mc)
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,138 @@
+package backend
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestBreaker_Transitions(t *testing.T) {
+	now := time.Unix(1714580400, 0)
+	breaker := NewBreaker("device", 2, 10*time.Second)
+	breaker.now = func() time.Time { return now }
+
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	notFound := status.Error(codes.NotFound, "device not found")
+
+	// Ошибки клиента не размыкают выключатель
+	breaker.Record(notFound)
+	breaker.Record(notFound)
+	if state := breaker.State(); state != StateClosed {
+		t.Fatalf("Expected %s after client errors, got %s", StateClosed, state)
+	}
+
+	breaker.Record(unavailable)
+	breaker.Record(unavailable)
+	if state := breaker.State(); state != StateOpen {
+		t.Fatalf("Expected %s after failures, got %s", StateOpen, state)
+	}
+	if err := breaker.Allow(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Expected Unavailable from open breaker, got %v", err)
+	}
+
+	// После паузы пропускается только один пробный запрос
+	now = now.Add(10 * time.Second)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Expected probe to be allowed, got %v", err)
+	}
+	if err := breaker.Allow(); err == nil {
+		t.Fatal("Expected second request during probe to be rejected")
+	}
+
+	// Неудачная проба снова размыкает выключатель
+	breaker.Record(unavailable)
+	if state := breaker.State(); state != StateOpen {
+		t.Fatalf("Expected %s after failed probe, got %s", StateOpen, state)
+	}
+
+	// Успешная проба замыкает выключатель
+	now = now.Add(10 * time.Second)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Expected probe to be allowed, got %v", err)
+	}
+	breaker.Record(nil)
+	if state := breaker.State(); state != StateClosed {
+		t.Fatalf("Expected %s after successful probe, got %s", StateClosed, state)
+	}
+}
+
+func TestBreaker_CanceledProbeReleased(t *testing.T) {
+	now := time.Unix(1714580400, 0)
+	breaker := NewBreaker("device", 1, time.Second)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Record(status.Error(codes.Unavailable, "down"))
+	now = now.Add(time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	interceptor := breaker.UnaryClientInterceptor()
+	err := interceptor(ctx, "/smarthome.v1.DeviceService/GetDevice", nil, nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return status.Error(codes.Canceled, "canceled")
+		})
+	if status.Code(err) != codes.Canceled {
+		t.Fatalf("Expected Canceled, got %v", err)
+	}
+
+	// Отмененная проба не должна блокировать следующую
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("Expected new probe to be allowed, got %v", err)
+	}
+}
+
+func TestDial_BalancesAcrossHealthyInstances(t *testing.T) {
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+
+		srv := grpc.NewServer()
+		healthpb.RegisterHealthServer(srv, health.NewServer())
+		go srv.Serve(lis)
+		defer srv.Stop()
+
+		addrs = append(addrs, lis.Addr().String())
+	}
+
+	// Один адрес недоступен: балансировщик должен обойти его
+	addrs = append(addrs, "127.0.0.1:1")
+
+	b, err := Dial(Config{
+		Name:      "device",
+		Addresses: addrs,
+		Policies: []MethodPolicy{
+			{Service: "grpc.health.v1.Health", Methods: []string{"Check"}, Timeout: time.Second, Retry: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer b.Close()
+
+	client := healthpb.NewHealthClient(b.Conn)
+	for i := 0; i < 5; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+		cancel()
+		if err != nil {
+			t.Fatalf("Check %d failed: %v", i, err)
+		}
+	}
+}
+
+func TestDial_NoAddresses(t *testing.T) {
+	if _, err := Dial(Config{Name: "voice"}); err == nil {
+		t.Error("Expected error for empty address list")
+	}
+}
@@ -0,0 +1,160 @@
+package backend
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Состояния автоматического выключателя
+const (
+	StateClosed   = "closed"    // Запросы проходят
+	StateOpen     = "open"      // Запросы отклоняются без обращения к сервису
+	StateHalfOpen = "half-open" // Пропускается один пробный запрос
+)
+
+// Breaker реализует автоматический выключатель (circuit breaker): после Threshold
+// подряд идущих отказов сервиса запросы отклоняются с codes.Unavailable на время Cooldown
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker создает выключатель для сервиса
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if cooldown <= 0 {
+		cooldown = 10 * time.Second
+	}
+
+	return &Breaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     StateClosed,
+	}
+}
+
+// State возвращает текущее состояние выключателя
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Allow проверяет, можно ли отправить запрос в сервис
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return status.Errorf(codes.Unavailable, "%s service is unavailable (circuit open)", b.name)
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return status.Errorf(codes.Unavailable, "%s service is unavailable (circuit half-open)", b.name)
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record учитывает результат запроса
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !isBackendFailure(err) {
+		b.state = StateClosed
+		b.failures = 0
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.state = StateOpen
+		b.openedAt = b.now()
+		b.probing = false
+	}
+}
+
+// finish учитывает результат вызова. Отмена запроса клиентом ничего не говорит
+// о состоянии сервиса, поэтому лишь освобождает место пробного запроса.
+func (b *Breaker) finish(ctx context.Context, err error) {
+	if ctx.Err() == nil {
+		b.Record(err)
+		return
+	}
+
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// isBackendFailure определяет, свидетельствует ли ошибка о неработоспособности сервиса.
+// Ошибки клиента (NotFound, InvalidArgument и т.д.) выключатель не размыкают.
+func isBackendFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	default:
+		return false
+	}
+}
+
+// UnaryClientInterceptor возвращает интерсептор, проверяющий выключатель для унарных вызовов
+func (b *Breaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := b.Allow(); err != nil {
+			return err
+		}
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		b.finish(ctx, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor возвращает интерсептор, проверяющий выключатель при открытии потока
+func (b *Breaker) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := b.Allow(); err != nil {
+			return nil, err
+		}
+
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		b.finish(ctx, err)
+		return stream, err
+	}
+}
@@ -0,0 +1,293 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/ratelimit"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Операции подзапросов
+const (
+	OpGet     = "get"     // GetDevice
+	OpList    = "list"    // ListDevices
+	OpControl = "control" // ControlDevice
+)
+
+// Режимы выполнения пакета
+const (
+	ModeParallel   = "parallel"   // Подзапросы выполняются параллельно
+	ModeSequential = "sequential" // По порядку, до первой ошибки
+)
+
+// maxBodySize - максимальный размер тела пакетного запроса
+const maxBodySize = 1 << 20
+
+// Тела ответов совпадают с ответами REST-маршрутов gRPC-gateway
+var (
+	marshaler   = protojson.MarshalOptions{EmitUnpopulated: true}
+	unmarshaler = protojson.UnmarshalOptions{DiscardUnknown: true}
+)
+
+// Config содержит настройки пакетного эндпоинта
+type Config struct {
+	DeviceClient smarthomev1.DeviceServiceClient
+	Workers      int // Максимум параллельных подзапросов одного пакета
+	MaxItems     int // Максимум подзапросов в пакете
+
+	// Лимит управления устройствами списывается за каждый подзапрос control
+	Limiter       ratelimit.Limiter
+	ControlPolicy ratelimit.Policy
+}
+
+// Request - пакетный запрос
+type Request struct {
+	Mode     string `json:"mode"`
+	Requests []Item `json:"requests"`
+}
+
+// Item - подзапрос пакета
+type Item struct {
+	ID         string          `json:"id"`
+	Op         string          `json:"op"`
+	DeviceID   string          `json:"device_id"`
+	Type       string          `json:"type"`
+	OnlineOnly bool            `json:"online_only"`
+	Command    json.RawMessage `json:"command"`
+}
+
+// Result - результат подзапроса
+type Result struct {
+	ID     string          `json:"id"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// Response - ответ на пакетный запрос в порядке подзапросов
+type Response struct {
+	Responses []Result `json:"responses"`
+	Succeeded int      `json:"succeeded"`
+	Failed    int      `json:"failed"`
+}
+
+type handler struct {
+	cfg Config
+}
+
+// NewHandler возвращает обработчик POST /api/v1/batch. Пакет выполняется
+// целиком и всегда отвечает 200, статус каждого подзапроса - в поле status.
+func NewHandler(cfg Config) http.HandlerFunc {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 8
+	}
+	if cfg.MaxItems <= 0 {
+		cfg.MaxItems = 50
+	}
+	h := &handler{cfg: cfg}
+	return h.serve
+}
+
+func (h *handler) serve(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		apierror.WriteProblem(w, r, apierror.New(codes.InvalidArgument, apierror.ReasonValidationFailed, "invalid batch request: "+err.Error()))
+		return
+	}
+
+	if len(req.Requests) == 0 {
+		apierror.WriteProblem(w, r, apierror.InvalidArgument("batch request contains no requests",
+			apierror.FieldViolation{Field: "requests", Description: "must not be empty"}))
+		return
+	}
+	if len(req.Requests) > h.cfg.MaxItems {
+		apierror.WriteProblemStatus(w, r, http.StatusRequestEntityTooLarge, apierror.InvalidArgument(
+			fmt.Sprintf("batch request contains more than %d requests", h.cfg.MaxItems),
+			apierror.FieldViolation{Field: "requests", Description: fmt.Sprintf("must contain at most %d items", h.cfg.MaxItems)}))
+		return
+	}
+
+	// Подзапросы без id получают порядковый номер, id должны быть уникальны
+	ids := make(map[string]bool, len(req.Requests))
+	for i := range req.Requests {
+		if req.Requests[i].ID == "" {
+			req.Requests[i].ID = strconv.Itoa(i)
+		}
+		if ids[req.Requests[i].ID] {
+			apierror.WriteProblem(w, r, apierror.InvalidArgument(fmt.Sprintf("duplicate request id %q", req.Requests[i].ID),
+				apierror.FieldViolation{Field: fmt.Sprintf("requests[%d].id", i), Description: "must be unique"}))
+			return
+		}
+		ids[req.Requests[i].ID] = true
+	}
+
+	var results []Result
+	switch req.Mode {
+	case "", ModeParallel:
+		results = h.runParallel(r, req.Requests)
+	case ModeSequential:
+		results = h.runSequential(r, req.Requests)
+	default:
+		apierror.WriteProblem(w, r, apierror.InvalidArgument(fmt.Sprintf("unknown batch mode %q", req.Mode),
+			apierror.FieldViolation{Field: "mode", Description: "must be parallel or sequential"}))
+		return
+	}
+
+	resp := Response{Responses: results}
+	for _, result := range results {
+		if result.Status < 400 {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// runParallel выполняет подзапросы пулом из cfg.Workers обработчиков
+func (h *handler) runParallel(r *http.Request, items []Item) []Result {
+	results := make([]Result, len(items))
+	sem := make(chan struct{}, h.cfg.Workers)
+
+	var wg sync.WaitGroup
+	for i := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = h.execute(r, items[i])
+		}(i)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runSequential выполняет подзапросы по порядку. После первой ошибки
+// оставшиеся подзапросы не выполняются и получают 424 Failed Dependency.
+func (h *handler) runSequential(r *http.Request, items []Item) []Result {
+	results := make([]Result, len(items))
+
+	failed := ""
+	for i, item := range items {
+		if failed != "" {
+			results[i] = errorResult(r, item.ID, http.StatusFailedDependency,
+				apierror.Newf(codes.Aborted, apierror.ReasonBatchItemSkipped, "not executed: request %q failed", failed).
+					WithMetadata("failed_request", failed))
+			continue
+		}
+
+		results[i] = h.execute(r, item)
+		if results[i].Status >= 400 {
+			failed = item.ID
+		}
+	}
+
+	return results
+}
+
+// execute выполняет один подзапрос
+func (h *handler) execute(r *http.Request, item Item) Result {
+	ctx := r.Context()
+
+	var (
+		resp proto.Message
+		err  error
+	)
+
+	switch item.Op {
+	case OpGet:
+		if item.DeviceID == "" {
+			return invalid(r, item, "device_id", "is required")
+		}
+		resp, err = h.cfg.DeviceClient.GetDevice(ctx, &smarthomev1.DeviceId{Id: item.DeviceID})
+
+	case OpList:
+		resp, err = h.cfg.DeviceClient.ListDevices(ctx, &smarthomev1.ListDevicesRequest{
+			Type:       item.Type,
+			OnlineOnly: item.OnlineOnly,
+		})
+
+	case OpControl:
+		if item.DeviceID == "" {
+			return invalid(r, item, "device_id", "is required")
+		}
+		command := &smarthomev1.Command{}
+		if len(item.Command) == 0 {
+			return invalid(r, item, "command", "is required")
+		}
+		if err := unmarshaler.Unmarshal(item.Command, command); err != nil {
+			return invalid(r, item, "command", "invalid command: "+err.Error())
+		}
+		if result, ok := h.allowControl(ctx, r, item); !ok {
+			return result
+		}
+		resp, err = h.cfg.DeviceClient.ControlDevice(ctx, &smarthomev1.ControlDeviceRequest{
+			Id:      item.DeviceID,
+			Command: command,
+		})
+
+	default:
+		return invalid(r, item, "op", fmt.Sprintf("unknown op %q", item.Op))
+	}
+
+	if err != nil {
+		return errorResult(r, item.ID, 0, err)
+	}
+
+	body, err := marshaler.Marshal(resp)
+	if err != nil {
+		return errorResult(r, item.ID, 0, apierror.New(codes.Internal, apierror.ReasonInternal, err.Error()))
+	}
+	return Result{ID: item.ID, Status: http.StatusOK, Body: body}
+}
+
+// allowControl списывает лимит управления устройствами за подзапрос
+func (h *handler) allowControl(ctx context.Context, r *http.Request, item Item) (Result, bool) {
+	if h.cfg.Limiter == nil {
+		return Result{}, true
+	}
+
+	result, err := ratelimit.Check(ctx, h.cfg.Limiter, h.cfg.ControlPolicy, r)
+	if err != nil {
+		// При недоступности хранилища лимитов не блокируем запросы
+		log.Printf("Rate limiter error for batch control: %v", err)
+		return Result{}, true
+	}
+	if !result.Allowed {
+		return errorResult(r, item.ID, 0, ratelimit.LimitError(result)), false
+	}
+	return Result{}, true
+}
+
+// invalid возвращает результат 400 для некорректного поля подзапроса
+func invalid(r *http.Request, item Item, field, description string) Result {
+	return errorResult(r, item.ID, 0, apierror.InvalidArgument(field+": "+description,
+		apierror.FieldViolation{Field: field, Description: description}))
+}
+
+// errorResult формирует тело ошибки в виде problem-документа, как у REST-маршрутов.
+// Если httpStatus равен 0, статус выводится из кода gRPC.
+func errorResult(r *http.Request, id string, httpStatus int, err error) Result {
+	problem := apierror.NewProblem(err, httpStatus, r.URL.Path)
+	body, marshalErr := json.Marshal(problem)
+	if marshalErr != nil {
+		body = []byte(`{"status":500,"reason":"INTERNAL"}`)
+	}
+	return Result{ID: id, Status: problem.Status, Body: body}
+}
@@ -0,0 +1,231 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	authMiddleware "github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/middleware"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeDeviceClient знает устройства lamp-1 и lamp-2 и отслеживает число параллельных вызовов
+type fakeDeviceClient struct {
+	smarthomev1.DeviceServiceClient
+
+	delay    time.Duration
+	active   int32
+	peak     int32
+	mu       sync.Mutex
+	commands []string
+}
+
+func (c *fakeDeviceClient) enter() func() {
+	n := atomic.AddInt32(&c.active, 1)
+	for {
+		peak := atomic.LoadInt32(&c.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&c.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(c.delay)
+	return func() { atomic.AddInt32(&c.active, -1) }
+}
+
+func (c *fakeDeviceClient) GetDevice(ctx context.Context, in *smarthomev1.DeviceId, opts ...grpc.CallOption) (*smarthomev1.GetDeviceResponse, error) {
+	defer c.enter()()
+	if in.Id != "lamp-1" && in.Id != "lamp-2" {
+		return nil, status.Errorf(codes.NotFound, "device with ID %s not found", in.Id)
+	}
+	return &smarthomev1.GetDeviceResponse{Device: &smarthomev1.Device{Id: in.Id, Type: "lamp"}}, nil
+}
+
+func (c *fakeDeviceClient) ListDevices(ctx context.Context, in *smarthomev1.ListDevicesRequest, opts ...grpc.CallOption) (*smarthomev1.ListDevicesResponse, error) {
+	defer c.enter()()
+	return &smarthomev1.ListDevicesResponse{
+		Devices:    []*smarthomev1.Device{{Id: "lamp-1"}, {Id: "lamp-2"}},
+		TotalCount: 2,
+	}, nil
+}
+
+func (c *fakeDeviceClient) ControlDevice(ctx context.Context, in *smarthomev1.ControlDeviceRequest, opts ...grpc.CallOption) (*smarthomev1.ControlDeviceResponse, error) {
+	defer c.enter()()
+	if in.Id != "lamp-1" && in.Id != "lamp-2" {
+		return nil, status.Errorf(codes.NotFound, "device with ID %s not found", in.Id)
+	}
+	c.mu.Lock()
+	c.commands = append(c.commands, in.Id+":"+in.Command.Action)
+	c.mu.Unlock()
+	return &smarthomev1.ControlDeviceResponse{Success: true, Status: "Command executed successfully"}, nil
+}
+
+func post(t *testing.T, handler http.Handler, body string) (*httptest.ResponseRecorder, Response) {
+	t.Helper()
+
+	token, _ := authMiddleware.GenerateToken("user-1", "tester")
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/batch", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	jwtauth.Verifier(authMiddleware.TokenAuth)(handler).ServeHTTP(rec, req)
+
+	var resp Response
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid response: %v", err)
+		}
+	}
+	return rec, resp
+}
+
+func TestBatch_ParallelPerItemResults(t *testing.T) {
+	client := &fakeDeviceClient{}
+	handler := NewHandler(Config{DeviceClient: client})
+
+	rec, resp := post(t, handler, `{"requests": [
+		{"id": "a", "op": "get", "device_id": "lamp-1"},
+		{"id": "b", "op": "list", "type": "lamp"},
+		{"id": "c", "op": "control", "device_id": "lamp-2", "command": {"action": "turn_off", "parameters": {"brightness": "0"}}},
+		{"id": "d", "op": "get", "device_id": "missing"},
+		{"op": "reboot"}
+	]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	want := map[string]int{"a": 200, "b": 200, "c": 200, "d": 404, "4": 400}
+	if len(resp.Responses) != len(want) {
+		t.Fatalf("Expected %d responses, got %d", len(want), len(resp.Responses))
+	}
+	for _, result := range resp.Responses {
+		if result.Status != want[result.ID] {
+			t.Errorf("Request %s: expected status %d, got %d: %s", result.ID, want[result.ID], result.Status, result.Body)
+		}
+	}
+	if resp.Succeeded != 3 || resp.Failed != 2 {
+		t.Errorf("Expected 3 succeeded and 2 failed, got %d and %d", resp.Succeeded, resp.Failed)
+	}
+
+	// Тела совпадают с ответами REST-маршрутов
+	var device struct {
+		Device struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+		} `json:"device"`
+	}
+	json.Unmarshal(resp.Responses[0].Body, &device)
+	if device.Device.ID != "lamp-1" || device.Device.Type != "lamp" {
+		t.Errorf("Unexpected get body: %s", resp.Responses[0].Body)
+	}
+	var notFound apierror.Problem
+	json.Unmarshal(resp.Responses[3].Body, &notFound)
+	if notFound.Status != http.StatusNotFound || notFound.Code != "NOT_FOUND" || !strings.Contains(notFound.Detail, "missing") {
+		t.Errorf("Unexpected error body: %s", resp.Responses[3].Body)
+	}
+	if len(client.commands) != 1 || client.commands[0] != "lamp-2:turn_off" {
+		t.Errorf("Unexpected commands: %v", client.commands)
+	}
+}
+
+func TestBatch_BoundedConcurrency(t *testing.T) {
+	client := &fakeDeviceClient{delay: 20 * time.Millisecond}
+	handler := NewHandler(Config{DeviceClient: client, Workers: 3})
+
+	items := make([]string, 12)
+	for i := range items {
+		items[i] = `{"op": "get", "device_id": "lamp-1"}`
+	}
+	rec, resp := post(t, handler, `{"requests": [`+strings.Join(items, ",")+`]}`)
+	if rec.Code != http.StatusOK || resp.Succeeded != 12 {
+		t.Fatalf("Expected 12 successful requests, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if peak := atomic.LoadInt32(&client.peak); peak != 3 {
+		t.Errorf("Expected at most 3 concurrent backend calls, peak was %d", peak)
+	}
+}
+
+func TestBatch_SequentialStopsOnFirstError(t *testing.T) {
+	client := &fakeDeviceClient{}
+	handler := NewHandler(Config{DeviceClient: client})
+
+	_, resp := post(t, handler, `{"mode": "sequential", "requests": [
+		{"id": "kitchen", "op": "control", "device_id": "lamp-1", "command": {"action": "turn_off"}},
+		{"id": "hall", "op": "control", "device_id": "missing", "command": {"action": "turn_off"}},
+		{"id": "bedroom", "op": "control", "device_id": "lamp-2", "command": {"action": "turn_off"}}
+	]}`)
+
+	statuses := []int{}
+	for _, result := range resp.Responses {
+		statuses = append(statuses, result.Status)
+	}
+	if len(statuses) != 3 || statuses[0] != 200 || statuses[1] != 404 || statuses[2] != http.StatusFailedDependency {
+		t.Fatalf("Unexpected statuses: %v", statuses)
+	}
+	var skipped apierror.Problem
+	json.Unmarshal(resp.Responses[2].Body, &skipped)
+	if skipped.Reason != apierror.ReasonBatchItemSkipped || skipped.Metadata["failed_request"] != "hall" {
+		t.Errorf("Unexpected skipped body: %s", resp.Responses[2].Body)
+	}
+	if len(client.commands) != 1 {
+		t.Errorf("Requests after the failure must not run, got commands %v", client.commands)
+	}
+}
+
+func TestBatch_ControlRateLimit(t *testing.T) {
+	client := &fakeDeviceClient{}
+	handler := NewHandler(Config{
+		DeviceClient:  client,
+		Limiter:       ratelimit.NewMemoryLimiter(),
+		ControlPolicy: ratelimit.Policy{Name: "control", Rule: ratelimit.Rule{Limit: 2, Period: time.Minute}},
+	})
+
+	_, resp := post(t, handler, `{"mode": "sequential", "requests": [
+		{"op": "get", "device_id": "lamp-1"},
+		{"op": "control", "device_id": "lamp-1", "command": {"action": "turn_on"}},
+		{"op": "control", "device_id": "lamp-2", "command": {"action": "turn_on"}},
+		{"op": "control", "device_id": "lamp-1", "command": {"action": "turn_off"}}
+	]}`)
+
+	if got := resp.Responses[3].Status; got != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for the third control request, got %d", got)
+	}
+	if len(client.commands) != 2 {
+		t.Errorf("Expected 2 executed commands, got %v", client.commands)
+	}
+}
+
+func TestBatch_InvalidRequests(t *testing.T) {
+	handler := NewHandler(Config{DeviceClient: &fakeDeviceClient{}, MaxItems: 2})
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"malformed", `{"requests": [`, http.StatusBadRequest},
+		{"empty", `{"requests": []}`, http.StatusBadRequest},
+		{"too many", `{"requests": [{"op": "list"}, {"op": "list"}, {"op": "list"}]}`, http.StatusRequestEntityTooLarge},
+		{"unknown mode", `{"mode": "random", "requests": [{"op": "list"}]}`, http.StatusBadRequest},
+		{"duplicate id", `{"requests": [{"id": "x", "op": "list"}, {"id": "x", "op": "list"}]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec, _ := post(t, handler, tt.body); rec.Code != tt.code {
+				t.Errorf("Expected %d, got %d: %s", tt.code, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+// Package cors реализует политику источников (origin) шлюза: заголовки CORS
+// для REST-маршрутов и проверку Origin при подключении WebSocket.
+//
+// По умолчанию политика строгая: сторонние источники не разрешены, WebSocket
+// принимается только с того же хоста или от клиентов без заголовка Origin.
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	"google.golang.org/grpc/codes"
+)
+
+// Значения по умолчанию для методов и заголовков
+var (
+	DefaultMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	DefaultHeaders = []string{"Authorization", "Content-Type", "Idempotency-Key", "If-Match", "If-None-Match", "Last-Event-ID"}
+	DefaultExposed = []string{"ETag", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Idempotent-Replayed"}
+)
+
+// Config содержит настройки политики источников
+type Config struct {
+	AllowedOrigins   []string      // Источники вида https://home.example.com, https://*.example.com или * (любой)
+	AllowedMethods   []string      // Методы, разрешенные в preflight (пусто - DefaultMethods)
+	AllowedHeaders   []string      // Заголовки запроса, разрешенные в preflight (пусто - DefaultHeaders, * - любые)
+	ExposedHeaders   []string      // Заголовки ответа, доступные скрипту (пусто - DefaultExposed)
+	AllowCredentials bool          // Разрешить запросы с cookie и Authorization
+	MaxAge           time.Duration // Время кэширования preflight в браузере
+}
+
+// Policy - проверенная политика источников
+type Policy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	wildcards   []wildcard
+	methods     map[string]bool
+	anyHeader   bool
+	headers     map[string]bool
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+// wildcard - источник с подстановкой поддомена: https://*.example.com
+type wildcard struct {
+	prefix string // https://
+	suffix string // .example.com
+}
+
+// New проверяет настройки и создает политику. Любой источник (*) нельзя
+// сочетать с AllowCredentials: это открыло бы доступ с cookie пользователя
+// для любого сайта.
+func New(config Config) (*Policy, error) {
+	p := &Policy{
+		origins:     make(map[string]bool),
+		methods:     make(map[string]bool),
+		headers:     make(map[string]bool),
+		credentials: config.AllowCredentials,
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		origin = strings.TrimSpace(origin)
+		switch {
+		case origin == "":
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			w, err := parseWildcard(origin)
+			if err != nil {
+				return nil, err
+			}
+			p.wildcards = append(p.wildcards, w)
+		default:
+			normalized, err := normalizeOrigin(origin)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed origin %q: %w", origin, err)
+			}
+			p.origins[normalized] = true
+		}
+	}
+	if p.anyOrigin && p.credentials {
+		return nil, fmt.Errorf("allowed origin * cannot be combined with credentials, list the origins explicitly")
+	}
+
+	methods := config.AllowedMethods
+	if len(methods) == 0 {
+		methods = DefaultMethods
+	}
+	for _, method := range methods {
+		p.methods[strings.ToUpper(strings.TrimSpace(method))] = true
+	}
+
+	headers := config.AllowedHeaders
+	if len(headers) == 0 {
+		headers = DefaultHeaders
+	}
+	for _, header := range headers {
+		header = strings.TrimSpace(header)
+		if header == "*" {
+			p.anyHeader = true
+			continue
+		}
+		p.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	exposed := config.ExposedHeaders
+	if len(exposed) == 0 {
+		exposed = DefaultExposed
+	}
+	p.exposed = strings.Join(exposed, ", ")
+
+	if config.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(config.MaxAge.Seconds()))
+	}
+
+	return p, nil
+}
+
+// Enabled возвращает true, если разрешен хотя бы один сторонний источник
+func (p *Policy) Enabled() bool {
+	return p.anyOrigin || len(p.origins) > 0 || len(p.wildcards) > 0
+}
+
+// AllowOrigin проверяет, разрешен ли источник
+func (p *Policy) AllowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	return p.listed(origin)
+}
+
+// listed проверяет, указан ли источник в политике явно или шаблоном
+func (p *Policy) listed(origin string) bool {
+	normalized, err := normalizeOrigin(origin)
+	if err != nil {
+		return false
+	}
+	if p.origins[normalized] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if strings.HasPrefix(normalized, w.prefix) && strings.HasSuffix(normalized, w.suffix) &&
+			len(normalized) > len(w.prefix)+len(w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOrigin проверяет Origin запроса на подключение WebSocket (для
+// websocket.Upgrader). Браузер отправляет cookie при подключении с любого
+// сайта, поэтому сторонние источники допускаются, только если они указаны
+// в политике явно: "*" для WebSocket не действует.
+func (p *Policy) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// Не браузерные клиенты заголовок не отправляют
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return p.listed(origin)
+}
+
+// Middleware отвечает на preflight-запросы и добавляет заголовки CORS к
+// ответам на запросы с разрешенных источников
+func (p *Policy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Add("Vary", "Origin")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			p.preflight(w, r, origin)
+			return
+		}
+
+		if p.AllowOrigin(origin) {
+			p.setOrigin(header, origin)
+			if p.exposed != "" {
+				header.Set("Access-Control-Expose-Headers", p.exposed)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// preflight отвечает на предварительный запрос OPTIONS
+func (p *Policy) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	header := w.Header()
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+
+	if !p.AllowOrigin(origin) {
+		reject(w, r, "origin %s is not allowed", origin)
+		return
+	}
+
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if !p.methods[method] {
+		reject(w, r, "method %s is not allowed", method)
+		return
+	}
+
+	var requested []string
+	for _, value := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if !p.anyHeader && !p.headers[http.CanonicalHeaderKey(name)] {
+				reject(w, r, "header %s is not allowed", name)
+				return
+			}
+			requested = append(requested, name)
+		}
+	}
+
+	p.setOrigin(header, origin)
+	header.Set("Access-Control-Allow-Methods", method)
+	if len(requested) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if p.maxAge != "" {
+		header.Set("Access-Control-Max-Age", p.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setOrigin выставляет Access-Control-Allow-Origin и Allow-Credentials
+func (p *Policy) setOrigin(header http.Header, origin string) {
+	if p.anyOrigin && !p.credentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if p.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// reject отвечает 403 на preflight, который политика не разрешает
+func reject(w http.ResponseWriter, r *http.Request, format string, args ...interface{}) {
+	apierror.WriteProblem(w, r, apierror.Newf(codes.PermissionDenied, apierror.ReasonCORSRejected, format, args...))
+}
+
+// normalizeOrigin приводит источник к виду scheme://host[:port] в нижнем регистре
+func normalizeOrigin(origin string) (string, error) {
+	u, err := url.Parse(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return "", fmt.Errorf("expected scheme://host[:port]")
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// parseWildcard разбирает источник вида https://*.example.com
+func parseWildcard(origin string) (wildcard, error) {
+	scheme, host, ok := strings.Cut(strings.ToLower(strings.TrimSuffix(origin, "/")), "://")
+	if !ok || scheme == "" || !strings.HasPrefix(host, "*.") || strings.Count(host, "*") != 1 || len(host) < 3 {
+		return wildcard{}, fmt.Errorf("invalid allowed origin %q: wildcard must look like https://*.example.com", origin)
+	}
+	return wildcard{prefix: scheme + "://", suffix: host[1:]}, nil
+}
@@ -0,0 +1,179 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+)
+
+func newPolicy(t *testing.T, config Config) *Policy {
+	policy, err := New(config)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return policy
+}
+
+func serve(policy *Policy, method, origin string, header http.Header) *httptest.ResponseRecorder {
+	handler := policy.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(method, "/api/v1/devices", nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNew_Validation(t *testing.T) {
+	for _, config := range []Config{
+		{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		{AllowedOrigins: []string{"home.example.com"}},
+		{AllowedOrigins: []string{"https://home.example.com/app"}},
+		{AllowedOrigins: []string{"https://home.*.com"}},
+	} {
+		if _, err := New(config); err == nil {
+			t.Errorf("Expected error for %+v", config)
+		}
+	}
+}
+
+func TestPolicy_AllowOrigin(t *testing.T) {
+	policy := newPolicy(t, Config{AllowedOrigins: []string{"https://Home.example.com/", "http://localhost:5173", "https://*.example.org"}})
+
+	for origin, want := range map[string]bool{
+		"https://home.example.com":     true,
+		"https://HOME.example.com":     true,
+		"http://home.example.com":      false,
+		"http://localhost:5173":        true,
+		"http://localhost:3000":        false,
+		"https://app.example.org":      true,
+		"https://a.b.example.org":      true,
+		"https://example.org":          false,
+		"https://evil-example.org":     false,
+		"https://app.example.org.evil": false,
+		"null":                         false,
+	} {
+		if got := policy.AllowOrigin(origin); got != want {
+			t.Errorf("AllowOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+
+	// Строгая политика по умолчанию
+	if strict := newPolicy(t, Config{}); strict.Enabled() || strict.AllowOrigin("https://home.example.com") {
+		t.Error("Empty policy must not allow cross-origin requests")
+	}
+}
+
+func TestMiddleware_Preflight(t *testing.T) {
+	policy := newPolicy(t, Config{
+		AllowedOrigins:   []string{"https://home.example.com"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+
+	rec := serve(policy, http.MethodOptions, "https://home.example.com", http.Header{
+		"Access-Control-Request-Method":  {"POST"},
+		"Access-Control-Request-Headers": {"content-type, idempotency-key"},
+	})
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", rec.Code)
+	}
+	for key, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://home.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "POST",
+		"Access-Control-Allow-Headers":     "content-type, idempotency-key",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if got := rec.Header().Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		origin string
+		header http.Header
+	}{
+		"origin":  {"https://evil.example.com", http.Header{"Access-Control-Request-Method": {"GET"}}},
+		"method":  {"https://home.example.com", http.Header{"Access-Control-Request-Method": {"TRACE"}}},
+		"headers": {"https://home.example.com", http.Header{"Access-Control-Request-Method": {"GET"}, "Access-Control-Request-Headers": {"X-Custom"}}},
+	} {
+		rec := serve(policy, http.MethodOptions, tc.origin, tc.header)
+		if rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: expected 403 without CORS headers, got %d %v", name, rec.Code, rec.Header())
+		}
+		if rec.Header().Get("Content-Type") != apierror.ContentType {
+			t.Errorf("%s: expected problem response, got %q", name, rec.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestMiddleware_ActualRequest(t *testing.T) {
+	policy := newPolicy(t, Config{AllowedOrigins: []string{"https://home.example.com"}})
+
+	rec := serve(policy, http.MethodGet, "https://home.example.com", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "https://home.example.com" {
+		t.Fatalf("Unexpected response: %d %v", rec.Code, rec.Header())
+	}
+	if rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("Credentials must not be allowed by default")
+	}
+	if rec.Header().Get("Access-Control-Expose-Headers") == "" || rec.Header().Get("Vary") != "Origin" {
+		t.Errorf("Missing Expose-Headers or Vary: %v", rec.Header())
+	}
+
+	// Запрос с чужого источника выполняется, но браузер не получит доступ к ответу
+	rec = serve(policy, http.MethodGet, "https://evil.example.com", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Unexpected response for foreign origin: %d %v", rec.Code, rec.Header())
+	}
+
+	// Любой источник без credentials
+	public := newPolicy(t, Config{AllowedOrigins: []string{"*"}})
+	if got := serve(public, http.MethodGet, "https://anything.test", nil).Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected *, got %q", got)
+	}
+}
+
+func TestPolicy_CheckOrigin(t *testing.T) {
+	policy := newPolicy(t, Config{AllowedOrigins: []string{"https://home.example.com"}})
+
+	for origin, want := range map[string]bool{
+		"":                          true, // не браузерный клиент
+		"http://gateway.local:8080": true, // тот же хост
+		"https://home.example.com":  true,
+		"https://evil.example.com":  false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://gateway.local:8080/ws/status", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if got := policy.CheckOrigin(req); got != want {
+			t.Errorf("CheckOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+
+	// "*" разрешает CORS-запросы без cookie, но не подключение WebSocket,
+	// которое браузер аутентифицирует cookie jwt
+	anyPolicy := newPolicy(t, Config{AllowedOrigins: []string{"*"}})
+	for origin, want := range map[string]bool{
+		"http://gateway.local:8080": true,
+		"https://evil.example.com":  false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://gateway.local:8080/graphql", nil)
+		req.Header.Set("Origin", origin)
+		if got := anyPolicy.CheckOrigin(req); got != want {
+			t.Errorf("CheckOrigin(%q) with * = %v, want %v", origin, got, want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package drain
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	"google.golang.org/grpc/codes"
+)
+
+// closeTimeout - время на отправку close-фрейма одному клиенту
+const closeTimeout = time.Second
+
+// CloseReason - причина в close-фрейме WebSocket при остановке шлюза
+const CloseReason = "server shutting down"
+
+// Drainer отслеживает WebSocket-соединения и долгоживущие потоки шлюза и
+// завершает их при остановке. http.Server.Shutdown не ждет захваченные
+// (hijacked) соединения и не прерывает SSE, поэтому их закрывает Drainer.
+type Drainer struct {
+	notReady atomic.Bool
+	draining atomic.Bool
+
+	// ctx отменяется в начале Drain и завершает потоки из Stream
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	conns map[*websocket.Conn]struct{}
+	done  chan struct{} // закрывается, когда отпущено последнее соединение во время Drain
+}
+
+// New создает Drainer
+func New() *Drainer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Drainer{
+		ctx:    ctx,
+		cancel: cancel,
+		conns:  make(map[*websocket.Conn]struct{}),
+	}
+}
+
+// Ready возвращает false после SetNotReady: шлюз готовится к остановке
+func (d *Drainer) Ready() bool {
+	return !d.notReady.Load()
+}
+
+// SetNotReady переводит /health в состояние "не готов", чтобы балансировщик
+// перестал направлять новые запросы до начала остановки
+func (d *Drainer) SetNotReady() {
+	d.notReady.Store(true)
+}
+
+// Draining возвращает true после начала Drain
+func (d *Drainer) Draining() bool {
+	return d.draining.Load()
+}
+
+// Track регистрирует WebSocket-соединение. Вызывающий должен вызвать release
+// при закрытии соединения. Если остановка уже началась, соединение сразу
+// получает close-фрейм "going away", а ok равен false.
+func (d *Drainer) Track(conn *websocket.Conn) (release func(), ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.Draining() {
+		goingAway(conn)
+		return func() {}, false
+	}
+
+	d.conns[conn] = struct{}{}
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		delete(d.conns, conn)
+		if len(d.conns) == 0 && d.done != nil {
+			close(d.done)
+			d.done = nil
+		}
+	}, true
+}
+
+// Middleware отклоняет новые WebSocket-подключения во время остановки
+func (d *Drainer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.Draining() && websocket.IsWebSocketUpgrade(r) {
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", "1")
+			apierror.WriteProblem(w, r, apierror.New(codes.Unavailable, apierror.ReasonUnavailable, CloseReason))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Stream отменяет контекст запроса при начале остановки. Подключается к
+// долгоживущим ответам (SSE), которые иначе задержали бы Shutdown до таймаута.
+func (d *Drainer) Stream(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		stop := context.AfterFunc(d.ctx, cancel)
+		defer stop()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Drain начинает остановку: новые WebSocket-подключения отклоняются, потоки из
+// Stream завершаются, открытые WebSocket получают close-фрейм 1001 Going Away.
+// Drain ждет, пока клиенты закроют соединения, и закрывает оставшиеся по
+// истечении ctx.
+func (d *Drainer) Drain(ctx context.Context) {
+	d.SetNotReady()
+
+	d.mu.Lock()
+	d.draining.Store(true)
+	d.cancel()
+
+	conns := make([]*websocket.Conn, 0, len(d.conns))
+	for conn := range d.conns {
+		conns = append(conns, conn)
+	}
+	var done chan struct{}
+	if len(d.conns) > 0 {
+		done = make(chan struct{})
+		d.done = done
+	}
+	d.mu.Unlock()
+
+	for _, conn := range conns {
+		goingAway(conn)
+	}
+
+	if done == nil {
+		return
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		d.mu.Lock()
+		for conn := range d.conns {
+			conn.Close()
+		}
+		d.mu.Unlock()
+	}
+}
+
+// goingAway отправляет клиенту close-фрейм 1001 Going Away. WriteControl
+// можно вызывать одновременно с другими методами записи соединения.
+func goingAway(conn *websocket.Conn) {
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseGoingAway, CloseReason),
+		time.Now().Add(closeTimeout))
+}
@@ -0,0 +1,163 @@
+package drain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+)
+
+// newWebSocketServer запускает сервер, который держит соединение до закрытия клиентом
+func newWebSocketServer(t *testing.T, d *Drainer) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		release, ok := d.Track(conn)
+		defer release()
+		if !ok {
+			return
+		}
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDrain_ClosesWebSockets(t *testing.T) {
+	d := New()
+	server := newWebSocketServer(t, d)
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// Дожидаемся регистрации соединения
+	for deadline := time.Now().Add(time.Second); ; {
+		d.mu.Lock()
+		n := len(d.conns)
+		d.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Connection was not tracked")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		d.Drain(ctx)
+	}()
+
+	// Клиент получает 1001 Going Away; gorilla отвечает close-фреймом,
+	// после чего сервер отпускает соединение и Drain завершается
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway || closeErr.Text != CloseReason {
+		t.Fatalf("Expected going away close, got %v", err)
+	}
+
+	select {
+	case <-drained:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Drain did not finish after the client closed")
+	}
+
+	if d.Ready() || !d.Draining() {
+		t.Errorf("Unexpected state after drain: ready=%v draining=%v", d.Ready(), d.Draining())
+	}
+
+	// Новые подключения отклоняются
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 for new upgrade, got %v %v", resp, err)
+	}
+	if resp.Header.Get("Content-Type") != apierror.ContentType || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Unexpected rejection headers: %v", resp.Header)
+	}
+}
+
+func TestDrain_ForceClosesOnTimeout(t *testing.T) {
+	d := New()
+	server := newWebSocketServer(t, d)
+
+	// Клиент не читает сокет и не отвечает на close-фрейм
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	d.Drain(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Drain took %s", elapsed)
+	}
+}
+
+func TestStream_CanceledOnDrain(t *testing.T) {
+	d := New()
+	canceled := make(chan struct{})
+	handler := d.Stream(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(canceled)
+	}))
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events", nil))
+
+	select {
+	case <-canceled:
+		t.Fatal("Stream canceled before drain")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	d.Drain(context.Background())
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("Stream was not canceled on drain")
+	}
+}
+
+func TestMiddleware_PassesPlainRequests(t *testing.T) {
+	d := New()
+	d.Drain(context.Background())
+
+	handler := d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/devices", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected plain request to pass during drain, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,167 @@
+package etag
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	"google.golang.org/grpc/codes"
+)
+
+// Compute возвращает сильный ETag для тела ответа
+func Compute(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:18]) + `"`
+}
+
+// Middleware выставляет ETag для успешных ответов на подходящие GET-запросы
+// и отвечает 304 Not Modified, если ETag совпадает с If-None-Match
+func Middleware(match func(*http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if (r.Method != http.MethodGet && r.Method != http.MethodHead) || !match(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &recorder{header: make(http.Header), status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			header := w.Header()
+			for key, values := range rec.header {
+				header[key] = values
+			}
+
+			if rec.status != http.StatusOK {
+				w.WriteHeader(rec.status)
+				w.Write(rec.body.Bytes())
+				return
+			}
+
+			tag := Compute(rec.body.Bytes())
+			header.Set("ETag", tag)
+			if header.Get("Cache-Control") == "" {
+				// Ответ можно хранить, но перед использованием нужно проверить ETag
+				header.Set("Cache-Control", "private, no-cache")
+			}
+
+			if noneMatch(r.Header.Get("If-None-Match"), tag) {
+				header.Del("Content-Length")
+				header.Del("Content-Type")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+			w.Write(rec.body.Bytes())
+		})
+	}
+}
+
+// IfMatch проверяет заголовок If-Match на подходящих запросах. current
+// возвращает ETag текущего представления ресурса, пустую строку - если
+// ресурса нет, или ошибку (статус HTTP выводится из ее кода gRPC). При
+// несовпадении возвращается 412 Precondition Failed и запрос не выполняется.
+//
+// Проверка и выполнение запроса не атомарны: If-Match защищает от действий
+// по заведомо устаревшему состоянию, но не от одновременных изменений.
+func IfMatch(match func(*http.Request) bool, current func(*http.Request) (string, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			condition := r.Header.Get("If-Match")
+			if condition == "" || !match(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			tag, err := current(r)
+			if err != nil {
+				log.Printf("Failed to resolve ETag for If-Match: %v", err)
+				apierror.WriteProblem(w, r, err)
+				return
+			}
+
+			if !matches(condition, tag) {
+				if tag != "" {
+					w.Header().Set("ETag", tag)
+				}
+				apierror.WriteProblemStatus(w, r, http.StatusPreconditionFailed, apierror.New(codes.FailedPrecondition,
+					apierror.ReasonPreconditionFailed, "resource has changed since the ETag in If-Match was issued"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// matches сравнивает If-Match с текущим ETag (строгое сравнение, RFC 9110 13.1.1)
+func matches(condition, tag string) bool {
+	if tag == "" {
+		return false
+	}
+	if strings.TrimSpace(condition) == "*" {
+		return true
+	}
+	for _, candidate := range splitTags(condition) {
+		if !strings.HasPrefix(candidate, "W/") && candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// noneMatch проверяет If-None-Match (слабое сравнение, RFC 9110 13.1.2)
+func noneMatch(condition, tag string) bool {
+	if condition == "" {
+		return false
+	}
+	if strings.TrimSpace(condition) == "*" {
+		return true
+	}
+	for _, candidate := range splitTags(condition) {
+		if strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTags разбирает список ETag через запятую
+func splitTags(header string) []string {
+	var tags []string
+	for _, part := range strings.Split(header, ",") {
+		if tag := strings.TrimSpace(part); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// recorder буферизует ответ для вычисления ETag
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.wrote {
+		r.status = status
+		r.wrote = true
+	}
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.wrote = true
+	return r.body.Write(b)
+}
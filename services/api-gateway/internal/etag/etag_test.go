@@ -0,0 +1,113 @@
+package etag
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMiddleware_NotModified(t *testing.T) {
+	body := `{"devices":[]}`
+	status := http.StatusOK
+	handler := Middleware(func(r *http.Request) bool { return true })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/devices", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("")
+	tag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || rec.Body.String() != body || tag != Compute([]byte(body)) {
+		t.Fatalf("Unexpected first response: %d %q %s", rec.Code, tag, rec.Body.String())
+	}
+	if rec.Header().Get("Cache-Control") != "private, no-cache" {
+		t.Errorf("Unexpected Cache-Control %q", rec.Header().Get("Cache-Control"))
+	}
+
+	for _, condition := range []string{tag, `"other", ` + tag, "W/" + tag, "*"} {
+		rec = get(condition)
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 || rec.Header().Get("ETag") != tag {
+			t.Errorf("If-None-Match %s: expected empty 304, got %d %q", condition, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Изменившееся тело получает новый ETag
+	body = `{"devices":[{"id":"lamp-1"}]}`
+	if rec = get(tag); rec.Code != http.StatusOK || rec.Header().Get("ETag") == tag {
+		t.Errorf("Expected 200 with a new ETag, got %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	// Ошибки передаются без ETag
+	status = http.StatusNotFound
+	if rec = get(tag); rec.Code != http.StatusNotFound || rec.Header().Get("ETag") != "" {
+		t.Errorf("Expected 404 without ETag, got %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	current := `"v1"`
+	var resolveErr error
+	executed := 0
+
+	handler := IfMatch(func(r *http.Request) bool { return true }, func(r *http.Request) (string, error) {
+		return current, resolveErr
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		executed++
+	}))
+
+	post := func(ifMatch string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/devices/lamp-1/control", nil)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		current string
+		want    int
+	}{
+		{"no header", "", `"v1"`, http.StatusOK},
+		{"match", `"v1"`, `"v1"`, http.StatusOK},
+		{"one of list", `"v0", "v1"`, `"v1"`, http.StatusOK},
+		{"any", "*", `"v1"`, http.StatusOK},
+		{"stale", `"v0"`, `"v1"`, http.StatusPreconditionFailed},
+		{"weak never matches", `W/"v1"`, `"v1"`, http.StatusPreconditionFailed},
+		{"missing resource", "*", "", http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current = tt.current
+			executed = 0
+			if got := post(tt.ifMatch); got != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, got)
+			}
+			if wantExecuted := tt.want == http.StatusOK; (executed == 1) != wantExecuted {
+				t.Errorf("Handler executed %d times", executed)
+			}
+		})
+	}
+
+	resolveErr = status.Error(codes.Unavailable, "device service unavailable")
+	if got := post(`"v1"`); got != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when ETag cannot be resolved, got %d", got)
+	}
+}
@@ -0,0 +1,152 @@
+package gql
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/drain"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/ratelimit"
+	"google.golang.org/grpc/codes"
+)
+
+//go:embed schema.graphql
+var schemaSDL string
+
+// maxRequestSize ограничивает размер тела GraphQL-запроса
+const maxRequestSize = 1 << 20
+
+// Config содержит зависимости GraphQL API
+type Config struct {
+	AuthClient   smarthomev1.AuthServiceClient
+	DeviceClient smarthomev1.DeviceServiceClient
+	VoiceClient  smarthomev1.VoiceServiceClient
+	Statuses     StatusSource       // Источник обновлений для подписок
+	Upgrader     websocket.Upgrader // Настройки WebSocket для подписок
+	Drainer      *drain.Drainer     // Закрывает подписки при остановке шлюза (nil - не отслеживать)
+
+	// Лимит управления устройствами списывается за каждую мутацию controlDevice
+	Limiter       ratelimit.Limiter
+	ControlPolicy ratelimit.Policy
+}
+
+// Server обслуживает GraphQL API поверх gRPC-клиентов шлюза
+type Server struct {
+	schema   *graphql.Schema
+	device   smarthomev1.DeviceServiceClient
+	upgrader websocket.Upgrader
+	drainer  *drain.Drainer
+}
+
+// NewServer разбирает схему и создает GraphQL-сервер
+func NewServer(config Config) (*Server, error) {
+	schema, err := graphql.ParseSchema(schemaSDL, &resolver{
+		auth:          config.AuthClient,
+		device:        config.DeviceClient,
+		voice:         config.VoiceClient,
+		statuses:      config.Statuses,
+		limiter:       config.Limiter,
+		controlPolicy: config.ControlPolicy,
+	},
+		graphql.UseStringDescriptions(),
+		graphql.MaxDepth(10),
+		graphql.MaxParallelism(50),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	upgrader := config.Upgrader
+	upgrader.Subprotocols = []string{protocolTransportWS, protocolLegacyWS}
+
+	return &Server{
+		schema:   schema,
+		device:   config.DeviceClient,
+		upgrader: upgrader,
+		drainer:  config.Drainer,
+	}, nil
+}
+
+// Handler возвращает обработчик /graphql. WebSocket-подключения обслуживаются
+// по протоколу graphql-ws и проверяют токен из connection_init, остальные
+// запросы проходят через цепочку protect (проверка JWT, лимиты).
+func (s *Server) Handler(protect func(http.Handler) http.Handler) http.Handler {
+	httpHandler := protect(http.HandlerFunc(s.serveHTTP))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			s.serveWebSocket(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+}
+
+// request - GraphQL-запрос в формате GraphQL over HTTP
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// serveHTTP выполняет запрос или пакет запросов (JSON-массив). Все запросы
+// пакета используют общий загрузчик устройств.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		apierror.WriteProblemStatus(w, r, http.StatusMethodNotAllowed, apierror.New(codes.Unimplemented,
+			apierror.ReasonMethodNotAllowed, "GraphQL queries must be sent with POST"))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		apierror.WriteProblem(w, r, apierror.New(codes.InvalidArgument, apierror.ReasonValidationFailed, "failed to read request body"))
+		return
+	}
+
+	batch := bytes.HasPrefix(bytes.TrimSpace(body), []byte("["))
+
+	var requests []request
+	if batch {
+		err = json.Unmarshal(body, &requests)
+	} else {
+		requests = make([]request, 1)
+		err = json.Unmarshal(body, &requests[0])
+	}
+	if err != nil {
+		apierror.WriteProblem(w, r, apierror.New(codes.InvalidArgument, apierror.ReasonValidationFailed, "invalid GraphQL request: "+err.Error()))
+		return
+	}
+
+	ctx := withLoader(r.Context(), newDeviceLoader(s.device))
+	ctx = withToken(ctx, requestToken(r))
+	ctx = withRequest(ctx, r)
+
+	responses := make([]*graphql.Response, len(requests))
+	for i, req := range requests {
+		responses[i] = s.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if batch {
+		json.NewEncoder(w).Encode(responses)
+		return
+	}
+	json.NewEncoder(w).Encode(responses[0])
+}
+
+// requestToken возвращает JWT из заголовка Authorization или cookie jwt
+func requestToken(r *http.Request) string {
+	if token := jwtauth.TokenFromHeader(r); token != "" {
+		return token
+	}
+	return jwtauth.TokenFromCookie(r)
+}
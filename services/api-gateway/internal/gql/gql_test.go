@@ -0,0 +1,448 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/gorilla/websocket"
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal"
+	authMiddleware "github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/middleware"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeDeviceClient отвечает из фиксированного списка устройств и считает вызовы
+type fakeDeviceClient struct {
+	smarthomev1.DeviceServiceClient
+
+	devices   []*smarthomev1.Device
+	getCalls  int32
+	listCalls int32
+	commands  []*smarthomev1.ControlDeviceRequest
+}
+
+func (c *fakeDeviceClient) GetDevice(ctx context.Context, in *smarthomev1.DeviceId, opts ...grpc.CallOption) (*smarthomev1.GetDeviceResponse, error) {
+	atomic.AddInt32(&c.getCalls, 1)
+	for _, device := range c.devices {
+		if device.Id == in.Id {
+			return &smarthomev1.GetDeviceResponse{Device: device}, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "device with ID %s not found", in.Id)
+}
+
+func (c *fakeDeviceClient) ListDevices(ctx context.Context, in *smarthomev1.ListDevicesRequest, opts ...grpc.CallOption) (*smarthomev1.ListDevicesResponse, error) {
+	atomic.AddInt32(&c.listCalls, 1)
+	var devices []*smarthomev1.Device
+	for _, device := range c.devices {
+		if in.Type == "" || device.Type == in.Type {
+			devices = append(devices, device)
+		}
+	}
+	return &smarthomev1.ListDevicesResponse{Devices: devices, TotalCount: int32(len(devices))}, nil
+}
+
+func (c *fakeDeviceClient) ControlDevice(ctx context.Context, in *smarthomev1.ControlDeviceRequest, opts ...grpc.CallOption) (*smarthomev1.ControlDeviceResponse, error) {
+	c.commands = append(c.commands, in)
+	return &smarthomev1.ControlDeviceResponse{Success: true, Status: "Command executed successfully"}, nil
+}
+
+// fakeAuthClient имитирует Auth Service, который не выдавал тестовый токен
+type fakeAuthClient struct {
+	smarthomev1.AuthServiceClient
+}
+
+func (c *fakeAuthClient) ValidateToken(ctx context.Context, in *smarthomev1.ValidateTokenRequest, opts ...grpc.CallOption) (*smarthomev1.ValidateTokenResponse, error) {
+	return &smarthomev1.ValidateTokenResponse{Valid: false, Error: "unknown token"}, nil
+}
+
+// fakeStatuses - источник статусов для подписок
+type fakeStatuses struct {
+	mu   sync.Mutex
+	subs []chan internal.StatusEvent
+}
+
+func (s *fakeStatuses) Subscribe(lastID uint64, resume bool) ([]internal.StatusEvent, <-chan internal.StatusEvent, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan internal.StatusEvent, 8)
+	s.subs = append(s.subs, ch)
+	return nil, ch, func() {}
+}
+
+func (s *fakeStatuses) publish(event internal.StatusEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ch := range s.subs {
+		ch <- event
+	}
+}
+
+func (s *fakeStatuses) subscribers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subs)
+}
+
+func newTestServer(t *testing.T) (*Server, *fakeDeviceClient, *fakeStatuses) {
+	devices := &fakeDeviceClient{devices: []*smarthomev1.Device{
+		{Id: "lamp-1", Name: "Лампа", Type: "lamp", Room: "Кухня", Status: &smarthomev1.DeviceStatus{Online: true, Parameters: map[string]string{"power": "on"}}},
+		{Id: "lamp-2", Name: "Торшер", Type: "lamp", Room: "Спальня", Status: &smarthomev1.DeviceStatus{Online: false}},
+		{Id: "socket-1", Name: "Розетка", Type: "socket", Room: "Кухня", Status: &smarthomev1.DeviceStatus{Online: true}},
+	}}
+	statuses := &fakeStatuses{}
+
+	server, err := NewServer(Config{AuthClient: &fakeAuthClient{}, DeviceClient: devices, Statuses: statuses})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	return server, devices, statuses
+}
+
+func execute(t *testing.T, handler http.Handler, body string) map[string]interface{} {
+	t.Helper()
+
+	token, _ := authMiddleware.GenerateToken("user-1", "tester")
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if errs, ok := resp["errors"]; ok {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	return resp["data"].(map[string]interface{})
+}
+
+func protect(next http.Handler) http.Handler {
+	return jwtauth.Verifier(authMiddleware.TokenAuth)(authMiddleware.JWT(next))
+}
+
+func TestQuery_BatchesDeviceLookups(t *testing.T) {
+	server, devices, _ := newTestServer(t)
+	handler := server.Handler(protect)
+
+	data := execute(t, handler, `{"query": "{ a: device(id: \"lamp-1\") { name } b: device(id: \"socket-1\") { name } c: device(id: \"lamp-1\") { room } missing: device(id: \"nope\") { name } }"}`)
+
+	if got := data["a"].(map[string]interface{})["name"]; got != "Лампа" {
+		t.Errorf("Expected Лампа, got %v", got)
+	}
+	if data["missing"] != nil {
+		t.Errorf("Expected null for unknown device, got %v", data["missing"])
+	}
+	if devices.listCalls != 1 || devices.getCalls != 0 {
+		t.Errorf("Expected one batched ListDevices call, got list=%d get=%d", devices.listCalls, devices.getCalls)
+	}
+}
+
+func TestQuery_RoomsAndMe(t *testing.T) {
+	server, devices, _ := newTestServer(t)
+	handler := server.Handler(protect)
+
+	data := execute(t, handler, `{"query": "{ me { id username } rooms { name onlineCount devices { id } } devices(room: \"кухня\") { id } }"}`)
+
+	if me := data["me"].(map[string]interface{}); me["id"] != "user-1" || me["username"] != "tester" {
+		t.Errorf("Unexpected user: %v", me)
+	}
+
+	rooms := data["rooms"].([]interface{})
+	if len(rooms) != 2 {
+		t.Fatalf("Expected 2 rooms, got %v", rooms)
+	}
+	kitchen := rooms[0].(map[string]interface{})
+	if kitchen["name"] != "Кухня" || kitchen["onlineCount"] != float64(2) {
+		t.Errorf("Unexpected kitchen: %v", kitchen)
+	}
+	if got := len(data["devices"].([]interface{})); got != 2 {
+		t.Errorf("Expected 2 kitchen devices, got %d", got)
+	}
+
+	// rooms и devices используют один вызов ListDevices
+	if devices.listCalls != 1 {
+		t.Errorf("Expected one ListDevices call per request, got %d", devices.listCalls)
+	}
+}
+
+func TestMutation_ControlDevice(t *testing.T) {
+	server, devices, _ := newTestServer(t)
+	handler := server.Handler(protect)
+
+	data := execute(t, handler, `{"query": "mutation($id: ID!) { controlDevice(id: $id, command: {action: \"set_level\", parameters: [{key: \"level\", value: \"40\"}]}) { success device { name } } }", "variables": {"id": "lamp-1"}}`)
+
+	result := data["controlDevice"].(map[string]interface{})
+	if result["success"] != true {
+		t.Errorf("Expected success, got %v", result)
+	}
+	if len(devices.commands) != 1 {
+		t.Fatalf("Expected one ControlDevice call, got %d", len(devices.commands))
+	}
+	if cmd := devices.commands[0].Command; cmd.Action != "set_level" || cmd.Parameters["level"] != "40" {
+		t.Errorf("Unexpected command: %v", cmd)
+	}
+}
+
+func TestMutation_ControlDeviceRateLimit(t *testing.T) {
+	devices := &fakeDeviceClient{devices: []*smarthomev1.Device{{Id: "lamp-1", Type: "lamp"}}}
+	server, err := NewServer(Config{
+		AuthClient:    &fakeAuthClient{},
+		DeviceClient:  devices,
+		Statuses:      &fakeStatuses{},
+		Limiter:       ratelimit.NewMemoryLimiter(),
+		ControlPolicy: ratelimit.Policy{Name: "control", Rule: ratelimit.Rule{Limit: 2, Period: time.Minute}},
+	})
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	// Три мутации с псевдонимами в одном запросе списывают лимит трижды
+	token, _ := authMiddleware.GenerateToken("user-1", "tester")
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": "mutation { a: controlDevice(id: \"lamp-1\", command: {action: \"turn_on\"}) { success } b: controlDevice(id: \"lamp-1\", command: {action: \"turn_off\"}) { success } c: controlDevice(id: \"lamp-1\", command: {action: \"turn_on\"}) { success } }"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	server.Handler(protect).ServeHTTP(rec, req)
+
+	var resp struct {
+		Errors []struct {
+			Path       []interface{}          `json:"path"`
+			Extensions map[string]interface{} `json:"extensions"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Path[0] != "c" || resp.Errors[0].Extensions["reason"] != apierror.ReasonRateLimited {
+		t.Errorf("Expected RATE_LIMITED for the third mutation, got %s", rec.Body.String())
+	}
+	if len(devices.commands) != 2 {
+		t.Errorf("Expected 2 executed commands, got %d", len(devices.commands))
+	}
+}
+
+func TestHTTP_RequiresToken(t *testing.T) {
+	server, _, _ := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": "{ me { id } }"}`))
+	rec := httptest.NewRecorder()
+	server.Handler(protect).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", rec.Code)
+	}
+
+	var problem apierror.Problem
+	json.Unmarshal(rec.Body.Bytes(), &problem)
+	if rec.Header().Get("Content-Type") != apierror.ContentType || problem.Reason != apierror.ReasonTokenMissing {
+		t.Errorf("Expected TOKEN_MISSING problem, got %s %s", rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+}
+
+func TestSubscription_GraphQLWS(t *testing.T) {
+	server, _, statuses := newTestServer(t)
+	ts := httptest.NewServer(server.Handler(protect))
+	defer ts.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{protocolTransportWS}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/graphql", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	token, _ := authMiddleware.GenerateToken("user-1", "tester")
+	conn.WriteJSON(map[string]interface{}{
+		"type":    "connection_init",
+		"payload": map[string]string{"Authorization": "Bearer " + token},
+	})
+
+	var msg wsMessage
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "connection_ack" {
+		t.Fatalf("Expected connection_ack, got %+v (%v)", msg, err)
+	}
+
+	conn.WriteJSON(map[string]interface{}{
+		"id":   "1",
+		"type": "subscribe",
+		"payload": map[string]string{
+			"query": `subscription { deviceStatus(room: "Кухня") { deviceId device { name } status { online } } }`,
+		},
+	})
+
+	// Ждем, пока резолвер подпишется на источник статусов
+	for i := 0; statuses.subscribers() == 0; i++ {
+		if i > 100 {
+			t.Fatal("Subscription was not started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	statuses.publish(internal.StatusEvent{ID: 1, Status: &smarthomev1.StatusResponse{DeviceId: "lamp-2", Status: &smarthomev1.DeviceStatus{}}})
+	statuses.publish(internal.StatusEvent{ID: 2, Status: &smarthomev1.StatusResponse{DeviceId: "socket-1", Status: &smarthomev1.DeviceStatus{Online: true}}})
+
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "next" || msg.ID != "1" {
+		t.Fatalf("Expected next message, got %+v (%v)", msg, err)
+	}
+
+	var payload struct {
+		Data struct {
+			DeviceStatus struct {
+				DeviceID string `json:"deviceId"`
+				Device   struct {
+					Name string `json:"name"`
+				} `json:"device"`
+			} `json:"deviceStatus"`
+		} `json:"data"`
+	}
+	json.Unmarshal(msg.Payload, &payload)
+	if got := payload.Data.DeviceStatus; got.DeviceID != "socket-1" || got.Device.Name != "Розетка" {
+		t.Errorf("Expected event for kitchen socket, got %+v", got)
+	}
+}
+
+func TestSubscription_RejectsInvalidToken(t *testing.T) {
+	server, _, _ := newTestServer(t)
+	ts := httptest.NewServer(server.Handler(protect))
+	defer ts.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{protocolTransportWS}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/graphql", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"type":    "connection_init",
+		"payload": map[string]string{"Authorization": "Bearer invalid"},
+	})
+
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, closeForbidden) {
+		t.Errorf("Expected close code %d, got %v", closeForbidden, err)
+	}
+}
+
+// dialInit подключается к /graphql и проходит connection_init с токеном
+func dialInit(t *testing.T, url, token string) *websocket.Conn {
+	t.Helper()
+
+	dialer := websocket.Dialer{Subprotocols: []string{protocolTransportWS}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/graphql", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	conn.WriteJSON(map[string]interface{}{
+		"type":    "connection_init",
+		"payload": map[string]string{"Authorization": "Bearer " + token},
+	})
+
+	var msg wsMessage
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "connection_ack" {
+		t.Fatalf("Expected connection_ack, got %+v (%v)", msg, err)
+	}
+	return conn
+}
+
+func TestSubscription_RejectsMutation(t *testing.T) {
+	server, devices, _ := newTestServer(t)
+	ts := httptest.NewServer(server.Handler(protect))
+	defer ts.Close()
+
+	token, _ := authMiddleware.GenerateToken("user-1", "tester")
+	conn := dialInit(t, ts.URL, token)
+	defer conn.Close()
+
+	for id, query := range map[string]string{
+		"1": `mutation { controlDevice(id: "lamp-1", command: {action: "turn_on"}) { success } }`,
+		"2": `{ devices { id } }`,
+	} {
+		conn.WriteJSON(map[string]interface{}{
+			"id":      id,
+			"type":    "subscribe",
+			"payload": map[string]string{"query": query},
+		})
+
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil || msg.Type != "error" || msg.ID != id {
+			t.Fatalf("Expected error for %q, got %+v (%v)", query, msg, err)
+		}
+	}
+
+	if len(devices.commands) != 0 || atomic.LoadInt32(&devices.listCalls) != 0 {
+		t.Errorf("Operations must not run over WebSocket, got commands %v", devices.commands)
+	}
+}
+
+func TestSubscription_ClosesOnTokenExpiry(t *testing.T) {
+	server, _, _ := newTestServer(t)
+	ts := httptest.NewServer(server.Handler(protect))
+	defer ts.Close()
+
+	_, token, _ := authMiddleware.TokenAuth.Encode(map[string]interface{}{
+		"user_id": "user-1",
+		"exp":     time.Now().Add(time.Second).Unix(),
+	})
+	conn := dialInit(t, ts.URL, token)
+	defer conn.Close()
+
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, closeForbidden) {
+		t.Errorf("Expected close code %d after expiry, got %v", closeForbidden, err)
+	}
+}
+
+func TestOperationType(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		operation string
+		want      string
+	}{
+		{"shorthand", `{ me { id } }`, "", operationQuery},
+		{"subscription", `subscription { deviceStatus { deviceId } }`, "", operationSubscription},
+		{"mutation", `mutation Control($id: ID!) { controlDevice(id: $id, command: {action: "on"}) { success } }`, "", operationMutation},
+		{"named", `subscription S { deviceStatus { deviceId } } mutation M { controlDevice(id: "1", command: {action: "on"}) { success } }`, "M", operationMutation},
+		{"ambiguous", `subscription S { deviceStatus { deviceId } } mutation M { x }`, "", ""},
+		{"unknown name", `subscription S { deviceStatus { deviceId } }`, "M", ""},
+		{"fragment", `fragment F on Device { id } subscription { deviceStatus { device { ...F } } }`, "", operationSubscription},
+		{"directive", `subscription @live { deviceStatus { deviceId } }`, "", operationSubscription},
+		{"comment", "# subscription\nmutation { controlDevice }", "", operationMutation},
+		{"string", `mutation { controlDevice(id: "} subscription {") { success } }`, "", operationMutation},
+		{"block string", `mutation { controlDevice(id: """ \""" } subscription { """) { success } }`, "", operationMutation},
+		{"default object", `subscription($f: In = {a: 1}) { deviceStatus { deviceId } }`, "", operationSubscription},
+		{"same name", `subscription M { deviceStatus { deviceId } } mutation M { x }`, "M", ""},
+		{"unbalanced", `subscription { deviceStatus { deviceId }`, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := operationType(tt.query, tt.operation); got != tt.want {
+				t.Errorf("operationType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
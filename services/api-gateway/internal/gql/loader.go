@@ -0,0 +1,155 @@
+package gql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// batchWait - сколько загрузчик собирает идентификаторы перед запросом к Device Service.
+// Резолверы списков выполняются параллельно, поэтому за это время успевают
+// запросить устройства все элементы списка.
+const batchWait = 2 * time.Millisecond
+
+// deviceResult - результат загрузки одного устройства
+type deviceResult struct {
+	done   chan struct{}
+	device *smarthomev1.Device
+	err    error
+}
+
+// deviceLoader загружает устройства в рамках одного GraphQL-запроса: повторные
+// запросы одного устройства берутся из кэша, а запросы разных устройств,
+// пришедшие одновременно, объединяются в один вызов Device Service
+type deviceLoader struct {
+	client smarthomev1.DeviceServiceClient
+
+	mu      sync.Mutex
+	devices map[string]*deviceResult
+	pending []string
+
+	listOnce sync.Once
+	list     []*smarthomev1.Device
+	listErr  error
+}
+
+type loaderKey struct{}
+
+// newDeviceLoader создает загрузчик устройств
+func newDeviceLoader(client smarthomev1.DeviceServiceClient) *deviceLoader {
+	return &deviceLoader{
+		client:  client,
+		devices: make(map[string]*deviceResult),
+	}
+}
+
+// withLoader добавляет в контекст загрузчик, общий для всех резолверов запроса
+func withLoader(ctx context.Context, loader *deviceLoader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, loader)
+}
+
+// loaderFrom возвращает загрузчик запроса
+func loaderFrom(ctx context.Context, client smarthomev1.DeviceServiceClient) *deviceLoader {
+	if loader, ok := ctx.Value(loaderKey{}).(*deviceLoader); ok {
+		return loader
+	}
+	return newDeviceLoader(client)
+}
+
+// Load возвращает устройство по идентификатору или nil, если устройство не найдено
+func (l *deviceLoader) Load(ctx context.Context, id string) (*smarthomev1.Device, error) {
+	l.mu.Lock()
+	result, ok := l.devices[id]
+	if !ok {
+		result = &deviceResult{done: make(chan struct{})}
+		l.devices[id] = result
+
+		// Первый идентификатор пакета запускает таймер отправки
+		if len(l.pending) == 0 {
+			time.AfterFunc(batchWait, func() { l.dispatch(ctx) })
+		}
+		l.pending = append(l.pending, id)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-result.done:
+		return result.device, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// List возвращает все устройства. Результат запрашивается один раз за запрос
+// и заполняет кэш загрузчика.
+func (l *deviceLoader) List(ctx context.Context) ([]*smarthomev1.Device, error) {
+	l.listOnce.Do(func() {
+		resp, err := l.client.ListDevices(ctx, &smarthomev1.ListDevicesRequest{})
+		if err != nil {
+			l.listErr = err
+			return
+		}
+		l.list = resp.Devices
+		l.Prime(resp.Devices...)
+	})
+	return l.list, l.listErr
+}
+
+// Prime добавляет в кэш уже полученные устройства
+func (l *deviceLoader) Prime(devices ...*smarthomev1.Device) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, device := range devices {
+		if _, ok := l.devices[device.Id]; ok {
+			continue
+		}
+		result := &deviceResult{done: make(chan struct{}), device: device}
+		close(result.done)
+		l.devices[device.Id] = result
+	}
+}
+
+// dispatch загружает накопленный пакет: одно устройство - через GetDevice,
+// несколько - одним вызовом ListDevices
+func (l *deviceLoader) dispatch(ctx context.Context) {
+	l.mu.Lock()
+	ids := l.pending
+	l.pending = nil
+	results := make([]*deviceResult, len(ids))
+	for i, id := range ids {
+		results[i] = l.devices[id]
+	}
+	l.mu.Unlock()
+
+	if len(ids) == 1 {
+		resp, err := l.client.GetDevice(ctx, &smarthomev1.DeviceId{Id: ids[0]})
+		switch {
+		case status.Code(err) == codes.NotFound:
+		case err != nil:
+			results[0].err = err
+		default:
+			results[0].device = resp.Device
+		}
+		close(results[0].done)
+		return
+	}
+
+	resp, err := l.client.ListDevices(ctx, &smarthomev1.ListDevicesRequest{})
+	byID := make(map[string]*smarthomev1.Device)
+	if err == nil {
+		for _, device := range resp.Devices {
+			byID[device.Id] = device
+		}
+	}
+
+	for i, id := range ids {
+		results[i].device = byID[id]
+		results[i].err = err
+		close(results[i].done)
+	}
+}
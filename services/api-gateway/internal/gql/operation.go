@@ -0,0 +1,137 @@
+package gql
+
+import "strings"
+
+// Типы операций GraphQL
+const (
+	operationQuery        = "query"
+	operationMutation     = "mutation"
+	operationSubscription = "subscription"
+)
+
+// operationType возвращает тип операции operationName в документе query.
+// Пустое имя выбирает единственную операцию документа. Если операцию
+// не удалось однозначно определить, возвращается пустая строка.
+//
+// graphql-go не экспортирует разбор запроса, поэтому документ просматривается
+// по лексемам верхнего уровня: строки, комментарии и вложенные скобки
+// (тело операции, переменные, аргументы директив) пропускаются.
+func operationType(query, operationName string) string {
+	var (
+		types    = make(map[string]string) // Имя операции -> тип
+		count    int
+		depth    int
+		kind     string // Тип текущего определения, "" - вне определения
+		named    bool   // Имя текущего определения уже прочитано или его нет
+		fragment bool
+	)
+
+	for i := 0; i < len(query); {
+		ch := query[i]
+		switch {
+		case ch == '#':
+			for i < len(query) && query[i] != '\n' && query[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], `"""`):
+			i += 3
+			for i < len(query) && !strings.HasPrefix(query[i:], `"""`) {
+				if strings.HasPrefix(query[i:], `\"""`) {
+					i += 3
+				}
+				i++
+			}
+			if i >= len(query) {
+				return ""
+			}
+			i += 3
+		case ch == '"':
+			i++
+			for i < len(query) && query[i] != '"' {
+				if query[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(query) {
+				return ""
+			}
+			i++
+		case ch == '{' || ch == '(' || ch == '[':
+			if depth == 0 && kind == "" && !fragment {
+				// Сокращенная запись запроса без ключевого слова
+				kind, named = operationQuery, true
+				types[""] = kind
+				count++
+			}
+			if depth == 0 {
+				named = true
+			}
+			depth++
+			i++
+		case ch == '}' || ch == ')' || ch == ']':
+			depth--
+			if depth < 0 {
+				return ""
+			}
+			if depth == 0 && ch == '}' {
+				kind, fragment = "", false
+			}
+			i++
+		case isNameStart(ch):
+			start := i
+			for i < len(query) && isNameChar(query[i]) {
+				i++
+			}
+			if depth > 0 {
+				continue
+			}
+			name := query[start:i]
+			switch {
+			case kind == "" && !fragment:
+				switch name {
+				case operationQuery, operationMutation, operationSubscription:
+					kind, named = name, false
+					types[""] = kind
+					count++
+				case "fragment":
+					fragment = true
+				default:
+					return ""
+				}
+			case kind != "" && !named:
+				if start > 0 && query[start-1] == '@' {
+					named = true
+					continue
+				}
+				if prev, ok := types[name]; ok && prev != kind {
+					// Одинаковые имена у операций разных типов
+					return ""
+				}
+				types[name] = kind
+				named = true
+			}
+		default:
+			i++
+		}
+	}
+
+	if depth != 0 || kind != "" || fragment {
+		return ""
+	}
+	if operationName == "" {
+		if count != 1 {
+			return ""
+		}
+		return types[""]
+	}
+	return types[operationName]
+}
+
+func isNameStart(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
+
+func isNameChar(ch byte) bool {
+	return isNameStart(ch) || ch >= '0' && ch <= '9'
+}
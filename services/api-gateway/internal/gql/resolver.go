@@ -0,0 +1,542 @@
+package gql
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/jwtauth/v5"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal"
+	authMiddleware "github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/middleware"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/ratelimit"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// rpcError передает клиенту сообщение, код и причину ошибки gRPC
+type rpcError struct {
+	err *apierror.Error
+}
+
+func (e rpcError) Error() string {
+	return e.err.Message
+}
+
+// Extensions добавляет код gRPC и причину из ErrorInfo в поле extensions ошибки GraphQL
+func (e rpcError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{
+		"code":   e.err.Code.String(),
+		"reason": e.err.Reason,
+		"domain": apierror.Domain,
+	}
+	if len(e.err.Metadata) > 0 {
+		extensions["metadata"] = e.err.Metadata
+	}
+	if len(e.err.Violations) > 0 {
+		extensions["invalid_params"] = e.err.Violations
+	}
+	return extensions
+}
+
+// wrapError преобразует ошибку gRPC-клиента в ошибку GraphQL
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return rpcError{err: apierror.FromError(err)}
+	}
+	return err
+}
+
+type tokenKey struct{}
+
+// withToken сохраняет в контексте исходный JWT для запросов к Auth Service
+func withToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+type requestKey struct{}
+
+// withRequest сохраняет в контексте HTTP-запрос, по клиенту которого
+// списываются лимиты мутаций
+func withRequest(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, r)
+}
+
+// resolver - корневой резолвер схемы
+type resolver struct {
+	auth     smarthomev1.AuthServiceClient
+	device   smarthomev1.DeviceServiceClient
+	voice    smarthomev1.VoiceServiceClient
+	statuses StatusSource
+
+	limiter       ratelimit.Limiter
+	controlPolicy ratelimit.Policy
+}
+
+// Me возвращает текущего пользователя. Данные запрашиваются у Auth Service,
+// а для токенов, которые он не выдавал (например, /debug/token), берутся из JWT.
+func (r *resolver) Me(ctx context.Context) (*userResolver, error) {
+	if token, _ := ctx.Value(tokenKey{}).(string); token != "" {
+		resp, err := r.auth.ValidateToken(ctx, &smarthomev1.ValidateTokenRequest{AccessToken: token})
+		if err == nil && resp.Valid && resp.User != nil {
+			return &userResolver{user: resp.User}, nil
+		}
+	}
+
+	_, claims, err := jwtauth.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &smarthomev1.User{Id: authMiddleware.UserIDFromContext(ctx)}
+	for _, key := range []string{"username", "name"} {
+		if name, ok := claims[key].(string); ok && name != "" {
+			user.Username = name
+			break
+		}
+	}
+	if roles, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range roles {
+			if role, ok := role.(string); ok {
+				user.Roles = append(user.Roles, role)
+			}
+		}
+	}
+
+	return &userResolver{user: user}, nil
+}
+
+// Devices возвращает устройства с фильтрами по типу, онлайн-статусу и комнате
+func (r *resolver) Devices(ctx context.Context, args struct {
+	Type       *string
+	OnlineOnly *bool
+	Room       *string
+}) ([]*deviceResolver, error) {
+	loader := loaderFrom(ctx, r.device)
+
+	var devices []*smarthomev1.Device
+	if args.Type != nil || args.OnlineOnly != nil {
+		req := &smarthomev1.ListDevicesRequest{}
+		if args.Type != nil {
+			req.Type = *args.Type
+		}
+		if args.OnlineOnly != nil {
+			req.OnlineOnly = *args.OnlineOnly
+		}
+
+		resp, err := r.device.ListDevices(ctx, req)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		devices = resp.Devices
+		loader.Prime(devices...)
+	} else {
+		var err error
+		if devices, err = loader.List(ctx); err != nil {
+			return nil, wrapError(err)
+		}
+	}
+
+	var result []*deviceResolver
+	for _, device := range devices {
+		if args.Room != nil && !strings.EqualFold(device.Room, *args.Room) {
+			continue
+		}
+		result = append(result, &deviceResolver{device: device})
+	}
+	return result, nil
+}
+
+// Device возвращает устройство по идентификатору
+func (r *resolver) Device(ctx context.Context, args struct{ ID graphql.ID }) (*deviceResolver, error) {
+	device, err := loaderFrom(ctx, r.device).Load(ctx, string(args.ID))
+	if err != nil || device == nil {
+		return nil, wrapError(err)
+	}
+	return &deviceResolver{device: device}, nil
+}
+
+// Rooms группирует устройства по комнатам
+func (r *resolver) Rooms(ctx context.Context) ([]*roomResolver, error) {
+	devices, err := loaderFrom(ctx, r.device).List(ctx)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return groupRooms(devices), nil
+}
+
+// Room возвращает комнату по названию
+func (r *resolver) Room(ctx context.Context, args struct{ Name string }) (*roomResolver, error) {
+	rooms, err := r.Rooms(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, room := range rooms {
+		if strings.EqualFold(room.name, args.Name) {
+			return room, nil
+		}
+	}
+	return nil, nil
+}
+
+// Intents возвращает интенты голосового ассистента
+func (r *resolver) Intents(ctx context.Context) ([]*intentResolver, error) {
+	resp, err := r.voice.ListIntents(ctx, &smarthomev1.Empty{})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	result := make([]*intentResolver, 0, len(resp.Intents))
+	for _, intent := range resp.Intents {
+		result = append(result, &intentResolver{intent: intent})
+	}
+	return result, nil
+}
+
+type commandInput struct {
+	Action     string
+	Parameters *[]parameterInput
+}
+
+type parameterInput struct {
+	Key   string
+	Value string
+}
+
+// ControlDevice отправляет команду устройству
+func (r *resolver) ControlDevice(ctx context.Context, args struct {
+	ID      graphql.ID
+	Command commandInput
+}) (*controlResultResolver, error) {
+	if err := r.allowControl(ctx); err != nil {
+		return nil, err
+	}
+
+	command := &smarthomev1.Command{
+		DeviceId:   string(args.ID),
+		Action:     args.Command.Action,
+		Parameters: make(map[string]string),
+		Time:       timestamppb.Now(),
+	}
+	if args.Command.Parameters != nil {
+		for _, p := range *args.Command.Parameters {
+			command.Parameters[p.Key] = p.Value
+		}
+	}
+
+	resp, err := r.device.ControlDevice(ctx, &smarthomev1.ControlDeviceRequest{
+		Id:      string(args.ID),
+		Command: command,
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	return &controlResultResolver{resp: resp, id: string(args.ID), client: r.device}, nil
+}
+
+// allowControl списывает лимит управления устройствами за мутацию, как
+// пакетный эндпоинт за подзапрос control: в одном запросе может быть
+// много мутаций с псевдонимами
+func (r *resolver) allowControl(ctx context.Context) error {
+	if r.limiter == nil {
+		return nil
+	}
+	req, _ := ctx.Value(requestKey{}).(*http.Request)
+	if req == nil {
+		return rpcError{err: apierror.New(codes.Internal, apierror.ReasonInternal, "request is missing in context")}
+	}
+
+	result, err := ratelimit.Check(ctx, r.limiter, r.controlPolicy, req)
+	if err != nil {
+		// При недоступности хранилища лимитов не блокируем запросы
+		log.Printf("Rate limiter error for GraphQL control: %v", err)
+		return nil
+	}
+	if !result.Allowed {
+		return rpcError{err: ratelimit.LimitError(result)}
+	}
+	return nil
+}
+
+// DeviceStatus подписывает клиента на обновления статусов устройств
+func (r *resolver) DeviceStatus(ctx context.Context, args struct {
+	DeviceID *graphql.ID
+	Room     *string
+	Type     *string
+}) (<-chan *statusEventResolver, error) {
+	_, events, unsubscribe := r.statuses.Subscribe(0, false)
+	loader := loaderFrom(ctx, r.device)
+	out := make(chan *statusEventResolver)
+
+	go func() {
+		defer close(out)
+		defer unsubscribe()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+
+				st := event.Status
+				if args.DeviceID != nil && st.DeviceId != string(*args.DeviceID) {
+					continue
+				}
+
+				var device *smarthomev1.Device
+				if args.Room != nil || args.Type != nil {
+					var err error
+					if device, err = loader.Load(ctx, st.DeviceId); err != nil || device == nil {
+						continue
+					}
+					if args.Room != nil && !strings.EqualFold(device.Room, *args.Room) {
+						continue
+					}
+					if args.Type != nil && device.Type != *args.Type {
+						continue
+					}
+				}
+
+				select {
+				case out <- &statusEventResolver{event: event, loader: loader}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// StatusSource - источник обновлений статусов (internal.StatusHub)
+type StatusSource interface {
+	Subscribe(lastID uint64, resume bool) ([]internal.StatusEvent, <-chan internal.StatusEvent, func())
+}
+
+type userResolver struct {
+	user *smarthomev1.User
+}
+
+func (u *userResolver) ID() graphql.ID   { return graphql.ID(u.user.Id) }
+func (u *userResolver) Username() string { return u.user.Username }
+func (u *userResolver) Email() *string   { return optional(u.user.Email) }
+func (u *userResolver) Roles() []string  { return nonNil(u.user.Roles) }
+
+type deviceResolver struct {
+	device *smarthomev1.Device
+}
+
+func (d *deviceResolver) ID() graphql.ID { return graphql.ID(d.device.Id) }
+func (d *deviceResolver) Name() string   { return d.device.Name }
+func (d *deviceResolver) Type() string   { return d.device.Type }
+func (d *deviceResolver) Model() *string { return optional(d.device.Model) }
+func (d *deviceResolver) Room() *string  { return optional(d.device.Room) }
+func (d *deviceResolver) Tags() []string { return nonNil(d.device.Tags) }
+func (d *deviceResolver) Status() *statusResolver {
+	if d.device.Status == nil {
+		return nil
+	}
+	return &statusResolver{status: d.device.Status}
+}
+
+type statusResolver struct {
+	status *smarthomev1.DeviceStatus
+}
+
+func (s *statusResolver) Online() bool { return s.status.Online }
+
+func (s *statusResolver) Parameters() []*parameterResolver {
+	keys := make([]string, 0, len(s.status.Parameters))
+	for key := range s.status.Parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]*parameterResolver, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, &parameterResolver{key: key, value: s.status.Parameters[key]})
+	}
+	return result
+}
+
+func (s *statusResolver) Parameter(args struct{ Key string }) *string {
+	if value, ok := s.status.Parameters[args.Key]; ok {
+		return &value
+	}
+	return nil
+}
+
+func (s *statusResolver) BatteryLevel() *int32 {
+	if s.status.BatteryLevel == 0 {
+		return nil
+	}
+	return &s.status.BatteryLevel
+}
+
+func (s *statusResolver) SignalStrength() *float64 {
+	if s.status.SignalStrength == 0 {
+		return nil
+	}
+	value := float64(s.status.SignalStrength)
+	return &value
+}
+
+type parameterResolver struct {
+	key   string
+	value string
+}
+
+func (p *parameterResolver) Key() string   { return p.key }
+func (p *parameterResolver) Value() string { return p.value }
+
+type roomResolver struct {
+	name    string
+	devices []*smarthomev1.Device
+}
+
+// groupRooms группирует устройства по комнатам в порядке названий
+func groupRooms(devices []*smarthomev1.Device) []*roomResolver {
+	byName := make(map[string]*roomResolver)
+	var rooms []*roomResolver
+	for _, device := range devices {
+		if device.Room == "" {
+			continue
+		}
+		room, ok := byName[device.Room]
+		if !ok {
+			room = &roomResolver{name: device.Room}
+			byName[device.Room] = room
+			rooms = append(rooms, room)
+		}
+		room.devices = append(room.devices, device)
+	}
+
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].name < rooms[j].name })
+	return rooms
+}
+
+func (r *roomResolver) Name() string { return r.name }
+
+func (r *roomResolver) Devices() []*deviceResolver {
+	result := make([]*deviceResolver, 0, len(r.devices))
+	for _, device := range r.devices {
+		result = append(result, &deviceResolver{device: device})
+	}
+	return result
+}
+
+func (r *roomResolver) OnlineCount() int32 {
+	var count int32
+	for _, device := range r.devices {
+		if device.Status != nil && device.Status.Online {
+			count++
+		}
+	}
+	return count
+}
+
+type statusEventResolver struct {
+	event  internal.StatusEvent
+	loader *deviceLoader
+}
+
+func (e *statusEventResolver) DeviceID() graphql.ID { return graphql.ID(e.event.Status.DeviceId) }
+
+// Device возвращает метаданные устройства с текущим статусом из события
+func (e *statusEventResolver) Device(ctx context.Context) (*deviceResolver, error) {
+	device, err := e.loader.Load(ctx, e.event.Status.DeviceId)
+	if err != nil || device == nil {
+		return nil, wrapError(err)
+	}
+
+	device = proto.Clone(device).(*smarthomev1.Device)
+	device.Status = e.event.Status.Status
+	return &deviceResolver{device: device}, nil
+}
+
+func (e *statusEventResolver) Status() *statusResolver {
+	if e.event.Status.Status == nil {
+		return nil
+	}
+	return &statusResolver{status: e.event.Status.Status}
+}
+
+func (e *statusEventResolver) Deleted() bool { return e.event.Status.Deleted }
+
+func (e *statusEventResolver) Time() *graphql.Time {
+	if e.event.Status.Time == nil {
+		return nil
+	}
+	return &graphql.Time{Time: e.event.Status.Time.AsTime()}
+}
+
+type intentResolver struct {
+	intent *smarthomev1.IntentDefinition
+}
+
+func (i *intentResolver) Name() string         { return i.intent.Name }
+func (i *intentResolver) Description() *string { return optional(i.intent.Description) }
+func (i *intentResolver) Examples() []string   { return nonNil(i.intent.Examples) }
+func (i *intentResolver) Entities() []*entityResolver {
+	result := make([]*entityResolver, 0, len(i.intent.Entities))
+	for _, entity := range i.intent.Entities {
+		result = append(result, &entityResolver{entity: entity})
+	}
+	return result
+}
+
+type entityResolver struct {
+	entity *smarthomev1.EntityDefinition
+}
+
+func (e *entityResolver) Name() string         { return e.entity.Name }
+func (e *entityResolver) Description() *string { return optional(e.entity.Description) }
+
+type controlResultResolver struct {
+	resp   *smarthomev1.ControlDeviceResponse
+	id     string
+	client smarthomev1.DeviceServiceClient
+}
+
+func (c *controlResultResolver) Success() bool   { return c.resp.Success }
+func (c *controlResultResolver) Status() *string { return optional(c.resp.Status) }
+func (c *controlResultResolver) Error() *string  { return optional(c.resp.Error) }
+
+// Device запрашивает устройство заново, минуя кэш запроса: состояние изменилось
+func (c *controlResultResolver) Device(ctx context.Context) (*deviceResolver, error) {
+	resp, err := c.client.GetDevice(ctx, &smarthomev1.DeviceId{Id: c.id})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return &deviceResolver{device: resp.Device}, nil
+}
+
+// optional возвращает nil для пустой строки
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// nonNil заменяет nil-срез пустым для non-null списков
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,316 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+	authMiddleware "github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/middleware"
+)
+
+// Подпротоколы WebSocket: graphql-transport-ws используется библиотекой graphql-ws,
+// graphql-ws - устаревший протокол subscriptions-transport-ws (Apollo)
+const (
+	protocolTransportWS = "graphql-transport-ws"
+	protocolLegacyWS    = "graphql-ws"
+)
+
+const (
+	// initTimeout - время ожидания connection_init после подключения
+	initTimeout = 10 * time.Second
+	// keepAliveInterval - период сообщений ka в устаревшем протоколе
+	keepAliveInterval = 15 * time.Second
+	// writeTimeout - максимальное время записи сообщения клиенту
+	writeTimeout = 10 * time.Second
+)
+
+// Коды закрытия соединения протокола graphql-transport-ws
+const (
+	closeUnauthorized        = 4401
+	closeForbidden           = 4403
+	closeInitTimeout         = 4408
+	closeSubscriberExists    = 4409
+	closeTooManyInitRequests = 4429
+	closeBadRequest          = 4400
+)
+
+// wsMessage - сообщение протоколов graphql-ws
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsConn - WebSocket-соединение с активными подписками
+type wsConn struct {
+	server *Server
+	conn   *websocket.Conn
+	legacy bool
+
+	writeMu sync.Mutex
+
+	mu   sync.Mutex
+	subs map[string]context.CancelFunc
+}
+
+// serveWebSocket обслуживает подписки по протоколу graphql-ws
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade GraphQL connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	if s.drainer != nil {
+		release, ok := s.drainer.Track(conn)
+		defer release()
+		if !ok {
+			return
+		}
+	}
+
+	c := &wsConn{
+		server: s,
+		conn:   conn,
+		legacy: conn.Subprotocol() == protocolLegacyWS,
+		subs:   make(map[string]context.CancelFunc),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer c.stopAll()
+
+	ctx, ok := c.init(ctx, r)
+	if !ok {
+		return
+	}
+
+	// Соединение живет не дольше токена из connection_init
+	if token, _, err := jwtauth.FromContext(ctx); err == nil && !token.Expiration().IsZero() {
+		timer := time.AfterFunc(time.Until(token.Expiration()), func() {
+			c.close(closeForbidden, "Token expired")
+			conn.Close()
+		})
+		defer timer.Stop()
+	}
+
+	if c.legacy {
+		go c.keepAlive(ctx)
+	}
+
+	for {
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("GraphQL WebSocket read error: %v", err)
+			}
+			return
+		}
+
+		switch msg.Type {
+		case "subscribe", "start":
+			if !c.subscribe(ctx, msg) {
+				return
+			}
+		case "complete", "stop":
+			c.remove(msg.ID)
+		case "ping":
+			c.write(wsMessage{Type: "pong", Payload: msg.Payload})
+		case "pong":
+		case "connection_terminate":
+			return
+		case "connection_init":
+			c.close(closeTooManyInitRequests, "Too many initialisation requests")
+			return
+		default:
+			c.close(closeBadRequest, "Unknown message type "+msg.Type)
+			return
+		}
+	}
+}
+
+// init ожидает connection_init и проверяет токен из его payload
+// (поле Authorization или token) или из заголовков запроса на подключение
+func (c *wsConn) init(ctx context.Context, r *http.Request) (context.Context, bool) {
+	c.conn.SetReadDeadline(time.Now().Add(initTimeout))
+
+	var msg wsMessage
+	if err := c.conn.ReadJSON(&msg); err != nil {
+		c.close(closeInitTimeout, "Connection initialisation timeout")
+		return ctx, false
+	}
+	c.conn.SetReadDeadline(time.Time{})
+
+	if msg.Type != "connection_init" {
+		c.close(closeUnauthorized, "Unauthorized")
+		return ctx, false
+	}
+
+	raw := requestToken(r)
+	var payload map[string]interface{}
+	if len(msg.Payload) > 0 && json.Unmarshal(msg.Payload, &payload) == nil {
+		for _, key := range []string{"Authorization", "authorization", "token"} {
+			if value, ok := payload[key].(string); ok && value != "" {
+				raw = strings.TrimSpace(strings.TrimPrefix(value, "Bearer "))
+				break
+			}
+		}
+	}
+
+	// VerifyToken проверяет и срок действия токена
+	token, err := jwtauth.VerifyToken(authMiddleware.TokenAuth, raw)
+	if err != nil {
+		c.close(closeForbidden, "Forbidden")
+		return ctx, false
+	}
+
+	ctx = jwtauth.NewContext(ctx, token, nil)
+	ctx = withToken(ctx, raw)
+
+	c.write(wsMessage{Type: "connection_ack"})
+	return ctx, true
+}
+
+// subscribe запускает операцию. Возвращает false, если соединение нужно закрыть.
+func (c *wsConn) subscribe(ctx context.Context, msg wsMessage) bool {
+	var req request
+	if msg.ID == "" || json.Unmarshal(msg.Payload, &req) != nil {
+		c.close(closeBadRequest, "Invalid subscribe message")
+		return false
+	}
+
+	// Запросы и мутации выполняются по HTTP, где к ним применяются лимиты
+	// и Idempotency-Key. По WebSocket принимаются только подписки.
+	if operationType(req.Query, req.OperationName) != operationSubscription {
+		payload, _ := json.Marshal([]map[string]string{{"message": "only subscription operations are allowed over WebSocket"}})
+		c.write(wsMessage{ID: msg.ID, Type: "error", Payload: payload})
+		return true
+	}
+
+	c.mu.Lock()
+	if _, exists := c.subs[msg.ID]; exists {
+		c.mu.Unlock()
+		c.close(closeSubscriberExists, "Subscriber for "+msg.ID+" already exists")
+		return false
+	}
+	// Каждая подписка получает свой загрузчик: метаданные устройств кэшируются
+	// на время подписки, как и в SSE
+	subCtx, cancel := context.WithCancel(withLoader(ctx, newDeviceLoader(c.server.device)))
+	c.subs[msg.ID] = cancel
+	c.mu.Unlock()
+
+	responses, err := c.server.schema.Subscribe(subCtx, req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		c.remove(msg.ID)
+		payload, _ := json.Marshal([]map[string]string{{"message": err.Error()}})
+		c.write(wsMessage{ID: msg.ID, Type: "error", Payload: payload})
+		return true
+	}
+
+	go c.forward(subCtx, msg.ID, responses)
+	return true
+}
+
+// forward отправляет клиенту результаты операции до ее завершения
+func (c *wsConn) forward(ctx context.Context, id string, responses <-chan interface{}) {
+	first := true
+	for r := range responses {
+		// Канал вычитывается до конца, чтобы не блокировать исполнитель GraphQL
+		if ctx.Err() != nil {
+			continue
+		}
+
+		resp, ok := r.(*graphql.Response)
+		if !ok {
+			continue
+		}
+
+		// Ошибки разбора и валидации отправляются сообщением error
+		if first && resp.Data == nil && len(resp.Errors) > 0 {
+			payload, _ := json.Marshal(resp.Errors)
+			c.write(wsMessage{ID: id, Type: "error", Payload: payload})
+			c.remove(id)
+			return
+		}
+		first = false
+
+		payload, _ := json.Marshal(resp)
+		msgType := "next"
+		if c.legacy {
+			msgType = "data"
+		}
+		c.write(wsMessage{ID: id, Type: msgType, Payload: payload})
+	}
+
+	// Подписка завершена сервером, а не клиентом
+	if c.remove(id) {
+		c.write(wsMessage{ID: id, Type: "complete"})
+	}
+}
+
+// remove отменяет и удаляет подписку. Возвращает false, если ее уже удалили.
+func (c *wsConn) remove(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cancel, ok := c.subs[id]
+	if ok {
+		cancel()
+		delete(c.subs, id)
+	}
+	return ok
+}
+
+// stopAll отменяет все подписки соединения
+func (c *wsConn) stopAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, cancel := range c.subs {
+		cancel()
+		delete(c.subs, id)
+	}
+}
+
+// keepAlive периодически отправляет ka в устаревшем протоколе
+func (c *wsConn) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.write(wsMessage{Type: "ka"}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// write отправляет сообщение клиенту
+func (c *wsConn) write(msg wsMessage) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.conn.WriteJSON(msg)
+}
+
+// close закрывает соединение с кодом протокола
+func (c *wsConn) close(code int, reason string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason), time.Now().Add(writeTimeout))
+}
@@ -0,0 +1,33 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// PendingTTL - время жизни записи о запросе, который еще выполняется.
+// Если экземпляр шлюза упадет во время запроса, ключ освободится через это время.
+const PendingTTL = time.Minute
+
+// Record хранит результат запроса с ключом идемпотентности
+type Record struct {
+	Fingerprint string      `json:"fingerprint"`      // Хэш метода, пути и тела запроса
+	Completed   bool        `json:"completed"`        // false - запрос еще выполняется
+	Status      int         `json:"status,omitempty"` // Код ответа
+	Header      http.Header `json:"header,omitempty"` // Заголовки, выставленные обработчиком
+	Body        []byte      `json:"body,omitempty"`   // Тело ответа
+}
+
+// Store хранит записи ключей идемпотентности
+type Store interface {
+	// Reserve атомарно создает незавершенную запись, если ключ свободен.
+	// Если ключ занят, возвращает существующую запись и false.
+	Reserve(ctx context.Context, key string, rec Record, ttl time.Duration) (Record, bool, error)
+
+	// Complete сохраняет результат запроса на время ttl
+	Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error
+
+	// Release удаляет запись, чтобы запрос можно было выполнить повторно
+	Release(ctx context.Context, key string) error
+}
@@ -0,0 +1,176 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	authMiddleware "github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/middleware"
+)
+
+func TestMemoryStore_Expiration(t *testing.T) {
+	now := time.Unix(1714580400, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, reserved, _ := store.Reserve(ctx, "u:k", Record{Fingerprint: "a"}, time.Minute); !reserved {
+		t.Fatal("Expected first reservation to succeed")
+	}
+	existing, reserved, _ := store.Reserve(ctx, "u:k", Record{Fingerprint: "b"}, time.Minute)
+	if reserved || existing.Fingerprint != "a" {
+		t.Fatalf("Expected existing record, got reserved=%v record=%+v", reserved, existing)
+	}
+
+	now = now.Add(time.Minute)
+	if _, reserved, _ := store.Reserve(ctx, "u:k", Record{Fingerprint: "b"}, time.Minute); !reserved {
+		t.Error("Expected reservation after expiration to succeed")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	store := NewMemoryStore()
+	calls := 0
+	status := http.StatusOK
+
+	handler := jwtauth.Verifier(authMiddleware.TokenAuth)(
+		Middleware(store, time.Hour, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"success":true}`))
+		})))
+
+	send := func(userID, key, body string) *httptest.ResponseRecorder {
+		token, err := authMiddleware.GenerateToken(userID, "user")
+		if err != nil {
+			t.Fatalf("Failed to generate token: %v", err)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/devices/lamp/control", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(HeaderKey, key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("user-1", "key-1", `{"command":"on"}`)
+	if rec.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("Expected first request to reach handler, got %d (calls %d)", rec.Code, calls)
+	}
+
+	// Повтор возвращает сохраненный ответ без вызова обработчика
+	rec = send("user-1", "key-1", `{"command":"on"}`)
+	if calls != 1 {
+		t.Fatalf("Expected duplicate to be replayed, handler called %d times", calls)
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"success":true}` {
+		t.Errorf("Unexpected replayed response: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get(HeaderReplayed) != "true" || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected replayed headers: %v", rec.Header())
+	}
+
+	// Тот же ключ с другим телом
+	if rec = send("user-1", "key-1", `{"command":"off"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for reused key, got %d", rec.Code)
+	}
+
+	// Ключи разных пользователей не пересекаются
+	if send("user-2", "key-1", `{"command":"on"}`); calls != 2 {
+		t.Errorf("Expected request of another user to reach handler, calls %d", calls)
+	}
+
+	// Ответы 5xx не сохраняются
+	status = http.StatusServiceUnavailable
+	send("user-1", "key-2", `{"command":"on"}`)
+	status = http.StatusOK
+	if rec = send("user-1", "key-2", `{"command":"on"}`); rec.Code != http.StatusOK || calls != 4 {
+		t.Errorf("Expected retry after 5xx to reach handler, got %d (calls %d)", rec.Code, calls)
+	}
+
+	// Запрос с тем же ключом еще выполняется
+	store.Reserve(context.Background(), "user-1:key-3", Record{Fingerprint: "pending"}, PendingTTL)
+	if rec = send("user-1", "key-3", `{"command":"on"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for pending key with another request, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware_InProgress(t *testing.T) {
+	store := NewMemoryStore()
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	handler := jwtauth.Verifier(authMiddleware.TokenAuth)(
+		Middleware(store, time.Hour, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		})))
+
+	token, _ := authMiddleware.GenerateToken("user-1", "user")
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/devices/lamp/control", strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(HeaderKey, "key-1")
+		return req
+	}
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), newRequest())
+		close(done)
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest())
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 while first request is in progress, got %d", rec.Code)
+	}
+
+	close(release)
+	<-done
+}
+
+// failingStore имитирует недоступное хранилище (например, Redis)
+type failingStore struct{}
+
+func (failingStore) Reserve(context.Context, string, Record, time.Duration) (Record, bool, error) {
+	return Record{}, false, errors.New("connection refused")
+}
+
+func (failingStore) Complete(context.Context, string, Record, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func (failingStore) Release(context.Context, string) error {
+	return errors.New("connection refused")
+}
+
+func TestMiddleware_StoreUnavailable(t *testing.T) {
+	calls := 0
+	handler := jwtauth.Verifier(authMiddleware.TokenAuth)(
+		Middleware(failingStore{}, time.Hour, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+		})))
+
+	token, _ := authMiddleware.GenerateToken("user-1", "user")
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/devices/lamp/control", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(HeaderKey, "key-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when the store is unavailable, got %d", rec.Code)
+	}
+	if calls != 0 {
+		t.Errorf("Handler called %d times, want 0", calls)
+	}
+}
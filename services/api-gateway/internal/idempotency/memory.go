@@ -0,0 +1,80 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cleanupInterval - как часто удаляются просроченные записи
+const cleanupInterval = time.Minute
+
+// entry хранит запись вместе со временем ее истечения
+type entry struct {
+	record  Record
+	expires time.Time
+}
+
+// MemoryStore хранит ключи идемпотентности в памяти одного экземпляра шлюза
+type MemoryStore struct {
+	mu          sync.Mutex
+	entries     map[string]entry
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+// NewMemoryStore создает новое хранилище в памяти
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]entry),
+		now:     time.Now,
+	}
+}
+
+// Reserve реализует Store
+func (s *MemoryStore) Reserve(_ context.Context, key string, rec Record, ttl time.Duration) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.cleanup(now)
+
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		return e.record, false, nil
+	}
+
+	s.entries[key] = entry{record: rec, expires: now.Add(ttl)}
+	return rec, true, nil
+}
+
+// Complete реализует Store
+func (s *MemoryStore) Complete(_ context.Context, key string, rec Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = entry{record: rec, expires: s.now().Add(ttl)}
+	return nil
+}
+
+// Release реализует Store
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// cleanup удаляет просроченные записи
+func (s *MemoryStore) cleanup(now time.Time) {
+	if now.Sub(s.lastCleanup) < cleanupInterval {
+		return
+	}
+	s.lastCleanup = now
+
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	authMiddleware "github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/middleware"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// HeaderKey - заголовок с ключом идемпотентности
+	HeaderKey = "Idempotency-Key"
+	// HeaderReplayed выставляется в ответах, повторенных из хранилища
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+	maxBodySize  = 1 << 20
+)
+
+// Middleware обеспечивает идемпотентность запросов с заголовком Idempotency-Key.
+// Первый ответ сохраняется на время ttl по ключу пользователь + ключ и
+// возвращается повторно на дубликаты. Ключ, повторно использованный с другим
+// запросом, отклоняется с 422. Ответы 5xx не сохраняются, чтобы запрос можно
+// было повторить после сбоя сервиса. При недоступности хранилища запрос
+// отклоняется с 503: без проверки ключа повтор выполнил бы команду дважды.
+func Middleware(store Store, ttl time.Duration, match func(*http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(HeaderKey)
+			userID := authMiddleware.UserID(r)
+			if key == "" || userID == "" || ttl <= 0 || (match != nil && !match(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > maxKeyLength {
+				apierror.WriteProblem(w, r, apierror.InvalidArgument("Idempotency-Key is too long",
+					apierror.FieldViolation{Field: HeaderKey, Description: fmt.Sprintf("must be at most %d characters", maxKeyLength)}))
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+			if err != nil {
+				apierror.WriteProblem(w, r, apierror.New(codes.InvalidArgument, apierror.ReasonValidationFailed, "failed to read request body"))
+				return
+			}
+			if len(body) > maxBodySize {
+				apierror.WriteProblemStatus(w, r, http.StatusRequestEntityTooLarge,
+					apierror.New(codes.InvalidArgument, apierror.ReasonValidationFailed, "request body is too large"))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			storeKey := userID + ":" + key
+			fingerprint := requestFingerprint(r, body)
+
+			// Результат сохраняем, даже если клиент уже отключился: именно
+			// такие запросы мобильное приложение и будет повторять
+			ctx := context.WithoutCancel(r.Context())
+
+			existing, reserved, err := store.Reserve(ctx, storeKey, Record{Fingerprint: fingerprint}, PendingTTL)
+			if err != nil {
+				log.Printf("Idempotency store error: %v", err)
+				w.Header().Set("Retry-After", "1")
+				apierror.WriteProblem(w, r, apierror.New(codes.Unavailable,
+					apierror.ReasonUnavailable, "idempotency store is unavailable"))
+				return
+			}
+
+			if !reserved {
+				switch {
+				case existing.Fingerprint != fingerprint:
+					apierror.WriteProblemStatus(w, r, http.StatusUnprocessableEntity, apierror.New(codes.InvalidArgument,
+						apierror.ReasonIdempotencyKeyReused, "Idempotency-Key was already used with a different request"))
+				case !existing.Completed:
+					w.Header().Set("Retry-After", "1")
+					apierror.WriteProblem(w, r, apierror.New(codes.Aborted,
+						apierror.ReasonIdempotencyKeyInFlight, "a request with this Idempotency-Key is in progress"))
+				default:
+					replay(w, existing)
+				}
+				return
+			}
+
+			rec := newRecorder(w)
+			completed := false
+			defer func() {
+				// Обработчик завершился паникой, ошибкой сервиса или результат
+				// не удалось сохранить - освобождаем ключ
+				if !completed {
+					if err := store.Release(ctx, storeKey); err != nil {
+						log.Printf("Idempotency store error: %v", err)
+					}
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+
+			if rec.status >= http.StatusInternalServerError {
+				return
+			}
+
+			err = store.Complete(ctx, storeKey, Record{
+				Fingerprint: fingerprint,
+				Completed:   true,
+				Status:      rec.status,
+				Header:      rec.handlerHeader(),
+				Body:        rec.body.Bytes(),
+			}, ttl)
+			if err != nil {
+				log.Printf("Idempotency store error: %v", err)
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// requestFingerprint вычисляет хэш метода, пути и тела запроса
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method)
+	h.Write([]byte{0})
+	io.WriteString(h, r.URL.Path)
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replay отправляет сохраненный ответ
+func replay(w http.ResponseWriter, rec Record) {
+	for k, values := range rec.Header {
+		w.Header()[k] = values
+	}
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
+
+// recorder передает ответ клиенту и одновременно сохраняет его
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	before      map[string]bool // Заголовки, выставленные до обработчика (например, X-RateLimit-*)
+}
+
+func newRecorder(w http.ResponseWriter) *recorder {
+	before := make(map[string]bool)
+	for k := range w.Header() {
+		before[k] = true
+	}
+	return &recorder{ResponseWriter: w, status: http.StatusOK, before: before}
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+// handlerHeader возвращает заголовки, выставленные обработчиком
+func (r *recorder) handlerHeader() http.Header {
+	header := make(http.Header)
+	for k, values := range r.Header() {
+		if !r.before[k] {
+			header[k] = values
+		}
+	}
+	return header
+}
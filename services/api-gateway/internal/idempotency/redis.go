@@ -0,0 +1,85 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStore хранит ключи идемпотентности в Redis, общем для нескольких экземпляров шлюза
+type RedisStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisStore создает хранилище поверх клиента Redis
+func NewRedisStore(client redis.Cmdable, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "idempotency:"
+	}
+
+	return &RedisStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Reserve реализует Store
+func (s *RedisStore) Reserve(ctx context.Context, key string, rec Record, ttl time.Duration) (Record, bool, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return Record{}, false, err
+	}
+
+	// Запись может истечь между SETNX и GET, тогда пробуем еще раз
+	for attempt := 0; attempt < 3; attempt++ {
+		ok, err := s.client.SetNX(ctx, s.prefix+key, data, ttl).Result()
+		if err != nil {
+			return Record{}, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+		}
+		if ok {
+			return rec, true, nil
+		}
+
+		existing, err := s.client.Get(ctx, s.prefix+key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return Record{}, false, fmt.Errorf("failed to get idempotency key: %w", err)
+		}
+
+		var stored Record
+		if err := json.Unmarshal(existing, &stored); err != nil {
+			return Record{}, false, fmt.Errorf("failed to decode idempotency record: %w", err)
+		}
+		return stored, false, nil
+	}
+
+	return Record{}, false, fmt.Errorf("failed to reserve idempotency key: too much contention")
+}
+
+// Complete реализует Store
+func (s *RedisStore) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.Set(ctx, s.prefix+key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store idempotency record: %w", err)
+	}
+	return nil
+}
+
+// Release реализует Store
+func (s *RedisStore) Release(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, s.prefix+key).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
@@ -1,11 +1,15 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/go-chi/jwtauth/v5"
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	"google.golang.org/grpc/codes"
 )
 
 var (
@@ -27,15 +31,15 @@ func JWT(next http.Handler) http.Handler {
 		token, claims, err := jwtauth.FromContext(r.Context())
 
 		if err != nil || token == nil {
-			http.Error(w, "Unauthorized: Missing or invalid token", http.StatusUnauthorized)
+			apierror.WriteProblem(w, r, tokenError(err))
 			return
 		}
 
-		// Проверяем срок действия токена
+		// Проверяем срок действия токена (jwtauth разбирает exp в time.Time)
 		if expClaim, exists := claims["exp"]; exists {
-			exp, ok := expClaim.(float64)
-			if !ok || float64(time.Now().Unix()) > exp {
-				http.Error(w, "Unauthorized: Token expired", http.StatusUnauthorized)
+			exp, ok := expClaim.(time.Time)
+			if !ok || time.Now().After(exp) {
+				apierror.WriteProblem(w, r, tokenError(jwtauth.ErrExpired))
 				return
 			}
 		}
@@ -45,6 +49,49 @@ func JWT(next http.Handler) http.Handler {
 	})
 }
 
+// tokenError возвращает ошибку 401 с причиной отказа в доступе
+func tokenError(err error) error {
+	switch {
+	case err == nil, errors.Is(err, jwtauth.ErrNoTokenFound):
+		return apierror.New(codes.Unauthenticated, apierror.ReasonTokenMissing, "authorization token is missing")
+	case errors.Is(err, jwtauth.ErrExpired):
+		return apierror.New(codes.Unauthenticated, apierror.ReasonTokenExpired, "authorization token has expired")
+	default:
+		return apierror.New(codes.Unauthenticated, apierror.ReasonTokenInvalid, "authorization token is invalid")
+	}
+}
+
+// RequireRole пропускает только пользователей, у которых в JWT (claim roles) есть роль role.
+// Подключается после JWT.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasRole(r.Context(), role) {
+				apierror.WriteProblem(w, r, apierror.Newf(codes.PermissionDenied, apierror.ReasonRoleRequired,
+					"%s role is required", role).WithMetadata("role", role))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HasRole проверяет наличие роли в проверенном JWT-токене из контекста
+func HasRole(ctx context.Context, role string) bool {
+	token, claims, err := jwtauth.FromContext(ctx)
+	if err != nil || token == nil {
+		return false
+	}
+
+	roles, _ := claims["roles"].([]interface{})
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 // isPublicPath определяет, требует ли путь аутентификацию
 func isPublicPath(path string) bool {
 	publicPaths := []string{
@@ -66,10 +113,14 @@ func isPublicPath(path string) bool {
 
 // Генерирует тестовый JWT-токен для отладки
 // В реальной системе токены будет генерировать auth-сервис
-func GenerateToken(userID string, username string) (string, error) {
+func GenerateToken(userID string, username string, roles ...string) (string, error) {
+	if len(roles) == 0 {
+		roles = []string{"user"}
+	}
 	claims := map[string]interface{}{
 		"user_id":  userID,
 		"username": username,
+		"roles":    roles,
 		"exp":      time.Now().Add(time.Hour * 24).Unix(),
 	}
 	_, tokenString, err := TokenAuth.Encode(claims)
@@ -79,3 +130,26 @@ func GenerateToken(userID string, username string) (string, error) {
 
 	return tokenString, nil
 }
+
+// UserID возвращает идентификатор пользователя из проверенного JWT-токена
+// или пустую строку для анонимного запроса
+func UserID(r *http.Request) string {
+	return UserIDFromContext(r.Context())
+}
+
+// UserIDFromContext возвращает идентификатор пользователя из токена в контексте
+func UserIDFromContext(ctx context.Context) string {
+	token, claims, err := jwtauth.FromContext(ctx)
+	if err != nil || token == nil {
+		return ""
+	}
+
+	// Тестовые токены содержат user_id, токены Auth Service - sub
+	for _, key := range []string{"user_id", "sub"} {
+		if userID, ok := claims[key].(string); ok && userID != "" {
+			return userID
+		}
+	}
+
+	return ""
+}
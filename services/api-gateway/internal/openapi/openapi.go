@@ -0,0 +1,223 @@
+package openapi
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+)
+
+// Спецификации, встроенные в бинарный файл шлюза:
+// gateway.swagger.json описывает собственные эндпоинты шлюза и ведется вручную,
+// smarthome.swagger.json генерируется protoc-gen-openapiv2 (make proto).
+// Файлы перечислены явно, чтобы без make proto сборка падала, а не отдавала
+// спецификацию без операций сервисов.
+//
+//go:embed spec/gateway.swagger.json spec/smarthome.swagger.json
+var specFS embed.FS
+
+// Статика Swagger UI из swagger-ui-dist 5.17.14 (лицензия Apache 2.0,
+// swagger-ui/LICENSE). Страница документации не обращается к внешним CDN.
+//
+//go:embed swagger-ui/swagger-ui.css swagger-ui/swagger-ui-bundle.js
+var uiFS embed.FS
+
+// BaseSpec - файл, задающий info, securityDefinitions и security объединенной спецификации
+const BaseSpec = "gateway.swagger.json"
+
+// publicOperations - операции gRPC-gateway, которые не требуют токена
+var publicOperations = map[string]bool{
+	"AuthService_Login":   true,
+	"AuthService_Refresh": true,
+}
+
+// problemRef - схема ошибок шлюза (problem+json), заменяет rpcStatus из
+// спецификаций сервисов
+const problemRef = "#/definitions/gatewayProblem"
+
+// Spec возвращает объединенную спецификацию из встроенных файлов
+func Spec() ([]byte, error) {
+	sub, err := fs.Sub(specFS, "spec")
+	if err != nil {
+		return nil, err
+	}
+	return Load(sub)
+}
+
+// Load читает все *.swagger.json из fsys и объединяет их в один документ.
+// Файл BaseSpec обязателен и используется как основа.
+func Load(fsys fs.FS) ([]byte, error) {
+	names, err := fs.Glob(fsys, "*.swagger.json")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	base, err := fs.ReadFile(fsys, BaseSpec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base spec: %w", err)
+	}
+
+	docs := [][]byte{base}
+	for _, name := range names {
+		if name == BaseSpec {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		docs = append(docs, data)
+	}
+
+	return Merge(docs...)
+}
+
+// document содержит разделы Swagger 2.0, которые участвуют в объединении.
+// Остальные разделы первого документа переносятся без изменений.
+type document struct {
+	Paths       map[string]map[string]map[string]interface{} `json:"paths"`
+	Definitions map[string]json.RawMessage                   `json:"definitions"`
+	Tags        []map[string]interface{}                     `json:"tags"`
+}
+
+// useProblemResponse заменяет схему rpcStatus в ответе default операции на
+// problem-документ, который шлюз отдает вместо тела gRPC-gateway
+func useProblemResponse(op map[string]interface{}) {
+	responses, _ := op["responses"].(map[string]interface{})
+	response, _ := responses["default"].(map[string]interface{})
+	schema, _ := response["schema"].(map[string]interface{})
+	if schema["$ref"] == "#/definitions/rpcStatus" {
+		response["schema"] = map[string]interface{}{"$ref": problemRef}
+	}
+}
+
+// Merge объединяет документы Swagger 2.0: пути, определения и теги добавляются
+// к первому документу. Повторное описание одной и той же операции - ошибка.
+func Merge(docs ...[]byte) ([]byte, error) {
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no documents to merge")
+	}
+
+	var root map[string]json.RawMessage
+	if err := json.Unmarshal(docs[0], &root); err != nil {
+		return nil, fmt.Errorf("failed to parse base document: %w", err)
+	}
+
+	merged := document{
+		Paths:       make(map[string]map[string]map[string]interface{}),
+		Definitions: make(map[string]json.RawMessage),
+	}
+	tagNames := make(map[string]bool)
+
+	for i, data := range docs {
+		var doc document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse document %d: %w", i, err)
+		}
+
+		for p, ops := range doc.Paths {
+			if merged.Paths[p] == nil {
+				merged.Paths[p] = make(map[string]map[string]interface{})
+			}
+			for method, op := range ops {
+				if _, exists := merged.Paths[p][method]; exists {
+					return nil, fmt.Errorf("duplicate operation %s %s", method, p)
+				}
+				if id, _ := op["operationId"].(string); publicOperations[id] {
+					op["security"] = []interface{}{}
+				}
+				useProblemResponse(op)
+				merged.Paths[p][method] = op
+			}
+		}
+
+		for name, def := range doc.Definitions {
+			if _, exists := merged.Definitions[name]; !exists {
+				merged.Definitions[name] = def
+			}
+		}
+
+		for _, tag := range doc.Tags {
+			name, _ := tag["name"].(string)
+			if !tagNames[name] {
+				tagNames[name] = true
+				merged.Tags = append(merged.Tags, tag)
+			}
+		}
+	}
+
+	for key, value := range map[string]interface{}{
+		"paths":       merged.Paths,
+		"definitions": merged.Definitions,
+		"tags":        merged.Tags,
+	} {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		root[key] = raw
+	}
+
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// SpecHandler возвращает обработчик, отдающий спецификацию
+func SpecHandler(spec []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(spec)
+	}
+}
+
+// DocsHandler возвращает страницу Swagger UI для спецификации по адресу specURL.
+// Статика страницы загружается с assetsURL, где смонтирован AssetsHandler.
+func DocsHandler(specURL, assetsURL string) http.HandlerFunc {
+	assets := path.Clean(assetsURL)
+	page := fmt.Sprintf(docsPage, assets, assets, path.Clean(specURL))
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	}
+}
+
+// AssetsHandler отдает встроенную статику Swagger UI. prefix - путь, по
+// которому смонтирован обработчик, например "/api/docs/".
+func AssetsHandler(prefix string) http.Handler {
+	// fs.Sub возвращает ошибку только для некорректного пути
+	sub, _ := fs.Sub(uiFS, "swagger-ui")
+	files := http.StripPrefix(prefix, http.FileServer(http.FS(sub)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Версия статики меняется только вместе с бинарным файлом шлюза
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		files.ServeHTTP(w, r)
+	})
+}
+
+// Страница Swagger UI. Статика встроена в шлюз и отдается AssetsHandler.
+const docsPage = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>Smart Home API</title>
+  <link rel="stylesheet" href="%s/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="%s/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({
+      url: %q,
+      dom_id: "#swagger-ui",
+      deepLinking: true,
+      persistAuthorization: true
+    });
+  </script>
+</body>
+</html>
+`
@@ -0,0 +1,115 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const serviceSpec = `{
+  "swagger": "2.0",
+  "info": {"title": "smarthome/v1/auth.proto", "version": "version not set"},
+  "tags": [{"name": "AuthService"}, {"name": "DeviceService"}],
+  "paths": {
+    "/api/v1/auth/login": {"post": {"operationId": "AuthService_Login"}},
+    "/api/v1/devices": {"get": {"operationId": "DeviceService_ListDevices", "responses": {"default": {"schema": {"$ref": "#/definitions/rpcStatus"}}}}}
+  },
+  "definitions": {"v1StatusResponse": {"type": "object"}}
+}`
+
+func TestLoad_MergesServiceSpecs(t *testing.T) {
+	fsys := fstest.MapFS{
+		BaseSpec:                 {Data: []byte(`{"swagger": "2.0", "info": {"title": "Smart Home API"}, "tags": [{"name": "Gateway"}], "paths": {"/health": {"get": {"operationId": "Gateway_Health"}}}}`)},
+		"smarthome.swagger.json": {Data: []byte(serviceSpec)},
+		"notes.txt":              {Data: []byte("ignored")},
+	}
+
+	data, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	var doc struct {
+		Info        map[string]string                                `json:"info"`
+		Tags        []map[string]string                              `json:"tags"`
+		Paths       map[string]map[string]map[string]json.RawMessage `json:"paths"`
+		Definitions map[string]json.RawMessage                       `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Merged spec is not valid JSON: %v", err)
+	}
+
+	if doc.Info["title"] != "Smart Home API" {
+		t.Errorf("Expected info from base spec, got %v", doc.Info)
+	}
+	for _, p := range []string{"/health", "/api/v1/auth/login", "/api/v1/devices"} {
+		if _, ok := doc.Paths[p]; !ok {
+			t.Errorf("Expected path %s in merged spec", p)
+		}
+	}
+	if len(doc.Tags) != 3 || doc.Tags[0]["name"] != "Gateway" {
+		t.Errorf("Expected Gateway tag followed by service tags, got %v", doc.Tags)
+	}
+	if _, ok := doc.Definitions["v1StatusResponse"]; !ok {
+		t.Error("Expected definitions from service spec")
+	}
+
+	// Вход не требует токена, остальные операции наследуют глобальный security
+	if got := string(doc.Paths["/api/v1/auth/login"]["post"]["security"]); got != "[]" {
+		t.Errorf("Expected empty security for login, got %q", got)
+	}
+	if _, ok := doc.Paths["/api/v1/devices"]["get"]["security"]; ok {
+		t.Error("Expected ListDevices to use global security")
+	}
+
+	// Ошибки описываются problem-документом шлюза
+	var responses map[string]struct {
+		Schema map[string]string `json:"schema"`
+	}
+	json.Unmarshal(doc.Paths["/api/v1/devices"]["get"]["responses"], &responses)
+	if got := responses["default"].Schema["$ref"]; got != problemRef {
+		t.Errorf("Expected default response %s, got %q", problemRef, got)
+	}
+}
+
+func TestMerge_DuplicateOperation(t *testing.T) {
+	if _, err := Merge([]byte(serviceSpec), []byte(serviceSpec)); err == nil {
+		t.Error("Expected error for duplicate operations")
+	}
+}
+
+func TestSpec_Embedded(t *testing.T) {
+	data, err := Spec()
+	if err != nil {
+		t.Fatalf("Spec failed: %v", err)
+	}
+	if !json.Valid(data) {
+		t.Fatal("Embedded spec is not valid JSON")
+	}
+}
+
+func TestDocs_ServesEmbeddedAssets(t *testing.T) {
+	rec := httptest.NewRecorder()
+	DocsHandler("/api/openapi.json", "/api/docs/").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/docs", nil))
+
+	page := rec.Body.String()
+	if strings.Contains(page, "https://") {
+		t.Errorf("Docs page must not load external resources:\n%s", page)
+	}
+
+	assets := AssetsHandler("/api/docs/")
+	for _, name := range []string{"swagger-ui.css", "swagger-ui-bundle.js"} {
+		if !strings.Contains(page, `"/api/docs/`+name+`"`) {
+			t.Errorf("Docs page does not reference %s", name)
+		}
+
+		rec := httptest.NewRecorder()
+		assets.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/docs/"+name, nil))
+		if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+			t.Errorf("Expected %s to be served, got %d", name, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// cleanupInterval - как часто удаляются полностью восстановленные корзины
+const cleanupInterval = time.Minute
+
+// bucket хранит состояние корзины одного ключа
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // Момент, когда корзина заполнится полностью
+}
+
+// MemoryLimiter реализует token bucket в памяти одного экземпляра шлюза
+type MemoryLimiter struct {
+	mu          sync.Mutex
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+// NewMemoryLimiter создает новый лимитер в памяти
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow реализует Limiter
+func (l *MemoryLimiter) Allow(_ context.Context, key string, rule Rule) (Result, error) {
+	capacity := float64(rule.capacity())
+	interval := rule.interval()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.cleanup(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		l.buckets[key] = b
+	}
+
+	// Восстанавливаем токены за прошедшее время
+	elapsed := now.Sub(b.updated)
+	if elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+float64(elapsed)/float64(interval))
+		b.updated = now
+	}
+
+	result := Result{Limit: int(capacity)}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(interval))
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((capacity - b.tokens) * float64(interval))
+	b.full = now.Add(result.Reset)
+
+	return result, nil
+}
+
+// Refund реализует Limiter
+func (l *MemoryLimiter) Refund(_ context.Context, key string, rule Rule) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		// Корзина уже удалена как полностью восстановленная
+		return nil
+	}
+	capacity := float64(rule.capacity())
+	b.tokens = math.Min(capacity, b.tokens+1)
+	b.full = b.updated.Add(time.Duration((capacity - b.tokens) * float64(rule.interval())))
+	return nil
+}
+
+// cleanup удаляет корзины, которые уже полностью восстановились
+func (l *MemoryLimiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < cleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+
+	for key, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	authMiddleware "github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/middleware"
+	"google.golang.org/grpc/codes"
+)
+
+// Policy связывает правило ограничения с группой маршрутов
+type Policy struct {
+	Name  string                   // Имя группы, входит в ключ лимитера
+	Rule  Rule                     // Параметры token bucket
+	Match func(*http.Request) bool // Отбор запросов группы (nil - все запросы)
+}
+
+// MatchRoute возвращает функцию отбора запросов по методу и шаблону пути
+// в формате path.Match, например "/api/v1/devices/*/control"
+func MatchRoute(method, pattern string) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		if method != "" && r.Method != method {
+			return false
+		}
+		ok, _ := path.Match(pattern, r.URL.Path)
+		return ok
+	}
+}
+
+// Middleware ограничивает частоту запросов по подходящим политикам.
+// Ключом служит идентификатор пользователя из JWT, а для анонимных запросов -
+// IP-адрес клиента, определенный middleware.RealIP. Если запрос отклоняет
+// одна из политик, токены, уже списанные другими, возвращаются.
+func Middleware(limiter Limiter, policies ...Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var reported *Result
+			var charged []Policy
+
+			subject := clientKey(r)
+			for _, policy := range policies {
+				if !policy.Rule.Enabled() || (policy.Match != nil && !policy.Match(r)) {
+					continue
+				}
+
+				result, err := limiter.Allow(r.Context(), policy.Name+":"+subject, policy.Rule)
+				if err != nil {
+					// При недоступности хранилища лимитов не блокируем запросы
+					log.Printf("Rate limiter error for %s: %v", policy.Name, err)
+					continue
+				}
+
+				if !result.Allowed {
+					reported = &result
+					for _, p := range charged {
+						if err := limiter.Refund(r.Context(), p.Name+":"+subject, p.Rule); err != nil {
+							log.Printf("Rate limiter error for %s: %v", p.Name, err)
+						}
+					}
+					break
+				}
+				charged = append(charged, policy)
+
+				// В заголовках отражаем самую строгую из сработавших политик
+				if reported == nil || stricter(result, *reported) {
+					reported = &result
+				}
+			}
+
+			if reported == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			setHeaders(w, *reported)
+			if !reported.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(reported.RetryAfter)))
+				apierror.WriteProblem(w, r, LimitError(*reported))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Check списывает один запрос по политике для клиента запроса r. Используется
+// обработчиками, которые выполняют несколько операций в одном HTTP-запросе.
+func Check(ctx context.Context, limiter Limiter, policy Policy, r *http.Request) (Result, error) {
+	if !policy.Rule.Enabled() {
+		return Result{Allowed: true}, nil
+	}
+	return limiter.Allow(ctx, policy.Name+":"+clientKey(r), policy.Rule)
+}
+
+// LimitError возвращает ошибку RATE_LIMITED для отклоненного запроса
+func LimitError(result Result) *apierror.Error {
+	return apierror.Newf(codes.ResourceExhausted, apierror.ReasonRateLimited,
+		"rate limit exceeded, retry after %s", result.RetryAfter).
+		WithMetadata("retry_after", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+}
+
+// clientKey возвращает ключ клиента: пользователь из JWT или IP-адрес
+func clientKey(r *http.Request) string {
+	if userID := authMiddleware.UserID(r); userID != "" {
+		return "user:" + userID
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// middleware.RealIP записывает адрес без порта
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// stricter возвращает true, если результат a ограничивает клиента сильнее, чем b
+func stricter(a, b Result) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	return a.Remaining < b.Remaining
+}
+
+// setHeaders выставляет заголовки X-RateLimit-*
+func setHeaders(w http.ResponseWriter, result Result) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+// ceilSeconds округляет длительность вверх до целых секунд
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule описывает параметры token bucket: Limit запросов за Period
+// с возможностью кратковременного всплеска до Burst запросов
+type Rule struct {
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// Enabled возвращает true, если правило ограничивает запросы
+func (r Rule) Enabled() bool {
+	return r.Limit > 0 && r.Period > 0
+}
+
+// capacity возвращает емкость корзины
+func (r Rule) capacity() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Limit
+}
+
+// interval возвращает время восстановления одного токена
+func (r Rule) interval() time.Duration {
+	return r.Period / time.Duration(r.Limit)
+}
+
+// String возвращает правило в формате ParseRule
+func (r Rule) String() string {
+	if !r.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s:%d", r.Limit, r.Period, r.capacity())
+}
+
+// Result содержит решение лимитера для одного запроса
+type Result struct {
+	Allowed    bool          // Разрешен ли запрос
+	Limit      int           // Емкость корзины
+	Remaining  int           // Оставшееся количество токенов
+	RetryAfter time.Duration // Через сколько появится токен (если запрос отклонен)
+	Reset      time.Duration // Через сколько корзина заполнится полностью
+}
+
+// Limiter принимает решение о допуске запроса по ключу
+type Limiter interface {
+	Allow(ctx context.Context, key string, rule Rule) (Result, error)
+
+	// Refund возвращает в корзину токен, списанный Allow, если запрос
+	// все-таки не выполнен (например, его отклонила другая политика)
+	Refund(ctx context.Context, key string, rule Rule) error
+}
+
+// ParseRule разбирает правило в формате "<limit>/<period>[:<burst>]",
+// где period - s, m, h или длительность Go ("10s"). Пустая строка, "0" и "off"
+// отключают ограничение.
+func ParseRule(s string) (Rule, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" || s == "off" {
+		return Rule{}, nil
+	}
+
+	spec, burstStr, hasBurst := strings.Cut(s, ":")
+	limitStr, periodStr, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("invalid rate limit %q: expected <limit>/<period>[:<burst>]", s)
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 {
+		return Rule{}, fmt.Errorf("invalid rate limit %q: bad limit", s)
+	}
+
+	var period time.Duration
+	switch periodStr {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		period, err = time.ParseDuration(periodStr)
+		if err != nil || period <= 0 {
+			return Rule{}, fmt.Errorf("invalid rate limit %q: bad period", s)
+		}
+	}
+
+	rule := Rule{Limit: limit, Period: period}
+	if hasBurst {
+		rule.Burst, err = strconv.Atoi(burstStr)
+		if err != nil || rule.Burst <= 0 {
+			return Rule{}, fmt.Errorf("invalid rate limit %q: bad burst", s)
+		}
+	}
+
+	return rule, nil
+}
@@ -0,0 +1,178 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		input     string
+		want      Rule
+		wantError bool
+	}{
+		{input: "", want: Rule{}},
+		{input: "off", want: Rule{}},
+		{input: "10/s", want: Rule{Limit: 10, Period: time.Second}},
+		{input: "60/m:10", want: Rule{Limit: 60, Period: time.Minute, Burst: 10}},
+		{input: "5/30s", want: Rule{Limit: 5, Period: 30 * time.Second}},
+		{input: "10", wantError: true},
+		{input: "x/m", wantError: true},
+		{input: "10/week", wantError: true},
+		{input: "10/m:0", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			rule, err := ParseRule(tt.input)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Expected error, got rule %v", rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rule != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, rule)
+			}
+		})
+	}
+}
+
+func TestMemoryLimiter_TokenBucket(t *testing.T) {
+	now := time.Unix(1714580400, 0)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+
+	// 1 токен в секунду, всплеск до 3 запросов
+	rule := Rule{Limit: 60, Period: time.Minute, Burst: 3}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		result, _ := limiter.Allow(ctx, "user:1", rule)
+		if !result.Allowed {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+		if result.Remaining != 2-i {
+			t.Errorf("Expected remaining %d, got %d", 2-i, result.Remaining)
+		}
+	}
+
+	result, _ := limiter.Allow(ctx, "user:1", rule)
+	if result.Allowed {
+		t.Fatal("Request over burst should be denied")
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("Expected retry after 1s, got %s", result.RetryAfter)
+	}
+
+	// Другой ключ не зависит от первого
+	if result, _ := limiter.Allow(ctx, "user:2", rule); !result.Allowed {
+		t.Error("Request for another key should be allowed")
+	}
+
+	// Через секунду восстанавливается один токен
+	now = now.Add(time.Second)
+	if result, _ := limiter.Allow(ctx, "user:1", rule); !result.Allowed {
+		t.Error("Request after refill should be allowed")
+	}
+	if result, _ := limiter.Allow(ctx, "user:1", rule); result.Allowed {
+		t.Error("Second request after refill of one token should be denied")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter := NewMemoryLimiter()
+	handler := Middleware(limiter,
+		Policy{Name: "api", Rule: Rule{Limit: 10, Period: time.Minute}},
+		Policy{
+			Name:  "control",
+			Rule:  Rule{Limit: 1, Period: time.Minute},
+			Match: MatchRoute(http.MethodPost, "/api/v1/devices/*/control"),
+		},
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(method, path, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send(http.MethodPost, "/api/v1/devices/lamp/control", "10.0.0.1:5000")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("Expected X-RateLimit-Remaining 0 from control policy, got %s", got)
+	}
+
+	rec = send(http.MethodPost, "/api/v1/devices/lamp/control", "10.0.0.1:5001")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Expected Retry-After 60, got %s", got)
+	}
+	if got := rec.Header().Get("X-RateLimit-Limit"); got != "1" {
+		t.Errorf("Expected X-RateLimit-Limit 1, got %s", got)
+	}
+
+	// Чтение не попадает под политику control
+	rec = send(http.MethodGet, "/api/v1/devices/lamp", "10.0.0.1:5002")
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for read request, got %d", rec.Code)
+	}
+
+	// Другой IP имеет собственный лимит
+	rec = send(http.MethodPost, "/api/v1/devices/lamp/control", "10.0.0.2:5000")
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for another client, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware_RefundsOnDenial(t *testing.T) {
+	limiter := NewMemoryLimiter()
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	handler := Middleware(limiter,
+		Policy{Name: "api", Rule: Rule{Limit: 3, Period: time.Hour}},
+		Policy{
+			Name:  "control",
+			Rule:  Rule{Limit: 1, Period: time.Hour},
+			Match: MatchRoute(http.MethodPost, "/api/v1/devices/*/control"),
+		},
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Первая команда списывает токены обеих политик, отклоненные повторы
+	// не должны расходовать лимит api
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		if code := send(http.MethodPost, "/api/v1/devices/lamp/control"); code != want {
+			t.Fatalf("control request %d: expected %d, got %d", i, want, code)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if code := send(http.MethodGet, "/api/v1/devices"); code != http.StatusOK {
+			t.Fatalf("read request %d: expected 200, got %d", i, code)
+		}
+	}
+	if code := send(http.MethodGet, "/api/v1/devices"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 after api limit is spent, got %d", code)
+	}
+}
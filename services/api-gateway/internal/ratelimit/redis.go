@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// tokenBucketScript атомарно обновляет корзину в Redis. Время берется с сервера
+// Redis, чтобы несколько экземпляров шлюза не зависели от расхождения своих часов.
+//
+// KEYS[1] - ключ корзины, ARGV[1] - емкость, ARGV[2] - интервал восстановления токена в мс.
+// Возвращает {allowed, remaining, retry_after_ms, reset_ms}.
+var tokenBucketScript = redis.NewScript(`
+if redis.replicate_commands then redis.replicate_commands() end
+
+local capacity = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+  tokens = capacity
+  ts = now
+end
+
+if now > ts then
+  tokens = math.min(capacity, tokens + (now - ts) / interval)
+  ts = now
+end
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = math.ceil((1 - tokens) * interval)
+end
+
+local reset = math.ceil((capacity - tokens) * interval)
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(ts))
+redis.call('PEXPIRE', KEYS[1], reset + 1000)
+
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+// refundScript возвращает токен в корзину, не превышая емкость.
+// KEYS[1] - ключ корзины, ARGV[1] - емкость.
+var refundScript = redis.NewScript(`
+local tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens'))
+if tokens == nil then
+  return 0
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(math.min(tonumber(ARGV[1]), tokens + 1)))
+return 1
+`)
+
+// RedisLimiter реализует token bucket в Redis, общий для нескольких экземпляров шлюза
+type RedisLimiter struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedisLimiter создает лимитер поверх клиента Redis
+func NewRedisLimiter(client redis.Scripter, prefix string) *RedisLimiter {
+	if prefix == "" {
+		prefix = "ratelimit:"
+	}
+
+	return &RedisLimiter{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// Allow реализует Limiter
+func (l *RedisLimiter) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	interval := float64(rule.interval()) / float64(time.Millisecond)
+
+	values, err := tokenBucketScript.Run(ctx, l.client, []string{l.prefix + key},
+		rule.capacity(), interval).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to run rate limit script: %w", err)
+	}
+	if len(values) != 4 {
+		return Result{}, fmt.Errorf("unexpected rate limit script result: %v", values)
+	}
+
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      rule.capacity(),
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		Reset:      time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+// Refund реализует Limiter
+func (l *RedisLimiter) Refund(ctx context.Context, key string, rule Rule) error {
+	if err := refundScript.Run(ctx, l.client, []string{l.prefix + key}, rule.capacity()).Err(); err != nil {
+		return fmt.Errorf("failed to run rate limit refund script: %w", err)
+	}
+	return nil
+}
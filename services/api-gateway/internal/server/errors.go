@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	"google.golang.org/grpc/codes"
+)
+
+// problemErrorHandler отдает ошибки gRPC-вызовов в виде problem+json (RFC 7807)
+// вместо стандартного тела gRPC-gateway {code, message, details}
+func problemErrorHandler(ctx context.Context, mux *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	// Заголовки из метаданных ответа бэкенда (как в runtime.DefaultHTTPErrorHandler)
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		for key, values := range md.HeaderMD {
+			for _, value := range values {
+				w.Header().Add(runtime.MetadataHeaderPrefix+key, value)
+			}
+		}
+	}
+
+	apierror.WriteProblem(w, r, err)
+}
+
+// problemRoutingErrorHandler отдает ошибки маршрутизации gRPC-gateway в виде problem+json
+func problemRoutingErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, httpStatus int) {
+	switch httpStatus {
+	case http.StatusNotFound:
+		notFound(w, r)
+	case http.StatusMethodNotAllowed:
+		methodNotAllowed(w, r)
+	default:
+		apierror.WriteProblemStatus(w, r, httpStatus,
+			apierror.New(codes.Internal, apierror.ReasonInternal, http.StatusText(httpStatus)))
+	}
+}
+
+// notFound отвечает на запросы к неизвестным маршрутам
+func notFound(w http.ResponseWriter, r *http.Request) {
+	apierror.WriteProblem(w, r, apierror.Newf(codes.NotFound, apierror.ReasonRouteNotFound,
+		"no route for %s %s", r.Method, r.URL.Path))
+}
+
+// methodNotAllowed отвечает на запросы с неподдерживаемым методом
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	apierror.WriteProblemStatus(w, r, http.StatusMethodNotAllowed, apierror.Newf(codes.Unimplemented,
+		apierror.ReasonMethodNotAllowed, "method %s is not allowed for %s", r.Method, r.URL.Path))
+}
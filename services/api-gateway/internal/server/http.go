@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,50 +12,159 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/websocket"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	"github.com/velvetriddles/mini-smart-home/libs/tlsutil"
 	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
 	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/admin"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/backend"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/batch"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/cors"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/drain"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/etag"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/gql"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/idempotency"
 	authMiddleware "github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/middleware"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/openapi"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/ratelimit"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/webhook"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
+// apiMarshaler - маршалер ответов gRPC-gateway (совпадает с маршалером по умолчанию)
+var apiMarshaler = &runtime.HTTPBodyMarshaler{
+	Marshaler: &runtime.JSONPb{
+		MarshalOptions:   protojson.MarshalOptions{EmitUnpopulated: true},
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	},
+}
+
 // Config содержит конфигурацию для HTTP-сервера
 type HTTPConfig struct {
 	Port              int
-	AuthServiceAddr   string
+	AuthServiceAddr   string // Адреса экземпляров через запятую или dns:///host:port
 	DeviceServiceAddr string
 	VoiceServiceAddr  string
+	SSEReplayBuffer   int
+	RateLimits        RateLimitConfig
+	Idempotency       IdempotencyConfig
+	Webhooks          WebhookConfig
+	Web               WebConfig
+	CORS              cors.Config    // Источники, которым разрешены запросы из браузера и WebSocket
+	TLS               TLSConfig      // HTTPS для внешних клиентов
+	BackendTLS        tlsutil.Config // mTLS с внутренними сервисами (пусто - без шифрования)
+	StatusInterval    time.Duration  // Период обновления метрик состояния сервисов (0 - только по запросу)
+	BatchWorkers      int            // Параллельных подзапросов одного пакета /api/v1/batch
+	BatchMaxItems     int            // Максимум подзапросов в пакете
+	BreakerThreshold  int            // Отказов подряд до размыкания выключателя
+	BreakerCooldown   time.Duration  // Время размыкания выключателя
+
+	// Таймауты http.Server. SSE и WebSocket снимают таймауты чтения и записи для своих соединений.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownDelay     time.Duration // Пауза между переводом /health в "не готов" и остановкой
+}
+
+// TLSConfig содержит сертификат HTTPS-сервера шлюза. Файлы перечитываются при
+// изменении, поэтому продление сертификата не требует перезапуска.
+type TLSConfig struct {
+	CertFile string // Сертификат (PEM), пусто - HTTP без шифрования
+	KeyFile  string // Закрытый ключ (PEM)
+}
+
+// RateLimitConfig содержит правила ограничения частоты запросов по группам маршрутов
+type RateLimitConfig struct {
+	Auth     ratelimit.Rule // /api/v1/auth, ключ - IP клиента
+	API      ratelimit.Rule // Все защищенные /api/v1 маршруты
+	Control  ratelimit.Rule // POST /api/v1/devices/{id}/control
+	RedisURL string         // Redis для общих лимитов нескольких реплик (пусто - в памяти)
+}
+
+// IdempotencyConfig содержит настройки ключей идемпотентности для управления устройствами
+type IdempotencyConfig struct {
+	TTL      time.Duration // Время хранения ответа (0 - заголовок Idempotency-Key игнорируется)
+	RedisURL string        // Redis для общих ключей нескольких реплик (пусто - в памяти)
+}
+
+// WebhookConfig содержит настройки доставки вебхуков
+type WebhookConfig struct {
+	StorePath    string // Файл подписок (пусто - только в памяти)
+	Workers      int    // Число параллельных доставок
+	MaxAttempts  int    // Попыток доставки одного события
+	DisableAfter int    // Неудачных доставок подряд до отключения подписки
+	AllowPrivate bool   // Разрешить получателей в частных сетях (10/8, 172.16/12, 192.168/16)
 }
 
 // Server представляет собой HTTP-сервер
 type HTTPServer struct {
-	router     *chi.Mux
-	config     HTTPConfig
-	authConn   *grpc.ClientConn
-	deviceConn *grpc.ClientConn
-	voiceConn  *grpc.ClientConn
-	upgrader   websocket.Upgrader
+	router    *chi.Mux
+	http      *http.Server
+	drainer   *drain.Drainer
+	cors      *cors.Policy
+	config    HTTPConfig
+	auth      *backend.Backend
+	device    *backend.Backend
+	voice     *backend.Backend
+	upgrader  websocket.Upgrader
+	statusHub *internal.StatusHub
+	cancel    context.CancelFunc
+	limiter   ratelimit.Limiter
+	idemStore idempotency.Store
+	webhooks  *webhook.Store
+	status    *admin.Status
+	redis     map[string]*redis.Client // Клиенты Redis по URL
 }
 
 // Создает новый HTTP-сервер
-func NewHTTPServer(config HTTPConfig) *HTTPServer {
+func NewHTTPServer(config HTTPConfig) (*HTTPServer, error) {
 	r := chi.NewRouter()
 
+	// Политика источников для CORS и WebSocket
+	policy, err := cors.New(config.CORS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CORS configuration: %w", err)
+	}
+
 	// Настройка websocket upgrader
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
-		CheckOrigin: func(r *http.Request) bool {
-			return true // В продакшне следует ограничить источники запроса
-		},
+		CheckOrigin:     policy.CheckOrigin,
+		Error:           internal.UpgradeError,
 	}
 
 	server := &HTTPServer{
 		router:   r,
 		config:   config,
 		upgrader: upgrader,
+		drainer:  drain.New(),
+		cors:     policy,
+		redis:    make(map[string]*redis.Client),
+	}
+	server.http = &http.Server{
+		Addr:              fmt.Sprintf(":%d", config.Port),
+		Handler:           r,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+	if config.TLS.CertFile != "" || config.TLS.KeyFile != "" {
+		tlsConfig, err := tlsutil.ServerTLSConfig(config.TLS.CertFile, config.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HTTPS configuration: %w", err)
+		}
+		server.http.TLSConfig = tlsConfig
 	}
 
 	// Настройка middleware
@@ -62,144 +172,462 @@ func NewHTTPServer(config HTTPConfig) *HTTPServer {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
+	// middleware.Timeout подключается в группах, чтобы не обрывать WebSocket и SSE
+
+	// CORS: preflight-запросы обрабатываются до маршрутизации и проверки токена
+	r.Use(policy.Middleware)
+
+	// Во время остановки новые WebSocket-подключения отклоняются
+	r.Use(server.drainer.Middleware)
+
+	// Ошибки маршрутизации тоже отдаются в виде problem+json
+	r.NotFound(notFound)
+	r.MethodNotAllowed(methodNotAllowed)
 
 	// Добавляем JWT middleware, но не для всех маршрутов
 	// Переместили в setupRoutes
 
 	// Соединение с gRPC-сервисами
-	server.setupGRPCConnections()
+	if err := server.setupGRPCConnections(); err != nil {
+		server.Close()
+		return nil, err
+	}
+
+	// Лимитер частоты запросов
+	if err := server.setupRateLimiter(); err != nil {
+		server.Close()
+		return nil, err
+	}
+
+	// Хранилище ключей идемпотентности
+	if err := server.setupIdempotencyStore(); err != nil {
+		server.Close()
+		return nil, err
+	}
+
+	// Общая подписка на статусы устройств для SSE-клиентов
+	ctx, cancel := context.WithCancel(context.Background())
+	server.cancel = cancel
+	server.statusHub = internal.NewStatusHub(
+		smarthomev1.NewDeviceServiceClient(server.device.Conn), config.SSEReplayBuffer)
+	go server.statusHub.Run(ctx)
+
+	// Доставка вебхуков по изменениям статусов устройств
+	webhooks, err := webhook.NewStore(config.Webhooks.StorePath)
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	server.webhooks = webhooks
+	go webhook.NewDispatcher(webhook.Config{
+		Store:        server.webhooks,
+		DeviceClient: smarthomev1.NewDeviceServiceClient(server.device.Conn),
+		Statuses:     server.statusHub,
+		Workers:      config.Webhooks.Workers,
+		MaxAttempts:  config.Webhooks.MaxAttempts,
+		DisableAfter: config.Webhooks.DisableAfter,
+		Addresses:    webhook.AddressPolicy{AllowPrivate: config.Webhooks.AllowPrivate},
+	}).Run(ctx)
+
+	// Сводное состояние внутренних сервисов для администраторов и метрик
+	server.status, err = admin.NewStatus(admin.Config{
+		Targets: []admin.Target{
+			{Name: "auth", Conn: server.auth.Conn, Breaker: server.auth.Breaker.State},
+			{Name: "device", Conn: server.device.Conn, Breaker: server.device.Breaker.State},
+			{Name: "voice", Conn: server.voice.Conn, Breaker: server.voice.Breaker.State},
+		},
+	})
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	if config.StatusInterval > 0 {
+		go server.status.Run(ctx, config.StatusInterval)
+	}
 
 	// Настройка маршрутов
-	server.setupRoutes()
+	if err := server.setupRoutes(); err != nil {
+		server.Close()
+		return nil, err
+	}
 
-	return server
+	return server, nil
 }
 
-// Устанавливает соединения с gRPC-сервисами
-func (s *HTTPServer) setupGRPCConnections() {
-	opts := []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+// Устанавливает соединения с gRPC-сервисами. Каждое соединение балансирует
+// запросы между экземплярами сервиса и применяет таймауты, повторы и выключатель.
+func (s *HTTPServer) setupGRPCConnections() error {
+	creds, err := s.config.BackendTLS.ClientCredentials()
+	if err != nil {
+		return fmt.Errorf("invalid backend TLS configuration: %w", err)
 	}
 
-	var err error
+	backends := []struct {
+		target   **backend.Backend
+		name     string
+		addrs    string
+		policies []backend.MethodPolicy
+	}{
+		{&s.auth, "auth", s.config.AuthServiceAddr, backend.AuthPolicies},
+		{&s.device, "device", s.config.DeviceServiceAddr, backend.DevicePolicies},
+		{&s.voice, "voice", s.config.VoiceServiceAddr, backend.VoicePolicies},
+	}
+
+	for _, b := range backends {
+		conn, err := backend.Dial(backend.Config{
+			Name:             b.name,
+			Addresses:        backend.ParseAddresses(b.addrs),
+			Policies:         b.policies,
+			BreakerThreshold: s.config.BreakerThreshold,
+			BreakerCooldown:  s.config.BreakerCooldown,
+			Credentials:      creds,
+		})
+		if err != nil {
+			return err
+		}
+		*b.target = conn
+	}
+
+	return nil
+}
+
+// Создает лимитер запросов: в Redis, если он указан, иначе в памяти
+func (s *HTTPServer) setupRateLimiter() error {
+	if s.config.RateLimits.RedisURL == "" {
+		s.limiter = ratelimit.NewMemoryLimiter()
+		return nil
+	}
 
-	// Соединение с Auth Service
-	s.authConn, err = grpc.Dial(s.config.AuthServiceAddr, opts...)
+	client, err := s.redisClient(s.config.RateLimits.RedisURL)
 	if err != nil {
-		log.Fatalf("Failed to connect to Auth Service: %v", err)
+		return fmt.Errorf("failed to parse rate limit Redis URL: %w", err)
+	}
+
+	s.limiter = ratelimit.NewRedisLimiter(client, "gateway:ratelimit:")
+	return nil
+}
+
+// Создает хранилище ключей идемпотентности: в Redis, если он указан, иначе в памяти
+func (s *HTTPServer) setupIdempotencyStore() error {
+	if s.config.Idempotency.RedisURL == "" {
+		s.idemStore = idempotency.NewMemoryStore()
+		return nil
 	}
 
-	// Соединение с Device Service
-	s.deviceConn, err = grpc.Dial(s.config.DeviceServiceAddr, opts...)
+	client, err := s.redisClient(s.config.Idempotency.RedisURL)
 	if err != nil {
-		log.Fatalf("Failed to connect to Device Service: %v", err)
+		return fmt.Errorf("failed to parse idempotency Redis URL: %w", err)
 	}
 
-	// Соединение с Voice Service
-	s.voiceConn, err = grpc.Dial(s.config.VoiceServiceAddr, opts...)
+	s.idemStore = idempotency.NewRedisStore(client, "gateway:idempotency:")
+	return nil
+}
+
+// Возвращает клиент Redis для URL. Одинаковые URL используют общий клиент.
+func (s *HTTPServer) redisClient(url string) (*redis.Client, error) {
+	if client, ok := s.redis[url]; ok {
+		return client, nil
+	}
+
+	opt, err := redis.ParseURL(url)
 	if err != nil {
-		log.Fatalf("Failed to connect to Voice Service: %v", err)
+		return nil, err
 	}
+
+	client := redis.NewClient(opt)
+	s.redis[url] = client
+	return client, nil
 }
 
 // Настраивает маршруты HTTP
-func (s *HTTPServer) setupRoutes() {
+func (s *HTTPServer) setupRoutes() error {
+	ctx := context.Background()
+
+	// gRPC-gateway для публичных эндпоинтов, например авторизации
+	authMux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(func(k string) (string, bool) {
+			if strings.ToLower(k) == "authorization" {
+				return k, true
+			}
+			return runtime.DefaultHeaderMatcher(k)
+		}),
+		runtime.WithErrorHandler(problemErrorHandler),
+		runtime.WithRoutingErrorHandler(problemRoutingErrorHandler),
+	)
+
+	// Регистрируем только AuthService для публичных маршрутов
+	if err := smarthomev1.RegisterAuthServiceHandler(ctx, authMux, s.auth.Conn); err != nil {
+		return fmt.Errorf("failed to register public AuthService handler: %w", err)
+	}
+
+	// gRPC-gateway для защищенных эндпоинтов Device и Voice сервисов.
+	// Маршалер задан явно: им же вычисляется ETag устройства для If-Match.
+	apiMux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, apiMarshaler),
+		runtime.WithErrorHandler(problemErrorHandler),
+		runtime.WithRoutingErrorHandler(problemRoutingErrorHandler),
+	)
+
+	if err := smarthomev1.RegisterDeviceServiceHandler(ctx, apiMux, s.device.Conn); err != nil {
+		return fmt.Errorf("failed to register DeviceService handler: %w", err)
+	}
+
+	if err := smarthomev1.RegisterVoiceServiceHandler(ctx, apiMux, s.voice.Conn); err != nil {
+		return fmt.Errorf("failed to register VoiceService handler: %w", err)
+	}
+
+	// Объединенная OpenAPI спецификация Auth, Device, Voice и эндпоинтов шлюза
+	spec, err := openapi.Spec()
+	if err != nil {
+		return fmt.Errorf("failed to load OpenAPI spec: %w", err)
+	}
+
+	// Лимит управления устройствами, также списывается за подзапросы control в /api/v1/batch
+	controlPolicy := ratelimit.Policy{
+		Name:  "control",
+		Rule:  s.config.RateLimits.Control,
+		Match: ratelimit.MatchRoute(http.MethodPost, "/api/v1/devices/*/control"),
+	}
+
+	// Цепочка middleware защищенных маршрутов
+	protected := chi.Middlewares{
+		// Разбираем токен из заголовка Authorization или cookie
+		jwtauth.Verifier(authMiddleware.TokenAuth),
+
+		// Ограничение частоты запросов по пользователю (или IP для невалидных токенов)
+		ratelimit.Middleware(s.limiter,
+			ratelimit.Policy{
+				Name: "api",
+				Rule: s.config.RateLimits.API,
+			},
+			controlPolicy,
+		),
+
+		authMiddleware.JWT,
+	}
+
+	// GraphQL API для дашборда
+	graphqlServer, err := gql.NewServer(gql.Config{
+		AuthClient:   smarthomev1.NewAuthServiceClient(s.auth.Conn),
+		DeviceClient: smarthomev1.NewDeviceServiceClient(s.device.Conn),
+		VoiceClient:  smarthomev1.NewVoiceServiceClient(s.voice.Conn),
+		Statuses:     s.statusHub,
+		Upgrader:     s.upgrader,
+		Drainer:      s.drainer,
+
+		Limiter:       s.limiter,
+		ControlPolicy: controlPolicy,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create GraphQL server: %w", err)
+	}
+
+	// Подписки по WebSocket проверяют токен из connection_init, остальные
+	// запросы проходят через цепочку защищенных маршрутов
+	s.router.Handle("/graphql", graphqlServer.Handler(
+		chi.Chain(append(protected, middleware.Timeout(60*time.Second))...).Handler))
+
 	// Публичные маршруты, не требующие авторизации
 	s.router.Group(func(r chi.Router) {
-		// Обработчик проверки здоровья
+		// Документация API
+		r.Get("/api/openapi.json", openapi.SpecHandler(spec))
+		r.Get("/api/docs", openapi.DocsHandler("/api/openapi.json", "/api/docs/"))
+		r.Get("/api/docs/*", openapi.AssetsHandler("/api/docs/").ServeHTTP)
+
+		// Обработчик проверки здоровья. Перед остановкой отвечает 503,
+		// чтобы балансировщик успел вывести экземпляр из ротации.
 		r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "text/plain")
+			if !s.drainer.Ready() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte("SHUTTING DOWN"))
+				return
+			}
 			w.Write([]byte("OK"))
 		})
 
+		// Метрики Prometheus, в том числе smarthome_gateway_backend_up
+		r.Handle("/metrics", promhttp.Handler())
+
 		// WebSocket для получения статусов устройств
-		deviceClient := smarthomev1.NewDeviceServiceClient(s.deviceConn)
+		deviceClient := smarthomev1.NewDeviceServiceClient(s.device.Conn)
 		r.Get("/ws/status", internal.NewWebSocketProxy(internal.WebSocketConfig{
 			DeviceClient: deviceClient,
+			Drainer:      s.drainer,
+			CheckOrigin:  s.cors.CheckOrigin,
 		}))
 
 		// Публичные API, требующие авторизации
 		r.Group(func(r chi.Router) {
-			// Подключаем gRPC-gateway для публичных эндпоинтов
-			// Например, авторизация
-			ctx := context.Background()
-			mux := runtime.NewServeMux(
-				runtime.WithIncomingHeaderMatcher(func(k string) (string, bool) {
-					if strings.ToLower(k) == "authorization" {
-						return k, true
-					}
-					return runtime.DefaultHeaderMatcher(k)
-				}),
-			)
-
-			opts := []grpc.DialOption{
-				grpc.WithTransportCredentials(insecure.NewCredentials()),
-			}
-
-			// Регистрируем только AuthService для публичных маршрутов
-			if err := smarthomev1.RegisterAuthServiceHandlerFromEndpoint(ctx, mux, s.config.AuthServiceAddr, opts); err != nil {
-				log.Fatalf("Failed to register public AuthService handler: %v", err)
-			}
-
-			r.Mount("/api/v1/auth", http.StripPrefix("/api/v1/auth", mux))
+			r.Use(middleware.Timeout(60 * time.Second))
+			r.Use(ratelimit.Middleware(s.limiter, ratelimit.Policy{
+				Name: "auth",
+				Rule: s.config.RateLimits.Auth,
+			}))
+
+			// Шаблоны gRPC-gateway уже содержат полный путь /api/v1/auth/...
+			r.Mount("/api/v1/auth", authMux)
 		})
 	})
 
 	// Защищенные маршруты, требующие авторизации
 	s.router.Group(func(r chi.Router) {
-		// Добавляем JWT middleware для защищенных маршрутов
-		r.Use(authMiddleware.JWT)
+		r.Use(protected...)
 
-		// Настраиваем защищенные gRPC-gateway эндпоинты
-		ctx := context.Background()
-		mux := runtime.NewServeMux()
+		// SSE-поток статусов устройств (регистрируется до gRPC-gateway,
+		// иначе путь будет перехвачен маршрутом /api/v1/devices/{id})
+		r.With(s.drainer.Stream).Get("/api/v1/devices/events", internal.NewSSEProxy(internal.SSEConfig{
+			DeviceClient: smarthomev1.NewDeviceServiceClient(s.device.Conn),
+			Hub:          s.statusHub,
+		}))
 
-		opts := []grpc.DialOption{
-			grpc.WithTransportCredentials(insecure.NewCredentials()),
-		}
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Timeout(60 * time.Second))
+			deviceClient := smarthomev1.NewDeviceServiceClient(s.device.Conn)
+
+			routes := apiRoutes(deviceClient)
+
+			// Повторы управления, активации сцены и создания ресурсов с тем же
+			// Idempotency-Key не выполняются дважды
+			r.Use(idempotency.Middleware(s.idemStore, s.config.Idempotency.TTL, routes.match(func(route apiRoute) bool {
+				return route.idempotent
+			})))
+
+			// ETag и 304 Not Modified для чтения устройств, их типов и истории, комнат, сцен, правил и расписаний
+			r.Use(etag.Middleware(routes.match(func(route apiRoute) bool {
+				return route.etag
+			})))
+
+			// Управление, изменение и удаление с If-Match выполняются, только если ресурс не изменился
+			r.Use(etag.IfMatch(routes.match(func(route apiRoute) bool {
+				return route.ifMatch != nil
+			}), routes.currentETag))
+
+			// Пакетное выполнение операций с устройствами
+			r.Post("/api/v1/batch", batch.NewHandler(batch.Config{
+				DeviceClient:  deviceClient,
+				Workers:       s.config.BatchWorkers,
+				MaxItems:      s.config.BatchMaxItems,
+				Limiter:       s.limiter,
+				ControlPolicy: controlPolicy,
+			}))
+
+			// Сводное состояние системы, только для администраторов
+			r.With(authMiddleware.RequireRole("admin")).Get("/api/v1/admin/status", s.status.Handler())
+
+			// Подписки на вебхуки текущего пользователя
+			r.Mount("/api/v1/webhooks", webhook.NewHandler(s.webhooks, webhook.AddressPolicy{AllowPrivate: s.config.Webhooks.AllowPrivate}))
+
+			// Шаблоны gRPC-gateway уже содержат полный путь /api/v1/...
+			r.Mount("/api/v1", apiMux)
+		})
+	})
 
-		// Регистрируем Device и Voice сервисы для защищенных маршрутов
-		if err := smarthomev1.RegisterDeviceServiceHandlerFromEndpoint(ctx, mux, s.config.DeviceServiceAddr, opts); err != nil {
-			log.Fatalf("Failed to register DeviceService handler: %v", err)
-		}
+	// Тестовый обработчик для генерации токена (для отладки)
+	s.router.Post("/debug/token", debugToken)
 
-		if err := smarthomev1.RegisterVoiceServiceHandlerFromEndpoint(ctx, mux, s.config.VoiceServiceAddr, opts); err != nil {
-			log.Fatalf("Failed to register VoiceService handler: %v", err)
-		}
+	// Веб-интерфейс обслуживает все остальные GET-запросы
+	return s.setupWeb()
+}
 
-		r.Mount("/api/v1", http.StripPrefix("/api/v1", mux))
-	})
+// debugToken выдает тестовый JWT с ролью user. Обработчик доступен без
+// аутентификации, поэтому роли из запроса не принимаются: токен администратора
+// выдает только auth-сервис.
+func debugToken(w http.ResponseWriter, r *http.Request) {
+	token, err := authMiddleware.GenerateToken("test-user-id", "testuser")
+	if err != nil {
+		apierror.WriteProblem(w, r, apierror.New(codes.Internal, apierror.ReasonInternal, err.Error()))
+		return
+	}
 
-	// Тестовый обработчик для генерации токена (для отладки)
-	s.router.Post("/debug/token", func(w http.ResponseWriter, r *http.Request) {
-		token, err := authMiddleware.GenerateToken("test-user-id", "testuser")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
+
+// resourceETag возвращает функцию для etag.IfMatch: ETag ответа GET на ресурс
+// с ID из пути запроса /api/v1/{collection}/{id}[/...], который читает fetch
+func resourceETag(fetch func(ctx context.Context, id string) (proto.Message, error)) func(*http.Request) (string, error) {
+	return func(r *http.Request) (string, error) {
+		var id string
+		if parts := strings.Split(r.URL.Path, "/"); len(parts) > 4 {
+			id = parts[4]
+		}
+
+		resp, err := fetch(r.Context(), id)
+		if status.Code(err) == codes.NotFound {
+			return "", nil
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return "", err
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"token": token})
-	})
+		body, err := apiMarshaler.Marshal(resp)
+		if err != nil {
+			return "", err
+		}
+		return etag.Compute(body), nil
+	}
 }
 
-// Start запускает HTTP-сервер
+// Start запускает HTTP-сервер (HTTPS, если задан сертификат) и блокируется до его остановки.
+// После Shutdown возвращает nil.
 func (s *HTTPServer) Start() error {
-	addr := fmt.Sprintf(":%d", s.config.Port)
-	log.Printf("Starting HTTP server on %s", addr)
-	return http.ListenAndServe(addr, s.router)
+	var err error
+	if s.http.TLSConfig != nil {
+		log.Printf("Starting HTTPS server on %s", s.http.Addr)
+		err = s.http.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("Starting HTTP server on %s", s.http.Addr)
+		err = s.http.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown плавно останавливает сервер: переводит /health в "не готов", ждет
+// ShutdownDelay, закрывает WebSocket с кодом 1001 Going Away, завершает SSE и
+// дожидается выполнения текущих запросов. По истечении ctx оставшиеся
+// соединения закрываются принудительно. Соединения с сервисами закрывает Close.
+func (s *HTTPServer) Shutdown(ctx context.Context) error {
+	s.drainer.SetNotReady()
+
+	if s.config.ShutdownDelay > 0 {
+		log.Printf("Health check reports not ready, waiting %s before shutdown", s.config.ShutdownDelay)
+		select {
+		case <-time.After(s.config.ShutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		s.drainer.Drain(ctx)
+	}()
+
+	err := s.http.Shutdown(ctx)
+	if err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
+		s.http.Close()
+	}
+	<-drained
+
+	return err
 }
 
 // Close закрывает все соединения
 func (s *HTTPServer) Close() {
-	if s.authConn != nil {
-		s.authConn.Close()
+	if s.cancel != nil {
+		s.cancel()
 	}
-	if s.deviceConn != nil {
-		s.deviceConn.Close()
+	for _, client := range s.redis {
+		client.Close()
 	}
-	if s.voiceConn != nil {
-		s.voiceConn.Close()
+	for _, b := range []*backend.Backend{s.auth, s.device, s.voice} {
+		if b != nil {
+			b.Close()
+		}
 	}
 }
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/jwtauth/v5"
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/etag"
+	authMiddleware "github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/middleware"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDebugToken_NoAdminRole(t *testing.T) {
+	rec := httptest.NewRecorder()
+	debugToken(rec, httptest.NewRequest(http.MethodPost, "/debug/token?role=admin", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	admin := jwtauth.Verifier(authMiddleware.TokenAuth)(authMiddleware.JWT(authMiddleware.RequireRole("admin")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/status", nil)
+	req.Header.Set("Authorization", "Bearer "+resp.Token)
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("admin route with debug token: status = %d, want 403", rec.Code)
+	}
+}
+
+func TestResourceETag(t *testing.T) {
+	current := resourceETag(func(ctx context.Context, id string) (proto.Message, error) {
+		if id != "lamp-1" {
+			return nil, status.Error(codes.NotFound, "not found")
+		}
+		return &smarthomev1.Device{Id: id, Name: "Лампа"}, nil
+	})
+	body, err := apiMarshaler.Marshal(&smarthomev1.Device{Id: "lamp-1", Name: "Лампа"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/v1/devices/lamp-1", etag.Compute(body)},
+		{"/api/v1/devices/lamp-1/control", etag.Compute(body)},
+		{"/api/v1/devices/missing", ""},
+	}
+	for _, tt := range tests {
+		got, err := current(httptest.NewRequest(http.MethodPatch, tt.path, nil))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: ETag = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
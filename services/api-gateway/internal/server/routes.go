@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"path"
+
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// apiRoute описывает маршрут gRPC-gateway и middleware шлюза, которые к нему
+// применяются. Маршруты gRPC-gateway смонтированы в chi одним обработчиком,
+// поэтому middleware выбирают запросы по этой таблице.
+type apiRoute struct {
+	method  string
+	pattern string // шаблон path.Match, * - один сегмент пути
+
+	// idempotent - повтор с тем же Idempotency-Key не выполняется дважды
+	idempotent bool
+	// etag - ETag и 304 Not Modified для ответа
+	etag bool
+	// ifMatch возвращает текущий ETag ресурса для проверки If-Match
+	ifMatch func(*http.Request) (string, error)
+}
+
+// routeTable - маршруты, для которых шлюз подключает middleware
+type routeTable []apiRoute
+
+// apiRoutes возвращает таблицу маршрутов Device Service. Новый маршрут
+// добавляется сюда одной строкой со всеми нужными ему middleware.
+func apiRoutes(client smarthomev1.DeviceServiceClient) routeTable {
+	device := resourceETag(func(ctx context.Context, id string) (proto.Message, error) {
+		return client.GetDevice(ctx, &smarthomev1.DeviceId{Id: id})
+	})
+	room := resourceETag(func(ctx context.Context, id string) (proto.Message, error) {
+		return client.GetRoom(ctx, &smarthomev1.RoomId{Id: id})
+	})
+	scene := resourceETag(func(ctx context.Context, id string) (proto.Message, error) {
+		return client.GetScene(ctx, &smarthomev1.SceneId{Id: id})
+	})
+	rule := resourceETag(func(ctx context.Context, id string) (proto.Message, error) {
+		return client.GetRule(ctx, &smarthomev1.RuleId{Id: id})
+	})
+
+	return routeTable{
+		{method: http.MethodGet, pattern: "/api/v1/devices", etag: true},
+		{method: http.MethodPost, pattern: "/api/v1/devices", idempotent: true},
+		{method: http.MethodGet, pattern: "/api/v1/devices/*", etag: true},
+		{method: http.MethodPatch, pattern: "/api/v1/devices/*", ifMatch: device},
+		{method: http.MethodDelete, pattern: "/api/v1/devices/*", ifMatch: device},
+		{method: http.MethodPost, pattern: "/api/v1/devices/*/control", idempotent: true, ifMatch: device},
+		{method: http.MethodGet, pattern: "/api/v1/devices/*/history", etag: true},
+		{method: http.MethodGet, pattern: "/api/v1/device-types", etag: true},
+
+		{method: http.MethodGet, pattern: "/api/v1/rooms", etag: true},
+		{method: http.MethodPost, pattern: "/api/v1/rooms", idempotent: true},
+		{method: http.MethodGet, pattern: "/api/v1/rooms/*", etag: true},
+		{method: http.MethodPatch, pattern: "/api/v1/rooms/*", ifMatch: room},
+		{method: http.MethodDelete, pattern: "/api/v1/rooms/*", ifMatch: room},
+		{method: http.MethodGet, pattern: "/api/v1/rooms/*/summary", etag: true},
+
+		{method: http.MethodGet, pattern: "/api/v1/scenes", etag: true},
+		{method: http.MethodPost, pattern: "/api/v1/scenes", idempotent: true},
+		{method: http.MethodGet, pattern: "/api/v1/scenes/*", etag: true},
+		{method: http.MethodPatch, pattern: "/api/v1/scenes/*", ifMatch: scene},
+		{method: http.MethodDelete, pattern: "/api/v1/scenes/*", ifMatch: scene},
+		{method: http.MethodPost, pattern: "/api/v1/scenes/*/activate", idempotent: true},
+
+		{method: http.MethodGet, pattern: "/api/v1/rules", etag: true},
+		{method: http.MethodPost, pattern: "/api/v1/rules", idempotent: true},
+		{method: http.MethodGet, pattern: "/api/v1/rules/*", etag: true},
+		{method: http.MethodPatch, pattern: "/api/v1/rules/*", ifMatch: rule},
+		{method: http.MethodDelete, pattern: "/api/v1/rules/*", ifMatch: rule},
+		{method: http.MethodGet, pattern: "/api/v1/rules/*/executions", etag: true},
+
+		{method: http.MethodGet, pattern: "/api/v1/schedules", etag: true},
+		{method: http.MethodPost, pattern: "/api/v1/schedules", idempotent: true},
+		{method: http.MethodGet, pattern: "/api/v1/schedules/*", etag: true},
+	}
+}
+
+// find возвращает маршрут запроса. HEAD обслуживается маршрутом GET.
+func (t routeTable) find(r *http.Request) (apiRoute, bool) {
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	for _, route := range t {
+		if route.method != method {
+			continue
+		}
+		if ok, _ := path.Match(route.pattern, r.URL.Path); ok {
+			return route, true
+		}
+	}
+	return apiRoute{}, false
+}
+
+// match возвращает условие для middleware: маршрут запроса есть в таблице
+// и для него выполняется has
+func (t routeTable) match(has func(apiRoute) bool) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		route, ok := t.find(r)
+		return ok && has(route)
+	}
+}
+
+// currentETag возвращает текущий ETag ресурса для etag.IfMatch
+func (t routeTable) currentETag(r *http.Request) (string, error) {
+	route, ok := t.find(r)
+	if !ok || route.ifMatch == nil {
+		return "", nil
+	}
+	return route.ifMatch(r)
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteTable(t *testing.T) {
+	routes := apiRoutes(nil)
+	idempotent := routes.match(func(route apiRoute) bool { return route.idempotent })
+	withETag := routes.match(func(route apiRoute) bool { return route.etag })
+	ifMatch := routes.match(func(route apiRoute) bool { return route.ifMatch != nil })
+
+	tests := []struct {
+		method     string
+		path       string
+		idempotent bool
+		etag       bool
+		ifMatch    bool
+	}{
+		{http.MethodGet, "/api/v1/devices", false, true, false},
+		{http.MethodHead, "/api/v1/devices/lamp-1", false, true, false},
+		{http.MethodPost, "/api/v1/devices", true, false, false},
+		{http.MethodPost, "/api/v1/devices/lamp-1/control", true, false, true},
+		{http.MethodPatch, "/api/v1/rooms/kitchen", false, false, true},
+		{http.MethodPost, "/api/v1/scenes/evening/activate", true, false, false},
+		{http.MethodGet, "/api/v1/devices/lamp-1/history", false, true, false},
+		{http.MethodGet, "/api/v1/devices/lamp-1/unknown", false, false, false},
+		{http.MethodDelete, "/api/v1/schedules/daily", false, false, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := idempotent(r); got != tt.idempotent {
+			t.Errorf("%s %s: idempotent = %v, want %v", tt.method, tt.path, got, tt.idempotent)
+		}
+		if got := withETag(r); got != tt.etag {
+			t.Errorf("%s %s: etag = %v, want %v", tt.method, tt.path, got, tt.etag)
+		}
+		if got := ifMatch(r); got != tt.ifMatch {
+			t.Errorf("%s %s: ifMatch = %v, want %v", tt.method, tt.path, got, tt.ifMatch)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/spa"
+)
+
+// WebEmbedded - значение WebConfig.Dir для веб-интерфейса, встроенного в бинарный файл
+const WebEmbedded = "embed"
+
+// WebConfig содержит настройки раздачи веб-интерфейса
+type WebConfig struct {
+	Dir        string // Каталог сборки web/dist или WebEmbedded (пусто - интерфейс не раздается)
+	APIBaseURL string // Базовый URL API в config.js (пусто - тот же origin)
+}
+
+// apiPrefixes - пути шлюза, которые не передаются веб-интерфейсу: неизвестный
+// маршрут API должен получить 404 problem+json, а не index.html
+var apiPrefixes = []string{"/api/", "/ws/", "/graphql", "/debug/", "/health", "/metrics"}
+
+// setupWeb подключает веб-интерфейс к маршрутам, которые не заняты API
+func (s *HTTPServer) setupWeb() error {
+	if s.config.Web.Dir == "" {
+		return nil
+	}
+
+	files, err := s.config.Web.files()
+	if err != nil {
+		return err
+	}
+
+	web, err := spa.NewHandler(spa.Config{
+		Files:      files,
+		APIBaseURL: s.config.Web.APIBaseURL,
+		NotFound:   http.HandlerFunc(notFound),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serve web UI from %s: %w", s.config.Web.Dir, err)
+	}
+
+	s.router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && !isAPIPath(r.URL.Path) {
+			web.ServeHTTP(w, r)
+			return
+		}
+		notFound(w, r)
+	})
+	return nil
+}
+
+// files возвращает файлы веб-интерфейса из каталога или из бинарного файла
+func (c WebConfig) files() (fs.FS, error) {
+	if c.Dir == WebEmbedded {
+		files, ok := spa.Embedded()
+		if !ok {
+			return nil, errors.New("web UI is not embedded: build the gateway with -tags spa")
+		}
+		return files, nil
+	}
+
+	info, err := os.Stat(c.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", c.Dir)
+	}
+	return os.DirFS(c.Dir), nil
+}
+
+// isAPIPath проверяет, относится ли путь к API шлюза
+func isAPIPath(path string) bool {
+	for _, prefix := range apiPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
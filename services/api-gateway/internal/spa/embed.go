@@ -0,0 +1,23 @@
+//go:build spa
+
+package spa
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// dist - сборка web/ (npm run build), скопированная в internal/spa/dist
+// перед сборкой шлюза с тегом spa (make gateway-spa)
+//
+//go:embed all:dist
+var dist embed.FS
+
+// Embedded возвращает веб-интерфейс, встроенный в бинарный файл
+func Embedded() (fs.FS, bool) {
+	files, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil, false
+	}
+	return files, true
+}
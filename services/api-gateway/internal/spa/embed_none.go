@@ -0,0 +1,11 @@
+//go:build !spa
+
+package spa
+
+import "io/fs"
+
+// Embedded возвращает веб-интерфейс, встроенный в бинарный файл. Без тега
+// сборки spa интерфейс не встраивается.
+func Embedded() (fs.FS, bool) {
+	return nil, false
+}
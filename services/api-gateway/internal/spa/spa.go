@@ -0,0 +1,190 @@
+// Package spa раздает собранный веб-интерфейс (web/dist) из шлюза: статику с
+// заранее сжатыми вариантами, fallback на index.html для маршрутов History API
+// и config.js с настройками клиента, известными только во время запуска.
+package spa
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/etag"
+)
+
+const (
+	// indexFile - точка входа SPA, отдается для всех маршрутов клиента
+	indexFile = "index.html"
+
+	// ConfigPath - путь скрипта с настройками клиента; подключается в index.html
+	// до бандла и задает window.__SMARTHOME_CONFIG__
+	ConfigPath = "/config.js"
+
+	// assetsDir - каталог, куда Vite кладет файлы с хешем содержимого в имени
+	assetsDir = "assets/"
+
+	cacheImmutable  = "public, max-age=31536000, immutable"
+	cacheRevalidate = "no-cache"
+)
+
+// encodings - заранее сжатые варианты файлов в порядке предпочтения
+var encodings = []struct {
+	name string // значение Content-Encoding
+	ext  string // суффикс файла рядом с исходным
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Config содержит настройки раздачи веб-интерфейса
+type Config struct {
+	Files      fs.FS        // Собранный бандл, корень содержит index.html
+	APIBaseURL string       // Базовый URL API для клиента, пустая строка - тот же origin
+	NotFound   http.Handler // Ответ на запрос отсутствующего файла (nil - http.NotFound)
+}
+
+// ClientConfig - настройки клиента, которые отдаются в config.js
+type ClientConfig struct {
+	APIBaseURL string `json:"apiBaseUrl"`
+}
+
+type handler struct {
+	files    fs.FS
+	config   []byte
+	notFound http.Handler
+}
+
+// NewHandler создает обработчик GET и HEAD запросов к веб-интерфейсу.
+// Пути с расширением отдаются как файлы, остальные - как index.html, чтобы
+// маршрутизацию выполнял клиент.
+func NewHandler(config Config) (http.Handler, error) {
+	if config.Files == nil {
+		return nil, errors.New("spa: no files")
+	}
+	if _, err := fs.Stat(config.Files, indexFile); err != nil {
+		return nil, fmt.Errorf("spa: %w", err)
+	}
+
+	clientConfig, err := json.Marshal(ClientConfig{APIBaseURL: config.APIBaseURL})
+	if err != nil {
+		return nil, err
+	}
+
+	notFound := config.NotFound
+	if notFound == nil {
+		notFound = http.HandlerFunc(http.NotFound)
+	}
+
+	return &handler{
+		files:    config.Files,
+		config:   []byte("window.__SMARTHOME_CONFIG__ = " + string(clientConfig) + ";\n"),
+		notFound: notFound,
+	}, nil
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == ConfigPath {
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		http.ServeContent(w, r, ConfigPath, time.Time{}, bytes.NewReader(h.config))
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = indexFile
+	}
+
+	if h.serveFile(w, r, name) {
+		return
+	}
+
+	// Отсутствующие файлы (/assets/old.js, /favicon.png) не подменяются index.html,
+	// иначе браузер получит HTML вместо скрипта или картинки
+	if path.Ext(name) != "" {
+		h.notFound.ServeHTTP(w, r)
+		return
+	}
+
+	if !h.serveFile(w, r, indexFile) {
+		h.notFound.ServeHTTP(w, r)
+	}
+}
+
+// serveFile отдает файл бандла, выбирая сжатый вариант по Accept-Encoding.
+// Возвращает false, если файла нет.
+func (h *handler) serveFile(w http.ResponseWriter, r *http.Request, name string) bool {
+	info, err := fs.Stat(h.files, name)
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	file, encoding := name, ""
+	for _, enc := range encodings {
+		if !acceptsEncoding(r.Header.Get("Accept-Encoding"), enc.name) {
+			continue
+		}
+		if info, err := fs.Stat(h.files, name+enc.ext); err == nil && !info.IsDir() {
+			file, encoding = name+enc.ext, enc.name
+			break
+		}
+	}
+
+	data, err := fs.ReadFile(h.files, file)
+	if err != nil {
+		return false
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Accept-Encoding")
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+	}
+
+	// Тип определяется по исходному имени: ServeContent не должен угадывать его
+	// по сжатым байтам
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+		if encoding != "" {
+			contentType = "application/octet-stream"
+		}
+	}
+	header.Set("Content-Type", contentType)
+
+	// Файлы из assets/ содержат хеш в имени и не меняются, остальные (index.html,
+	// favicon) проверяются при каждом обращении по ETag
+	if strings.HasPrefix(name, assetsDir) {
+		header.Set("Cache-Control", cacheImmutable)
+	} else {
+		header.Set("Cache-Control", cacheRevalidate)
+	}
+	header.Set("ETag", etag.Compute(data))
+
+	http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(data))
+	return true
+}
+
+// acceptsEncoding проверяет, разрешает ли Accept-Encoding кодирование name
+func acceptsEncoding(header, name string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), name) {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package spa
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func newTestHandler(t *testing.T) http.Handler {
+	handler, err := NewHandler(Config{
+		Files: fstest.MapFS{
+			"index.html":                {Data: []byte("<!DOCTYPE html><title>index</title>")},
+			"favicon.svg":               {Data: []byte("<svg></svg>")},
+			"assets/index-AbC123.js":    {Data: []byte("console.log(1)")},
+			"assets/index-AbC123.js.br": {Data: []byte("br-bytes")},
+			"assets/index-AbC123.js.gz": {Data: []byte("gz-bytes")},
+		},
+		APIBaseURL: "https://api.example.com",
+	})
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	return handler
+}
+
+func get(handler http.Handler, path, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_HistoryFallback(t *testing.T) {
+	handler := newTestHandler(t)
+
+	for _, path := range []string{"/", "/devices", "/devices/light-1/", "/index.html"} {
+		rec := get(handler, path, "")
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<title>index</title>") {
+			t.Errorf("%s: expected index.html, got %d %q", path, rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("Cache-Control") != cacheRevalidate {
+			t.Errorf("%s: unexpected Cache-Control %q", path, rec.Header().Get("Cache-Control"))
+		}
+	}
+
+	// Отсутствующий файл не подменяется index.html
+	if rec := get(handler, "/assets/missing-123.js", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing asset, got %d", rec.Code)
+	}
+}
+
+func TestHandler_Assets(t *testing.T) {
+	handler := newTestHandler(t)
+
+	rec := get(handler, "/assets/index-AbC123.js", "")
+	if rec.Body.String() != "console.log(1)" || rec.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("Unexpected uncompressed response: %q %q", rec.Header().Get("Content-Encoding"), rec.Body.String())
+	}
+	if rec.Header().Get("Cache-Control") != cacheImmutable {
+		t.Errorf("Unexpected Cache-Control %q", rec.Header().Get("Cache-Control"))
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/javascript") {
+		t.Errorf("Unexpected Content-Type %q", rec.Header().Get("Content-Type"))
+	}
+
+	for _, tc := range []struct {
+		accept   string
+		encoding string
+		body     string
+	}{
+		{"gzip, deflate, br", "br", "br-bytes"},
+		{"gzip", "gzip", "gz-bytes"},
+		{"br;q=0, gzip;q=0.5", "gzip", "gz-bytes"},
+		{"identity", "", "console.log(1)"},
+	} {
+		rec := get(handler, "/assets/index-AbC123.js", tc.accept)
+		if rec.Header().Get("Content-Encoding") != tc.encoding || rec.Body.String() != tc.body {
+			t.Errorf("Accept-Encoding %q: got %q %q", tc.accept, rec.Header().Get("Content-Encoding"), rec.Body.String())
+		}
+		if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/javascript") {
+			t.Errorf("Accept-Encoding %q: unexpected Content-Type %q", tc.accept, rec.Header().Get("Content-Type"))
+		}
+		if rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("Accept-Encoding %q: missing Vary", tc.accept)
+		}
+	}
+}
+
+func TestHandler_ConditionalRequest(t *testing.T) {
+	handler := newTestHandler(t)
+
+	tag := get(handler, "/favicon.svg", "").Header().Get("ETag")
+	if tag == "" {
+		t.Fatal("Missing ETag")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/favicon.svg", nil)
+	req.Header.Set("If-None-Match", tag)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected 304, got %d", rec.Code)
+	}
+}
+
+func TestHandler_Config(t *testing.T) {
+	rec := get(newTestHandler(t), ConfigPath, "")
+	want := `window.__SMARTHOME_CONFIG__ = {"apiBaseUrl":"https://api.example.com"};` + "\n"
+	if rec.Body.String() != want {
+		t.Errorf("Unexpected config.js %q", rec.Body.String())
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Unexpected Cache-Control %q", rec.Header().Get("Cache-Control"))
+	}
+}
+
+func TestNewHandler_RequiresIndex(t *testing.T) {
+	if _, err := NewHandler(Config{Files: fstest.MapFS{"app.js": {}}}); err == nil {
+		t.Error("Expected error without index.html")
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"br", true},
+		{"gzip, BR", true},
+		{"br;q=0", false},
+		{"br; q=0.1", true},
+		{"brotli", false},
+	} {
+		if got := acceptsEncoding(tc.header, "br"); got != tc.want {
+			t.Errorf("acceptsEncoding(%q, br) = %v, want %v", tc.header, got, tc.want)
+		}
+	}
+}
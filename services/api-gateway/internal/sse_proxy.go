@@ -0,0 +1,343 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// DefaultReplayBufferSize - количество последних событий, доступных для повторной отправки
+	DefaultReplayBufferSize = 256
+
+	// DefaultSSEKeepAlive - интервал отправки комментариев для поддержания соединения
+	DefaultSSEKeepAlive = 15 * time.Second
+
+	// subscriberBufferSize - размер буфера канала одного подписчика
+	subscriberBufferSize = 64
+
+	// maxReconnectDelay - максимальная задержка между попытками переподключения к Device Service
+	maxReconnectDelay = 30 * time.Second
+)
+
+// StatusEvent представляет обновление статуса устройства с порядковым номером
+type StatusEvent struct {
+	ID     uint64
+	Status *smarthomev1.StatusResponse
+}
+
+// StatusHub держит одну подписку на StreamStatuses и раздает обновления
+// всем SSE-клиентам, сохраняя последние события в кольцевом буфере
+type StatusHub struct {
+	client smarthomev1.DeviceServiceClient
+	size   int
+
+	mu          sync.Mutex
+	nextID      uint64
+	buffer      []StatusEvent
+	subscribers map[chan StatusEvent]struct{}
+}
+
+// NewStatusHub создает новый хаб статусов с буфером заданного размера
+func NewStatusHub(client smarthomev1.DeviceServiceClient, size int) *StatusHub {
+	if size <= 0 {
+		size = DefaultReplayBufferSize
+	}
+
+	return &StatusHub{
+		client:      client,
+		size:        size,
+		nextID:      1,
+		buffer:      make([]StatusEvent, 0, size),
+		subscribers: make(map[chan StatusEvent]struct{}),
+	}
+}
+
+// Run поддерживает подписку на все устройства, переподключаясь при ошибках,
+// пока не будет отменен контекст
+func (h *StatusHub) Run(ctx context.Context) {
+	delay := time.Second
+
+	for {
+		err := h.consume(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Status hub: stream error: %v, reconnecting in %s", err, delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// consume читает поток статусов до первой ошибки
+func (h *StatusHub) consume(ctx context.Context) error {
+	stream, err := h.client.StreamStatuses(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := stream.Send(&smarthomev1.StatusRequest{SubscribeAll: true}); err != nil {
+		return err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		h.publish(resp)
+	}
+}
+
+// publish присваивает событию номер, сохраняет его в буфере и рассылает подписчикам
+func (h *StatusHub) publish(status *smarthomev1.StatusResponse) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	event := StatusEvent{ID: h.nextID, Status: status}
+	h.nextID++
+
+	if len(h.buffer) == h.size {
+		copy(h.buffer, h.buffer[1:])
+		h.buffer = h.buffer[:h.size-1]
+	}
+	h.buffer = append(h.buffer, event)
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Медленный клиент: закрываем его канал, после переподключения
+			// он догонит пропущенные события по Last-Event-ID
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe регистрирует нового подписчика. Если указан lastID, возвращаются
+// сохраненные в буфере события с большим номером. Если lastID неизвестен хабу
+// (например, после перезапуска шлюза), возвращается весь буфер.
+func (h *StatusHub) Subscribe(lastID uint64, resume bool) ([]StatusEvent, <-chan StatusEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var backlog []StatusEvent
+	if resume {
+		if lastID >= h.nextID {
+			lastID = 0
+		}
+		for _, event := range h.buffer {
+			if event.ID > lastID {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+
+	ch := make(chan StatusEvent, subscriberBufferSize)
+	h.subscribers[ch] = struct{}{}
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return backlog, ch, unsubscribe
+}
+
+// SSEConfig содержит настройки для SSE-эндпоинта
+type SSEConfig struct {
+	DeviceClient smarthomev1.DeviceServiceClient
+	Hub          *StatusHub
+	KeepAlive    time.Duration
+}
+
+// statusFilter отбирает события по device_id, room и type
+type statusFilter struct {
+	deviceID   string
+	room       string
+	deviceType string
+
+	client  smarthomev1.DeviceServiceClient
+	devices map[string]*smarthomev1.Device
+}
+
+// newStatusFilter создает фильтр на основе параметров запроса
+func newStatusFilter(r *http.Request, client smarthomev1.DeviceServiceClient) *statusFilter {
+	query := r.URL.Query()
+	return &statusFilter{
+		deviceID:   query.Get("device_id"),
+		room:       query.Get("room"),
+		deviceType: query.Get("type"),
+		client:     client,
+		devices:    make(map[string]*smarthomev1.Device),
+	}
+}
+
+// match проверяет, подходит ли событие под фильтр
+func (f *statusFilter) match(ctx context.Context, status *smarthomev1.StatusResponse) bool {
+	if f.deviceID != "" && status.DeviceId != f.deviceID {
+		return false
+	}
+
+	if f.room == "" && f.deviceType == "" {
+		return true
+	}
+
+	// Для фильтрации по комнате и типу нужны метаданные устройства
+	device, ok := f.devices[status.DeviceId]
+	if !ok {
+		resp, err := f.client.GetDevice(ctx, &smarthomev1.DeviceId{Id: status.DeviceId})
+		if err != nil {
+			log.Printf("SSE: failed to get device %s: %v", status.DeviceId, err)
+			return false
+		}
+		device = resp.Device
+		f.devices[status.DeviceId] = device
+	}
+
+	if f.room != "" && !strings.EqualFold(device.Room, f.room) {
+		return false
+	}
+	if f.deviceType != "" && device.Type != f.deviceType {
+		return false
+	}
+
+	return true
+}
+
+// NewSSEProxy создает обработчик Server-Sent Events для обновлений статусов устройств
+func NewSSEProxy(config SSEConfig) http.HandlerFunc {
+	keepAlive := config.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = DefaultSSEKeepAlive
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			apierror.WriteProblem(w, r, apierror.New(codes.Internal, apierror.ReasonInternal, "streaming is not supported"))
+			return
+		}
+
+		// Last-Event-ID передается браузером при переподключении,
+		// скрипты могут передать его параметром запроса
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("last_event_id")
+		}
+
+		var lastID uint64
+		resume := false
+		if lastEventID != "" {
+			id, err := strconv.ParseUint(lastEventID, 10, 64)
+			if err != nil {
+				apierror.WriteProblem(w, r, apierror.InvalidArgument("invalid Last-Event-ID",
+					apierror.FieldViolation{Field: "Last-Event-ID", Description: "must be a non-negative integer"}))
+				return
+			}
+			lastID, resume = id, true
+		}
+
+		filter := newStatusFilter(r, config.DeviceClient)
+		backlog, events, unsubscribe := config.Hub.Subscribe(lastID, resume)
+		defer unsubscribe()
+
+		// Таймауты чтения и записи http.Server рассчитаны на обычные запросы,
+		// поток событий живет до отключения клиента или остановки шлюза
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(time.Time{})
+		rc.SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		log.Printf("SSE connection established from %s", r.RemoteAddr)
+
+		ctx := r.Context()
+		fmt.Fprintf(w, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+
+		for _, event := range backlog {
+			if !filter.match(ctx, event.Status) {
+				continue
+			}
+			if err := writeStatusEvent(w, event); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				log.Printf("SSE connection closed for %s", r.RemoteAddr)
+				return
+			case <-ticker.C:
+				if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			case event, ok := <-events:
+				if !ok {
+					// Хаб отключил клиента, браузер переподключится сам
+					return
+				}
+				if !filter.match(ctx, event.Status) {
+					continue
+				}
+				if err := writeStatusEvent(w, event); err != nil {
+					log.Printf("Error sending SSE event: %v", err)
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// writeStatusEvent записывает событие в формате text/event-stream
+func writeStatusEvent(w io.Writer, event StatusEvent) error {
+	data, err := protojson.Marshal(event.Status)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: status\ndata: %s\n\n", event.ID, data)
+	return err
+}
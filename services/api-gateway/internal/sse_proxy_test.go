@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+)
+
+func TestStatusHub_Replay(t *testing.T) {
+	hub := NewStatusHub(nil, 3)
+
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		hub.publish(&smarthomev1.StatusResponse{DeviceId: id})
+	}
+
+	tests := []struct {
+		name    string
+		lastID  uint64
+		resume  bool
+		wantIDs []uint64
+	}{
+		{
+			name:    "No Last-Event-ID",
+			resume:  false,
+			wantIDs: nil,
+		},
+		{
+			name:    "Resume inside buffer",
+			lastID:  3,
+			resume:  true,
+			wantIDs: []uint64{4, 5},
+		},
+		{
+			name:    "Resume before buffer start",
+			lastID:  1,
+			resume:  true,
+			wantIDs: []uint64{3, 4, 5},
+		},
+		{
+			name:    "Resume with unknown ID",
+			lastID:  100,
+			resume:  true,
+			wantIDs: []uint64{3, 4, 5},
+		},
+		{
+			name:    "Already up to date",
+			lastID:  5,
+			resume:  true,
+			wantIDs: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backlog, _, unsubscribe := hub.Subscribe(tt.lastID, tt.resume)
+			defer unsubscribe()
+
+			if len(backlog) != len(tt.wantIDs) {
+				t.Fatalf("Expected %d events, got %d", len(tt.wantIDs), len(backlog))
+			}
+			for i, event := range backlog {
+				if event.ID != tt.wantIDs[i] {
+					t.Errorf("Expected event ID %d, got %d", tt.wantIDs[i], event.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestStatusHub_SlowSubscriberDropped(t *testing.T) {
+	hub := NewStatusHub(nil, 10)
+	_, events, unsubscribe := hub.Subscribe(0, false)
+	defer unsubscribe()
+
+	for i := 0; i < subscriberBufferSize+1; i++ {
+		hub.publish(&smarthomev1.StatusResponse{DeviceId: "lamp"})
+	}
+
+	count := 0
+	for range events {
+		count++
+	}
+
+	if count != subscriberBufferSize {
+		t.Errorf("Expected %d buffered events before close, got %d", subscriberBufferSize, count)
+	}
+}
+
+func TestSSEProxy_StreamsEvents(t *testing.T) {
+	hub := NewStatusHub(nil, 10)
+	hub.publish(&smarthomev1.StatusResponse{DeviceId: "lamp"})
+	hub.publish(&smarthomev1.StatusResponse{DeviceId: "socket"})
+
+	srv := httptest.NewServer(NewSSEProxy(SSEConfig{Hub: hub}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"?device_id=socket", nil)
+	req.Header.Set("Last-Event-ID", "0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %s", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	// Событие из буфера для lamp отфильтровано, socket приходит с ID 2
+	expectLine(t, lines, "id: 2")
+
+	hub.publish(&smarthomev1.StatusResponse{DeviceId: "lamp"})
+	hub.publish(&smarthomev1.StatusResponse{DeviceId: "socket"})
+
+	expectLine(t, lines, "id: 4")
+}
+
+// expectLine ждет строку, начинающуюся с prefix, пропуская остальные
+func expectLine(t *testing.T, lines <-chan string, prefix string) {
+	t.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatalf("Stream closed before %q", prefix)
+			}
+			if strings.HasPrefix(line, "id: ") {
+				if line != prefix {
+					t.Fatalf("Expected %q, got %q", prefix, line)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %q", prefix)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal"
+)
+
+const (
+	// deviceCacheTTL - время жизни метаданных устройства (комната, тип) в кэше
+	deviceCacheTTL = time.Minute
+	// resubscribeDelay - пауза перед повторной подпиской на поток статусов
+	resubscribeDelay = time.Second
+	// queueSize - размер очереди доставок
+	queueSize = 1024
+)
+
+// StatusSource - источник обновлений статусов устройств (StatusHub)
+type StatusSource interface {
+	Subscribe(lastID uint64, resume bool) ([]internal.StatusEvent, <-chan internal.StatusEvent, func())
+}
+
+// Config содержит настройки доставки
+type Config struct {
+	Store        *Store
+	DeviceClient smarthomev1.DeviceServiceClient
+	Statuses     StatusSource
+
+	Workers        int           // Число параллельных доставок
+	MaxAttempts    int           // Попыток доставки одного события
+	InitialBackoff time.Duration // Пауза перед первым повтором, далее удваивается
+	MaxBackoff     time.Duration // Максимальная пауза между повторами
+	Timeout        time.Duration // Таймаут одного запроса
+	DisableAfter   int           // Неудачных доставок подряд до отключения подписки (0 - не отключать)
+
+	// Addresses проверяет адрес получателя при каждом подключении клиента
+	// по умолчанию. Заданный HTTPClient проверяет адреса сам.
+	Addresses  AddressPolicy
+	HTTPClient *http.Client
+}
+
+// delivery - доставка события одной подписке
+type delivery struct {
+	sub     Subscription
+	event   Event
+	body    []byte
+	attempt int
+}
+
+// cachedDevice - метаданные устройства в кэше
+type cachedDevice struct {
+	device  EventDevice
+	fetched time.Time
+}
+
+// Dispatcher превращает поток статусов в события и доставляет их подписчикам
+type Dispatcher struct {
+	cfg   Config
+	queue chan *delivery
+
+	mu      sync.Mutex
+	last    map[string]*smarthomev1.DeviceStatus
+	devices map[string]cachedDevice
+}
+
+// NewDispatcher создает диспетчер, незаданные параметры получают значения по умолчанию
+func NewDispatcher(cfg Config) *Dispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 5 * time.Minute
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.HTTPClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		// Запросы идут напрямую: через прокси проверялся бы адрес прокси
+		transport.Proxy = nil
+		transport.DialContext = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   cfg.Addresses.control,
+		}).DialContext
+		cfg.HTTPClient = &http.Client{
+			Transport: transport,
+			// Редиректы не выполняются: подписка доставляется только на указанный адрес
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	return &Dispatcher{
+		cfg:     cfg,
+		queue:   make(chan *delivery, queueSize),
+		last:    make(map[string]*smarthomev1.DeviceStatus),
+		devices: make(map[string]cachedDevice),
+	}
+}
+
+// Run запускает обработчики доставки и читает поток статусов до отмены контекста
+func (d *Dispatcher) Run(ctx context.Context) {
+	for i := 0; i < d.cfg.Workers; i++ {
+		go d.worker(ctx)
+	}
+
+	if d.cfg.Statuses == nil {
+		<-ctx.Done()
+		return
+	}
+
+	for {
+		_, events, unsubscribe := d.cfg.Statuses.Subscribe(0, false)
+		d.consume(ctx, events)
+		unsubscribe()
+
+		// Канал закрыт хабом (отставание) или контекст отменен
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// consume обрабатывает обновления статусов до закрытия канала
+func (d *Dispatcher) consume(ctx context.Context, events <-chan internal.StatusEvent) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			d.handleStatus(ctx, event.Status)
+		}
+	}
+}
+
+// handleStatus сравнивает статус с предыдущим и публикует изменения.
+// Первый статус устройства только запоминается: поток присылает полные
+// снимки, и без этого каждая переподписка порождала бы ложные события.
+func (d *Dispatcher) handleStatus(ctx context.Context, resp *smarthomev1.StatusResponse) {
+	if resp == nil || resp.Status == nil {
+		return
+	}
+
+	d.mu.Lock()
+	prev, seen := d.last[resp.DeviceId]
+	d.last[resp.DeviceId] = resp.Status
+	d.mu.Unlock()
+
+	if !seen {
+		return
+	}
+
+	eventType, changed := diffStatus(prev, resp.Status)
+	if eventType == "" {
+		return
+	}
+
+	event := Event{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		Time:       time.Now().UTC(),
+		Device:     d.device(ctx, resp.DeviceId),
+		Online:     resp.Status.Online,
+		Parameters: resp.Status.Parameters,
+		Changed:    changed,
+	}
+	if resp.Time != nil {
+		event.Time = resp.Time.AsTime().UTC()
+	}
+
+	d.Publish(event)
+}
+
+// diffStatus определяет тип события по двум статусам устройства
+func diffStatus(prev, cur *smarthomev1.DeviceStatus) (string, []string) {
+	if prev.Online != cur.Online {
+		if cur.Online {
+			return EventOnline, nil
+		}
+		return EventOffline, nil
+	}
+
+	var changed []string
+	for key, value := range cur.Parameters {
+		if old, ok := prev.Parameters[key]; !ok || old != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range prev.Parameters {
+		if _, ok := cur.Parameters[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	if prev.BatteryLevel != cur.BatteryLevel {
+		changed = append(changed, "battery_level")
+	}
+
+	if len(changed) == 0 {
+		return "", nil
+	}
+	sort.Strings(changed)
+	return EventChanged, changed
+}
+
+// device возвращает метаданные устройства из кэша или запрашивает их у сервиса устройств
+func (d *Dispatcher) device(ctx context.Context, id string) EventDevice {
+	d.mu.Lock()
+	cached, ok := d.devices[id]
+	d.mu.Unlock()
+	if ok && time.Since(cached.fetched) < deviceCacheTTL {
+		return cached.device
+	}
+
+	result := EventDevice{ID: id}
+	if d.cfg.DeviceClient == nil {
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	resp, err := d.cfg.DeviceClient.GetDevice(ctx, &smarthomev1.DeviceId{Id: id})
+	if err == nil && resp.Device == nil {
+		err = fmt.Errorf("empty response")
+	}
+	if err != nil {
+		log.Printf("Webhook: failed to get device %s: %v", id, err)
+		if ok {
+			return cached.device
+		}
+		return result
+	}
+
+	result.Name = resp.Device.Name
+	result.Type = resp.Device.Type
+	result.Room = resp.Device.Room
+
+	d.mu.Lock()
+	d.devices[id] = cachedDevice{device: result, fetched: time.Now()}
+	d.mu.Unlock()
+
+	return result
+}
+
+// Publish ставит событие в очередь доставки всем подходящим активным подпискам
+func (d *Dispatcher) Publish(event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Webhook: failed to marshal event %s: %v", event.ID, err)
+		return
+	}
+
+	for _, sub := range d.cfg.Store.active() {
+		if !sub.Filter.Match(event) {
+			continue
+		}
+		d.enqueue(&delivery{sub: sub, event: event, body: body, attempt: 1})
+	}
+}
+
+// enqueue добавляет доставку в очередь, не блокируясь
+func (d *Dispatcher) enqueue(del *delivery) {
+	select {
+	case d.queue <- del:
+	default:
+		log.Printf("Webhook: delivery queue is full, dropping event %s for subscription %s",
+			del.event.ID, del.sub.ID)
+	}
+}
+
+// worker выполняет доставки из очереди
+func (d *Dispatcher) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case del := <-d.queue:
+			d.deliver(ctx, del)
+		}
+	}
+}
+
+// deliver выполняет одну попытку доставки и планирует повтор при неудаче
+func (d *Dispatcher) deliver(ctx context.Context, del *delivery) {
+	// Подписку могли удалить или отключить, пока доставка ждала повтора
+	if !d.cfg.Store.isActive(del.sub.ID) {
+		return
+	}
+
+	attempt := d.send(ctx, del)
+	d.cfg.Store.recordAttempt(del.sub.ID, attempt)
+
+	if attempt.Success {
+		if _, err := d.cfg.Store.recordResult(del.sub.ID, true, d.cfg.DisableAfter); err != nil {
+			log.Printf("Webhook: failed to update subscription %s: %v", del.sub.ID, err)
+		}
+		return
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	if del.attempt < d.cfg.MaxAttempts {
+		retry := *del
+		retry.attempt++
+		time.AfterFunc(d.backoff(del.attempt), func() {
+			if ctx.Err() == nil {
+				d.enqueue(&retry)
+			}
+		})
+		return
+	}
+
+	// Все попытки исчерпаны - доставка считается неудачной
+	disabled, err := d.cfg.Store.recordResult(del.sub.ID, false, d.cfg.DisableAfter)
+	if err != nil {
+		log.Printf("Webhook: failed to update subscription %s: %v", del.sub.ID, err)
+	}
+	if disabled {
+		log.Printf("Webhook: subscription %s disabled after repeated delivery failures", del.sub.ID)
+	}
+}
+
+// send отправляет подписанный запрос получателю
+func (d *Dispatcher) send(ctx context.Context, del *delivery) Attempt {
+	start := time.Now()
+	attempt := Attempt{
+		EventID:   del.event.ID,
+		EventType: del.event.Type,
+		Attempt:   del.attempt,
+		Time:      start.UTC(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.sub.URL, bytes.NewReader(del.body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	timestamp := start.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mini-smart-home-webhook/1.0")
+	req.Header.Set(HeaderEvent, del.event.Type)
+	req.Header.Set(HeaderEventID, del.event.ID)
+	req.Header.Set(HeaderAttempt, strconv.Itoa(del.attempt))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(del.sub.Secret, timestamp, del.body))
+
+	resp, err := d.cfg.HTTPClient.Do(req)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = resp.StatusCode
+	attempt.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !attempt.Success {
+		attempt.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+// backoff возвращает паузу перед повтором после попытки attempt
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.cfg.InitialBackoff
+	for i := 1; i < attempt && delay < d.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.cfg.MaxBackoff {
+		delay = d.cfg.MaxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,164 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	authMiddleware "github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/middleware"
+	"google.golang.org/grpc/codes"
+)
+
+// maxRequestSize - максимальный размер тела запроса на создание подписки
+const maxRequestSize = 64 << 10
+
+// createRequest - тело запроса на создание подписки
+type createRequest struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+	Filter Filter `json:"filter"`
+}
+
+// NewHandler возвращает REST API подписок текущего пользователя.
+// Монтируется в защищенную группу маршрутов, пользователь берется из JWT.
+// Адреса новых подписок проверяются политикой addresses.
+func NewHandler(store *Store, addresses AddressPolicy) http.Handler {
+	h := &handler{store: store, addresses: addresses}
+
+	r := chi.NewRouter()
+	r.Post("/", h.create)
+	r.Get("/", h.list)
+	r.Get("/{id}", h.get)
+	r.Delete("/{id}", h.delete)
+	r.Post("/{id}/enable", h.enable)
+	r.Get("/{id}/deliveries", h.deliveries)
+	return r
+}
+
+type handler struct {
+	store     *Store
+	addresses AddressPolicy
+}
+
+// create регистрирует подписку. Если секрет не указан, он генерируется;
+// секрет возвращается только в ответе на этот запрос.
+func (h *handler) create(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		apierror.WriteProblem(w, r, apierror.New(codes.InvalidArgument, apierror.ReasonValidationFailed, "invalid request body: "+err.Error()))
+		return
+	}
+
+	if err := ValidateURL(r.Context(), req.URL, h.addresses); err != nil {
+		apierror.WriteProblem(w, r, apierror.InvalidArgument(err.Error(),
+			apierror.FieldViolation{Field: "url", Description: err.Error()}))
+		return
+	}
+	if err := req.Filter.Validate(); err != nil {
+		apierror.WriteProblem(w, r, apierror.InvalidArgument(err.Error(),
+			apierror.FieldViolation{Field: "filter", Description: err.Error()}))
+		return
+	}
+
+	if req.Secret == "" {
+		secret, err := generateSecret()
+		if err != nil {
+			apierror.WriteProblem(w, r, apierror.New(codes.Internal, apierror.ReasonInternal, "failed to generate secret"))
+			return
+		}
+		req.Secret = secret
+	}
+
+	sub, err := h.store.Create(Subscription{
+		UserID: authMiddleware.UserID(r),
+		URL:    req.URL,
+		Secret: req.Secret,
+		Filter: req.Filter,
+	})
+	if err != nil {
+		log.Printf("Webhook: failed to create subscription: %v", err)
+		apierror.WriteProblem(w, r, apierror.New(codes.Internal, apierror.ReasonInternal, "failed to create subscription"))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"webhooks": h.store.List(authMiddleware.UserID(r)),
+	})
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.store.Get(authMiddleware.UserID(r), chi.URLParam(r, "id"))
+	if !ok {
+		notFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, sub)
+}
+
+func (h *handler) delete(w http.ResponseWriter, r *http.Request) {
+	ok, err := h.store.Delete(authMiddleware.UserID(r), chi.URLParam(r, "id"))
+	if !ok {
+		notFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Webhook: failed to save store after delete: %v", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// enable снова включает подписку, отключенную после серии неудачных доставок
+func (h *handler) enable(w http.ResponseWriter, r *http.Request) {
+	sub, ok, err := h.store.Enable(authMiddleware.UserID(r), chi.URLParam(r, "id"))
+	if !ok {
+		notFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Webhook: failed to save store after enable: %v", err)
+	}
+	writeJSON(w, http.StatusOK, sub)
+}
+
+// deliveries возвращает журнал последних попыток доставки
+func (h *handler) deliveries(w http.ResponseWriter, r *http.Request) {
+	attempts, ok := h.store.Attempts(authMiddleware.UserID(r), chi.URLParam(r, "id"))
+	if !ok {
+		notFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deliveries": attempts})
+}
+
+// notFound отвечает 404 для неизвестной или чужой подписки
+func notFound(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	apierror.WriteProblem(w, r, apierror.Newf(codes.NotFound, apierror.ReasonWebhookNotFound, "webhook %s not found", id).
+		WithMetadata("webhook_id", id))
+}
+
+// generateSecret создает случайный секрет подписи
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,267 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxAttemptsKept - сколько последних попыток доставки хранится для подписки
+const maxAttemptsKept = 50
+
+// Store хранит подписки в памяти и, если указан файл, сохраняет их на диск.
+// Журнал попыток доставки хранится только в памяти.
+type Store struct {
+	mu       sync.Mutex
+	path     string
+	subs     map[string]*Subscription
+	attempts map[string][]Attempt
+	now      func() time.Time
+}
+
+// NewStore создает хранилище и загружает подписки из файла path (пусто - только в памяти)
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:     path,
+		subs:     make(map[string]*Subscription),
+		attempts: make(map[string][]Attempt),
+		now:      time.Now,
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook store: %w", err)
+	}
+
+	var subs []*Subscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook store: %w", err)
+	}
+	for _, sub := range subs {
+		s.subs[sub.ID] = sub
+	}
+
+	return s, nil
+}
+
+// Create сохраняет новую подписку
+func (s *Store) Create(sub Subscription) (Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub.ID = uuid.New().String()
+	sub.Active = true
+	sub.CreatedAt = s.now().UTC()
+	s.subs[sub.ID] = &sub
+
+	if err := s.save(); err != nil {
+		delete(s.subs, sub.ID)
+		return Subscription{}, err
+	}
+	return sub, nil
+}
+
+// List возвращает подписки пользователя в порядке создания (без секретов)
+func (s *Store) List(userID string) []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []Subscription{}
+	for _, sub := range s.subs {
+		if sub.UserID == userID {
+			result = append(result, redact(*sub))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// Get возвращает подписку пользователя (без секрета)
+func (s *Store) Get(userID, id string) (Subscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	if !ok || sub.UserID != userID {
+		return Subscription{}, false
+	}
+	return redact(*sub), true
+}
+
+// Delete удаляет подписку пользователя
+func (s *Store) Delete(userID, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	if !ok || sub.UserID != userID {
+		return false, nil
+	}
+
+	delete(s.subs, id)
+	delete(s.attempts, id)
+	return true, s.save()
+}
+
+// Enable снова включает подписку и сбрасывает счетчик отказов
+func (s *Store) Enable(userID, id string) (Subscription, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	if !ok || sub.UserID != userID {
+		return Subscription{}, false, nil
+	}
+
+	sub.Active = true
+	sub.Failures = 0
+	sub.DisabledReason = ""
+	return redact(*sub), true, s.save()
+}
+
+// Attempts возвращает последние попытки доставки по подписке пользователя, новые первыми
+func (s *Store) Attempts(userID, id string) ([]Attempt, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	if !ok || sub.UserID != userID {
+		return nil, false
+	}
+
+	attempts := s.attempts[id]
+	result := make([]Attempt, 0, len(attempts))
+	for i := len(attempts) - 1; i >= 0; i-- {
+		result = append(result, attempts[i])
+	}
+	return result, true
+}
+
+// active возвращает активные подписки (с секретами) для рассылки
+func (s *Store) active() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []Subscription
+	for _, sub := range s.subs {
+		if sub.Active {
+			result = append(result, *sub)
+		}
+	}
+	return result
+}
+
+// isActive проверяет, что подписка существует и не отключена
+func (s *Store) isActive(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	return ok && sub.Active
+}
+
+// recordAttempt добавляет попытку в журнал подписки
+func (s *Store) recordAttempt(id string, attempt Attempt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subs[id]; !ok {
+		return
+	}
+
+	attempts := append(s.attempts[id], attempt)
+	if len(attempts) > maxAttemptsKept {
+		attempts = attempts[len(attempts)-maxAttemptsKept:]
+	}
+	s.attempts[id] = attempts
+}
+
+// recordResult учитывает итог доставки события. После disableAfter
+// неудачных доставок подряд подписка отключается; возвращает true, если
+// подписка была отключена этим вызовом.
+func (s *Store) recordResult(id string, success bool, disableAfter int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	if !ok {
+		return false, nil
+	}
+
+	if success {
+		if sub.Failures == 0 {
+			return false, nil
+		}
+		sub.Failures = 0
+		return false, s.save()
+	}
+
+	sub.Failures++
+	if !sub.Active || disableAfter <= 0 || sub.Failures < disableAfter {
+		return false, s.save()
+	}
+
+	sub.Active = false
+	sub.DisabledReason = fmt.Sprintf("disabled after %d consecutive failed deliveries", sub.Failures)
+	return true, s.save()
+}
+
+// save записывает подписки в файл. Вызывается под s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	subs := make([]*Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+
+	data, err := json.MarshalIndent(subs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Запись через временный файл, чтобы не повредить хранилище при сбое
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to save webhook store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save webhook store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save webhook store: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return fmt.Errorf("failed to save webhook store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save webhook store: %w", err)
+	}
+	return nil
+}
+
+// redact убирает секрет из подписки
+func redact(sub Subscription) Subscription {
+	sub.Secret = ""
+	return sub
+}
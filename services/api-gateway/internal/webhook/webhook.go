@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// lookupTimeout - время на разрешение имени хоста при создании подписки
+const lookupTimeout = 5 * time.Second
+
+// Типы событий устройств
+const (
+	EventOnline  = "device.online"  // Устройство появилось в сети
+	EventOffline = "device.offline" // Устройство пропало из сети
+	EventChanged = "device.changed" // Изменились параметры устройства
+)
+
+var eventTypes = map[string]bool{
+	EventOnline:  true,
+	EventOffline: true,
+	EventChanged: true,
+}
+
+// Заголовки запросов доставки
+const (
+	HeaderSignature = "X-Webhook-Signature" // sha256=<HMAC>
+	HeaderTimestamp = "X-Webhook-Timestamp" // Unix-время, входит в подпись
+	HeaderEvent     = "X-Webhook-Event"     // Тип события
+	HeaderEventID   = "X-Webhook-Id"        // Идентификатор события, одинаков для всех попыток
+	HeaderAttempt   = "X-Webhook-Attempt"   // Номер попытки доставки
+)
+
+// Filter отбирает события для подписки. Пустое поле не ограничивает отбор.
+type Filter struct {
+	DeviceIDs []string `json:"device_ids,omitempty"`
+	Rooms     []string `json:"rooms,omitempty"`
+	Types     []string `json:"types,omitempty"`
+	Events    []string `json:"events,omitempty"`
+}
+
+// Validate проверяет типы событий фильтра
+func (f Filter) Validate() error {
+	for _, event := range f.Events {
+		if !eventTypes[event] {
+			return fmt.Errorf("unknown event type %q", event)
+		}
+	}
+	return nil
+}
+
+// Match проверяет, подходит ли событие под фильтр
+func (f Filter) Match(e Event) bool {
+	return matchAny(f.DeviceIDs, e.Device.ID, false) &&
+		matchAny(f.Rooms, e.Device.Room, true) &&
+		matchAny(f.Types, e.Device.Type, false) &&
+		matchAny(f.Events, e.Type, false)
+}
+
+// matchAny возвращает true для пустого списка или если значение есть в списке
+func matchAny(values []string, value string, ignoreCase bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value || (ignoreCase && strings.EqualFold(v, value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription - подписка пользователя на события устройств
+type Subscription struct {
+	ID             string    `json:"id"`
+	UserID         string    `json:"user_id"`
+	URL            string    `json:"url"`
+	Secret         string    `json:"secret,omitempty"` // Возвращается только при создании
+	Filter         Filter    `json:"filter"`
+	Active         bool      `json:"active"`
+	Failures       int       `json:"consecutive_failures"` // Неудачных доставок подряд
+	DisabledReason string    `json:"disabled_reason,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// AddressPolicy ограничивает адреса получателей, чтобы подписка не могла
+// обращаться к самому шлюзу и внутренним сервисам (SSRF). Loopback,
+// link-local (в том числе метаданные облака 169.254.169.254), multicast
+// и неуказанные адреса запрещены всегда.
+type AddressPolicy struct {
+	// AllowPrivate разрешает частные сети (10.0.0.0/8, 172.16.0.0/12,
+	// 192.168.0.0/16, fc00::/7), например Node-RED в домашней сети
+	AllowPrivate bool
+}
+
+// CheckIP проверяет, можно ли доставлять вебхуки на адрес ip
+func (p AddressPolicy) CheckIP(ip net.IP) error {
+	switch {
+	case ip.IsLoopback():
+		return fmt.Errorf("loopback address %s is not allowed", ip)
+	case ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast():
+		return fmt.Errorf("link-local address %s is not allowed", ip)
+	case ip.IsUnspecified() || (ip.To4() != nil && ip.To4()[0] == 0):
+		return fmt.Errorf("unspecified address %s is not allowed", ip)
+	case ip.IsMulticast():
+		return fmt.Errorf("multicast address %s is not allowed", ip)
+	case ip.IsPrivate() && !p.AllowPrivate:
+		return fmt.Errorf("private address %s is not allowed", ip)
+	}
+	return nil
+}
+
+// control проверяет адрес при подключении (net.Dialer.Control): имя хоста
+// могло начать указывать на запрещенный адрес после создания подписки
+func (p AddressPolicy) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(stripZone(host))
+	if ip == nil {
+		return fmt.Errorf("invalid address %s", address)
+	}
+	return p.CheckIP(ip)
+}
+
+// ValidateURL проверяет адрес получателя. Имя хоста разрешается, и все его
+// адреса проверяются политикой. Если имя не удалось разрешить, подписка
+// создается: адрес все равно проверяется при каждой доставке.
+func ValidateURL(ctx context.Context, raw string, policy AddressPolicy) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url scheme must be http or https")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("url host is required")
+	}
+
+	host := stripZone(u.Hostname())
+	if ip := net.ParseIP(host); ip != nil {
+		return policy.CheckIP(ip)
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("loopback host %s is not allowed", host)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if err := policy.CheckIP(addr.IP); err != nil {
+			return fmt.Errorf("url host %s resolves to %w", host, err)
+		}
+	}
+	return nil
+}
+
+// stripZone удаляет зону IPv6-адреса (fe80::1%eth0)
+func stripZone(host string) string {
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		return host[:i]
+	}
+	return host
+}
+
+// EventDevice - метаданные устройства в событии
+type EventDevice struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	Type string `json:"type,omitempty"`
+	Room string `json:"room,omitempty"`
+}
+
+// Event - тело запроса доставки
+type Event struct {
+	ID         string            `json:"id"`
+	Type       string            `json:"type"`
+	Time       time.Time         `json:"time"`
+	Device     EventDevice       `json:"device"`
+	Online     bool              `json:"online"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Changed    []string          `json:"changed,omitempty"` // Изменившиеся параметры для device.changed
+}
+
+// Attempt - запись о попытке доставки
+type Attempt struct {
+	EventID    string    `json:"event_id"`
+	EventType  string    `json:"event_type"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	DurationMs int64     `json:"duration_ms"`
+	Time       time.Time `json:"time"`
+}
+
+// Sign вычисляет подпись тела запроса: HMAC-SHA256 от "<timestamp>.<body>"
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись на стороне получателя
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
@@ -0,0 +1,413 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth/v5"
+	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal"
+	authMiddleware "github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/middleware"
+	"google.golang.org/grpc"
+)
+
+// fakeDeviceClient возвращает метаданные одного устройства
+type fakeDeviceClient struct {
+	smarthomev1.DeviceServiceClient
+}
+
+func (c *fakeDeviceClient) GetDevice(ctx context.Context, in *smarthomev1.DeviceId, opts ...grpc.CallOption) (*smarthomev1.GetDeviceResponse, error) {
+	return &smarthomev1.GetDeviceResponse{Device: &smarthomev1.Device{
+		Id: in.Id, Name: "Лампа", Type: "lamp", Room: "Кухня",
+	}}, nil
+}
+
+// fakeStatuses - источник статусов с одним подписчиком
+type fakeStatuses struct {
+	ch chan internal.StatusEvent
+}
+
+func (s *fakeStatuses) Subscribe(lastID uint64, resume bool) ([]internal.StatusEvent, <-chan internal.StatusEvent, func()) {
+	return nil, s.ch, func() {}
+}
+
+func status(online bool, power string) internal.StatusEvent {
+	return internal.StatusEvent{Status: &smarthomev1.StatusResponse{
+		DeviceId: "lamp-1",
+		Status:   &smarthomev1.DeviceStatus{Online: online, Parameters: map[string]string{"power": power}},
+	}}
+}
+
+// receiver - тестовый получатель вебхуков, отвечающий кодами из statuses по очереди
+type receiver struct {
+	t        *testing.T
+	secret   string
+	statuses []int
+
+	mu       sync.Mutex
+	events   []Event
+	attempts []string
+	calls    int32
+	done     chan struct{}
+}
+
+func newReceiver(t *testing.T, secret string, statuses ...int) (*receiver, *httptest.Server) {
+	r := &receiver{t: t, secret: secret, statuses: statuses, done: make(chan struct{}, 16)}
+	srv := httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+func (r *receiver) serve(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	timestamp, _ := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if !Verify(r.secret, timestamp, body, req.Header.Get(HeaderSignature)) {
+		r.t.Errorf("Invalid signature %q", req.Header.Get(HeaderSignature))
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		r.t.Errorf("Invalid body: %v", err)
+	}
+	if req.Header.Get(HeaderEvent) != event.Type || req.Header.Get(HeaderEventID) != event.ID {
+		r.t.Errorf("Event headers do not match body: %v", req.Header)
+	}
+
+	call := int(atomic.AddInt32(&r.calls, 1))
+	code := http.StatusOK
+	if call <= len(r.statuses) {
+		code = r.statuses[call-1]
+	}
+
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.attempts = append(r.attempts, req.Header.Get(HeaderAttempt))
+	r.mu.Unlock()
+
+	w.WriteHeader(code)
+	r.done <- struct{}{}
+}
+
+func (r *receiver) wait(n int) {
+	r.t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.done:
+		case <-time.After(5 * time.Second):
+			r.t.Fatalf("Expected %d deliveries, got %d", n, i)
+		}
+	}
+}
+
+func newDispatcher(t *testing.T, store *Store, cfg Config) (*Dispatcher, *fakeStatuses) {
+	statuses := &fakeStatuses{ch: make(chan internal.StatusEvent, 8)}
+	cfg.Store = store
+	cfg.DeviceClient = &fakeDeviceClient{}
+	cfg.Statuses = statuses
+	cfg.InitialBackoff = 10 * time.Millisecond
+	cfg.MaxBackoff = 20 * time.Millisecond
+	if cfg.HTTPClient == nil {
+		// Получатели тестов слушают loopback, который клиент по умолчанию запрещает
+		cfg.HTTPClient = &http.Client{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	d := NewDispatcher(cfg)
+	go d.Run(ctx)
+	return d, statuses
+}
+
+func TestDispatcher_DeliversSignedChanges(t *testing.T) {
+	store, _ := NewStore("")
+	recv, srv := newReceiver(t, "s3cret")
+	store.Create(Subscription{UserID: "user-1", URL: srv.URL, Secret: "s3cret"})
+
+	// Один обработчик сохраняет порядок доставки
+	_, statuses := newDispatcher(t, store, Config{Workers: 1})
+
+	// Первый снимок - только база для сравнения, повтор без изменений не порождает событий
+	statuses.ch <- status(true, "off")
+	statuses.ch <- status(true, "off")
+	statuses.ch <- status(true, "on")
+	statuses.ch <- status(false, "on")
+	recv.wait(2)
+
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+
+	if len(recv.events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(recv.events))
+	}
+	changed := recv.events[0]
+	if changed.Type != EventChanged || len(changed.Changed) != 1 || changed.Changed[0] != "power" {
+		t.Errorf("Unexpected first event: %+v", changed)
+	}
+	if changed.Device.Room != "Кухня" || changed.Device.Type != "lamp" {
+		t.Errorf("Expected device metadata in event, got %+v", changed.Device)
+	}
+	if recv.events[1].Type != EventOffline {
+		t.Errorf("Expected %s, got %s", EventOffline, recv.events[1].Type)
+	}
+}
+
+func TestDispatcher_RetriesWithBackoff(t *testing.T) {
+	store, _ := NewStore("")
+	recv, srv := newReceiver(t, "key", http.StatusInternalServerError, http.StatusBadGateway)
+	sub, _ := store.Create(Subscription{UserID: "user-1", URL: srv.URL, Secret: "key"})
+
+	d, _ := newDispatcher(t, store, Config{MaxAttempts: 3, DisableAfter: 1})
+	d.Publish(Event{ID: "evt-1", Type: EventChanged, Device: EventDevice{ID: "lamp-1"}})
+	recv.wait(3)
+
+	recv.mu.Lock()
+	if strings.Join(recv.attempts, ",") != "1,2,3" {
+		t.Errorf("Expected attempts 1,2,3, got %v", recv.attempts)
+	}
+	for _, event := range recv.events {
+		if event.ID != "evt-1" {
+			t.Errorf("Retries must keep the event ID, got %s", event.ID)
+		}
+	}
+	recv.mu.Unlock()
+
+	// Журнал обновляется после ответа получателя
+	waitFor(t, func() bool {
+		attempts, _ := store.Attempts("user-1", sub.ID)
+		return len(attempts) == 3
+	})
+	attempts, _ := store.Attempts("user-1", sub.ID)
+	if !attempts[0].Success || attempts[1].StatusCode != http.StatusBadGateway || attempts[2].Success {
+		t.Errorf("Unexpected attempt log: %+v", attempts)
+	}
+
+	// Успешная доставка после повторов не отключает подписку
+	if got, _ := store.Get("user-1", sub.ID); !got.Active || got.Failures != 0 {
+		t.Errorf("Expected active subscription, got %+v", got)
+	}
+}
+
+func TestDispatcher_DisablesFailingEndpoint(t *testing.T) {
+	store, _ := NewStore("")
+	recv, srv := newReceiver(t, "key", http.StatusInternalServerError, http.StatusInternalServerError,
+		http.StatusInternalServerError, http.StatusInternalServerError)
+	sub, _ := store.Create(Subscription{UserID: "user-1", URL: srv.URL, Secret: "key"})
+
+	d, _ := newDispatcher(t, store, Config{MaxAttempts: 2, DisableAfter: 2})
+	d.Publish(Event{ID: "evt-1", Type: EventChanged})
+	recv.wait(2)
+	waitFor(t, func() bool {
+		got, _ := store.Get("user-1", sub.ID)
+		return got.Failures == 1
+	})
+	if got, _ := store.Get("user-1", sub.ID); !got.Active {
+		t.Fatalf("Subscription disabled too early: %+v", got)
+	}
+
+	d.Publish(Event{ID: "evt-2", Type: EventChanged})
+	recv.wait(2)
+	waitFor(t, func() bool {
+		got, _ := store.Get("user-1", sub.ID)
+		return !got.Active
+	})
+	if got, _ := store.Get("user-1", sub.ID); got.DisabledReason == "" {
+		t.Errorf("Expected disabled reason, got %+v", got)
+	}
+
+	// Отключенная подписка больше не получает событий
+	d.Publish(Event{ID: "evt-3", Type: EventChanged})
+	time.Sleep(50 * time.Millisecond)
+	if calls := atomic.LoadInt32(&recv.calls); calls != 4 {
+		t.Errorf("Expected 4 deliveries, got %d", calls)
+	}
+
+	if got, ok, _ := store.Enable("user-1", sub.ID); !ok || !got.Active || got.Failures != 0 {
+		t.Errorf("Enable failed: %+v", got)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Condition not met")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFilter_Match(t *testing.T) {
+	event := Event{Type: EventOnline, Device: EventDevice{ID: "lamp-1", Type: "lamp", Room: "Кухня"}}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"device", Filter{DeviceIDs: []string{"lamp-2", "lamp-1"}}, true},
+		{"other device", Filter{DeviceIDs: []string{"lamp-2"}}, false},
+		{"room ignores case", Filter{Rooms: []string{"кухня"}}, true},
+		{"type and event", Filter{Types: []string{"lamp"}, Events: []string{EventOnline}}, true},
+		{"other event", Filter{Events: []string{EventOffline}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(event); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := (Filter{Events: []string{"device.exploded"}}).Validate(); err == nil {
+		t.Error("Expected error for unknown event type")
+	}
+}
+
+func TestStore_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	sub, err := store.Create(Subscription{UserID: "user-1", URL: "http://example.com/hook", Secret: "key"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	reopened, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	active := reopened.active()
+	if len(active) != 1 || active[0].ID != sub.ID || active[0].Secret != "key" {
+		t.Errorf("Subscription was not restored: %+v", active)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	store, _ := NewStore("")
+	r := chi.NewRouter()
+	r.Use(jwtauth.Verifier(authMiddleware.TokenAuth), authMiddleware.JWT)
+	r.Mount("/api/v1/webhooks", NewHandler(store, AddressPolicy{}))
+
+	do := func(user, method, path, body string) *httptest.ResponseRecorder {
+		token, _ := authMiddleware.GenerateToken(user, user)
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, body := range []string{
+		`{"url":"ftp://example.com"}`,
+		`{"url":"http://example.com","filter":{"events":["device.unknown"]}}`,
+		`{"url":"http://example.com","extra":true}`,
+		`{"url":"http://169.254.169.254/latest/meta-data"}`,
+	} {
+		if rec := do("user-1", http.MethodPost, "/api/v1/webhooks", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, rec.Code)
+		}
+	}
+
+	rec := do("user-1", http.MethodPost, "/api/v1/webhooks",
+		`{"url":"https://example.com/hook","filter":{"rooms":["Кухня"],"events":["device.offline"]}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created Subscription
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.ID == "" || len(created.Secret) != 64 || !created.Active {
+		t.Fatalf("Unexpected subscription: %+v", created)
+	}
+
+	rec = do("user-1", http.MethodGet, "/api/v1/webhooks/"+created.ID, "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), created.Secret) {
+		t.Errorf("Expected subscription without secret, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Подписки другого пользователя недоступны
+	if rec := do("user-2", http.MethodGet, "/api/v1/webhooks/"+created.ID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for other user, got %d", rec.Code)
+	}
+	if rec := do("user-2", http.MethodGet, "/api/v1/webhooks", ""); !strings.Contains(rec.Body.String(), `"webhooks":[]`) {
+		t.Errorf("Expected empty list for other user, got %s", rec.Body.String())
+	}
+
+	if rec := do("user-1", http.MethodGet, "/api/v1/webhooks/"+created.ID+"/deliveries", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for deliveries, got %d", rec.Code)
+	}
+	if rec := do("user-1", http.MethodDelete, "/api/v1/webhooks/"+created.ID, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", rec.Code)
+	}
+	if rec := do("user-1", http.MethodGet, "/api/v1/webhooks/"+created.ID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d", rec.Code)
+	}
+}
+
+func TestValidateURL_RejectsInternalAddresses(t *testing.T) {
+	ctx := context.Background()
+
+	for _, raw := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://api.localhost/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[fe80::1%25eth0]/hook",
+		"http://0.0.0.0/hook",
+		"http://[::]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://192.168.1.10:1880/hook",
+		"http://10.0.0.5/hook",
+	} {
+		if err := ValidateURL(ctx, raw, AddressPolicy{}); err == nil {
+			t.Errorf("Expected %s to be rejected", raw)
+		}
+	}
+
+	// Частные сети разрешаются флагом, loopback и link-local - никогда
+	private := AddressPolicy{AllowPrivate: true}
+	if err := ValidateURL(ctx, "http://192.168.1.10:1880/hook", private); err != nil {
+		t.Errorf("Expected private address to be allowed: %v", err)
+	}
+	for _, raw := range []string{"http://127.0.0.1/hook", "http://169.254.169.254/"} {
+		if err := ValidateURL(ctx, raw, private); err == nil {
+			t.Errorf("Expected %s to be rejected with private networks allowed", raw)
+		}
+	}
+
+	if err := ValidateURL(ctx, "https://203.0.113.10/hook", AddressPolicy{}); err != nil {
+		t.Errorf("Expected public address to be allowed: %v", err)
+	}
+}
+
+func TestDispatcher_DefaultClientRejectsLoopback(t *testing.T) {
+	_, srv := newReceiver(t, "secret")
+
+	// Имя хоста уже прошло проверку при создании подписки, адрес
+	// проверяется еще раз при подключении
+	d := NewDispatcher(Config{})
+	if resp, err := d.cfg.HTTPClient.Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Fatalf("Expected delivery to %s to be refused", srv.URL)
+	} else if !strings.Contains(err.Error(), "loopback address") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
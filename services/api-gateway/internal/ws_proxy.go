@@ -7,12 +7,31 @@ import (
 	"net/http"
 
 	"github.com/gorilla/websocket"
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
 	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/api-gateway/internal/drain"
+	"google.golang.org/grpc/codes"
 )
 
 // WebSocketConfig содержит настройки для WebSocket-прокси
 type WebSocketConfig struct {
 	DeviceClient smarthomev1.DeviceServiceClient
+	Drainer      *drain.Drainer // Закрывает соединения при остановке шлюза (nil - не отслеживать)
+
+	// CheckOrigin проверяет заголовок Origin (nil - только тот же хост)
+	CheckOrigin func(r *http.Request) bool
+}
+
+// UpgradeError отвечает на отклоненное подключение WebSocket в формате problem+json
+func UpgradeError(w http.ResponseWriter, r *http.Request, status int, reason error) {
+	if status == http.StatusForbidden {
+		// gorilla/websocket отвечает 403 только при отказе CheckOrigin
+		apierror.WriteProblemStatus(w, r, status, apierror.Newf(codes.PermissionDenied,
+			apierror.ReasonCORSRejected, "origin %s is not allowed", r.Header.Get("Origin")))
+		return
+	}
+	apierror.WriteProblemStatus(w, r, status, apierror.New(codes.InvalidArgument,
+		apierror.ReasonValidationFailed, reason.Error()))
 }
 
 // NewWebSocketProxy создает новый обработчик для WebSocket соединений
@@ -20,9 +39,8 @@ func NewWebSocketProxy(config WebSocketConfig) http.HandlerFunc {
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
-		CheckOrigin: func(r *http.Request) bool {
-			return true // В продакшене следует ограничить источники запроса
-		},
+		CheckOrigin:     config.CheckOrigin,
+		Error:           UpgradeError,
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -34,6 +52,14 @@ func NewWebSocketProxy(config WebSocketConfig) http.HandlerFunc {
 		}
 		defer conn.Close()
 
+		if config.Drainer != nil {
+			release, ok := config.Drainer.Track(conn)
+			defer release()
+			if !ok {
+				return
+			}
+		}
+
 		log.Printf("WebSocket connection established from %s", r.RemoteAddr)
 
 		// Создаем контекст, который можно отменить при закрытии соединения
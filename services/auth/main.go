@@ -7,6 +7,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/velvetriddles/mini-smart-home/libs/tlsutil"
 	"go.uber.org/zap"
 )
 
@@ -18,6 +19,7 @@ type AuthConfig struct {
 	RedisDSN    string
 	JwtSecret   string
 	JwtTTL      time.Duration
+	TLS         tlsutil.Config
 }
 
 func main() {
@@ -38,6 +40,7 @@ func main() {
 		RedisDSN:    getEnv("REDIS_DSN", "redis://localhost:6379/0"),
 		JwtSecret:   getEnv("JWT_SECRET", "super-secret-key-change-in-production"),
 		JwtTTL:      getEnvDuration("JWT_TTL", 24*time.Hour),
+		TLS:         tlsutil.FromEnv(""), // TLS_CA_FILE, TLS_CERT_FILE, TLS_KEY_FILE
 	}
 
 	// Создание и запуск сервера (преобразуем в формат, ожидаемый NewServer)
@@ -48,6 +51,7 @@ func main() {
 		RedisDSN:    authConfig.RedisDSN,
 		JwtSecret:   authConfig.JwtSecret,
 		JwtTTL:      authConfig.JwtTTL,
+		TLS:         authConfig.TLS,
 	}
 
 	server, err := NewServer(config)
@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -19,6 +21,9 @@ import (
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	_ "github.com/lib/pq"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	"github.com/velvetriddles/mini-smart-home/libs/sysstatus"
+	"github.com/velvetriddles/mini-smart-home/libs/tlsutil"
 	smarthomev1 "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
@@ -45,6 +50,7 @@ type Config struct {
 	RedisDSN    string
 	JwtSecret   string
 	JwtTTL      time.Duration
+	TLS         tlsutil.Config // mTLS для gRPC (пусто - без шифрования)
 }
 
 // Server представляет собой сервер аутентификации
@@ -100,12 +106,20 @@ func NewServer(config *Config) (*Server, error) {
 	// Настройка Prometheus метрик для gRPC
 	grpc_prometheus.EnableHandlingTimeHistogram()
 
+	// Учетные данные gRPC: mTLS с общим CA, если заданы сертификаты
+	creds, err := config.TLS.ServerOption()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+
 	// Создание gRPC сервера с middleware
 	grpcServer := grpc.NewServer(
+		creds,
 		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
 			grpc_prometheus.UnaryServerInterceptor,
 			grpc_recovery.UnaryServerInterceptor(),
 			grpc_logging.UnaryServerInterceptor(logger),
+			apierror.UnaryServerInterceptor(),
 		)),
 	)
 
@@ -134,6 +148,10 @@ func NewServer(config *Config) (*Server, error) {
 	// В реальном приложении здесь был бы вызов pb.RegisterAuthServiceServer(grpcServer, server)
 	// Но мы используем только health сервис для примера
 	healthpb.RegisterHealthServer(grpcServer, server)
+	smarthomev1.RegisterSystemServiceServer(grpcServer, sysstatus.NewServer("auth",
+		sysstatus.Dependency{Name: "postgres", Check: server.checkPostgres},
+		sysstatus.Dependency{Name: "redis", Check: server.checkRedis},
+	))
 	reflection.Register(grpcServer)
 
 	// Настройка HTTP маршрутов
@@ -225,7 +243,7 @@ func (s *Server) Start() error {
 
 	// Запуск gRPC сервера в горутине
 	go func() {
-		s.logger.Info("Starting gRPC server", zap.String("port", s.config.GrpcPort))
+		s.logger.Info("Starting gRPC server", zap.String("port", s.config.GrpcPort), zap.Bool("mtls", s.config.TLS.Enabled()))
 		if err := s.grpcServer.Serve(lis); err != nil {
 			s.logger.Fatal("Failed to serve gRPC", zap.Error(err))
 		}
@@ -308,6 +326,26 @@ func (s *Server) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*
 	}, nil
 }
 
+// checkPostgres проверяет соединение с PostgreSQL для SystemService
+func (s *Server) checkPostgres(ctx context.Context) (map[string]string, error) {
+	if err := s.db.PingContext(ctx); err != nil {
+		return nil, err
+	}
+	stats := s.db.Stats()
+	return map[string]string{
+		"open_connections": strconv.Itoa(stats.OpenConnections),
+		"in_use":           strconv.Itoa(stats.InUse),
+	}, nil
+}
+
+// checkRedis проверяет соединение с Redis для SystemService
+func (s *Server) checkRedis(ctx context.Context) (map[string]string, error) {
+	if err := s.redisClient.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
 // Watch implements the Watch method for the health server
 func (s *Server) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
 	return status.Errorf(codes.Unimplemented, "health watch is not implemented")
@@ -362,6 +400,14 @@ func (s *Server) GenerateJWT(userID, username string, roles []string) (string, s
 	return accessToken, signedRefreshToken, expiresAt, nil
 }
 
+// tokenReason возвращает причину отказа для ошибки ValidateJWT
+func tokenReason(err error) string {
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return apierror.ReasonTokenExpired
+	}
+	return apierror.ReasonTokenInvalid
+}
+
 // ValidateJWT проверяет JWT токен
 func (s *Server) ValidateJWT(tokenString string) (*jwt.Token, jwt.MapClaims, error) {
 	// Парсинг токена
@@ -457,7 +503,14 @@ func (s *Server) RevokeToken(ctx context.Context, tokenString string) error {
 func (s *Server) Login(ctx context.Context, req *smarthomev1.LoginRequest) (*smarthomev1.LoginResponse, error) {
 	// Проверка входных данных
 	if req.Username == "" || req.Password == "" {
-		return nil, status.Errorf(codes.InvalidArgument, "username and password are required")
+		e := apierror.InvalidArgument("username and password are required")
+		if req.Username == "" {
+			e.WithViolation("username", "must not be empty")
+		}
+		if req.Password == "" {
+			e.WithViolation("password", "must not be empty")
+		}
+		return nil, e
 	}
 
 	// Поиск пользователя в базе данных
@@ -478,7 +531,8 @@ func (s *Server) Login(ctx context.Context, req *smarthomev1.LoginRequest) (*sma
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, status.Errorf(codes.NotFound, "invalid username or password")
+			// Не раскрываем, существует ли пользователь
+			return nil, apierror.New(codes.Unauthenticated, apierror.ReasonInvalidCredentials, "invalid username or password")
 		}
 		s.logger.Error("Database error during login", zap.Error(err))
 		return nil, status.Errorf(codes.Internal, "database error")
@@ -487,7 +541,7 @@ func (s *Server) Login(ctx context.Context, req *smarthomev1.LoginRequest) (*sma
 	// Проверка пароля
 	err = bcrypt.CompareHashAndPassword([]byte(user.PassHash), []byte(req.Password))
 	if err != nil {
-		return nil, status.Errorf(codes.Unauthenticated, "invalid username or password")
+		return nil, apierror.New(codes.Unauthenticated, apierror.ReasonInvalidCredentials, "invalid username or password")
 	}
 
 	// Генерация JWT токена
@@ -515,7 +569,8 @@ func (s *Server) Login(ctx context.Context, req *smarthomev1.LoginRequest) (*sma
 func (s *Server) Logout(ctx context.Context, req *smarthomev1.LogoutRequest) (*smarthomev1.LogoutResponse, error) {
 	// Проверка входных данных
 	if req.AccessToken == "" {
-		return nil, status.Errorf(codes.InvalidArgument, "access_token is required")
+		return nil, apierror.InvalidArgument("access_token is required",
+			apierror.FieldViolation{Field: "access_token", Description: "must not be empty"})
 	}
 
 	// Отзыв токена
@@ -538,19 +593,20 @@ func (s *Server) Logout(ctx context.Context, req *smarthomev1.LogoutRequest) (*s
 func (s *Server) Refresh(ctx context.Context, req *smarthomev1.RefreshRequest) (*smarthomev1.RefreshResponse, error) {
 	// Проверка входных данных
 	if req.RefreshToken == "" {
-		return nil, status.Errorf(codes.InvalidArgument, "refresh_token is required")
+		return nil, apierror.InvalidArgument("refresh_token is required",
+			apierror.FieldViolation{Field: "refresh_token", Description: "must not be empty"})
 	}
 
 	// Валидация refresh токена
 	_, claims, err := s.ValidateJWT(req.RefreshToken)
 	if err != nil {
-		return nil, status.Errorf(codes.Unauthenticated, "invalid refresh token")
+		return nil, apierror.New(codes.Unauthenticated, tokenReason(err), "invalid refresh token")
 	}
 
 	// Извлечение данных пользователя
 	sub, ok := claims["sub"].(string)
 	if !ok {
-		return nil, status.Errorf(codes.Internal, "invalid token payload")
+		return nil, apierror.New(codes.Unauthenticated, apierror.ReasonTokenInvalid, "invalid token payload")
 	}
 
 	// Получение информации о пользователе из базы данных
@@ -569,7 +625,7 @@ func (s *Server) Refresh(ctx context.Context, req *smarthomev1.RefreshRequest) (
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, status.Errorf(codes.NotFound, "user not found")
+			return nil, apierror.New(codes.NotFound, apierror.ReasonUserNotFound, "user not found")
 		}
 		s.logger.Error("Database error during token refresh", zap.Error(err))
 		return nil, status.Errorf(codes.Internal, "database error")
@@ -599,15 +655,17 @@ func (s *Server) Refresh(ctx context.Context, req *smarthomev1.RefreshRequest) (
 func (s *Server) ValidateToken(ctx context.Context, req *smarthomev1.ValidateTokenRequest) (*smarthomev1.ValidateTokenResponse, error) {
 	// Проверка входных данных
 	if req.AccessToken == "" {
-		return nil, status.Errorf(codes.InvalidArgument, "access_token is required")
+		return nil, apierror.InvalidArgument("access_token is required",
+			apierror.FieldViolation{Field: "access_token", Description: "must not be empty"})
 	}
 
 	// Валидация токена
 	_, claims, err := s.ValidateJWT(req.AccessToken)
 	if err != nil {
+		s.logger.Debug("Token validation failed", zap.Error(err))
 		return &smarthomev1.ValidateTokenResponse{
 			Valid: false,
-			Error: err.Error(),
+			Error: tokenReason(err),
 		}, nil
 	}
 
@@ -616,7 +674,7 @@ func (s *Server) ValidateToken(ctx context.Context, req *smarthomev1.ValidateTok
 	if !ok {
 		return &smarthomev1.ValidateTokenResponse{
 			Valid: false,
-			Error: "invalid token payload",
+			Error: apierror.ReasonTokenInvalid,
 		}, nil
 	}
 
@@ -624,7 +682,7 @@ func (s *Server) ValidateToken(ctx context.Context, req *smarthomev1.ValidateTok
 	if !ok {
 		return &smarthomev1.ValidateTokenResponse{
 			Valid: false,
-			Error: "invalid token payload",
+			Error: apierror.ReasonTokenInvalid,
 		}, nil
 	}
 
@@ -633,7 +691,7 @@ func (s *Server) ValidateToken(ctx context.Context, req *smarthomev1.ValidateTok
 	if !ok {
 		return &smarthomev1.ValidateTokenResponse{
 			Valid: false,
-			Error: "invalid token payload",
+			Error: apierror.ReasonTokenInvalid,
 		}, nil
 	}
 
@@ -660,7 +718,7 @@ func (s *Server) ValidateToken(ctx context.Context, req *smarthomev1.ValidateTok
 		if err == sql.ErrNoRows {
 			return &smarthomev1.ValidateTokenResponse{
 				Valid: false,
-				Error: "user not found",
+				Error: apierror.ReasonUserNotFound,
 			}, nil
 		}
 
@@ -0,0 +1,80 @@
+package automation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+		"* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *", "* * * foo *", "@reboot",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, expected error", expr)
+		}
+	}
+}
+
+func TestCron_Next(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+
+	// 2026-05-04 - понедельник
+	after := time.Date(2026, 5, 4, 6, 59, 30, 0, time.UTC)
+	tests := []struct {
+		expr  string
+		loc   *time.Location
+		after time.Time
+		want  time.Time
+	}{
+		{"* * * * *", time.UTC, after, time.Date(2026, 5, 4, 7, 0, 0, 0, time.UTC)},
+		{"0 7 * * mon-fri", time.UTC, after, time.Date(2026, 5, 4, 7, 0, 0, 0, time.UTC)},
+		{"0 7 * * 1-5", time.UTC, time.Date(2026, 5, 8, 7, 0, 0, 0, time.UTC), time.Date(2026, 5, 11, 7, 0, 0, 0, time.UTC)},
+		{"0 7 * * 1-5", moscow, after, time.Date(2026, 5, 5, 4, 0, 0, 0, time.UTC)},
+		{"*/15 9-17 * * *", time.UTC, after, time.Date(2026, 5, 4, 9, 0, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.UTC, after, time.Date(2026, 5, 4, 7, 5, 0, 0, time.UTC)},
+		{"30 8 1,15 * *", time.UTC, after, time.Date(2026, 5, 15, 8, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.UTC, after, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.UTC, after, time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)},
+		// День месяца или день недели: 13-е или ближайшая пятница
+		{"0 0 13 * fri", time.UTC, after, time.Date(2026, 5, 8, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.UTC, after, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.UTC, after, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.UTC, after, time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) failed: %v", tt.expr, err)
+		}
+		if got := c.Next(tt.after, tt.loc); !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%s) = %s, want %s", tt.expr, tt.after, got, tt.want)
+		}
+	}
+}
+
+func TestCron_NextDaylightSaving(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+
+	// 2026-03-29: 02:00-03:00 нет на часах, запуск в 02:30 пропускается
+	c, _ := ParseCron("30 2 * * *")
+	got := c.Next(time.Date(2026, 3, 28, 12, 0, 0, 0, berlin), berlin)
+	if want := time.Date(2026, 3, 30, 2, 30, 0, 0, berlin); !got.Equal(want) {
+		t.Errorf("Next across spring gap = %s, want %s", got, want)
+	}
+
+	// 2026-10-25: 02:00-03:00 повторяется, запуск в 02:30 один раз
+	first := time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC) // 02:30 CEST
+	if got := c.Next(first.Add(-time.Hour), berlin); !got.Equal(first) {
+		t.Errorf("Next before autumn repeat = %s, want %s", got, first)
+	}
+	if got, want := c.Next(first, berlin), time.Date(2026, 10, 26, 2, 30, 0, 0, berlin); !got.Equal(want) {
+		t.Errorf("Next after autumn repeat = %s, want %s", got, want)
+	}
+}
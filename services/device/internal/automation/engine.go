@@ -0,0 +1,585 @@
+// Package automation выполняет правила автоматизации: следит за изменениями
+// устройств в шине событий и за временем, проверяет условия правил и
+// выполняет их действия через Executor.
+package automation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/events"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+	"google.golang.org/grpc/status"
+)
+
+// Статусы запуска правила
+const (
+	StatusRunning          = "running"
+	StatusCompleted        = "completed"
+	StatusFailed           = "failed"
+	StatusConditionsNotMet = "conditions_not_met"
+	StatusCooldown         = "cooldown"
+	StatusCanceled         = "canceled"
+)
+
+const (
+	defaultTickInterval = time.Second
+
+	// maxExecutions ограничивает журнал запусков одного правила
+	maxExecutions = 50
+
+	// maxCatchUp ограничивает пропущенное время (остановка процесса, сон
+	// машины), за которое срабатывают триггеры time
+	maxCatchUp = 5 * time.Minute
+
+	// actionTimeout ограничивает выполнение одного действия
+	actionTimeout = 10 * time.Second
+)
+
+// Executor выполняет действия правил. Реализуется server.GRPCServer, поэтому
+// действия проходят ту же проверку, что и запросы клиентов.
+type Executor interface {
+	ControlDevice(ctx context.Context, req *pb.ControlDeviceRequest) (*pb.ControlDeviceResponse, error)
+	ActivateScene(ctx context.Context, req *pb.ActivateSceneRequest) (*pb.ActivateSceneResponse, error)
+}
+
+// Config содержит настройки Engine
+type Config struct {
+	Store        datastore.DeviceStore // Хранилище правил и устройств
+	Bus          *events.Bus           // Шина изменений устройств
+	Executor     Executor              // Исполнитель действий
+	Location     *time.Location        // Часовой пояс триггеров и условий времени (nil - time.Local)
+	TickInterval time.Duration         // Период проверки времени и отложенных действий (0 - 1s)
+}
+
+// Execution - запуск правила в журнале
+type Execution struct {
+	Time            time.Time // Время срабатывания триггера
+	Trigger         string    // Описание сработавшего триггера
+	Status          string    // Один из Status*
+	Error           string    // Ошибка действия (для StatusFailed)
+	ActionsExecuted int       // Выполнено действий
+	FinishedTime    time.Time // Время завершения (нулевое для StatusRunning)
+}
+
+// Engine выполняет включенные правила хранилища. Правило запускается
+// триггером, если выдержан интервал Cooldown и выполнены все условия;
+// действия выполняются по порядку, ошибка действия прерывает запуск.
+// Повторный запуск правила отменяет его предыдущий запуск, ожидающий
+// отложенных действий: так правило "движение - включить свет, через 5 минут
+// выключить" продлевает паузу при каждом движении.
+//
+// После изменения правил в хранилище нужно вызвать Reload.
+type Engine struct {
+	config Config
+	now    func() time.Time
+
+	mu        sync.Mutex
+	rules     []*model.Rule           // Включенные правила
+	states    map[string]deviceState  // Последнее известное состояние устройств
+	lastRun   map[string]time.Time    // Время последнего запуска по ID правила
+	logs      map[string][]*Execution // Журнал запусков по ID правила, новые в конце
+	active    map[string]*run         // Незавершенный запуск по ID правила
+	lastCheck time.Time               // Время последней проверки триггеров time
+}
+
+// deviceState - состояние устройства, с которым сравниваются изменения
+type deviceState struct {
+	version    int64
+	online     bool
+	parameters map[string]string
+}
+
+// run - незавершенный запуск правила
+type run struct {
+	rule      *model.Rule
+	execution *Execution
+	next      int       // Индекс следующего действия
+	due       time.Time // Время продолжения после delay (нулевое - не ожидает)
+}
+
+// NewEngine создает движок правил. Обработка начинается после Run.
+func NewEngine(config Config) *Engine {
+	if config.Location == nil {
+		config.Location = time.Local
+	}
+	if config.TickInterval <= 0 {
+		config.TickInterval = defaultTickInterval
+	}
+	return &Engine{
+		config:  config,
+		now:     time.Now,
+		states:  make(map[string]deviceState),
+		lastRun: make(map[string]time.Time),
+		logs:    make(map[string][]*Execution),
+		active:  make(map[string]*run),
+	}
+}
+
+// Run загружает правила и обрабатывает изменения устройств и время до
+// отмены ctx
+func (e *Engine) Run(ctx context.Context) {
+	// Подписка до чтения состояний, чтобы не пропустить изменения между ними
+	sub := e.config.Bus.Subscribe()
+	defer sub.Close()
+
+	if err := e.Reload(); err != nil {
+		log.Printf("Automation: failed to load rules: %v", err)
+	}
+	e.prime()
+
+	ticker := time.NewTicker(e.config.TickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Ready():
+			for _, event := range sub.Drain() {
+				e.handle(ctx, event)
+			}
+		case <-ticker.C:
+			e.tick(ctx)
+		}
+	}
+}
+
+// Reload перечитывает правила из хранилища. Запуски удаленных, выключенных
+// и измененных правил, ожидающие отложенных действий, отменяются; журнал
+// удаленных правил очищается.
+func (e *Engine) Reload() error {
+	rules, err := e.config.Store.ListRules()
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	byID := make(map[string]*model.Rule, len(rules))
+	enabled := make([]*model.Rule, 0, len(rules))
+	for _, rule := range rules {
+		byID[rule.ID] = rule
+		if rule.Enabled {
+			enabled = append(enabled, rule)
+		}
+	}
+	for id, r := range e.active {
+		if current, ok := byID[id]; !ok || !current.Enabled || !reflect.DeepEqual(current, r.rule) {
+			e.cancel(id)
+		}
+	}
+	for id := range e.logs {
+		if _, ok := byID[id]; !ok {
+			delete(e.logs, id)
+			delete(e.lastRun, id)
+		}
+	}
+	e.rules = enabled
+	return nil
+}
+
+// Executions возвращает журнал запусков правила, новые первыми
+func (e *Engine) Executions(ruleID string) []Execution {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	executions := e.logs[ruleID]
+	result := make([]Execution, 0, len(executions))
+	for i := len(executions) - 1; i >= 0; i-- {
+		result = append(result, *executions[i])
+	}
+	return result
+}
+
+// prime запоминает текущее состояние устройств: триггеры срабатывают
+// только на изменения после запуска
+func (e *Engine) prime() {
+	devices := e.config.Store.GetAllDevices()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, device := range devices {
+		e.states[device.ID] = stateOf(device)
+	}
+}
+
+// match - сработавший триггер правила
+type match struct {
+	rule    *model.Rule
+	trigger string
+}
+
+// handle сравнивает изменение устройства с предыдущим состоянием и
+// запускает правила, триггеры которых сработали
+func (e *Engine) handle(ctx context.Context, event events.Event) {
+	e.mu.Lock()
+	previous, known := e.states[event.DeviceID]
+	if event.Deleted() {
+		delete(e.states, event.DeviceID)
+		e.mu.Unlock()
+		return
+	}
+	if known && event.Device.Version <= previous.version {
+		// Изменение уже учтено (получено до prime или повторно)
+		e.mu.Unlock()
+		return
+	}
+	current := stateOf(event.Device)
+	e.states[event.DeviceID] = current
+
+	var matches []match
+	if known {
+		for _, rule := range e.rules {
+			if trigger, ok := deviceTrigger(rule, event.DeviceID, previous, current); ok {
+				matches = append(matches, match{rule: rule, trigger: trigger})
+			}
+		}
+	}
+	e.mu.Unlock()
+
+	for _, m := range matches {
+		e.start(ctx, m.rule, m.trigger)
+	}
+}
+
+// deviceTrigger возвращает описание первого триггера правила, который
+// срабатывает на переход устройства из previous в current
+func deviceTrigger(rule *model.Rule, deviceID string, previous, current deviceState) (string, bool) {
+	for _, t := range rule.Triggers {
+		if t.DeviceID != deviceID {
+			continue
+		}
+		switch t.Type {
+		case model.TriggerParameterChanged:
+			value, ok := current.parameters[t.Parameter]
+			if !ok || value == previous.parameters[t.Parameter] || (t.Value != "" && value != t.Value) {
+				continue
+			}
+			return fmt.Sprintf("device %s: %s = %s", deviceID, t.Parameter, value), true
+		case model.TriggerDeviceOffline:
+			if previous.online && !current.online {
+				return fmt.Sprintf("device %s went offline", deviceID), true
+			}
+		}
+	}
+	return "", false
+}
+
+// tick запускает правила с триггерами time на каждую минуту с прошлой
+// проверки (не дальше maxCatchUp) и продолжает запуски, дождавшиеся
+// окончания delay
+func (e *Engine) tick(ctx context.Context) {
+	e.mu.Lock()
+	now := e.now()
+
+	var matches []match
+	if !e.lastCheck.IsZero() {
+		start := e.lastCheck.Truncate(time.Minute).Add(time.Minute)
+		end := now.Truncate(time.Minute)
+		if earliest := end.Add(-maxCatchUp); start.Before(earliest) {
+			start = earliest
+		}
+		for minute := start; !minute.After(end); minute = minute.Add(time.Minute) {
+			local := minute.In(e.config.Location)
+			for _, rule := range e.rules {
+				if trigger, ok := timeTrigger(rule, local); ok {
+					matches = append(matches, match{rule: rule, trigger: trigger})
+				}
+			}
+		}
+	}
+	e.lastCheck = now
+
+	var due []*run
+	for _, r := range e.active {
+		if !r.due.IsZero() && !r.due.After(now) {
+			r.due = time.Time{}
+			r.execution.ActionsExecuted++
+			due = append(due, r)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, r := range due {
+		e.proceed(ctx, r)
+	}
+	for _, m := range matches {
+		e.start(ctx, m.rule, m.trigger)
+	}
+}
+
+// timeTrigger возвращает описание триггера time правила, который
+// срабатывает в минуту local
+func timeTrigger(rule *model.Rule, local time.Time) (string, bool) {
+	clock := local.Format("15:04")
+	weekday := model.Weekdays[local.Weekday()]
+	for _, t := range rule.Triggers {
+		if t.Type != model.TriggerTime || t.Time != clock {
+			continue
+		}
+		if len(t.Days) > 0 && !contains(t.Days, weekday) {
+			continue
+		}
+		return "time " + clock, true
+	}
+	return "", false
+}
+
+// start запускает правило по сработавшему триггеру
+func (e *Engine) start(ctx context.Context, rule *model.Rule, trigger string) {
+	now := e.now()
+
+	e.mu.Lock()
+	if last, ok := e.lastRun[rule.ID]; ok && rule.Cooldown > 0 && now.Sub(last) < rule.Cooldown {
+		e.record(rule.ID, &Execution{Time: now, Trigger: trigger, Status: StatusCooldown, FinishedTime: now})
+		e.mu.Unlock()
+		return
+	}
+	e.mu.Unlock()
+
+	met := e.conditionsMet(rule, now)
+
+	e.mu.Lock()
+	if !met {
+		e.record(rule.ID, &Execution{Time: now, Trigger: trigger, Status: StatusConditionsNotMet, FinishedTime: now})
+		e.mu.Unlock()
+		return
+	}
+	if _, ok := e.active[rule.ID]; ok {
+		e.cancel(rule.ID)
+	}
+	r := &run{
+		rule:      rule,
+		execution: &Execution{Time: now, Trigger: trigger, Status: StatusRunning},
+	}
+	e.lastRun[rule.ID] = now
+	e.active[rule.ID] = r
+	e.record(rule.ID, r.execution)
+	e.mu.Unlock()
+
+	e.proceed(ctx, r)
+}
+
+// proceed выполняет действия запуска до delay или до конца
+func (e *Engine) proceed(ctx context.Context, r *run) {
+	for {
+		e.mu.Lock()
+		if e.active[r.rule.ID] != r {
+			// Запуск отменен
+			e.mu.Unlock()
+			return
+		}
+		if r.next == len(r.rule.Actions) {
+			e.finish(r, StatusCompleted, "")
+			e.mu.Unlock()
+			return
+		}
+		action := r.rule.Actions[r.next]
+		if action.Type == model.ActionDelay {
+			r.next++
+			r.due = e.now().Add(action.Delay)
+			e.mu.Unlock()
+			return
+		}
+		e.mu.Unlock()
+
+		err := execute(ctx, e.config.Executor, action)
+
+		e.mu.Lock()
+		if e.active[r.rule.ID] != r {
+			e.mu.Unlock()
+			return
+		}
+		if err != nil {
+			log.Printf("Automation: rule %s action %d failed: %v", r.rule.ID, r.next+1, err)
+			e.finish(r, StatusFailed, fmt.Sprintf("action %d (%s): %s", r.next+1, action.Type, errorMessage(err)))
+			e.mu.Unlock()
+			return
+		}
+		r.next++
+		r.execution.ActionsExecuted++
+		e.mu.Unlock()
+	}
+}
+
+// execute выполняет действие control или scene правила или расписания
+func execute(ctx context.Context, executor Executor, action model.RuleAction) error {
+	ctx, cancel := context.WithTimeout(ctx, actionTimeout)
+	defer cancel()
+
+	switch action.Type {
+	case model.ActionControl:
+		_, err := executor.ControlDevice(ctx, &pb.ControlDeviceRequest{
+			Id: action.DeviceID,
+			Command: &pb.Command{
+				DeviceId:   action.DeviceID,
+				Action:     action.Command,
+				Parameters: action.Parameters,
+			},
+		})
+		return err
+	case model.ActionScene:
+		resp, err := executor.ActivateScene(ctx, &pb.ActivateSceneRequest{Id: action.SceneID})
+		if err != nil {
+			return err
+		}
+		if !resp.GetSuccess() {
+			return fmt.Errorf("scene %s was not applied to all devices", action.SceneID)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown action type %q", action.Type)
+	}
+}
+
+// errorMessage возвращает текст ошибки без префикса статуса gRPC
+func errorMessage(err error) string {
+	if s, ok := status.FromError(err); ok {
+		return s.Message()
+	}
+	return err.Error()
+}
+
+// finish завершает запуск. Вызывается под e.mu.
+func (e *Engine) finish(r *run, status, message string) {
+	r.execution.Status = status
+	r.execution.Error = message
+	r.execution.FinishedTime = e.now()
+	delete(e.active, r.rule.ID)
+}
+
+// cancel отменяет незавершенный запуск правила. Вызывается под e.mu.
+func (e *Engine) cancel(ruleID string) {
+	if r, ok := e.active[ruleID]; ok {
+		e.finish(r, StatusCanceled, "")
+	}
+}
+
+// record добавляет запуск в журнал правила. Вызывается под e.mu.
+func (e *Engine) record(ruleID string, execution *Execution) {
+	executions := append(e.logs[ruleID], execution)
+	if len(executions) > maxExecutions {
+		executions = executions[len(executions)-maxExecutions:]
+	}
+	e.logs[ruleID] = executions
+}
+
+// conditionsMet проверяет условия правила в момент now
+func (e *Engine) conditionsMet(rule *model.Rule, now time.Time) bool {
+	for _, c := range rule.Conditions {
+		switch c.Type {
+		case model.ConditionDeviceState:
+			if !e.deviceStateMet(c) {
+				return false
+			}
+		case model.ConditionTimeWindow:
+			if !inWindow(now.In(e.config.Location), c.After, c.Before) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// deviceStateMet проверяет условие device_state по текущему состоянию
+// устройства в хранилище. Условие для удаленного устройства не выполняется.
+func (e *Engine) deviceStateMet(c model.RuleCondition) bool {
+	device, err := e.config.Store.GetDevice(c.DeviceID)
+	if err != nil || device.Status == nil {
+		return false
+	}
+
+	var actual string
+	if c.Parameter == model.ParamOnline {
+		actual = strconv.FormatBool(device.Status.Online)
+	} else {
+		value, ok := device.Status.Parameters[c.Parameter]
+		if !ok {
+			return false
+		}
+		actual = value
+	}
+	return compare(actual, c.Operator, c.Value)
+}
+
+// compare сравнивает значения оператором условия. Операторы gt, gte, lt и
+// lte сравнивают числа; нечисловые значения условию не удовлетворяют.
+func compare(actual, operator, expected string) bool {
+	switch operator {
+	case "eq":
+		return actual == expected
+	case "ne":
+		return actual != expected
+	}
+
+	a, err := strconv.ParseFloat(actual, 64)
+	if err != nil {
+		return false
+	}
+	b, err := strconv.ParseFloat(expected, 64)
+	if err != nil {
+		return false
+	}
+	switch operator {
+	case "gt":
+		return a > b
+	case "gte":
+		return a >= b
+	case "lt":
+		return a < b
+	case "lte":
+		return a <= b
+	}
+	return false
+}
+
+// inWindow проверяет, что время суток local попадает в окно [after, before).
+// Если before раньше after, окно проходит через полночь.
+func inWindow(local time.Time, after, before string) bool {
+	from, err := model.ParseClock(after)
+	if err != nil {
+		return false
+	}
+	to, err := model.ParseClock(before)
+	if err != nil {
+		return false
+	}
+	minute := local.Hour()*60 + local.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+// stateOf возвращает состояние устройства для сравнения изменений
+func stateOf(device *model.Device) deviceState {
+	state := deviceState{version: device.Version, parameters: map[string]string{}}
+	if device.Status != nil {
+		state.online = device.Status.Online
+		for k, v := range device.Status.Parameters {
+			state.parameters[k] = v
+		}
+	}
+	return state
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
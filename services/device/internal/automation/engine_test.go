@@ -0,0 +1,303 @@
+package automation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/events"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+)
+
+// fakeExecutor записывает выполненные действия
+type fakeExecutor struct {
+	commands []string // device_id:action
+	scenes   []string
+	fail     error
+}
+
+func (f *fakeExecutor) ControlDevice(ctx context.Context, req *pb.ControlDeviceRequest) (*pb.ControlDeviceResponse, error) {
+	if f.fail != nil {
+		return nil, f.fail
+	}
+	f.commands = append(f.commands, req.Id+":"+req.Command.Action)
+	return &pb.ControlDeviceResponse{Success: true}, nil
+}
+
+func (f *fakeExecutor) ActivateScene(ctx context.Context, req *pb.ActivateSceneRequest) (*pb.ActivateSceneResponse, error) {
+	f.scenes = append(f.scenes, req.Id)
+	return &pb.ActivateSceneResponse{SceneId: req.Id, Success: true}, nil
+}
+
+// testEngine - движок с хранилищем в памяти и управляемыми часами
+type testEngine struct {
+	*Engine
+	store    *datastore.MemoryStore
+	executor *fakeExecutor
+	clock    time.Time
+	sensor   *model.Device
+	lamp     *model.Device
+}
+
+func newTestEngine(t *testing.T, rules ...*model.Rule) *testEngine {
+	t.Helper()
+	te := &testEngine{
+		store:    datastore.NewMemoryStore(),
+		executor: &fakeExecutor{},
+		clock:    time.Date(2026, 5, 4, 6, 59, 30, 0, time.UTC), // Понедельник
+	}
+	te.sensor = model.NewDevice("Датчик", model.DeviceTypeSensor, "Aqara", "Коридор")
+	te.sensor.Status.Parameters[model.ParamLastMotion] = "100"
+	te.lamp = model.NewDevice("Лампа", model.DeviceTypeLamp, "Philips Hue", "Коридор")
+	te.lamp.Status.Parameters[model.ParamPower] = "off"
+	for _, device := range []*model.Device{te.sensor, te.lamp} {
+		if err := te.store.SaveDevice(device); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, rule := range rules {
+		if err := te.store.SaveRule(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	te.Engine = NewEngine(Config{Store: te.store, Bus: events.NewBus(), Executor: te.executor, Location: time.UTC})
+	te.now = func() time.Time { return te.clock }
+	if err := te.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	te.prime()
+	te.tick(context.Background())
+	return te
+}
+
+// set изменяет параметр устройства и передает изменение движку
+func (te *testEngine) set(t *testing.T, device *model.Device, key, value string) {
+	t.Helper()
+	if err := te.store.UpdateDeviceParameter(device.ID, key, value); err != nil {
+		t.Fatal(err)
+	}
+	te.publish(t, device.ID)
+}
+
+func (te *testEngine) publish(t *testing.T, id string) {
+	t.Helper()
+	device, err := te.store.GetDevice(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.handle(context.Background(), events.Event{DeviceID: id, Device: device, Time: te.clock})
+}
+
+// advance переводит часы и проверяет время
+func (te *testEngine) advance(d time.Duration) {
+	te.clock = te.clock.Add(d)
+	te.tick(context.Background())
+}
+
+func motionRule(sensorID, lampID string) *model.Rule {
+	rule := model.NewRule("Свет по движению")
+	rule.Triggers = []model.RuleTrigger{{Type: model.TriggerParameterChanged, DeviceID: sensorID, Parameter: model.ParamLastMotion}}
+	rule.Actions = []model.RuleAction{
+		{Type: model.ActionControl, DeviceID: lampID, Command: "turn_on"},
+		{Type: model.ActionDelay, Delay: 5 * time.Minute},
+		{Type: model.ActionControl, DeviceID: lampID, Command: "turn_off"},
+	}
+	return rule
+}
+
+func statuses(executions []Execution) []string {
+	result := make([]string, 0, len(executions))
+	for _, e := range executions {
+		result = append(result, e.Status)
+	}
+	return result
+}
+
+func assertStrings(t *testing.T, name string, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s = %v, want %v", name, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestEngine_ParameterTriggerWithDelay(t *testing.T) {
+	te := newTestEngine(t)
+	rule := motionRule(te.sensor.ID, te.lamp.ID)
+	te.store.SaveRule(rule)
+	te.Reload()
+
+	// Изменение другого параметра не запускает правило
+	te.set(t, te.sensor, model.ParamHumidity, "50")
+	assertStrings(t, "commands", te.executor.commands)
+
+	te.set(t, te.sensor, model.ParamLastMotion, "200")
+	assertStrings(t, "commands", te.executor.commands, te.lamp.ID+":turn_on")
+	assertStrings(t, "statuses", statuses(te.Executions(rule.ID)), StatusRunning)
+
+	te.advance(4 * time.Minute)
+	assertStrings(t, "commands", te.executor.commands, te.lamp.ID+":turn_on")
+
+	te.advance(time.Minute)
+	assertStrings(t, "commands", te.executor.commands, te.lamp.ID+":turn_on", te.lamp.ID+":turn_off")
+	executions := te.Executions(rule.ID)
+	assertStrings(t, "statuses", statuses(executions), StatusCompleted)
+	if executions[0].ActionsExecuted != 3 || executions[0].Trigger != "device "+te.sensor.ID+": last_motion = 200" {
+		t.Errorf("Unexpected execution: %+v", executions[0])
+	}
+}
+
+func TestEngine_RetriggerRestartsDelay(t *testing.T) {
+	te := newTestEngine(t)
+	rule := motionRule(te.sensor.ID, te.lamp.ID)
+	te.store.SaveRule(rule)
+	te.Reload()
+
+	te.set(t, te.sensor, model.ParamLastMotion, "200")
+	te.advance(3 * time.Minute)
+	te.set(t, te.sensor, model.ParamLastMotion, "380")
+	te.advance(3 * time.Minute)
+
+	// Первый запуск отменен, свет не выключен через 5 минут после первого движения
+	assertStrings(t, "commands", te.executor.commands, te.lamp.ID+":turn_on", te.lamp.ID+":turn_on")
+	assertStrings(t, "statuses", statuses(te.Executions(rule.ID)), StatusRunning, StatusCanceled)
+
+	te.advance(2 * time.Minute)
+	assertStrings(t, "statuses", statuses(te.Executions(rule.ID)), StatusCompleted, StatusCanceled)
+}
+
+func TestEngine_Cooldown(t *testing.T) {
+	te := newTestEngine(t)
+	rule := motionRule(te.sensor.ID, te.lamp.ID)
+	rule.Actions = rule.Actions[:1]
+	rule.Cooldown = time.Minute
+	te.store.SaveRule(rule)
+	te.Reload()
+
+	te.set(t, te.sensor, model.ParamLastMotion, "200")
+	te.clock = te.clock.Add(30 * time.Second)
+	te.set(t, te.sensor, model.ParamLastMotion, "230")
+	te.clock = te.clock.Add(31 * time.Second)
+	te.set(t, te.sensor, model.ParamLastMotion, "261")
+
+	assertStrings(t, "commands", te.executor.commands, te.lamp.ID+":turn_on", te.lamp.ID+":turn_on")
+	assertStrings(t, "statuses", statuses(te.Executions(rule.ID)), StatusCompleted, StatusCooldown, StatusCompleted)
+}
+
+func TestEngine_TimeTrigger(t *testing.T) {
+	te := newTestEngine(t)
+	weekdays := model.NewRule("Утро по будням")
+	weekdays.Triggers = []model.RuleTrigger{{Type: model.TriggerTime, Time: "07:00", Days: []string{"mon", "tue", "wed", "thu", "fri"}}}
+	weekdays.Actions = []model.RuleAction{{Type: model.ActionScene, SceneID: "morning"}}
+	weekend := model.NewRule("Утро в выходные")
+	weekend.Triggers = []model.RuleTrigger{{Type: model.TriggerTime, Time: "07:00", Days: []string{"sat", "sun"}}}
+	weekend.Actions = []model.RuleAction{{Type: model.ActionScene, SceneID: "weekend"}}
+	te.store.SaveRule(weekdays)
+	te.store.SaveRule(weekend)
+	te.Reload()
+
+	te.advance(20 * time.Second) // 06:59:50
+	assertStrings(t, "scenes", te.executor.scenes)
+
+	te.advance(20 * time.Second) // 07:00:10
+	assertStrings(t, "scenes", te.executor.scenes, "morning")
+
+	// Срабатывание один раз в минуту
+	te.advance(20 * time.Second)
+	assertStrings(t, "scenes", te.executor.scenes, "morning")
+
+	// Пропущенная минута срабатывает после паузы не длиннее maxCatchUp
+	te.clock = time.Date(2026, 5, 5, 6, 58, 0, 0, time.UTC)
+	te.tick(context.Background())
+	te.advance(4 * time.Minute)
+	assertStrings(t, "scenes", te.executor.scenes, "morning", "morning")
+}
+
+func TestEngine_Conditions(t *testing.T) {
+	te := newTestEngine(t)
+	rule := motionRule(te.sensor.ID, te.lamp.ID)
+	rule.Actions = rule.Actions[:1]
+	rule.Conditions = []model.RuleCondition{
+		{Type: model.ConditionTimeWindow, After: "22:00", Before: "07:00"},
+		{Type: model.ConditionDeviceState, DeviceID: te.lamp.ID, Parameter: model.ParamPower, Operator: "eq", Value: "off"},
+	}
+	te.store.SaveRule(rule)
+	te.Reload()
+
+	te.set(t, te.sensor, model.ParamLastMotion, "200")
+	assertStrings(t, "commands", te.executor.commands, te.lamp.ID+":turn_on")
+
+	// Лампа уже включена
+	te.store.UpdateDeviceParameter(te.lamp.ID, model.ParamPower, "on")
+	te.set(t, te.sensor, model.ParamLastMotion, "300")
+
+	// Вне окна времени
+	te.store.UpdateDeviceParameter(te.lamp.ID, model.ParamPower, "off")
+	te.clock = te.clock.Add(time.Hour)
+	te.set(t, te.sensor, model.ParamLastMotion, "400")
+
+	assertStrings(t, "commands", te.executor.commands, te.lamp.ID+":turn_on")
+	assertStrings(t, "statuses", statuses(te.Executions(rule.ID)), StatusConditionsNotMet, StatusConditionsNotMet, StatusCompleted)
+}
+
+func TestEngine_DeviceOfflineAndFailure(t *testing.T) {
+	te := newTestEngine(t)
+	rule := model.NewRule("Датчик отключился")
+	rule.Triggers = []model.RuleTrigger{{Type: model.TriggerDeviceOffline, DeviceID: te.sensor.ID}}
+	rule.Actions = []model.RuleAction{
+		{Type: model.ActionControl, DeviceID: te.lamp.ID, Command: "turn_on"},
+		{Type: model.ActionScene, SceneID: "alarm"},
+	}
+	te.store.SaveRule(rule)
+	te.Reload()
+	te.executor.fail = errors.New("device is offline")
+
+	status := model.NewDeviceStatus()
+	status.Online = false
+	te.store.UpdateDeviceStatus(te.sensor.ID, status)
+	te.publish(t, te.sensor.ID)
+
+	// Повторное состояние "не в сети" не запускает правило
+	te.store.UpdateDeviceParameter(te.sensor.ID, model.ParamHumidity, "10")
+	te.publish(t, te.sensor.ID)
+
+	executions := te.Executions(rule.ID)
+	assertStrings(t, "statuses", statuses(executions), StatusFailed)
+	if executions[0].ActionsExecuted != 0 || executions[0].Error != "action 1 (control): device is offline" {
+		t.Errorf("Unexpected execution: %+v", executions[0])
+	}
+	// Ошибка действия прерывает запуск
+	assertStrings(t, "scenes", te.executor.scenes)
+}
+
+func TestEngine_ReloadCancelsDisabledRule(t *testing.T) {
+	te := newTestEngine(t)
+	rule := motionRule(te.sensor.ID, te.lamp.ID)
+	te.store.SaveRule(rule)
+	te.Reload()
+
+	te.set(t, te.sensor, model.ParamLastMotion, "200")
+	rule.Enabled = false
+	te.store.SaveRule(rule)
+	te.Reload()
+	te.advance(10 * time.Minute)
+	te.set(t, te.sensor, model.ParamLastMotion, "800")
+
+	assertStrings(t, "commands", te.executor.commands, te.lamp.ID+":turn_on")
+	assertStrings(t, "statuses", statuses(te.Executions(rule.ID)), StatusCanceled)
+
+	// Журнал удаленного правила очищается
+	te.store.DeleteRule(rule.ID)
+	te.Reload()
+	if executions := te.Executions(rule.ID); len(executions) != 0 {
+		t.Errorf("Executions of deleted rule = %+v", executions)
+	}
+}
@@ -0,0 +1,260 @@
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+)
+
+// missedRunGrace - опоздание, после которого запуск расписания считается
+// пропущенным (остановка сервиса, сон машины)
+const missedRunGrace = time.Minute
+
+// SchedulerConfig содержит настройки Scheduler
+type SchedulerConfig struct {
+	Store        datastore.DeviceStore // Хранилище расписаний
+	Executor     Executor              // Исполнитель действий
+	Location     *time.Location        // Часовой пояс расписаний без TimeZone (nil - time.Local)
+	TickInterval time.Duration         // Период проверки расписаний (0 - 1s)
+}
+
+// Scheduler запускает действия расписаний хранилища в момент NextRun.
+// Scheduler - единственный, кто изменяет расписания после создания, поэтому
+// создание, пауза и удаление выполняются через его методы.
+//
+// Следующий запуск сохраняется до выполнения действия: после перезапуска
+// сервиса действие не повторяется. Запуск, опоздавший больше чем на минуту,
+// выполняется по MissedRunPolicy: skip отмечает его пропущенным, run_once
+// выполняет один раз, сколько бы повторений cron ни было пропущено.
+type Scheduler struct {
+	config SchedulerConfig
+	now    func() time.Time
+
+	mu sync.Mutex
+}
+
+// NewScheduler создает планировщик. Запуски начинаются после Run.
+func NewScheduler(config SchedulerConfig) *Scheduler {
+	if config.Location == nil {
+		config.Location = time.Local
+	}
+	if config.TickInterval <= 0 {
+		config.TickInterval = defaultTickInterval
+	}
+	return &Scheduler{config: config, now: time.Now}
+}
+
+// Run выполняет расписания до отмены ctx. Запуски, пропущенные пока
+// сервис был остановлен, обрабатываются сразу.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.tick(ctx)
+
+	ticker := time.NewTicker(s.config.TickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.tick(ctx)
+		}
+	}
+}
+
+// Add вычисляет первый запуск и сохраняет расписание
+func (s *Scheduler) Add(schedule *model.Schedule) (*model.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule = schedule.Clone()
+	schedule.NextRun = schedule.RunAt
+	if schedule.Cron != "" {
+		next, err := s.nextCron(schedule, s.now())
+		if err != nil {
+			return nil, err
+		}
+		schedule.NextRun = next
+	}
+	if err := s.config.Store.SaveSchedule(schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// Pause приостанавливает расписание
+func (s *Scheduler) Pause(id string) (*model.Schedule, error) {
+	return s.update(id, func(schedule *model.Schedule) error {
+		schedule.Paused = true
+		return nil
+	})
+}
+
+// Resume возобновляет расписание. Повторения cron, пропущенные во время
+// паузы, не выполняются; однократный запуск, время которого прошло,
+// обрабатывается по MissedRunPolicy.
+func (s *Scheduler) Resume(id string) (*model.Schedule, error) {
+	return s.update(id, func(schedule *model.Schedule) error {
+		if !schedule.Paused {
+			return nil
+		}
+		schedule.Paused = false
+		if schedule.Cron != "" {
+			next, err := s.nextCron(schedule, s.now())
+			if err != nil {
+				return err
+			}
+			schedule.NextRun = next
+		}
+		return nil
+	})
+}
+
+// Delete удаляет расписание
+func (s *Scheduler) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.config.Store.DeleteSchedule(id)
+}
+
+// update изменяет и сохраняет расписание
+func (s *Scheduler) update(id string, change func(schedule *model.Schedule) error) (*model.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, err := s.config.Store.GetSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := change(schedule); err != nil {
+		return nil, err
+	}
+	if err := s.config.Store.SaveSchedule(schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// due - запуск расписания, выбранный tick
+type due struct {
+	id      string
+	action  model.ScheduleAction
+	missed  time.Time // Время пропущенного запуска (нулевое - выполнить)
+	started time.Time
+}
+
+// tick выполняет наступившие запуски
+func (s *Scheduler) tick(ctx context.Context) {
+	for _, d := range s.collect() {
+		if ctx.Err() != nil {
+			return
+		}
+
+		status, message := model.ScheduleMissed, ""
+		if d.missed.IsZero() {
+			status = model.ScheduleCompleted
+			err := execute(ctx, s.config.Executor, model.RuleAction{
+				Type:       d.action.Type,
+				DeviceID:   d.action.DeviceID,
+				Command:    d.action.Command,
+				Parameters: d.action.Parameters,
+				SceneID:    d.action.SceneID,
+			})
+			if err != nil {
+				status, message = model.ScheduleFailed, errorMessage(err)
+			}
+		} else {
+			message = fmt.Sprintf("run at %s was missed", d.missed.UTC().Format(time.RFC3339))
+		}
+		s.finish(d, status, message)
+	}
+}
+
+// collect выбирает наступившие запуски и сохраняет следующие
+func (s *Scheduler) collect() []due {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules, err := s.config.Store.ListSchedules()
+	if err != nil {
+		log.Printf("Scheduler: failed to list schedules: %v", err)
+		return nil
+	}
+
+	now := s.now()
+	var result []due
+	for _, schedule := range schedules {
+		if schedule.Paused || schedule.NextRun.IsZero() || schedule.NextRun.After(now) {
+			continue
+		}
+
+		d := due{id: schedule.ID, action: schedule.Action, started: now}
+		if now.Sub(schedule.NextRun) > missedRunGrace && schedule.MissedRunPolicy != model.MissedRunRunOnce {
+			d.missed = schedule.NextRun
+		}
+
+		// Следующий запуск сохраняется до выполнения, пропущенные
+		// повторения cron не выполняются
+		schedule.NextRun = time.Time{}
+		if schedule.Cron != "" {
+			next, err := s.nextCron(schedule, now)
+			if err != nil {
+				log.Printf("Scheduler: schedule %s: %v", schedule.ID, err)
+			}
+			schedule.NextRun = next
+		}
+		if err := s.config.Store.SaveSchedule(schedule); err != nil {
+			log.Printf("Scheduler: failed to save schedule %s: %v", schedule.ID, err)
+			continue
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+// finish записывает результат запуска, если расписание не удалено
+func (s *Scheduler) finish(d due, status, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, err := s.config.Store.GetSchedule(d.id)
+	if errors.Is(err, datastore.ErrScheduleNotFound) {
+		return
+	}
+	if err != nil {
+		log.Printf("Scheduler: failed to get schedule %s: %v", d.id, err)
+		return
+	}
+
+	schedule.LastRun = d.started
+	schedule.LastStatus = status
+	schedule.LastError = message
+	if err := s.config.Store.SaveSchedule(schedule); err != nil {
+		log.Printf("Scheduler: failed to save schedule %s: %v", d.id, err)
+	}
+	if status == model.ScheduleFailed {
+		log.Printf("Scheduler: schedule %s failed: %s", d.id, message)
+	}
+}
+
+// nextCron возвращает следующий запуск cron-расписания после after
+func (s *Scheduler) nextCron(schedule *model.Schedule, after time.Time) (time.Time, error) {
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc := s.config.Location
+	if schedule.TimeZone != "" {
+		if loc, err = time.LoadLocation(schedule.TimeZone); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return cron.Next(after, loc), nil
+}
@@ -0,0 +1,168 @@
+package automation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+)
+
+// testScheduler - планировщик с хранилищем в памяти и управляемыми часами
+type testScheduler struct {
+	*Scheduler
+	store    *datastore.MemoryStore
+	executor *fakeExecutor
+	clock    time.Time
+}
+
+func newTestScheduler(store *datastore.MemoryStore, clock time.Time) *testScheduler {
+	ts := &testScheduler{store: store, executor: &fakeExecutor{}, clock: clock}
+	ts.Scheduler = NewScheduler(SchedulerConfig{Store: store, Executor: ts.executor, Location: time.UTC})
+	ts.now = func() time.Time { return ts.clock }
+	return ts
+}
+
+// advance переводит часы и выполняет наступившие запуски
+func (ts *testScheduler) advance(d time.Duration) {
+	ts.clock = ts.clock.Add(d)
+	ts.tick(context.Background())
+}
+
+func (ts *testScheduler) get(t *testing.T, id string) *model.Schedule {
+	t.Helper()
+	schedule, err := ts.store.GetSchedule(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schedule
+}
+
+var kettleOn = model.ScheduleAction{Type: model.ActionControl, DeviceID: "kettle", Command: "turn_on"}
+
+func TestScheduler_OneShot(t *testing.T) {
+	ts := newTestScheduler(datastore.NewMemoryStore(), time.Date(2026, 5, 4, 6, 59, 30, 0, time.UTC))
+	schedule := model.NewSchedule("Выключить лампу", model.ScheduleAction{Type: model.ActionControl, DeviceID: "lamp", Command: "turn_off"})
+	schedule.RunAt = ts.clock.Add(30 * time.Minute)
+	added, err := ts.Add(schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !added.NextRun.Equal(schedule.RunAt) {
+		t.Errorf("NextRun = %s, want %s", added.NextRun, schedule.RunAt)
+	}
+
+	ts.advance(29 * time.Minute)
+	assertStrings(t, "commands", ts.executor.commands)
+	ts.advance(time.Minute)
+	ts.advance(time.Minute)
+	assertStrings(t, "commands", ts.executor.commands, "lamp:turn_off")
+
+	got := ts.get(t, schedule.ID)
+	if !got.NextRun.IsZero() || got.LastStatus != model.ScheduleCompleted || !got.LastRun.Equal(schedule.RunAt) {
+		t.Errorf("Unexpected schedule after run: %+v", got)
+	}
+}
+
+func TestScheduler_CronAndFailure(t *testing.T) {
+	// Понедельник 06:59:30 UTC, 09:59:30 по Москве
+	ts := newTestScheduler(datastore.NewMemoryStore(), time.Date(2026, 5, 4, 6, 59, 30, 0, time.UTC))
+	schedule := model.NewSchedule("Чайник", kettleOn)
+	schedule.Cron = "0 7 * * mon-fri"
+	schedule.TimeZone = "Europe/Moscow"
+	added, err := ts.Add(schedule)
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	if want := time.Date(2026, 5, 5, 4, 0, 0, 0, time.UTC); !added.NextRun.Equal(want) {
+		t.Fatalf("NextRun = %s, want %s", added.NextRun, want)
+	}
+
+	ts.executor.fail = errors.New("device offline")
+	ts.advance(21*time.Hour + 30*time.Second)
+	got := ts.get(t, schedule.ID)
+	if got.LastStatus != model.ScheduleFailed || got.LastError != "device offline" {
+		t.Errorf("Unexpected schedule after failed run: %+v", got)
+	}
+	if want := time.Date(2026, 5, 6, 4, 0, 0, 0, time.UTC); !got.NextRun.Equal(want) {
+		t.Errorf("NextRun = %s, want %s", got.NextRun, want)
+	}
+
+	ts.executor.fail = nil
+	ts.advance(24 * time.Hour)
+	assertStrings(t, "commands", ts.executor.commands, "kettle:turn_on")
+	if got := ts.get(t, schedule.ID); got.LastStatus != model.ScheduleCompleted || got.LastError != "" {
+		t.Errorf("Unexpected schedule after run: %+v", got)
+	}
+}
+
+func TestScheduler_PauseResume(t *testing.T) {
+	ts := newTestScheduler(datastore.NewMemoryStore(), time.Date(2026, 5, 4, 6, 59, 30, 0, time.UTC))
+	schedule := model.NewSchedule("Чайник", kettleOn)
+	schedule.Cron = "0 * * * *"
+	if _, err := ts.Add(schedule); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ts.Pause(schedule.ID); err != nil {
+		t.Fatal(err)
+	}
+	ts.advance(3 * time.Hour)
+	assertStrings(t, "commands", ts.executor.commands)
+
+	// Запуски, пропущенные во время паузы, не выполняются
+	resumed, err := ts.Resume(schedule.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC); resumed.Paused || !resumed.NextRun.Equal(want) {
+		t.Errorf("Unexpected schedule after resume: %+v", resumed)
+	}
+	ts.advance(time.Minute)
+	assertStrings(t, "commands", ts.executor.commands, "kettle:turn_on")
+
+	if err := ts.Delete(schedule.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Pause(schedule.ID); !errors.Is(err, datastore.ErrScheduleNotFound) {
+		t.Errorf("Expected ErrScheduleNotFound, got %v", err)
+	}
+}
+
+func TestScheduler_MissedRunPolicy(t *testing.T) {
+	store := datastore.NewMemoryStore()
+	ts := newTestScheduler(store, time.Date(2026, 5, 4, 6, 59, 30, 0, time.UTC))
+	skip := model.NewSchedule("Пропустить", kettleOn)
+	skip.Cron = "*/10 * * * *"
+	once := model.NewSchedule("Выполнить один раз", model.ScheduleAction{Type: model.ActionScene, SceneID: "morning"})
+	once.Cron = "*/10 * * * *"
+	once.MissedRunPolicy = model.MissedRunRunOnce
+	for _, s := range []*model.Schedule{skip, once} {
+		if _, err := ts.Add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Сервис остановлен на час: новый планировщик над тем же хранилищем
+	ts = newTestScheduler(store, ts.clock.Add(time.Hour))
+	ts.advance(0)
+	assertStrings(t, "commands", ts.executor.commands)
+	assertStrings(t, "scenes", ts.executor.scenes, "morning")
+
+	got := ts.get(t, skip.ID)
+	if got.LastStatus != model.ScheduleMissed || got.LastError != "run at 2026-05-04T07:00:00Z was missed" {
+		t.Errorf("Unexpected skipped schedule: %+v", got)
+	}
+	if want := time.Date(2026, 5, 4, 8, 0, 0, 0, time.UTC); !got.NextRun.Equal(want) {
+		t.Errorf("NextRun = %s, want %s", got.NextRun, want)
+	}
+	if got := ts.get(t, once.ID); got.LastStatus != model.ScheduleCompleted {
+		t.Errorf("Unexpected run_once schedule: %+v", got)
+	}
+
+	// Опоздание в пределах минуты - не пропуск
+	ts.advance(time.Minute)
+	assertStrings(t, "commands", ts.executor.commands, "kettle:turn_on")
+}
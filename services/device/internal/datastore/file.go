@@ -0,0 +1,628 @@
+package datastore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+)
+
+// Durability определяет, когда журнал сбрасывается на диск (fsync)
+type Durability string
+
+const (
+	// DurabilityAlways - fsync после каждой записи: изменение не теряется
+	// после успешного ответа, даже при отключении питания
+	DurabilityAlways Durability = "always"
+
+	// DurabilityInterval - fsync раз в SyncInterval: при отключении питания
+	// теряются изменения за последний интервал
+	DurabilityInterval Durability = "interval"
+
+	// DurabilityNone - сброс на диск выполняет ОС: изменения переживают
+	// падение процесса, но не отключение питания
+	DurabilityNone Durability = "none"
+)
+
+// Имена файлов в каталоге хранилища
+const (
+	walFileName      = "devices.wal"
+	snapshotFileName = "devices.snapshot"
+)
+
+// Значения по умолчанию FileConfig
+const (
+	defaultSyncInterval  = time.Second
+	defaultSnapshotEvery = 1000
+)
+
+// ErrStoreClosed означает запись в закрытое хранилище
+var ErrStoreClosed = errors.New("device store is closed")
+
+// FileConfig содержит настройки FileStore
+type FileConfig struct {
+	Dir           string        // Каталог хранилища (создается при необходимости)
+	Durability    Durability    // Режим сброса журнала на диск (пусто - DurabilityAlways)
+	SyncInterval  time.Duration // Период fsync для DurabilityInterval (0 - 1s)
+	SnapshotEvery int           // Записей журнала между снимками (0 - 1000)
+}
+
+// FileStore реализует хранилище устройств в локальном каталоге без внешней
+// СУБД. Состояние хранится в памяти (MemoryStore); каждое изменение
+// дописывается в журнал (write-ahead log) итоговым состоянием устройства,
+// комнаты, сцены, правила или расписания, а после SnapshotEvery записей состояние сохраняется снимком и журнал
+// очищается. При запуске состояние восстанавливается из снимка и журнала.
+//
+// Каталог не должен использоваться несколькими процессами одновременно.
+type FileStore struct {
+	*MemoryStore // Чтение выполняется из памяти
+
+	config FileConfig
+
+	mu      sync.Mutex // Сериализует изменения, запись журнала и снимки
+	wal     *os.File
+	size    int64  // Размер журнала после последней целой записи
+	seq     uint64 // Номер последней записи
+	records int    // Записей в журнале после последнего снимка
+	dirty   bool   // Есть записи, не сброшенные на диск
+	failed  error  // Журнал в неизвестном состоянии, запись запрещена
+	closed  bool
+	done    chan struct{}
+}
+
+// NewFileStore открывает хранилище в config.Dir и восстанавливает состояние
+func NewFileStore(config FileConfig) (*FileStore, error) {
+	switch config.Durability {
+	case "":
+		config.Durability = DurabilityAlways
+	case DurabilityAlways, DurabilityInterval, DurabilityNone:
+	default:
+		return nil, fmt.Errorf("unknown durability mode %q, expected always, interval or none", config.Durability)
+	}
+	if config.SyncInterval <= 0 {
+		config.SyncInterval = defaultSyncInterval
+	}
+	if config.SnapshotEvery <= 0 {
+		config.SnapshotEvery = defaultSnapshotEvery
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	s := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		config:      config,
+		done:        make(chan struct{}),
+	}
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+
+	if config.Durability == DurabilityInterval {
+		go s.syncLoop()
+	}
+	return s, nil
+}
+
+// recover загружает снимок, воспроизводит журнал и открывает его для записи
+func (s *FileStore) recover() error {
+	snapshotSeq, err := s.loadSnapshot()
+	if err != nil {
+		return err
+	}
+	s.seq = snapshotSeq
+
+	wal, err := os.OpenFile(filepath.Join(s.config.Dir, walFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open device log: %w", err)
+	}
+
+	end, err := readLog(wal, func(rec walRecord) error {
+		// Записи до снимка уже учтены в нем (сбой между снимком и очисткой журнала)
+		if rec.Seq <= snapshotSeq {
+			return nil
+		}
+		s.apply(rec)
+		s.seq = rec.Seq
+		s.records++
+		return nil
+	})
+	if err != nil {
+		wal.Close()
+		return fmt.Errorf("failed to replay device log: %w", err)
+	}
+
+	info, err := wal.Stat()
+	if err != nil {
+		wal.Close()
+		return err
+	}
+	if end < info.Size() {
+		log.Printf("FileStore: discarding torn record at the end of %s (%d bytes)", walFileName, info.Size()-end)
+		if err := wal.Truncate(end); err != nil {
+			wal.Close()
+			return fmt.Errorf("failed to truncate device log: %w", err)
+		}
+		if err := wal.Sync(); err != nil {
+			wal.Close()
+			return err
+		}
+	}
+	if _, err := wal.Seek(end, 0); err != nil {
+		wal.Close()
+		return err
+	}
+
+	s.wal = wal
+	s.size = end
+	return nil
+}
+
+// loadSnapshot загружает снимок, если он есть, и возвращает его номер записи
+func (s *FileStore) loadSnapshot() (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(s.config.Dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snapshot fileSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return 0, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	for _, room := range snapshot.Rooms {
+		s.MemoryStore.putRoom(room.ID, room.toModel())
+	}
+	for _, scene := range snapshot.Scenes {
+		s.MemoryStore.putScene(scene.ID, scene.toModel())
+	}
+	for _, rule := range snapshot.Rules {
+		s.MemoryStore.putRule(rule.ID, rule.toModel())
+	}
+	for _, schedule := range snapshot.Schedules {
+		s.MemoryStore.putSchedule(schedule.ID, schedule.toModel())
+	}
+	for _, device := range snapshot.Devices {
+		s.MemoryStore.put(device.ID, device.toModel())
+	}
+	return snapshot.Seq, nil
+}
+
+// fileSnapshot - снимок состояния на момент записи журнала Seq
+type fileSnapshot struct {
+	Seq       uint64          `json:"seq"`
+	Rooms     []*diskRoom     `json:"rooms,omitempty"`
+	Devices   []*diskDevice   `json:"devices"`
+	Scenes    []*diskScene    `json:"scenes,omitempty"`
+	Rules     []*diskRule     `json:"rules,omitempty"`
+	Schedules []*diskSchedule `json:"schedules,omitempty"`
+}
+
+// apply применяет запись журнала к состоянию в памяти
+func (s *FileStore) apply(rec walRecord) {
+	switch rec.Op {
+	case opPut:
+		if rec.Device != nil {
+			s.MemoryStore.put(rec.ID, rec.Device.toModel())
+		}
+	case opDelete:
+		s.MemoryStore.put(rec.ID, nil)
+	case opPutRoom:
+		if rec.Room != nil {
+			s.MemoryStore.putRoom(rec.ID, rec.Room.toModel())
+		}
+	case opDeleteRoom:
+		s.MemoryStore.putRoom(rec.ID, nil)
+	case opPutScene:
+		if rec.Scene != nil {
+			s.MemoryStore.putScene(rec.ID, rec.Scene.toModel())
+		}
+	case opDeleteScene:
+		s.MemoryStore.putScene(rec.ID, nil)
+	case opPutRule:
+		if rec.Rule != nil {
+			s.MemoryStore.putRule(rec.ID, rec.Rule.toModel())
+		}
+	case opDeleteRule:
+		s.MemoryStore.putRule(rec.ID, nil)
+	case opPutSchedule:
+		if rec.Schedule != nil {
+			s.MemoryStore.putSchedule(rec.ID, rec.Schedule.toModel())
+		}
+	case opDeleteSchedule:
+		s.MemoryStore.putSchedule(rec.ID, nil)
+	}
+}
+
+// SaveDevice сохраняет устройство в хранилище
+func (s *FileStore) SaveDevice(device *model.Device) error {
+	version := device.Version
+	err := s.mutate(device.ID, func() error { return s.MemoryStore.SaveDevice(device) })
+	if err != nil {
+		device.Version = version
+	}
+	return err
+}
+
+// DeleteDevice удаляет устройство из хранилища
+func (s *FileStore) DeleteDevice(id string) error {
+	return s.mutate(id, func() error { return s.MemoryStore.DeleteDevice(id) })
+}
+
+// UpdateDeviceStatus обновляет статус устройства
+func (s *FileStore) UpdateDeviceStatus(id string, status *model.DeviceStatus) error {
+	return s.mutate(id, func() error { return s.MemoryStore.UpdateDeviceStatus(id, status) })
+}
+
+// UpdateDeviceParameter обновляет параметр устройства
+func (s *FileStore) UpdateDeviceParameter(id, key, value string) error {
+	return s.mutate(id, func() error { return s.MemoryStore.UpdateDeviceParameter(id, key, value) })
+}
+
+// SaveRoom сохраняет комнату в хранилище
+func (s *FileStore) SaveRoom(room *model.Room) error {
+	return s.mutateRoom(room.ID, func() error { return s.MemoryStore.SaveRoom(room) })
+}
+
+// DeleteRoom удаляет комнату из хранилища
+func (s *FileStore) DeleteRoom(id string) error {
+	return s.mutateRoom(id, func() error { return s.MemoryStore.DeleteRoom(id) })
+}
+
+// SaveScene сохраняет сцену в хранилище
+func (s *FileStore) SaveScene(scene *model.Scene) error {
+	return s.mutateScene(scene.ID, func() error { return s.MemoryStore.SaveScene(scene) })
+}
+
+// DeleteScene удаляет сцену из хранилища
+func (s *FileStore) DeleteScene(id string) error {
+	return s.mutateScene(id, func() error { return s.MemoryStore.DeleteScene(id) })
+}
+
+// SaveRule сохраняет правило в хранилище
+func (s *FileStore) SaveRule(rule *model.Rule) error {
+	return s.mutateRule(rule.ID, func() error { return s.MemoryStore.SaveRule(rule) })
+}
+
+// DeleteRule удаляет правило из хранилища
+func (s *FileStore) DeleteRule(id string) error {
+	return s.mutateRule(id, func() error { return s.MemoryStore.DeleteRule(id) })
+}
+
+// SaveSchedule сохраняет расписание в хранилище
+func (s *FileStore) SaveSchedule(schedule *model.Schedule) error {
+	return s.mutateSchedule(schedule.ID, func() error { return s.MemoryStore.SaveSchedule(schedule) })
+}
+
+// DeleteSchedule удаляет расписание из хранилища
+func (s *FileStore) DeleteSchedule(id string) error {
+	return s.mutateSchedule(id, func() error { return s.MemoryStore.DeleteSchedule(id) })
+}
+
+// AddTestDevices добавляет тестовые комнаты и устройства, если хранилище пустое
+func (s *FileStore) AddTestDevices() {
+	if rooms, _ := s.ListRooms(); len(s.GetAllDevices()) > 0 || len(rooms) > 0 {
+		return
+	}
+	if err := saveTestData(s); err != nil {
+		log.Printf("FileStore: failed to add test devices: %v", err)
+	}
+}
+
+// mutate выполняет изменение устройства id в памяти и дописывает его итоговое
+// состояние в журнал. Если запись в журнал не удалась, изменение в памяти
+// отменяется и возвращается ошибка.
+func (s *FileStore) mutate(id string, change func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	previous := s.MemoryStore.peek(id)
+	if err := change(); err != nil {
+		return err
+	}
+
+	rec := walRecord{Seq: s.seq + 1, Op: opDelete, ID: id}
+	if current := s.MemoryStore.peek(id); current != nil {
+		rec.Op = opPut
+		rec.Device = toDisk(current)
+	}
+	return s.commit(rec, func() { s.MemoryStore.put(id, previous) })
+}
+
+// mutateRoom выполняет изменение комнаты id так же, как mutate
+func (s *FileStore) mutateRoom(id string, change func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	previous := s.MemoryStore.peekRoom(id)
+	if err := change(); err != nil {
+		return err
+	}
+
+	rec := walRecord{Seq: s.seq + 1, Op: opDeleteRoom, ID: id}
+	if current := s.MemoryStore.peekRoom(id); current != nil {
+		rec.Op = opPutRoom
+		rec.Room = toDiskRoom(current)
+	}
+	return s.commit(rec, func() { s.MemoryStore.putRoom(id, previous) })
+}
+
+// mutateScene выполняет изменение сцены id так же, как mutate
+func (s *FileStore) mutateScene(id string, change func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	previous := s.MemoryStore.peekScene(id)
+	if err := change(); err != nil {
+		return err
+	}
+
+	rec := walRecord{Seq: s.seq + 1, Op: opDeleteScene, ID: id}
+	if current := s.MemoryStore.peekScene(id); current != nil {
+		rec.Op = opPutScene
+		rec.Scene = toDiskScene(current)
+	}
+	return s.commit(rec, func() { s.MemoryStore.putScene(id, previous) })
+}
+
+// mutateRule выполняет изменение правила id так же, как mutate
+func (s *FileStore) mutateRule(id string, change func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	previous := s.MemoryStore.peekRule(id)
+	if err := change(); err != nil {
+		return err
+	}
+
+	rec := walRecord{Seq: s.seq + 1, Op: opDeleteRule, ID: id}
+	if current := s.MemoryStore.peekRule(id); current != nil {
+		rec.Op = opPutRule
+		rec.Rule = toDiskRule(current)
+	}
+	return s.commit(rec, func() { s.MemoryStore.putRule(id, previous) })
+}
+
+// mutateSchedule выполняет изменение расписания id так же, как mutate
+func (s *FileStore) mutateSchedule(id string, change func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	previous := s.MemoryStore.peekSchedule(id)
+	if err := change(); err != nil {
+		return err
+	}
+
+	rec := walRecord{Seq: s.seq + 1, Op: opDeleteSchedule, ID: id}
+	if current := s.MemoryStore.peekSchedule(id); current != nil {
+		rec.Op = opPutSchedule
+		rec.Schedule = toDiskSchedule(current)
+	}
+	return s.commit(rec, func() { s.MemoryStore.putSchedule(id, previous) })
+}
+
+// writable проверяет, что в хранилище можно писать
+func (s *FileStore) writable() error {
+	if s.closed {
+		return ErrStoreClosed
+	}
+	if s.failed != nil {
+		return fmt.Errorf("device log is unavailable: %w", s.failed)
+	}
+	return nil
+}
+
+// commit дописывает запись rec в журнал и при необходимости сохраняет
+// снимок. Если запись не удалась, вызывается rollback.
+func (s *FileStore) commit(rec walRecord, rollback func()) error {
+	if err := s.append(rec); err != nil {
+		rollback()
+		return fmt.Errorf("failed to write device log: %w", err)
+	}
+	s.seq = rec.Seq
+	s.records++
+
+	if s.records >= s.config.SnapshotEvery {
+		if err := s.snapshot(); err != nil {
+			// Журнал остается целым, снимок будет повторен после следующей записи
+			log.Printf("FileStore: snapshot failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// append дописывает запись в журнал и сбрасывает его на диск по режиму Durability
+func (s *FileStore) append(rec walRecord) error {
+	data, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.wal.Write(data); err != nil {
+		// Частично записанная запись иначе оказалась бы в середине журнала
+		if truncErr := s.wal.Truncate(s.size); truncErr != nil {
+			s.failed = truncErr
+		} else if _, seekErr := s.wal.Seek(s.size, 0); seekErr != nil {
+			s.failed = seekErr
+		}
+		return err
+	}
+	s.size += int64(len(data))
+
+	switch s.config.Durability {
+	case DurabilityAlways:
+		if err := s.wal.Sync(); err != nil {
+			// После неудачного fsync состояние страниц в кэше ОС неизвестно
+			s.failed = err
+			return err
+		}
+	case DurabilityInterval:
+		s.dirty = true
+	}
+	return nil
+}
+
+// snapshot сохраняет текущее состояние снимком и очищает журнал. Снимок
+// записывается во временный файл и атомарно переименовывается.
+func (s *FileStore) snapshot() error {
+	devices := s.MemoryStore.GetAllDevices()
+	rooms, _ := s.MemoryStore.ListRooms()
+	scenes, _ := s.MemoryStore.ListScenes()
+	rules, _ := s.MemoryStore.ListRules()
+	schedules, _ := s.MemoryStore.ListSchedules()
+	snapshot := fileSnapshot{
+		Seq:       s.seq,
+		Rooms:     make([]*diskRoom, 0, len(rooms)),
+		Devices:   make([]*diskDevice, 0, len(devices)),
+		Scenes:    make([]*diskScene, 0, len(scenes)),
+		Rules:     make([]*diskRule, 0, len(rules)),
+		Schedules: make([]*diskSchedule, 0, len(schedules)),
+	}
+	for _, room := range rooms {
+		snapshot.Rooms = append(snapshot.Rooms, toDiskRoom(room))
+	}
+	for _, device := range devices {
+		snapshot.Devices = append(snapshot.Devices, toDisk(device))
+	}
+	for _, scene := range scenes {
+		snapshot.Scenes = append(snapshot.Scenes, toDiskScene(scene))
+	}
+	for _, rule := range rules {
+		snapshot.Rules = append(snapshot.Rules, toDiskRule(rule))
+	}
+	for _, schedule := range schedules {
+		snapshot.Schedules = append(snapshot.Schedules, toDiskSchedule(schedule))
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.config.Dir, snapshotFileName)
+	tmp := path + ".tmp"
+	if err := writeFileSync(tmp, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	syncDir(s.config.Dir)
+
+	// Записи журнала учтены в снимке; если очистка не удастся, при
+	// восстановлении они будут пропущены по номеру
+	if err := s.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.wal.Seek(0, 0); err != nil {
+		s.failed = err
+		return err
+	}
+	s.size = 0
+	s.records = 0
+	if err := s.wal.Sync(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// syncLoop сбрасывает журнал на диск раз в SyncInterval (DurabilityInterval)
+func (s *FileStore) syncLoop() {
+	ticker := time.NewTicker(s.config.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.dirty && !s.closed {
+				if err := s.wal.Sync(); err != nil {
+					log.Printf("FileStore: failed to sync device log: %v", err)
+				} else {
+					s.dirty = false
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Close сохраняет снимок и закрывает журнал
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+
+	var err error
+	if s.failed == nil && s.records > 0 {
+		err = s.snapshot()
+	}
+	if syncErr := s.wal.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := s.wal.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeFileSync записывает файл и сбрасывает его на диск
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir сбрасывает на диск каталог, чтобы переименование файла пережило
+// отключение питания. На Windows каталог так открыть нельзя, ошибка игнорируется.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
@@ -0,0 +1,352 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+)
+
+func TestFileStore(t *testing.T) {
+	testStore(t, func(t *testing.T) DeviceStore {
+		return openFileStore(t, FileConfig{Dir: t.TempDir()})
+	})
+
+	// Снимок после каждой записи
+	t.Run("Snapshots", func(t *testing.T) {
+		testStore(t, func(t *testing.T) DeviceStore {
+			return openFileStore(t, FileConfig{Dir: t.TempDir(), SnapshotEvery: 1})
+		})
+	})
+}
+
+func TestFileStore_Recover(t *testing.T) {
+	for _, snapshotEvery := range []int{1, 2, 1000} {
+		dir := t.TempDir()
+		config := FileConfig{Dir: dir, Durability: DurabilityNone, SnapshotEvery: snapshotEvery}
+
+		store := openFileStore(t, config)
+		lamp := model.NewDevice("Лампа", model.DeviceTypeLamp, "Philips Hue", "Гостиная")
+		socket := model.NewDevice("Розетка", model.DeviceTypeSocket, "TP-Link Kasa", "Кухня")
+		mustSave(t, store, lamp)
+		mustSave(t, store, socket)
+		if err := store.UpdateDeviceParameter(lamp.ID, model.ParamPower, "off"); err != nil {
+			t.Fatalf("UpdateDeviceParameter failed: %v", err)
+		}
+		if err := store.DeleteDevice(socket.ID); err != nil {
+			t.Fatalf("DeleteDevice failed: %v", err)
+		}
+		crash(store)
+
+		store = openFileStore(t, config)
+		got, err := store.GetDevice(lamp.ID)
+		if err != nil {
+			t.Fatalf("snapshotEvery=%d: GetDevice after reopen failed: %v", snapshotEvery, err)
+		}
+		if got.Name != lamp.Name || got.Status.Parameters[model.ParamPower] != "off" || got.Version != 2 {
+			t.Errorf("snapshotEvery=%d: unexpected device after reopen: %+v", snapshotEvery, got)
+		}
+		if _, err := store.GetDevice(socket.ID); !errors.Is(err, ErrDeviceNotFound) {
+			t.Errorf("snapshotEvery=%d: deleted device recovered, err = %v", snapshotEvery, err)
+		}
+
+		// Версии продолжаются после восстановления
+		got.Name = "Лампа 2"
+		mustSave(t, store, got)
+		if got.Version != 3 {
+			t.Errorf("snapshotEvery=%d: Version = %d, want 3", snapshotEvery, got.Version)
+		}
+	}
+}
+
+func TestFileStore_RecoverRooms(t *testing.T) {
+	for _, snapshotEvery := range []int{1, 1000} {
+		config := FileConfig{Dir: t.TempDir(), Durability: DurabilityNone, SnapshotEvery: snapshotEvery}
+
+		store := openFileStore(t, config)
+		kitchen := model.NewRoom("Кухня", 1, "kitchen", "кухне")
+		attic := model.NewRoom("Мансарда", 2, "")
+		for _, room := range []*model.Room{kitchen, attic} {
+			if err := store.SaveRoom(room); err != nil {
+				t.Fatalf("SaveRoom failed: %v", err)
+			}
+		}
+		lamp := model.NewDevice("Лампа", model.DeviceTypeLamp, "Philips Hue", "Кухня")
+		lamp.RoomID = kitchen.ID
+		mustSave(t, store, lamp)
+		if err := store.DeleteRoom(attic.ID); err != nil {
+			t.Fatalf("DeleteRoom failed: %v", err)
+		}
+		crash(store)
+
+		store = openFileStore(t, config)
+		if got, err := store.GetRoom(kitchen.ID); err != nil || got.Name != "Кухня" || len(got.Aliases) != 1 {
+			t.Errorf("snapshotEvery=%d: unexpected room after reopen: %+v %v", snapshotEvery, got, err)
+		}
+		if _, err := store.GetRoom(attic.ID); !errors.Is(err, ErrRoomNotFound) {
+			t.Errorf("snapshotEvery=%d: deleted room recovered, err = %v", snapshotEvery, err)
+		}
+		if got, err := store.GetDevice(lamp.ID); err != nil || got.RoomID != kitchen.ID {
+			t.Errorf("snapshotEvery=%d: unexpected device after reopen: %+v %v", snapshotEvery, got, err)
+		}
+		if err := store.DeleteRoom(kitchen.ID); !errors.Is(err, ErrRoomNotEmpty) {
+			t.Errorf("snapshotEvery=%d: expected ErrRoomNotEmpty, got %v", snapshotEvery, err)
+		}
+	}
+}
+
+func TestFileStore_RecoverScenes(t *testing.T) {
+	for _, snapshotEvery := range []int{1, 1000} {
+		config := FileConfig{Dir: t.TempDir(), Durability: DurabilityNone, SnapshotEvery: snapshotEvery}
+
+		store := openFileStore(t, config)
+		movie := model.NewScene("Кино", "film", model.SceneTarget{DeviceID: "lamp-1", Parameters: map[string]string{"power": "on", "level": "20"}})
+		night := model.NewScene("Ночь", "", model.SceneTarget{DeviceID: "lamp-1", Parameters: map[string]string{"power": "off"}})
+		for _, scene := range []*model.Scene{movie, night} {
+			if err := store.SaveScene(scene); err != nil {
+				t.Fatalf("SaveScene failed: %v", err)
+			}
+		}
+		if err := store.DeleteScene(night.ID); err != nil {
+			t.Fatalf("DeleteScene failed: %v", err)
+		}
+		crash(store)
+
+		store = openFileStore(t, config)
+		if got, err := store.GetScene(movie.ID); err != nil || got.Name != "Кино" || len(got.Targets) != 1 || got.Targets[0].Parameters["level"] != "20" {
+			t.Errorf("snapshotEvery=%d: unexpected scene after reopen: %+v %v", snapshotEvery, got, err)
+		}
+		if _, err := store.GetScene(night.ID); !errors.Is(err, ErrSceneNotFound) {
+			t.Errorf("snapshotEvery=%d: deleted scene recovered, err = %v", snapshotEvery, err)
+		}
+	}
+}
+
+func TestFileStore_RecoverRules(t *testing.T) {
+	for _, snapshotEvery := range []int{1, 1000} {
+		config := FileConfig{Dir: t.TempDir(), Durability: DurabilityNone, SnapshotEvery: snapshotEvery}
+
+		store := openFileStore(t, config)
+		rule := model.NewRule("Свет в коридоре")
+		rule.Triggers = []model.RuleTrigger{{Type: model.TriggerDeviceOffline, DeviceID: "sensor-1"}}
+		rule.Actions = []model.RuleAction{{Type: model.ActionScene, SceneID: "scene-1"}}
+		removed := model.NewRule("Удаленное")
+		for _, r := range []*model.Rule{rule, removed} {
+			if err := store.SaveRule(r); err != nil {
+				t.Fatalf("SaveRule failed: %v", err)
+			}
+		}
+		if err := store.DeleteRule(removed.ID); err != nil {
+			t.Fatalf("DeleteRule failed: %v", err)
+		}
+		crash(store)
+
+		store = openFileStore(t, config)
+		if got, err := store.GetRule(rule.ID); err != nil || got.Name != rule.Name || len(got.Triggers) != 1 || got.Actions[0].SceneID != "scene-1" {
+			t.Errorf("snapshotEvery=%d: unexpected rule after reopen: %+v %v", snapshotEvery, got, err)
+		}
+		if _, err := store.GetRule(removed.ID); !errors.Is(err, ErrRuleNotFound) {
+			t.Errorf("snapshotEvery=%d: deleted rule recovered, err = %v", snapshotEvery, err)
+		}
+	}
+}
+
+func TestFileStore_RecoverSchedules(t *testing.T) {
+	for _, snapshotEvery := range []int{1, 1000} {
+		config := FileConfig{Dir: t.TempDir(), Durability: DurabilityNone, SnapshotEvery: snapshotEvery}
+
+		store := openFileStore(t, config)
+		schedule := model.NewSchedule("Чайник", model.ScheduleAction{Type: model.ActionControl, DeviceID: "socket-1", Command: "turn_on"})
+		schedule.Cron = "0 7 * * 1-5"
+		schedule.NextRun = time.Date(2026, 5, 5, 7, 0, 0, 0, time.UTC)
+		removed := model.NewSchedule("Удаленное", model.ScheduleAction{Type: model.ActionScene, SceneID: "scene-1"})
+		for _, s := range []*model.Schedule{schedule, removed} {
+			if err := store.SaveSchedule(s); err != nil {
+				t.Fatalf("SaveSchedule failed: %v", err)
+			}
+		}
+		if err := store.DeleteSchedule(removed.ID); err != nil {
+			t.Fatalf("DeleteSchedule failed: %v", err)
+		}
+		crash(store)
+
+		store = openFileStore(t, config)
+		if got, err := store.GetSchedule(schedule.ID); err != nil || got.Cron != schedule.Cron || !got.NextRun.Equal(schedule.NextRun) ||
+			!got.RunAt.IsZero() || got.Action.Command != "turn_on" {
+			t.Errorf("snapshotEvery=%d: unexpected schedule after reopen: %+v %v", snapshotEvery, got, err)
+		}
+		if _, err := store.GetSchedule(removed.ID); !errors.Is(err, ErrScheduleNotFound) {
+			t.Errorf("snapshotEvery=%d: deleted schedule recovered, err = %v", snapshotEvery, err)
+		}
+	}
+}
+
+func TestFileStore_TornRecord(t *testing.T) {
+	dir := t.TempDir()
+	config := FileConfig{Dir: dir}
+
+	store := openFileStore(t, config)
+	lamp := model.NewDevice("Лампа", model.DeviceTypeLamp, "Philips Hue", "Гостиная")
+	socket := model.NewDevice("Розетка", model.DeviceTypeSocket, "TP-Link Kasa", "Кухня")
+	mustSave(t, store, lamp)
+	size := store.size
+	mustSave(t, store, socket)
+	crash(store)
+
+	// Обрываем последнюю запись посередине
+	path := filepath.Join(dir, walFileName)
+	if err := os.Truncate(path, size+5); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openFileStore(t, config)
+	if _, err := store.GetDevice(lamp.ID); err != nil {
+		t.Errorf("GetDevice(lamp) failed: %v", err)
+	}
+	if _, err := store.GetDevice(socket.ID); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("torn record applied, err = %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != size {
+		t.Errorf("log is not truncated to %d bytes: %v, %v", size, info.Size(), err)
+	}
+
+	// Новая запись дописывается после последней целой
+	socket.Version = 0
+	mustSave(t, store, socket)
+	crash(store)
+	store = openFileStore(t, config)
+	if _, err := store.GetDevice(socket.ID); err != nil {
+		t.Errorf("GetDevice(socket) after rewrite failed: %v", err)
+	}
+}
+
+func TestFileStore_CorruptLog(t *testing.T) {
+	dir := t.TempDir()
+	config := FileConfig{Dir: dir}
+
+	store := openFileStore(t, config)
+	mustSave(t, store, model.NewDevice("Лампа", model.DeviceTypeLamp, "Philips Hue", "Гостиная"))
+	mustSave(t, store, model.NewDevice("Розетка", model.DeviceTypeSocket, "TP-Link Kasa", "Кухня"))
+	crash(store)
+
+	// Повреждаем данные первой записи: это не обрыв, открытие должно завершиться ошибкой
+	path := filepath.Join(dir, walFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[recordHeaderSize+2] ^= 0xFF
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileStore(config); !errors.Is(err, errCorruptLog) {
+		t.Fatalf("NewFileStore error = %v, want errCorruptLog", err)
+	}
+}
+
+func TestFileStore_SnapshotCompaction(t *testing.T) {
+	dir := t.TempDir()
+	config := FileConfig{Dir: dir, SnapshotEvery: 3}
+
+	store := openFileStore(t, config)
+	lamp := model.NewDevice("Лампа", model.DeviceTypeLamp, "Philips Hue", "Гостиная")
+	mustSave(t, store, lamp)
+	for _, level := range []string{"10", "20", "30"} {
+		if err := store.UpdateDeviceParameter(lamp.ID, model.ParamLevel, level); err != nil {
+			t.Fatalf("UpdateDeviceParameter failed: %v", err)
+		}
+	}
+	// 4 записи: после третьей снимок, в журнале одна запись
+	if store.records != 1 {
+		t.Errorf("records = %d, want 1", store.records)
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); err != nil {
+		t.Fatalf("snapshot is not written: %v", err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, walFileName)); err != nil || info.Size() != 0 {
+		t.Errorf("log is not compacted on Close: %v", err)
+	}
+	if err := store.SaveDevice(lamp); !errors.Is(err, ErrStoreClosed) {
+		t.Errorf("SaveDevice after Close error = %v, want ErrStoreClosed", err)
+	}
+
+	store = openFileStore(t, config)
+	got, err := store.GetDevice(lamp.ID)
+	if err != nil {
+		t.Fatalf("GetDevice after reopen failed: %v", err)
+	}
+	if got.Status.Parameters[model.ParamLevel] != "30" || got.Version != 4 {
+		t.Errorf("unexpected device after reopen: %+v", got)
+	}
+}
+
+func TestFileStore_SkipsRecordsInSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	config := FileConfig{Dir: dir}
+
+	store := openFileStore(t, config)
+	lamp := model.NewDevice("Лампа", model.DeviceTypeLamp, "Philips Hue", "Гостиная")
+	mustSave(t, store, lamp)
+	if err := store.DeleteDevice(lamp.ID); err != nil {
+		t.Fatalf("DeleteDevice failed: %v", err)
+	}
+	crash(store)
+
+	// Сбой между записью снимка и очисткой журнала: снимок содержит
+	// состояние после первой записи, журнал - обе записи
+	data, err := os.ReadFile(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, snapshotFileName), []byte(`{"seq":1,"devices":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openFileStore(t, config)
+	if _, err := store.GetDevice(lamp.ID); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("GetDevice error = %v, want ErrDeviceNotFound", err)
+	}
+	if store.seq != 2 || store.size != int64(len(data)) {
+		t.Errorf("seq = %d, size = %d, want 2, %d", store.seq, store.size, len(data))
+	}
+}
+
+func TestNewFileStore_InvalidDurability(t *testing.T) {
+	if _, err := NewFileStore(FileConfig{Dir: t.TempDir(), Durability: "sometimes"}); err == nil {
+		t.Fatal("expected error for unknown durability mode")
+	}
+}
+
+func openFileStore(t *testing.T, config FileConfig) *FileStore {
+	t.Helper()
+	store, err := NewFileStore(config)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func mustSave(t *testing.T, store DeviceStore, device *model.Device) {
+	t.Helper()
+	if err := store.SaveDevice(device); err != nil {
+		t.Fatalf("SaveDevice failed: %v", err)
+	}
+}
+
+// crash закрывает журнал без снимка, как при падении процесса
+func crash(store *FileStore) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.closed = true
+	close(store.done)
+	store.wal.Close()
+}
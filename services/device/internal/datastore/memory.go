@@ -1,58 +1,32 @@
 package datastore
 
 import (
-	"errors"
+	"log"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
 )
 
-var (
-	// ErrDeviceNotFound означает, что устройство не найдено в хранилище
-	ErrDeviceNotFound = errors.New("device not found")
-
-	// ErrInvalidDeviceID означает, что указан неверный идентификатор устройства
-	ErrInvalidDeviceID = errors.New("invalid device ID")
-)
-
-// DeviceStore представляет интерфейс хранилища устройств
-type DeviceStore interface {
-	// GetDevice возвращает устройство по ID
-	GetDevice(id string) (*model.Device, error)
-
-	// ListDevices возвращает список устройств, опционально фильтрованных
-	ListDevices(deviceType string, onlineOnly bool) ([]*model.Device, error)
-
-	// SaveDevice сохраняет устройство в хранилище
-	SaveDevice(device *model.Device) error
-
-	// DeleteDevice удаляет устройство из хранилища
-	DeleteDevice(id string) error
-
-	// UpdateDeviceStatus обновляет статус устройства
-	UpdateDeviceStatus(id string, status *model.DeviceStatus) error
-
-	// UpdateDeviceParameter обновляет параметр устройства
-	UpdateDeviceParameter(id, key, value string) error
-
-	// GetAllDevices возвращает все устройства для стриминга статусов
-	GetAllDevices() []*model.Device
-
-	// AddTestDevices добавляет тестовые устройства для разработки
-	AddTestDevices()
-}
-
-// MemoryStore реализует хранилище устройств в памяти
+// MemoryStore реализует хранилище устройств, комнат, сцен, правил и расписаний в памяти
 type MemoryStore struct {
-	devices map[string]*model.Device
-	mu      sync.RWMutex
+	devices   map[string]*model.Device
+	rooms     map[string]*model.Room
+	scenes    map[string]*model.Scene
+	rules     map[string]*model.Rule
+	schedules map[string]*model.Schedule
+	mu        sync.RWMutex
 }
 
 // NewMemoryStore создает новый экземпляр in-memory хранилища
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
-		devices: make(map[string]*model.Device),
+		devices:   make(map[string]*model.Device),
+		rooms:     make(map[string]*model.Room),
+		scenes:    make(map[string]*model.Scene),
+		rules:     make(map[string]*model.Rule),
+		schedules: make(map[string]*model.Schedule),
 	}
 }
 
@@ -70,7 +44,7 @@ func (s *MemoryStore) GetDevice(id string) (*model.Device, error) {
 		return nil, ErrDeviceNotFound
 	}
 
-	return device, nil
+	return device.Clone(), nil
 }
 
 // ListDevices возвращает список устройств, опционально фильтрованных
@@ -87,13 +61,16 @@ func (s *MemoryStore) ListDevices(deviceType string, onlineOnly bool) ([]*model.
 		}
 
 		// Фильтрация по онлайн-статусу, если указано
-		if onlineOnly && !device.Status.Online {
+		if onlineOnly && (device.Status == nil || !device.Status.Online) {
 			continue
 		}
 
-		result = append(result, device)
+		result = append(result, device.Clone())
 	}
 
+	// Стабильный порядок: одинаковое состояние дает одинаковый ответ (и ETag в шлюзе)
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
 	return result, nil
 }
 
@@ -106,7 +83,22 @@ func (s *MemoryStore) SaveDevice(device *model.Device) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.devices[device.ID] = device
+	var version int64
+	if current, ok := s.devices[device.ID]; ok {
+		version = current.Version
+	}
+	if device.Version != 0 && device.Version != version {
+		if version == 0 {
+			return ErrDeviceNotFound
+		}
+		return ErrVersionConflict
+	}
+	if _, ok := s.rooms[device.RoomID]; device.RoomID != "" && !ok {
+		return ErrRoomNotFound
+	}
+
+	device.Version = version + 1
+	s.devices[device.ID] = device.Clone()
 	return nil
 }
 
@@ -141,8 +133,9 @@ func (s *MemoryStore) UpdateDeviceStatus(id string, status *model.DeviceStatus)
 		return ErrDeviceNotFound
 	}
 
-	device.Status = status
+	device.Status = status.Clone()
 	device.LastUpdated = time.Now()
+	device.Version++
 
 	return nil
 }
@@ -164,9 +157,13 @@ func (s *MemoryStore) UpdateDeviceParameter(id, key, value string) error {
 	if device.Status == nil {
 		device.Status = model.NewDeviceStatus()
 	}
+	if device.Status.Parameters == nil {
+		device.Status.Parameters = make(map[string]string)
+	}
 
 	device.Status.Parameters[key] = value
 	device.LastUpdated = time.Now()
+	device.Version++
 
 	return nil
 }
@@ -178,47 +175,373 @@ func (s *MemoryStore) GetAllDevices() []*model.Device {
 
 	devices := make([]*model.Device, 0, len(s.devices))
 	for _, device := range s.devices {
-		devices = append(devices, device)
+		devices = append(devices, device.Clone())
 	}
 
 	return devices
 }
 
-// AddTestDevices добавляет тестовые устройства для разработки
+// peek возвращает копию устройства или nil, если его нет
+func (s *MemoryStore) peek(id string) *model.Device {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if device, ok := s.devices[id]; ok {
+		return device.Clone()
+	}
+	return nil
+}
+
+// put записывает устройство как есть, без проверки версии (nil удаляет).
+// Используется при восстановлении FileStore.
+func (s *MemoryStore) put(id string, device *model.Device) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if device == nil {
+		delete(s.devices, id)
+		return
+	}
+	s.devices[id] = device.Clone()
+}
+
+// GetRoom возвращает комнату по ID
+func (s *MemoryStore) GetRoom(id string) (*model.Room, error) {
+	if id == "" {
+		return nil, ErrInvalidRoomID
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	room, ok := s.rooms[id]
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+	return room.Clone(), nil
+}
+
+// ListRooms возвращает все комнаты
+func (s *MemoryStore) ListRooms() ([]*model.Room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rooms := make([]*model.Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		rooms = append(rooms, room.Clone())
+	}
+	sortRooms(rooms)
+	return rooms, nil
+}
+
+// SaveRoom сохраняет комнату в хранилище
+func (s *MemoryStore) SaveRoom(room *model.Room) error {
+	if room.ID == "" {
+		return ErrInvalidRoomID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rooms[room.ID] = room.Clone()
+	return nil
+}
+
+// DeleteRoom удаляет комнату, если к ней не привязаны устройства
+func (s *MemoryStore) DeleteRoom(id string) error {
+	if id == "" {
+		return ErrInvalidRoomID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rooms[id]; !ok {
+		return ErrRoomNotFound
+	}
+	for _, device := range s.devices {
+		if device.RoomID == id {
+			return ErrRoomNotEmpty
+		}
+	}
+
+	delete(s.rooms, id)
+	return nil
+}
+
+// peekRoom возвращает копию комнаты или nil, если ее нет
+func (s *MemoryStore) peekRoom(id string) *model.Room {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if room, ok := s.rooms[id]; ok {
+		return room.Clone()
+	}
+	return nil
+}
+
+// putRoom записывает комнату как есть (nil удаляет). Используется при
+// восстановлении FileStore.
+func (s *MemoryStore) putRoom(id string, room *model.Room) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room == nil {
+		delete(s.rooms, id)
+		return
+	}
+	s.rooms[id] = room.Clone()
+}
+
+// GetScene возвращает сцену по ID
+func (s *MemoryStore) GetScene(id string) (*model.Scene, error) {
+	if id == "" {
+		return nil, ErrInvalidSceneID
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scene, ok := s.scenes[id]
+	if !ok {
+		return nil, ErrSceneNotFound
+	}
+	return scene.Clone(), nil
+}
+
+// ListScenes возвращает все сцены
+func (s *MemoryStore) ListScenes() ([]*model.Scene, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scenes := make([]*model.Scene, 0, len(s.scenes))
+	for _, scene := range s.scenes {
+		scenes = append(scenes, scene.Clone())
+	}
+	sortScenes(scenes)
+	return scenes, nil
+}
+
+// SaveScene сохраняет сцену в хранилище
+func (s *MemoryStore) SaveScene(scene *model.Scene) error {
+	if scene.ID == "" {
+		return ErrInvalidSceneID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scenes[scene.ID] = scene.Clone()
+	return nil
+}
+
+// DeleteScene удаляет сцену из хранилища
+func (s *MemoryStore) DeleteScene(id string) error {
+	if id == "" {
+		return ErrInvalidSceneID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.scenes[id]; !ok {
+		return ErrSceneNotFound
+	}
+	delete(s.scenes, id)
+	return nil
+}
+
+// peekScene возвращает копию сцены или nil, если ее нет
+func (s *MemoryStore) peekScene(id string) *model.Scene {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if scene, ok := s.scenes[id]; ok {
+		return scene.Clone()
+	}
+	return nil
+}
+
+// putScene записывает сцену как есть (nil удаляет). Используется при
+// восстановлении FileStore.
+func (s *MemoryStore) putScene(id string, scene *model.Scene) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if scene == nil {
+		delete(s.scenes, id)
+		return
+	}
+	s.scenes[id] = scene.Clone()
+}
+
+// GetRule возвращает правило по ID
+func (s *MemoryStore) GetRule(id string) (*model.Rule, error) {
+	if id == "" {
+		return nil, ErrInvalidRuleID
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rule, ok := s.rules[id]
+	if !ok {
+		return nil, ErrRuleNotFound
+	}
+	return rule.Clone(), nil
+}
+
+// ListRules возвращает все правила
+func (s *MemoryStore) ListRules() ([]*model.Rule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rules := make([]*model.Rule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		rules = append(rules, rule.Clone())
+	}
+	sortRules(rules)
+	return rules, nil
+}
+
+// SaveRule сохраняет правило в хранилище
+func (s *MemoryStore) SaveRule(rule *model.Rule) error {
+	if rule.ID == "" {
+		return ErrInvalidRuleID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules[rule.ID] = rule.Clone()
+	return nil
+}
+
+// DeleteRule удаляет правило из хранилища
+func (s *MemoryStore) DeleteRule(id string) error {
+	if id == "" {
+		return ErrInvalidRuleID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[id]; !ok {
+		return ErrRuleNotFound
+	}
+	delete(s.rules, id)
+	return nil
+}
+
+// peekRule возвращает копию правила или nil, если его нет
+func (s *MemoryStore) peekRule(id string) *model.Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if rule, ok := s.rules[id]; ok {
+		return rule.Clone()
+	}
+	return nil
+}
+
+// putRule записывает правило как есть (nil удаляет). Используется при
+// восстановлении FileStore.
+func (s *MemoryStore) putRule(id string, rule *model.Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rule == nil {
+		delete(s.rules, id)
+		return
+	}
+	s.rules[id] = rule.Clone()
+}
+
+// GetSchedule возвращает расписание по ID
+func (s *MemoryStore) GetSchedule(id string) (*model.Schedule, error) {
+	if id == "" {
+		return nil, ErrInvalidScheduleID
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+	return schedule.Clone(), nil
+}
+
+// ListSchedules возвращает все расписания
+func (s *MemoryStore) ListSchedules() ([]*model.Schedule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedules := make([]*model.Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, schedule.Clone())
+	}
+	sortSchedules(schedules)
+	return schedules, nil
+}
+
+// SaveSchedule сохраняет расписание в хранилище
+func (s *MemoryStore) SaveSchedule(schedule *model.Schedule) error {
+	if schedule.ID == "" {
+		return ErrInvalidScheduleID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.schedules[schedule.ID] = schedule.Clone()
+	return nil
+}
+
+// DeleteSchedule удаляет расписание из хранилища
+func (s *MemoryStore) DeleteSchedule(id string) error {
+	if id == "" {
+		return ErrInvalidScheduleID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schedules[id]; !ok {
+		return ErrScheduleNotFound
+	}
+	delete(s.schedules, id)
+	return nil
+}
+
+// peekSchedule возвращает копию расписания или nil, если его нет
+func (s *MemoryStore) peekSchedule(id string) *model.Schedule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if schedule, ok := s.schedules[id]; ok {
+		return schedule.Clone()
+	}
+	return nil
+}
+
+// putSchedule записывает расписание как есть (nil удаляет). Используется при
+// восстановлении FileStore.
+func (s *MemoryStore) putSchedule(id string, schedule *model.Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if schedule == nil {
+		delete(s.schedules, id)
+		return
+	}
+	s.schedules[id] = schedule.Clone()
+}
+
+// AddTestDevices добавляет тестовые комнаты и устройства для разработки
 func (s *MemoryStore) AddTestDevices() {
-	// Лампа в гостиной
-	lamp := model.NewDevice("Лампа гостиная", model.DeviceTypeLamp, "Philips Hue", "Гостиная")
-	lamp.Status.Parameters[model.ParamPower] = "on"
-	lamp.Status.Parameters[model.ParamLevel] = "80"
-	lamp.Status.Parameters[model.ParamColor] = "#FFFFFF"
-	lamp.Tags = []string{"освещение", "гостиная"}
-	s.SaveDevice(lamp)
-
-	// Розетка на кухне
-	socket := model.NewDevice("Розетка кухня", model.DeviceTypeSocket, "TP-Link Kasa", "Кухня")
-	socket.Status.Parameters[model.ParamPower] = "off"
-	socket.Tags = []string{"розетка", "кухня"}
-	s.SaveDevice(socket)
-
-	// Термостат в спальне
-	thermostat := model.NewDevice("Термостат спальня", model.DeviceTypeThermostat, "Nest", "Спальня")
-	thermostat.Status.Parameters[model.ParamPower] = "on"
-	thermostat.Status.Parameters[model.ParamTemperature] = "22.5"
-	thermostat.Status.Parameters[model.ParamMode] = "auto"
-	thermostat.Tags = []string{"климат", "спальня"}
-	s.SaveDevice(thermostat)
-
-	// Датчик движения в коридоре
-	sensor := model.NewDevice("Датчик движения коридор", model.DeviceTypeSensor, "Aqara", "Коридор")
-	sensor.Status.Parameters[model.ParamLastMotion] = "1714580400" // Unix timestamp
-	sensor.Status.BatteryLevel = 85
-	sensor.Tags = []string{"датчик", "безопасность", "коридор"}
-	s.SaveDevice(sensor)
-
-	// Камера у входной двери
-	camera := model.NewDevice("Камера входная дверь", model.DeviceTypeCamera, "Hikvision", "Прихожая")
-	camera.Status.Parameters[model.ParamPower] = "on"
-	camera.Status.Parameters[model.ParamMode] = "motion"
-	camera.Tags = []string{"безопасность", "видеонаблюдение"}
-	s.SaveDevice(camera)
+	if err := saveTestData(s); err != nil {
+		log.Printf("MemoryStore: failed to add test devices: %v", err)
+	}
 }
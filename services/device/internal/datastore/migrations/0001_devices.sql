@@ -0,0 +1,45 @@
+-- Устройства, их статусы, параметры и теги
+
+CREATE TABLE devices (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    model TEXT NOT NULL DEFAULT '',
+    room TEXT NOT NULL DEFAULT '',
+    last_updated TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    -- Версия записи для оптимистичной блокировки, увеличивается при каждом изменении
+    version BIGINT NOT NULL DEFAULT 1
+);
+
+-- Статус есть не у каждого устройства: нет строки - нет статуса.
+-- Значения по умолчанию совпадают с model.NewDeviceStatus.
+CREATE TABLE device_statuses (
+    device_id TEXT PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+    online BOOLEAN NOT NULL DEFAULT TRUE,
+    battery_level INTEGER NOT NULL DEFAULT 100,
+    signal_strength REAL NOT NULL DEFAULT 90
+);
+
+CREATE TABLE device_parameters (
+    device_id TEXT NOT NULL REFERENCES device_statuses(device_id) ON DELETE CASCADE,
+    param_key TEXT NOT NULL,
+    param_value TEXT NOT NULL,
+    PRIMARY KEY (device_id, param_key)
+);
+
+-- position сохраняет порядок тегов
+CREATE TABLE device_tags (
+    device_id TEXT NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (device_id, position)
+);
+
+CREATE INDEX idx_devices_type ON devices(type);
+CREATE INDEX idx_devices_room ON devices(room);
+CREATE INDEX idx_device_statuses_online ON device_statuses(online);
+
+COMMENT ON TABLE devices IS 'Устройства умного дома';
+COMMENT ON TABLE device_statuses IS 'Текущие статусы устройств';
+COMMENT ON TABLE device_parameters IS 'Динамические параметры устройств';
+COMMENT ON TABLE device_tags IS 'Теги для группировки устройств';
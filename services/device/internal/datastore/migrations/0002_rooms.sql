@@ -0,0 +1,17 @@
+-- Комнаты и привязка устройств к ним
+
+CREATE TABLE rooms (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    -- Другие названия комнаты, в том числе падежные формы для голосовых команд
+    aliases TEXT[] NOT NULL DEFAULT '{}',
+    floor INTEGER NOT NULL DEFAULT 0,
+    icon TEXT NOT NULL DEFAULT ''
+);
+
+-- Комнату с устройствами удалить нельзя (ON DELETE RESTRICT по умолчанию)
+ALTER TABLE devices ADD COLUMN room_id TEXT REFERENCES rooms(id);
+
+CREATE INDEX idx_devices_room_id ON devices(room_id);
+
+COMMENT ON TABLE rooms IS 'Комнаты дома';
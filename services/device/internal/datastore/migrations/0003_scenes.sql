@@ -0,0 +1,12 @@
+-- Сцены: сохраненные состояния нескольких устройств
+
+CREATE TABLE scenes (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    icon TEXT NOT NULL DEFAULT '',
+    -- Целевые состояния устройств: [{"device_id": ..., "parameters": {...}}].
+    -- Ссылки на устройства не проверяются: устройство сцены может быть удалено.
+    targets JSONB NOT NULL DEFAULT '[]'
+);
+
+COMMENT ON TABLE scenes IS 'Сцены (сохраненные состояния устройств)';
@@ -0,0 +1,14 @@
+-- Правила автоматизации: триггеры, условия и действия
+
+CREATE TABLE rules (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    cooldown_seconds BIGINT NOT NULL DEFAULT 0,
+    -- Триггеры, условия и действия в формате diskRule:
+    -- {"triggers": [...], "conditions": [...], "actions": [...]}.
+    -- Ссылки на устройства и сцены не проверяются.
+    definition JSONB NOT NULL DEFAULT '{}'
+);
+
+COMMENT ON TABLE rules IS 'Правила автоматизации';
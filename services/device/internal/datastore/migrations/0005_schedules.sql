@@ -0,0 +1,20 @@
+-- Расписания: разовые и периодические (cron) команды устройствам и сцены
+
+CREATE TABLE schedules (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    paused BOOLEAN NOT NULL DEFAULT FALSE,
+    -- Действие в формате diskScheduleAction. Ссылки на устройства и сцены
+    -- не проверяются.
+    action JSONB NOT NULL DEFAULT '{}',
+    run_at TIMESTAMPTZ NULL,
+    cron TEXT NOT NULL DEFAULT '',
+    time_zone TEXT NOT NULL DEFAULT '',
+    missed_run_policy TEXT NOT NULL DEFAULT 'skip',
+    next_run_time TIMESTAMPTZ NULL,
+    last_run_time TIMESTAMPTZ NULL,
+    last_status TEXT NOT NULL DEFAULT '',
+    last_error TEXT NOT NULL DEFAULT ''
+);
+
+COMMENT ON TABLE schedules IS 'Расписания команд устройствам и сцен';
@@ -0,0 +1,16 @@
+-- История изменений параметров устройств (пакет history)
+
+CREATE TABLE device_history (
+    seq BIGSERIAL PRIMARY KEY,
+    -- Без внешнего ключа: история удаляется вместе с устройством явно,
+    -- а устаревшие точки - по сроку хранения
+    device_id TEXT NOT NULL,
+    parameter TEXT NOT NULL,
+    value TEXT NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX device_history_device_seq_idx ON device_history (device_id, seq);
+CREATE INDEX device_history_recorded_at_idx ON device_history (recorded_at);
+
+COMMENT ON TABLE device_history IS 'История параметров устройств';
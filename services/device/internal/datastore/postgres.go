@@ -0,0 +1,813 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+)
+
+// queryTimeout ограничивает одну операцию с хранилищем: интерфейс
+// DeviceStore не принимает context
+const queryTimeout = 5 * time.Second
+
+// selectDevices выбирает устройства вместе со статусом (has_status = false,
+// если строки статуса нет)
+const selectDevices = `
+SELECT d.id, d.name, d.type, d.model, d.room, COALESCE(d.room_id, ''), d.last_updated, d.version,
+       s.device_id IS NOT NULL, COALESCE(s.online, FALSE), COALESCE(s.battery_level, 0), COALESCE(s.signal_strength, 0)
+FROM devices d
+LEFT JOIN device_statuses s ON s.device_id = d.id`
+
+// PostgresStore реализует хранилище устройств, комнат и сцен в PostgreSQL. Схема создается
+// миграциями из migrations/ при подключении.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore подключается к PostgreSQL и применяет миграции
+func NewPostgresStore(ctx context.Context, dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PostgreSQL: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping PostgreSQL: %w", err)
+	}
+	if err := Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+// DB возвращает пул соединений (для проверки состояния)
+func (s *PostgresStore) DB() *sql.DB {
+	return s.db
+}
+
+// Close закрывает пул соединений
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// GetDevice возвращает устройство по ID
+func (s *PostgresStore) GetDevice(id string) (*model.Device, error) {
+	if id == "" {
+		return nil, ErrInvalidDeviceID
+	}
+
+	devices, err := s.query(selectDevices+` WHERE d.id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, ErrDeviceNotFound
+	}
+	return devices[0], nil
+}
+
+// ListDevices возвращает список устройств, опционально фильтрованных
+func (s *PostgresStore) ListDevices(deviceType string, onlineOnly bool) ([]*model.Device, error) {
+	return s.query(selectDevices+`
+WHERE ($1 = '' OR d.type = $1) AND (NOT $2 OR COALESCE(s.online, FALSE))
+ORDER BY d.id`, deviceType, onlineOnly)
+}
+
+// SaveDevice сохраняет устройство в хранилище
+func (s *PostgresStore) SaveDevice(device *model.Device) error {
+	if device.ID == "" {
+		return ErrInvalidDeviceID
+	}
+
+	var version int64
+	err := s.inTx(func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		if device.Version == 0 {
+			// Запись без проверки версии: создание или замена
+			err = tx.QueryRowContext(ctx, `
+INSERT INTO devices (id, name, type, model, room, room_id, last_updated, version)
+VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, 1)
+ON CONFLICT (id) DO UPDATE SET
+    name = EXCLUDED.name, type = EXCLUDED.type, model = EXCLUDED.model, room = EXCLUDED.room,
+    room_id = EXCLUDED.room_id, last_updated = EXCLUDED.last_updated, version = devices.version + 1
+RETURNING version`,
+				device.ID, device.Name, device.Type, device.Model, device.Room, device.RoomID, device.LastUpdated,
+			).Scan(&version)
+		} else {
+			err = tx.QueryRowContext(ctx, `
+UPDATE devices SET name = $2, type = $3, model = $4, room = $5, room_id = NULLIF($6, ''), last_updated = $7, version = version + 1
+WHERE id = $1 AND version = $8
+RETURNING version`,
+				device.ID, device.Name, device.Type, device.Model, device.Room, device.RoomID, device.LastUpdated, device.Version,
+			).Scan(&version)
+			if errors.Is(err, sql.ErrNoRows) {
+				return s.missingOrConflict(ctx, tx, device.ID)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := writeStatus(ctx, tx, device.ID, device.Status); err != nil {
+			return err
+		}
+		return writeTags(ctx, tx, device.ID, device.Tags)
+	})
+	if isForeignKeyViolation(err) {
+		return ErrRoomNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	device.Version = version
+	return nil
+}
+
+// DeleteDevice удаляет устройство из хранилища
+func (s *PostgresStore) DeleteDevice(id string) error {
+	if id == "" {
+		return ErrInvalidDeviceID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM devices WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+// UpdateDeviceStatus обновляет статус устройства
+func (s *PostgresStore) UpdateDeviceStatus(id string, status *model.DeviceStatus) error {
+	if id == "" {
+		return ErrInvalidDeviceID
+	}
+
+	return s.inTx(func(ctx context.Context, tx *sql.Tx) error {
+		if err := touch(ctx, tx, id); err != nil {
+			return err
+		}
+		return writeStatus(ctx, tx, id, status)
+	})
+}
+
+// UpdateDeviceParameter обновляет параметр устройства
+func (s *PostgresStore) UpdateDeviceParameter(id, key, value string) error {
+	if id == "" || key == "" {
+		return ErrInvalidDeviceID
+	}
+
+	return s.inTx(func(ctx context.Context, tx *sql.Tx) error {
+		if err := touch(ctx, tx, id); err != nil {
+			return err
+		}
+		// Устройство без статуса получает статус по умолчанию, как в MemoryStore
+		if _, err := tx.ExecContext(ctx, `INSERT INTO device_statuses (device_id) VALUES ($1) ON CONFLICT DO NOTHING`, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO device_parameters (device_id, param_key, param_value) VALUES ($1, $2, $3)
+ON CONFLICT (device_id, param_key) DO UPDATE SET param_value = EXCLUDED.param_value`, id, key, value)
+		return err
+	})
+}
+
+// GetAllDevices возвращает все устройства для стриминга статусов
+func (s *PostgresStore) GetAllDevices() []*model.Device {
+	devices, err := s.ListDevices("", false)
+	if err != nil {
+		log.Printf("PostgresStore: failed to list devices: %v", err)
+		return nil
+	}
+	return devices
+}
+
+// GetRoom возвращает комнату по ID
+func (s *PostgresStore) GetRoom(id string) (*model.Room, error) {
+	if id == "" {
+		return nil, ErrInvalidRoomID
+	}
+
+	rooms, err := s.queryRooms(selectRooms+` WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(rooms) == 0 {
+		return nil, ErrRoomNotFound
+	}
+	return rooms[0], nil
+}
+
+// ListRooms возвращает все комнаты. Имена сравниваются побайтно (COLLATE "C"),
+// как в MemoryStore.
+func (s *PostgresStore) ListRooms() ([]*model.Room, error) {
+	return s.queryRooms(selectRooms + ` ORDER BY floor, name COLLATE "C", id`)
+}
+
+// SaveRoom сохраняет комнату в хранилище
+func (s *PostgresStore) SaveRoom(room *model.Room) error {
+	if room.ID == "" {
+		return ErrInvalidRoomID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	aliases := room.Aliases
+	if aliases == nil {
+		aliases = []string{}
+	}
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO rooms (id, name, aliases, floor, icon) VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (id) DO UPDATE SET
+    name = EXCLUDED.name, aliases = EXCLUDED.aliases, floor = EXCLUDED.floor, icon = EXCLUDED.icon`,
+		room.ID, room.Name, pq.Array(aliases), room.Floor, room.Icon)
+	return err
+}
+
+// DeleteRoom удаляет комнату, если к ней не привязаны устройства
+func (s *PostgresStore) DeleteRoom(id string) error {
+	if id == "" {
+		return ErrInvalidRoomID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM rooms WHERE id = $1`, id)
+	if isForeignKeyViolation(err) {
+		return ErrRoomNotEmpty
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrRoomNotFound
+	}
+	return nil
+}
+
+// AddTestDevices добавляет тестовые комнаты и устройства, если хранилище
+// пустое: данные в PostgreSQL сохраняются между перезапусками
+func (s *PostgresStore) AddTestDevices() {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM devices) OR EXISTS (SELECT 1 FROM rooms)`).Scan(&exists); err != nil {
+		log.Printf("PostgresStore: failed to check devices: %v", err)
+		return
+	}
+	if exists {
+		return
+	}
+
+	if err := saveTestData(s); err != nil {
+		log.Printf("PostgresStore: failed to add test devices: %v", err)
+	}
+}
+
+// GetScene возвращает сцену по ID
+func (s *PostgresStore) GetScene(id string) (*model.Scene, error) {
+	if id == "" {
+		return nil, ErrInvalidSceneID
+	}
+
+	scenes, err := s.queryScenes(selectScenes+` WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(scenes) == 0 {
+		return nil, ErrSceneNotFound
+	}
+	return scenes[0], nil
+}
+
+// ListScenes возвращает все сцены
+func (s *PostgresStore) ListScenes() ([]*model.Scene, error) {
+	return s.queryScenes(selectScenes + ` ORDER BY name COLLATE "C", id`)
+}
+
+// SaveScene сохраняет сцену в хранилище
+func (s *PostgresStore) SaveScene(scene *model.Scene) error {
+	if scene.ID == "" {
+		return ErrInvalidSceneID
+	}
+
+	targets, err := json.Marshal(toDiskScene(scene).Targets)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err = s.db.ExecContext(ctx, `
+INSERT INTO scenes (id, name, icon, targets) VALUES ($1, $2, $3, $4)
+ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, icon = EXCLUDED.icon, targets = EXCLUDED.targets`,
+		scene.ID, scene.Name, scene.Icon, string(targets))
+	return err
+}
+
+// DeleteScene удаляет сцену из хранилища
+func (s *PostgresStore) DeleteScene(id string) error {
+	if id == "" {
+		return ErrInvalidSceneID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM scenes WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSceneNotFound
+	}
+	return nil
+}
+
+const selectScenes = `SELECT id, name, icon, targets FROM scenes`
+
+// queryScenes выбирает сцены. Цели хранятся в формате diskScene.
+func (s *PostgresStore) queryScenes(query string, args ...interface{}) ([]*model.Scene, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scenes := []*model.Scene{}
+	for rows.Next() {
+		var (
+			disk    diskScene
+			targets []byte
+		)
+		if err := rows.Scan(&disk.ID, &disk.Name, &disk.Icon, &targets); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(targets, &disk.Targets); err != nil {
+			return nil, fmt.Errorf("failed to decode scene %s targets: %w", disk.ID, err)
+		}
+		scenes = append(scenes, disk.toModel())
+	}
+	return scenes, rows.Err()
+}
+
+// GetRule возвращает правило по ID
+func (s *PostgresStore) GetRule(id string) (*model.Rule, error) {
+	if id == "" {
+		return nil, ErrInvalidRuleID
+	}
+
+	rules, err := s.queryRules(selectRules+` WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, ErrRuleNotFound
+	}
+	return rules[0], nil
+}
+
+// ListRules возвращает все правила
+func (s *PostgresStore) ListRules() ([]*model.Rule, error) {
+	return s.queryRules(selectRules + ` ORDER BY name COLLATE "C", id`)
+}
+
+// SaveRule сохраняет правило в хранилище
+func (s *PostgresStore) SaveRule(rule *model.Rule) error {
+	if rule.ID == "" {
+		return ErrInvalidRuleID
+	}
+
+	disk := toDiskRule(rule)
+	definition, err := json.Marshal(ruleDefinition{
+		Triggers:   disk.Triggers,
+		Conditions: disk.Conditions,
+		Actions:    disk.Actions,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err = s.db.ExecContext(ctx, `
+INSERT INTO rules (id, name, enabled, cooldown_seconds, definition) VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, enabled = EXCLUDED.enabled,
+    cooldown_seconds = EXCLUDED.cooldown_seconds, definition = EXCLUDED.definition`,
+		disk.ID, disk.Name, disk.Enabled, disk.CooldownSeconds, string(definition))
+	return err
+}
+
+// DeleteRule удаляет правило из хранилища
+func (s *PostgresStore) DeleteRule(id string) error {
+	if id == "" {
+		return ErrInvalidRuleID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM rules WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// ruleDefinition - содержимое колонки rules.definition
+type ruleDefinition struct {
+	Triggers   []diskRuleTrigger   `json:"triggers"`
+	Conditions []diskRuleCondition `json:"conditions"`
+	Actions    []diskRuleAction    `json:"actions"`
+}
+
+const selectRules = `SELECT id, name, enabled, cooldown_seconds, definition FROM rules`
+
+// queryRules выбирает правила
+func (s *PostgresStore) queryRules(query string, args ...interface{}) ([]*model.Rule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*model.Rule{}
+	for rows.Next() {
+		var (
+			disk       diskRule
+			definition []byte
+			decoded    ruleDefinition
+		)
+		if err := rows.Scan(&disk.ID, &disk.Name, &disk.Enabled, &disk.CooldownSeconds, &definition); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(definition, &decoded); err != nil {
+			return nil, fmt.Errorf("failed to decode rule %s definition: %w", disk.ID, err)
+		}
+		disk.Triggers, disk.Conditions, disk.Actions = decoded.Triggers, decoded.Conditions, decoded.Actions
+		rules = append(rules, disk.toModel())
+	}
+	return rules, rows.Err()
+}
+
+// GetSchedule возвращает расписание по ID
+func (s *PostgresStore) GetSchedule(id string) (*model.Schedule, error) {
+	if id == "" {
+		return nil, ErrInvalidScheduleID
+	}
+
+	schedules, err := s.querySchedules(selectSchedules+` WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(schedules) == 0 {
+		return nil, ErrScheduleNotFound
+	}
+	return schedules[0], nil
+}
+
+// ListSchedules возвращает все расписания
+func (s *PostgresStore) ListSchedules() ([]*model.Schedule, error) {
+	return s.querySchedules(selectSchedules + ` ORDER BY name COLLATE "C", id`)
+}
+
+// SaveSchedule сохраняет расписание в хранилище
+func (s *PostgresStore) SaveSchedule(schedule *model.Schedule) error {
+	if schedule.ID == "" {
+		return ErrInvalidScheduleID
+	}
+
+	disk := toDiskSchedule(schedule)
+	action, err := json.Marshal(disk.Action)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err = s.db.ExecContext(ctx, `
+INSERT INTO schedules (id, name, paused, action, run_at, cron, time_zone, missed_run_policy,
+    next_run_time, last_run_time, last_status, last_error)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, paused = EXCLUDED.paused,
+    action = EXCLUDED.action, run_at = EXCLUDED.run_at, cron = EXCLUDED.cron,
+    time_zone = EXCLUDED.time_zone, missed_run_policy = EXCLUDED.missed_run_policy,
+    next_run_time = EXCLUDED.next_run_time, last_run_time = EXCLUDED.last_run_time,
+    last_status = EXCLUDED.last_status, last_error = EXCLUDED.last_error`,
+		disk.ID, disk.Name, disk.Paused, string(action), nullTime(disk.RunAt), disk.Cron,
+		disk.TimeZone, disk.MissedRunPolicy, nullTime(disk.NextRun), nullTime(disk.LastRun),
+		disk.LastStatus, disk.LastError)
+	return err
+}
+
+// DeleteSchedule удаляет расписание из хранилища
+func (s *PostgresStore) DeleteSchedule(id string) error {
+	if id == "" {
+		return ErrInvalidScheduleID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM schedules WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+const selectSchedules = `SELECT id, name, paused, action, run_at, cron, time_zone, missed_run_policy,
+    next_run_time, last_run_time, last_status, last_error FROM schedules`
+
+// querySchedules выбирает расписания
+func (s *PostgresStore) querySchedules(query string, args ...interface{}) ([]*model.Schedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []*model.Schedule{}
+	for rows.Next() {
+		var (
+			disk                    diskSchedule
+			action                  []byte
+			runAt, nextRun, lastRun sql.NullTime
+		)
+		if err := rows.Scan(&disk.ID, &disk.Name, &disk.Paused, &action, &runAt, &disk.Cron,
+			&disk.TimeZone, &disk.MissedRunPolicy, &nextRun, &lastRun, &disk.LastStatus, &disk.LastError); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(action, &disk.Action); err != nil {
+			return nil, fmt.Errorf("failed to decode schedule %s action: %w", disk.ID, err)
+		}
+		disk.RunAt, disk.NextRun, disk.LastRun = runAt.Time, nextRun.Time, lastRun.Time
+		schedules = append(schedules, disk.toModel())
+	}
+	return schedules, rows.Err()
+}
+
+// nullTime конвертирует нулевое время в NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+const selectRooms = `SELECT id, name, aliases, floor, icon FROM rooms`
+
+// queryRooms выбирает комнаты
+func (s *PostgresStore) queryRooms(query string, args ...interface{}) ([]*model.Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rooms := []*model.Room{}
+	for rows.Next() {
+		var room model.Room
+		if err := rows.Scan(&room.ID, &room.Name, pq.Array(&room.Aliases), &room.Floor, &room.Icon); err != nil {
+			return nil, err
+		}
+		if room.Aliases == nil {
+			room.Aliases = []string{}
+		}
+		rooms = append(rooms, &room)
+	}
+	return rooms, rows.Err()
+}
+
+// query выбирает устройства вместе с параметрами и тегами в одном снимке данных
+func (s *PostgresStore) query(query string, args ...interface{}) ([]*model.Device, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		devices []*model.Device
+		ids     []string
+		byID    = make(map[string]*model.Device)
+	)
+	for rows.Next() {
+		var (
+			device    model.Device
+			hasStatus bool
+			status    model.DeviceStatus
+		)
+		if err := rows.Scan(&device.ID, &device.Name, &device.Type, &device.Model, &device.Room, &device.RoomID,
+			&device.LastUpdated, &device.Version,
+			&hasStatus, &status.Online, &status.BatteryLevel, &status.SignalStrength); err != nil {
+			return nil, err
+		}
+		if hasStatus {
+			status.Parameters = make(map[string]string)
+			device.Status = &status
+		}
+		device.Tags = []string{}
+
+		devices = append(devices, &device)
+		ids = append(ids, device.ID)
+		byID[device.ID] = &device
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return devices, nil
+	}
+
+	params, err := tx.QueryContext(ctx, `SELECT device_id, param_key, param_value FROM device_parameters WHERE device_id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer params.Close()
+	for params.Next() {
+		var id, key, value string
+		if err := params.Scan(&id, &key, &value); err != nil {
+			return nil, err
+		}
+		if device := byID[id]; device != nil && device.Status != nil {
+			device.Status.Parameters[key] = value
+		}
+	}
+	if err := params.Err(); err != nil {
+		return nil, err
+	}
+
+	tags, err := tx.QueryContext(ctx, `SELECT device_id, tag FROM device_tags WHERE device_id = ANY($1) ORDER BY device_id, position`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer tags.Close()
+	for tags.Next() {
+		var id, tag string
+		if err := tags.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+		if device := byID[id]; device != nil {
+			device.Tags = append(device.Tags, tag)
+		}
+	}
+	if err := tags.Err(); err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// inTx выполняет fn в транзакции с таймаутом queryTimeout
+func (s *PostgresStore) inTx(fn func(ctx context.Context, tx *sql.Tx) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// missingOrConflict определяет причину неудачного условного обновления
+func (s *PostgresStore) missingOrConflict(ctx context.Context, tx *sql.Tx, id string) error {
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM devices WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrDeviceNotFound
+	}
+	return ErrVersionConflict
+}
+
+// isForeignKeyViolation проверяет, что запрос нарушил внешний ключ: в схеме
+// это ссылка devices.room_id на rooms
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// touch увеличивает версию устройства и обновляет время изменения
+func touch(ctx context.Context, tx *sql.Tx, id string) error {
+	result, err := tx.ExecContext(ctx, `UPDATE devices SET last_updated = $2, version = version + 1 WHERE id = $1`, id, time.Now())
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+// writeStatus заменяет статус и параметры устройства (nil удаляет статус)
+func writeStatus(ctx context.Context, tx *sql.Tx, id string, status *model.DeviceStatus) error {
+	if status == nil {
+		_, err := tx.ExecContext(ctx, `DELETE FROM device_statuses WHERE device_id = $1`, id)
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO device_statuses (device_id, online, battery_level, signal_strength) VALUES ($1, $2, $3, $4)
+ON CONFLICT (device_id) DO UPDATE SET
+    online = EXCLUDED.online, battery_level = EXCLUDED.battery_level, signal_strength = EXCLUDED.signal_strength`,
+		id, status.Online, status.BatteryLevel, status.SignalStrength); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM device_parameters WHERE device_id = $1`, id); err != nil {
+		return err
+	}
+	if len(status.Parameters) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(status.Parameters))
+	values := make([]string, 0, len(status.Parameters))
+	for key, value := range status.Parameters {
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	_, err := tx.ExecContext(ctx, `
+INSERT INTO device_parameters (device_id, param_key, param_value)
+SELECT $1, p.key, p.value FROM unnest($2::text[], $3::text[]) AS p(key, value)`,
+		id, pq.Array(keys), pq.Array(values))
+	return err
+}
+
+// writeTags заменяет теги устройства, сохраняя их порядок
+func writeTags(ctx context.Context, tx *sql.Tx, id string, tags []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM device_tags WHERE device_id = $1`, id); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `
+INSERT INTO device_tags (device_id, position, tag)
+SELECT $1, t.position, t.tag FROM unnest($2::text[]) WITH ORDINALITY AS t(tag, position)`,
+		id, pq.Array(tags))
+	return err
+}
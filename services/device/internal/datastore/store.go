@@ -0,0 +1,265 @@
+package datastore
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+)
+
+var (
+	// ErrDeviceNotFound означает, что устройство не найдено в хранилище
+	ErrDeviceNotFound = errors.New("device not found")
+
+	// ErrInvalidDeviceID означает, что указан неверный идентификатор устройства
+	ErrInvalidDeviceID = errors.New("invalid device ID")
+
+	// ErrVersionConflict означает, что устройство изменено после чтения
+	// (версия в хранилище не совпадает с device.Version)
+	ErrVersionConflict = errors.New("device version conflict")
+
+	// ErrRoomNotFound означает, что комната не найдена в хранилище (в том
+	// числе комната из Device.RoomID при сохранении устройства)
+	ErrRoomNotFound = errors.New("room not found")
+
+	// ErrInvalidRoomID означает, что указан неверный идентификатор комнаты
+	ErrInvalidRoomID = errors.New("invalid room ID")
+
+	// ErrRoomNotEmpty означает попытку удалить комнату, к которой привязаны устройства
+	ErrRoomNotEmpty = errors.New("room has devices")
+
+	// ErrSceneNotFound означает, что сцена не найдена в хранилище
+	ErrSceneNotFound = errors.New("scene not found")
+
+	// ErrInvalidSceneID означает, что указан неверный идентификатор сцены
+	ErrInvalidSceneID = errors.New("invalid scene ID")
+
+	// ErrRuleNotFound означает, что правило автоматизации не найдено в хранилище
+	ErrRuleNotFound = errors.New("rule not found")
+
+	// ErrInvalidRuleID означает, что указан неверный идентификатор правила
+	ErrInvalidRuleID = errors.New("invalid rule ID")
+
+	// ErrScheduleNotFound означает, что расписание не найдено в хранилище
+	ErrScheduleNotFound = errors.New("schedule not found")
+
+	// ErrInvalidScheduleID означает, что указан неверный идентификатор расписания
+	ErrInvalidScheduleID = errors.New("invalid schedule ID")
+)
+
+// DeviceStore представляет интерфейс хранилища устройств. Методы чтения
+// возвращают копии: изменения устройства сохраняются только через SaveDevice
+// и методы Update*.
+type DeviceStore interface {
+	// GetDevice возвращает устройство по ID
+	GetDevice(id string) (*model.Device, error)
+
+	// ListDevices возвращает список устройств, опционально фильтрованных
+	ListDevices(deviceType string, onlineOnly bool) ([]*model.Device, error)
+
+	// SaveDevice создает или заменяет устройство. Если device.Version не 0,
+	// запись выполняется только при совпадении с версией в хранилище, иначе
+	// возвращается ErrVersionConflict (ErrDeviceNotFound, если устройство
+	// удалено). После записи device.Version содержит новую версию.
+	SaveDevice(device *model.Device) error
+
+	// DeleteDevice удаляет устройство из хранилища
+	DeleteDevice(id string) error
+
+	// UpdateDeviceStatus обновляет статус устройства
+	UpdateDeviceStatus(id string, status *model.DeviceStatus) error
+
+	// UpdateDeviceParameter обновляет параметр устройства
+	UpdateDeviceParameter(id, key, value string) error
+
+	// GetAllDevices возвращает все устройства для стриминга статусов
+	GetAllDevices() []*model.Device
+
+	// AddTestDevices добавляет тестовые комнаты и устройства для разработки
+	AddTestDevices()
+
+	RoomStore
+	SceneStore
+	RuleStore
+	ScheduleStore
+}
+
+// RoomStore представляет хранилище комнат. Хранилище проверяет ссылки
+// устройств на комнаты: SaveDevice возвращает ErrRoomNotFound для
+// несуществующей Device.RoomID, DeleteRoom - ErrRoomNotEmpty для комнаты
+// с устройствами.
+type RoomStore interface {
+	// GetRoom возвращает комнату по ID
+	GetRoom(id string) (*model.Room, error)
+
+	// ListRooms возвращает комнаты, упорядоченные по этажу, имени и ID
+	ListRooms() ([]*model.Room, error)
+
+	// SaveRoom создает или заменяет комнату
+	SaveRoom(room *model.Room) error
+
+	// DeleteRoom удаляет комнату
+	DeleteRoom(id string) error
+}
+
+// SceneStore представляет хранилище сцен. Ссылки сцен на устройства не
+// проверяются: устройство сцены может быть удалено.
+type SceneStore interface {
+	// GetScene возвращает сцену по ID
+	GetScene(id string) (*model.Scene, error)
+
+	// ListScenes возвращает сцены, упорядоченные по имени и ID
+	ListScenes() ([]*model.Scene, error)
+
+	// SaveScene создает или заменяет сцену
+	SaveScene(scene *model.Scene) error
+
+	// DeleteScene удаляет сцену
+	DeleteScene(id string) error
+}
+
+// RuleStore представляет хранилище правил автоматизации. Ссылки правил на
+// устройства и сцены не проверяются.
+type RuleStore interface {
+	// GetRule возвращает правило по ID
+	GetRule(id string) (*model.Rule, error)
+
+	// ListRules возвращает правила, упорядоченные по имени и ID
+	ListRules() ([]*model.Rule, error)
+
+	// SaveRule создает или заменяет правило
+	SaveRule(rule *model.Rule) error
+
+	// DeleteRule удаляет правило
+	DeleteRule(id string) error
+}
+
+// ScheduleStore представляет хранилище расписаний вместе с состоянием
+// запусков. Ссылки расписаний на устройства и сцены не проверяются.
+type ScheduleStore interface {
+	// GetSchedule возвращает расписание по ID
+	GetSchedule(id string) (*model.Schedule, error)
+
+	// ListSchedules возвращает расписания, упорядоченные по имени и ID
+	ListSchedules() ([]*model.Schedule, error)
+
+	// SaveSchedule создает или заменяет расписание
+	SaveSchedule(schedule *model.Schedule) error
+
+	// DeleteSchedule удаляет расписание
+	DeleteSchedule(id string) error
+}
+
+// sortSchedules упорядочивает расписания по имени и ID
+func sortSchedules(schedules []*model.Schedule) {
+	sort.Slice(schedules, func(i, j int) bool {
+		if schedules[i].Name != schedules[j].Name {
+			return schedules[i].Name < schedules[j].Name
+		}
+		return schedules[i].ID < schedules[j].ID
+	})
+}
+
+// sortRules упорядочивает правила по имени и ID
+func sortRules(rules []*model.Rule) {
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Name != rules[j].Name {
+			return rules[i].Name < rules[j].Name
+		}
+		return rules[i].ID < rules[j].ID
+	})
+}
+
+// sortScenes упорядочивает сцены по имени и ID
+func sortScenes(scenes []*model.Scene) {
+	sort.Slice(scenes, func(i, j int) bool {
+		if scenes[i].Name != scenes[j].Name {
+			return scenes[i].Name < scenes[j].Name
+		}
+		return scenes[i].ID < scenes[j].ID
+	})
+}
+
+// sortRooms упорядочивает комнаты по этажу, имени и ID
+func sortRooms(rooms []*model.Room) {
+	sort.Slice(rooms, func(i, j int) bool {
+		if rooms[i].Floor != rooms[j].Floor {
+			return rooms[i].Floor < rooms[j].Floor
+		}
+		if rooms[i].Name != rooms[j].Name {
+			return rooms[i].Name < rooms[j].Name
+		}
+		return rooms[i].ID < rooms[j].ID
+	})
+}
+
+// testRooms возвращает тестовые комнаты для разработки по имени
+func testRooms() map[string]*model.Room {
+	rooms := map[string]*model.Room{}
+	for _, room := range []*model.Room{
+		model.NewRoom("Гостиная", 1, "sofa", "гостиной", "зал", "зале"),
+		model.NewRoom("Кухня", 1, "kitchen", "кухне", "кухню"),
+		model.NewRoom("Спальня", 1, "bed", "спальне", "спальню"),
+		model.NewRoom("Коридор", 1, "door", "коридоре"),
+		model.NewRoom("Прихожая", 1, "door", "прихожей", "прихожую"),
+	} {
+		rooms[room.Name] = room
+	}
+	return rooms
+}
+
+// testDevices возвращает набор тестовых устройств для разработки
+func testDevices() []*model.Device {
+	// Лампа в гостиной
+	lamp := model.NewDevice("Лампа гостиная", model.DeviceTypeLamp, "Philips Hue", "Гостиная")
+	lamp.Status.Parameters[model.ParamPower] = "on"
+	lamp.Status.Parameters[model.ParamLevel] = "80"
+	lamp.Status.Parameters[model.ParamColor] = "#FFFFFF"
+	lamp.Tags = []string{"освещение", "гостиная"}
+
+	// Розетка на кухне
+	socket := model.NewDevice("Розетка кухня", model.DeviceTypeSocket, "TP-Link Kasa", "Кухня")
+	socket.Status.Parameters[model.ParamPower] = "off"
+	socket.Tags = []string{"розетка", "кухня"}
+
+	// Термостат в спальне
+	thermostat := model.NewDevice("Термостат спальня", model.DeviceTypeThermostat, "Nest", "Спальня")
+	thermostat.Status.Parameters[model.ParamPower] = "on"
+	thermostat.Status.Parameters[model.ParamTemperature] = "22.5"
+	thermostat.Status.Parameters[model.ParamMode] = "auto"
+	thermostat.Tags = []string{"климат", "спальня"}
+
+	// Датчик движения в коридоре
+	sensor := model.NewDevice("Датчик движения коридор", model.DeviceTypeSensor, "Aqara", "Коридор")
+	sensor.Status.Parameters[model.ParamLastMotion] = "1714580400" // Unix timestamp
+	sensor.Status.BatteryLevel = 85
+	sensor.Tags = []string{"датчик", "безопасность", "коридор"}
+
+	// Камера у входной двери
+	camera := model.NewDevice("Камера входная дверь", model.DeviceTypeCamera, "Hikvision", "Прихожая")
+	camera.Status.Parameters[model.ParamPower] = "on"
+	camera.Status.Parameters[model.ParamMode] = "motion"
+	camera.Tags = []string{"безопасность", "видеонаблюдение"}
+
+	return []*model.Device{lamp, socket, thermostat, sensor, camera}
+}
+
+// saveTestData сохраняет тестовые комнаты и устройства, привязывая
+// устройства к комнатам по имени
+func saveTestData(store DeviceStore) error {
+	rooms := testRooms()
+	for _, room := range rooms {
+		if err := store.SaveRoom(room); err != nil {
+			return err
+		}
+	}
+	for _, device := range testDevices() {
+		if room, ok := rooms[device.Room]; ok {
+			device.RoomID = room.ID
+		}
+		if err := store.SaveDevice(device); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,745 @@
+package datastore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+)
+
+// testStore запускает общий набор тестов DeviceStore. newStore должен
+// возвращать пустое хранилище.
+func testStore(t *testing.T, newStore func(t *testing.T) DeviceStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store DeviceStore)
+	}{
+		{"GetDevice", testGetDevice},
+		{"ListDevices", testListDevices},
+		{"SaveAndDeleteDevice", testSaveAndDeleteDevice},
+		{"UpdateDeviceStatus", testUpdateDeviceStatus},
+		{"UpdateDeviceParameter", testUpdateDeviceParameter},
+		{"GetAllDevices", testGetAllDevices},
+		{"RoundTrip", testRoundTrip},
+		{"ReturnsCopies", testReturnsCopies},
+		{"OptimisticLocking", testOptimisticLocking},
+		{"AddTestDevices", testAddTestDevices},
+		{"SaveAndDeleteRoom", testSaveAndDeleteRoom},
+		{"RoomReferences", testRoomReferences},
+		{"SaveAndDeleteScene", testSaveAndDeleteScene},
+		{"SaveAndDeleteRule", testSaveAndDeleteRule},
+		{"SaveAndDeleteSchedule", testSaveAndDeleteSchedule},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func testGetDevice(t *testing.T, store DeviceStore) {
+	// Создаем тестовое устройство
+	testDevice := model.NewDevice("Test Device", model.DeviceTypeLamp, "Test Model", "Test Room")
+	if err := store.SaveDevice(testDevice); err != nil {
+		t.Fatalf("Failed to save test device: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		deviceID  string
+		wantError bool
+	}{
+		{
+			name:      "Existing device",
+			deviceID:  testDevice.ID,
+			wantError: false,
+		},
+		{
+			name:      "Non-existing device",
+			deviceID:  "non-existing-id",
+			wantError: true,
+		},
+		{
+			name:      "Empty ID",
+			deviceID:  "",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device, err := store.GetDevice(tt.deviceID)
+
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Expected error, got nil")
+				}
+			} else {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				if device == nil {
+					t.Error("Device is nil")
+				} else if device.ID != testDevice.ID {
+					t.Errorf("Expected device ID %s, got %s", testDevice.ID, device.ID)
+				}
+			}
+		})
+	}
+}
+
+func testListDevices(t *testing.T, store DeviceStore) {
+	// Добавляем устройства разных типов
+	lamp1 := model.NewDevice("Lamp 1", model.DeviceTypeLamp, "Model A", "Room 1")
+	lamp1.Status.Online = true
+	store.SaveDevice(lamp1)
+
+	lamp2 := model.NewDevice("Lamp 2", model.DeviceTypeLamp, "Model B", "Room 2")
+	lamp2.Status.Online = false
+	store.SaveDevice(lamp2)
+
+	thermo := model.NewDevice("Thermostat", model.DeviceTypeThermostat, "Model C", "Room 3")
+	thermo.Status.Online = true
+	store.SaveDevice(thermo)
+
+	tests := []struct {
+		name       string
+		deviceType string
+		onlineOnly bool
+		wantCount  int
+	}{
+		{
+			name:       "All devices",
+			deviceType: "",
+			onlineOnly: false,
+			wantCount:  3,
+		},
+		{
+			name:       "Only lamps",
+			deviceType: model.DeviceTypeLamp,
+			onlineOnly: false,
+			wantCount:  2,
+		},
+		{
+			name:       "Only thermostats",
+			deviceType: model.DeviceTypeThermostat,
+			onlineOnly: false,
+			wantCount:  1,
+		},
+		{
+			name:       "Only online devices",
+			deviceType: "",
+			onlineOnly: true,
+			wantCount:  2,
+		},
+		{
+			name:       "Only online lamps",
+			deviceType: model.DeviceTypeLamp,
+			onlineOnly: true,
+			wantCount:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devices, err := store.ListDevices(tt.deviceType, tt.onlineOnly)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if len(devices) != tt.wantCount {
+				t.Errorf("Expected %d devices, got %d", tt.wantCount, len(devices))
+			}
+
+			for i := 1; i < len(devices); i++ {
+				if devices[i-1].ID >= devices[i].ID {
+					t.Errorf("Expected devices sorted by ID, got %s before %s", devices[i-1].ID, devices[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func testSaveAndDeleteDevice(t *testing.T, store DeviceStore) {
+	// Создаем тестовое устройство
+	testDevice := model.NewDevice("Test Device", model.DeviceTypeLamp, "Test Model", "Test Room")
+
+	// Сохраняем устройство
+	if err := store.SaveDevice(testDevice); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	// Проверяем, что устройство сохранено
+	device, err := store.GetDevice(testDevice.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device after save: %v", err)
+	}
+	if device.ID != testDevice.ID {
+		t.Errorf("Expected device ID %s, got %s", testDevice.ID, device.ID)
+	}
+
+	// Удаляем устройство
+	if err := store.DeleteDevice(testDevice.ID); err != nil {
+		t.Fatalf("Failed to delete device: %v", err)
+	}
+
+	// Проверяем, что устройство удалено
+	_, err = store.GetDevice(testDevice.ID)
+	if err != ErrDeviceNotFound {
+		t.Errorf("Expected ErrDeviceNotFound, got %v", err)
+	}
+
+	// Повторное удаление
+	if err := store.DeleteDevice(testDevice.ID); err != ErrDeviceNotFound {
+		t.Errorf("Expected ErrDeviceNotFound on second delete, got %v", err)
+	}
+}
+
+func testUpdateDeviceStatus(t *testing.T, store DeviceStore) {
+	// Создаем тестовое устройство
+	testDevice := model.NewDevice("Test Device", model.DeviceTypeLamp, "Test Model", "Test Room")
+	testDevice.Status.Online = true
+	store.SaveDevice(testDevice)
+
+	// Создаем новый статус
+	newStatus := model.NewDeviceStatus()
+	newStatus.Online = false
+	newStatus.BatteryLevel = 50
+
+	// Обновляем статус
+	if err := store.UpdateDeviceStatus(testDevice.ID, newStatus); err != nil {
+		t.Fatalf("Failed to update device status: %v", err)
+	}
+
+	// Получаем устройство и проверяем статус
+	device, err := store.GetDevice(testDevice.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+
+	if device.Status.Online != false {
+		t.Errorf("Expected online status false, got %v", device.Status.Online)
+	}
+
+	if device.Status.BatteryLevel != 50 {
+		t.Errorf("Expected battery level 50, got %d", device.Status.BatteryLevel)
+	}
+
+	if err := store.UpdateDeviceStatus("non-existing-id", newStatus); err != ErrDeviceNotFound {
+		t.Errorf("Expected ErrDeviceNotFound, got %v", err)
+	}
+}
+
+func testUpdateDeviceParameter(t *testing.T, store DeviceStore) {
+	// Создаем тестовое устройство
+	testDevice := model.NewDevice("Test Device", model.DeviceTypeLamp, "Test Model", "Test Room")
+	testDevice.Status.Parameters[model.ParamPower] = "off"
+	store.SaveDevice(testDevice)
+
+	// Обновляем параметр
+	if err := store.UpdateDeviceParameter(testDevice.ID, model.ParamPower, "on"); err != nil {
+		t.Fatalf("Failed to update device parameter: %v", err)
+	}
+
+	// Получаем устройство и проверяем параметр
+	device, err := store.GetDevice(testDevice.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+
+	if value, ok := device.Status.Parameters[model.ParamPower]; !ok || value != "on" {
+		t.Errorf("Expected parameter %s to be 'on', got %s", model.ParamPower, value)
+	}
+
+	// Устройство без статуса получает статус по умолчанию
+	bare := model.NewDevice("Bare", model.DeviceTypeSensor, "", "")
+	bare.Status = nil
+	store.SaveDevice(bare)
+	if err := store.UpdateDeviceParameter(bare.ID, model.ParamHumidity, "40"); err != nil {
+		t.Fatalf("Failed to update parameter of device without status: %v", err)
+	}
+	device, err = store.GetDevice(bare.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if device.Status == nil || !device.Status.Online || device.Status.Parameters[model.ParamHumidity] != "40" {
+		t.Errorf("Expected default status with humidity 40, got %+v", device.Status)
+	}
+}
+
+func testGetAllDevices(t *testing.T, store DeviceStore) {
+	// Добавляем несколько устройств
+	for i := 0; i < 5; i++ {
+		device := model.NewDevice("Test Device", model.DeviceTypeLamp, "Test Model", "Test Room")
+		store.SaveDevice(device)
+	}
+
+	// Получаем все устройства
+	devices := store.GetAllDevices()
+
+	// Проверяем количество устройств
+	if len(devices) != 5 {
+		t.Errorf("Expected 5 devices, got %d", len(devices))
+	}
+}
+
+func testRoundTrip(t *testing.T, store DeviceStore) {
+	device := model.NewDevice("Лампа", model.DeviceTypeLamp, "Philips Hue", "Гостиная")
+	device.Status.Online = false
+	device.Status.BatteryLevel = 42
+	device.Status.SignalStrength = 55.5
+	device.Status.Parameters[model.ParamPower] = "on"
+	device.Status.Parameters[model.ParamColor] = "#FF0000"
+	device.Tags = []string{"освещение", "гостиная", "вечер"}
+	if err := store.SaveDevice(device); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+
+	got, err := store.GetDevice(device.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if got.Name != device.Name || got.Type != device.Type || got.Model != device.Model || got.Room != device.Room {
+		t.Errorf("Unexpected device fields: %+v", got)
+	}
+	if got.Status == nil || got.Status.Online || got.Status.BatteryLevel != 42 || got.Status.SignalStrength != 55.5 {
+		t.Fatalf("Unexpected status: %+v", got.Status)
+	}
+	if len(got.Status.Parameters) != 2 || got.Status.Parameters[model.ParamColor] != "#FF0000" {
+		t.Errorf("Unexpected parameters: %v", got.Status.Parameters)
+	}
+	if len(got.Tags) != 3 || got.Tags[0] != "освещение" || got.Tags[2] != "вечер" {
+		t.Errorf("Expected tags in saved order, got %v", got.Tags)
+	}
+	if got.LastUpdated.IsZero() {
+		t.Error("Expected LastUpdated to be set")
+	}
+
+	// Замена устройства заменяет параметры и теги целиком
+	got.Status.Parameters = map[string]string{model.ParamPower: "off"}
+	got.Tags = []string{"спальня"}
+	if err := store.SaveDevice(got); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	got, err = store.GetDevice(device.ID)
+	if err != nil {
+		t.Fatalf("Failed to get device: %v", err)
+	}
+	if len(got.Status.Parameters) != 1 || got.Status.Parameters[model.ParamPower] != "off" {
+		t.Errorf("Expected replaced parameters, got %v", got.Status.Parameters)
+	}
+	if len(got.Tags) != 1 || got.Tags[0] != "спальня" {
+		t.Errorf("Expected replaced tags, got %v", got.Tags)
+	}
+
+	// Устройство без статуса
+	got.Status = nil
+	if err := store.SaveDevice(got); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	if got, err = store.GetDevice(device.ID); err != nil || got.Status != nil {
+		t.Errorf("Expected device without status, got %+v %v", got, err)
+	}
+}
+
+func testReturnsCopies(t *testing.T, store DeviceStore) {
+	device := model.NewDevice("Test Device", model.DeviceTypeLamp, "Test Model", "Test Room")
+	device.Status.Parameters[model.ParamPower] = "off"
+	store.SaveDevice(device)
+
+	// Изменение сохраненного или прочитанного объекта не меняет хранилище
+	device.Status.Parameters[model.ParamPower] = "on"
+	got, _ := store.GetDevice(device.ID)
+	got.Name = "Changed"
+	got.Status.Parameters[model.ParamLevel] = "10"
+
+	got, _ = store.GetDevice(device.ID)
+	if got.Name != "Test Device" || got.Status.Parameters[model.ParamPower] != "off" || got.Status.Parameters[model.ParamLevel] != "" {
+		t.Errorf("Store changed without SaveDevice: %+v %v", got, got.Status.Parameters)
+	}
+}
+
+func testOptimisticLocking(t *testing.T, store DeviceStore) {
+	device := model.NewDevice("Test Device", model.DeviceTypeLamp, "Test Model", "Test Room")
+	if err := store.SaveDevice(device); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	if device.Version != 1 {
+		t.Fatalf("Expected version 1 after create, got %d", device.Version)
+	}
+
+	// Два клиента читают одну версию
+	first, _ := store.GetDevice(device.ID)
+	second, _ := store.GetDevice(device.ID)
+	if first.Version != 1 || second.Version != 1 {
+		t.Fatalf("Expected stored version 1, got %d and %d", first.Version, second.Version)
+	}
+
+	first.Status.Parameters[model.ParamPower] = "on"
+	if err := store.SaveDevice(first); err != nil {
+		t.Fatalf("First save failed: %v", err)
+	}
+	if first.Version != 2 {
+		t.Errorf("Expected version 2 after update, got %d", first.Version)
+	}
+
+	// Второй клиент сохраняет устаревшую версию
+	second.Status.Parameters[model.ParamPower] = "off"
+	if err := store.SaveDevice(second); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("Expected ErrVersionConflict, got %v", err)
+	}
+	if got, _ := store.GetDevice(device.ID); got.Status.Parameters[model.ParamPower] != "on" || got.Version != 2 {
+		t.Errorf("Conflicting save changed device: %v version %d", got.Status.Parameters, got.Version)
+	}
+
+	// Обновления статуса и параметров тоже увеличивают версию
+	if err := store.UpdateDeviceParameter(device.ID, model.ParamLevel, "50"); err != nil {
+		t.Fatalf("Failed to update parameter: %v", err)
+	}
+	if err := store.SaveDevice(first); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict after parameter update, got %v", err)
+	}
+	if err := store.UpdateDeviceStatus(device.ID, model.NewDeviceStatus()); err != nil {
+		t.Fatalf("Failed to update status: %v", err)
+	}
+	if got, _ := store.GetDevice(device.ID); got.Version != 4 {
+		t.Errorf("Expected version 4, got %d", got.Version)
+	}
+
+	// Версия 0 записывает без проверки
+	second.Version = 0
+	if err := store.SaveDevice(second); err != nil || second.Version != 5 {
+		t.Errorf("Expected unconditional save to version 5, got %d %v", second.Version, err)
+	}
+
+	// Условная запись удаленного устройства
+	store.DeleteDevice(device.ID)
+	if err := store.SaveDevice(second); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Expected ErrDeviceNotFound for deleted device, got %v", err)
+	}
+}
+
+func testAddTestDevices(t *testing.T, store DeviceStore) {
+	store.AddTestDevices()
+
+	devices, err := store.ListDevices("", false)
+	if err != nil {
+		t.Fatalf("Failed to list devices: %v", err)
+	}
+	if len(devices) != 5 {
+		t.Fatalf("Expected 5 test devices, got %d", len(devices))
+	}
+	thermostats, _ := store.ListDevices(model.DeviceTypeThermostat, false)
+	if len(thermostats) != 1 || thermostats[0].Status.Parameters[model.ParamTemperature] != "22.5" {
+		t.Errorf("Unexpected test thermostat: %+v", thermostats)
+	}
+
+	// Устройства привязаны к тестовым комнатам
+	rooms, err := store.ListRooms()
+	if err != nil || len(rooms) != 5 {
+		t.Fatalf("Expected 5 test rooms, got %d %v", len(rooms), err)
+	}
+	for _, device := range devices {
+		room, err := store.GetRoom(device.RoomID)
+		if err != nil || room.Name != device.Room {
+			t.Errorf("Device %s is not in room %s: %+v %v", device.Name, device.Room, room, err)
+		}
+	}
+}
+
+func testSaveAndDeleteRoom(t *testing.T, store DeviceStore) {
+	kitchen := model.NewRoom("Кухня", 1, "kitchen", "кухне", "кухню")
+	attic := model.NewRoom("Мансарда", 2, "")
+	hall := model.NewRoom("Гостиная", 1, "sofa")
+	for _, room := range []*model.Room{kitchen, attic, hall} {
+		if err := store.SaveRoom(room); err != nil {
+			t.Fatalf("Failed to save room: %v", err)
+		}
+	}
+
+	got, err := store.GetRoom(kitchen.ID)
+	if err != nil {
+		t.Fatalf("Failed to get room: %v", err)
+	}
+	if got.Name != "Кухня" || got.Floor != 1 || got.Icon != "kitchen" || len(got.Aliases) != 2 || got.Aliases[1] != "кухню" {
+		t.Errorf("Unexpected room: %+v", got)
+	}
+
+	// Изменение прочитанной комнаты не меняет хранилище
+	got.Aliases[0] = "changed"
+	if got, _ := store.GetRoom(kitchen.ID); got.Aliases[0] != "кухне" {
+		t.Errorf("Store changed without SaveRoom: %v", got.Aliases)
+	}
+	if _, err := store.GetRoom("missing"); !errors.Is(err, ErrRoomNotFound) {
+		t.Errorf("Expected ErrRoomNotFound, got %v", err)
+	}
+	if _, err := store.GetRoom(""); !errors.Is(err, ErrInvalidRoomID) {
+		t.Errorf("Expected ErrInvalidRoomID, got %v", err)
+	}
+
+	// Комнаты упорядочены по этажу и имени
+	rooms, err := store.ListRooms()
+	if err != nil {
+		t.Fatalf("Failed to list rooms: %v", err)
+	}
+	if len(rooms) != 3 || rooms[0].ID != hall.ID || rooms[1].ID != kitchen.ID || rooms[2].ID != attic.ID {
+		t.Errorf("Unexpected room order: %+v", rooms)
+	}
+
+	// Замена комнаты
+	kitchen.Name = "Кухня-столовая"
+	kitchen.Aliases = nil
+	if err := store.SaveRoom(kitchen); err != nil {
+		t.Fatalf("Failed to save room: %v", err)
+	}
+	if got, _ := store.GetRoom(kitchen.ID); got.Name != "Кухня-столовая" || len(got.Aliases) != 0 {
+		t.Errorf("Unexpected room after replace: %+v", got)
+	}
+
+	if err := store.DeleteRoom(attic.ID); err != nil {
+		t.Fatalf("Failed to delete room: %v", err)
+	}
+	if err := store.DeleteRoom(attic.ID); !errors.Is(err, ErrRoomNotFound) {
+		t.Errorf("Expected ErrRoomNotFound on second delete, got %v", err)
+	}
+}
+
+func testRoomReferences(t *testing.T, store DeviceStore) {
+	kitchen := model.NewRoom("Кухня", 1, "kitchen")
+	if err := store.SaveRoom(kitchen); err != nil {
+		t.Fatalf("Failed to save room: %v", err)
+	}
+
+	// Устройство нельзя привязать к несуществующей комнате
+	lamp := model.NewDevice("Лампа", model.DeviceTypeLamp, "Philips Hue", "Кухня")
+	lamp.RoomID = "missing"
+	if err := store.SaveDevice(lamp); !errors.Is(err, ErrRoomNotFound) {
+		t.Fatalf("Expected ErrRoomNotFound, got %v", err)
+	}
+	if _, err := store.GetDevice(lamp.ID); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Device with missing room was saved: %v", err)
+	}
+
+	lamp.RoomID = kitchen.ID
+	lamp.Version = 0
+	if err := store.SaveDevice(lamp); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	if got, _ := store.GetDevice(lamp.ID); got.RoomID != kitchen.ID {
+		t.Errorf("Expected room ID %s, got %q", kitchen.ID, got.RoomID)
+	}
+
+	// Комнату с устройствами удалить нельзя
+	if err := store.DeleteRoom(kitchen.ID); !errors.Is(err, ErrRoomNotEmpty) {
+		t.Fatalf("Expected ErrRoomNotEmpty, got %v", err)
+	}
+	lamp.RoomID = ""
+	if err := store.SaveDevice(lamp); err != nil {
+		t.Fatalf("Failed to save device: %v", err)
+	}
+	if got, _ := store.GetDevice(lamp.ID); got.RoomID != "" {
+		t.Errorf("Expected device without room, got %q", got.RoomID)
+	}
+	if err := store.DeleteRoom(kitchen.ID); err != nil {
+		t.Errorf("Failed to delete empty room: %v", err)
+	}
+}
+
+func testSaveAndDeleteScene(t *testing.T, store DeviceStore) {
+	movie := model.NewScene("Кино", "film",
+		model.SceneTarget{DeviceID: "lamp-1", Parameters: map[string]string{"power": "on", "level": "20"}},
+		model.SceneTarget{DeviceID: "socket-1", Parameters: map[string]string{"power": "off"}})
+	morning := model.NewScene("Доброе утро", "sun", model.SceneTarget{DeviceID: "lamp-1", Parameters: map[string]string{"power": "on"}})
+	for _, scene := range []*model.Scene{movie, morning} {
+		if err := store.SaveScene(scene); err != nil {
+			t.Fatalf("Failed to save scene: %v", err)
+		}
+	}
+
+	got, err := store.GetScene(movie.ID)
+	if err != nil {
+		t.Fatalf("Failed to get scene: %v", err)
+	}
+	if got.Name != "Кино" || got.Icon != "film" || len(got.Targets) != 2 ||
+		got.Targets[0].DeviceID != "lamp-1" || got.Targets[0].Parameters["level"] != "20" || got.Targets[1].Parameters["power"] != "off" {
+		t.Errorf("Unexpected scene: %+v", got)
+	}
+
+	// Изменение прочитанной сцены не меняет хранилище
+	got.Targets[0].Parameters["level"] = "100"
+	if got, _ := store.GetScene(movie.ID); got.Targets[0].Parameters["level"] != "20" {
+		t.Errorf("Store changed without SaveScene: %+v", got.Targets[0])
+	}
+	if _, err := store.GetScene("missing"); !errors.Is(err, ErrSceneNotFound) {
+		t.Errorf("Expected ErrSceneNotFound, got %v", err)
+	}
+	if _, err := store.GetScene(""); !errors.Is(err, ErrInvalidSceneID) {
+		t.Errorf("Expected ErrInvalidSceneID, got %v", err)
+	}
+
+	// Сцены упорядочены по имени
+	scenes, err := store.ListScenes()
+	if err != nil {
+		t.Fatalf("Failed to list scenes: %v", err)
+	}
+	if len(scenes) != 2 || scenes[0].ID != morning.ID || scenes[1].ID != movie.ID {
+		t.Errorf("Unexpected scene order: %+v", scenes)
+	}
+
+	// Замена сцены
+	movie.Targets = movie.Targets[:1]
+	if err := store.SaveScene(movie); err != nil {
+		t.Fatalf("Failed to save scene: %v", err)
+	}
+	if got, _ := store.GetScene(movie.ID); len(got.Targets) != 1 {
+		t.Errorf("Unexpected scene after replace: %+v", got)
+	}
+
+	if err := store.DeleteScene(movie.ID); err != nil {
+		t.Fatalf("Failed to delete scene: %v", err)
+	}
+	if err := store.DeleteScene(movie.ID); !errors.Is(err, ErrSceneNotFound) {
+		t.Errorf("Expected ErrSceneNotFound on second delete, got %v", err)
+	}
+}
+
+func testSaveAndDeleteRule(t *testing.T, store DeviceStore) {
+	rule := model.NewRule("Свет в коридоре")
+	rule.Triggers = []model.RuleTrigger{
+		{Type: model.TriggerParameterChanged, DeviceID: "sensor-1", Parameter: "last_motion"},
+		{Type: model.TriggerTime, Time: "07:30", Days: []string{"mon", "fri"}},
+	}
+	rule.Conditions = []model.RuleCondition{{Type: model.ConditionTimeWindow, After: "22:00", Before: "06:00"}}
+	rule.Actions = []model.RuleAction{
+		{Type: model.ActionControl, DeviceID: "lamp-1", Command: "turn_on", Parameters: map[string]string{"level": "30"}},
+		{Type: model.ActionDelay, Delay: 5 * time.Minute},
+		{Type: model.ActionScene, SceneID: "scene-1"},
+	}
+	rule.Cooldown = time.Minute
+	alarm := model.NewRule("Будильник")
+	for _, r := range []*model.Rule{rule, alarm} {
+		if err := store.SaveRule(r); err != nil {
+			t.Fatalf("Failed to save rule: %v", err)
+		}
+	}
+
+	got, err := store.GetRule(rule.ID)
+	if err != nil {
+		t.Fatalf("Failed to get rule: %v", err)
+	}
+	if got.Name != rule.Name || !got.Enabled || got.Cooldown != time.Minute || len(got.Triggers) != 2 ||
+		got.Triggers[1].Days[1] != "fri" || got.Conditions[0].After != "22:00" || len(got.Actions) != 3 ||
+		got.Actions[0].Parameters["level"] != "30" || got.Actions[1].Delay != 5*time.Minute || got.Actions[2].SceneID != "scene-1" {
+		t.Errorf("Unexpected rule: %+v", got)
+	}
+
+	// Изменение прочитанного правила не меняет хранилище
+	got.Actions[0].Parameters["level"] = "100"
+	if got, _ := store.GetRule(rule.ID); got.Actions[0].Parameters["level"] != "30" {
+		t.Errorf("Store changed without SaveRule: %+v", got.Actions[0])
+	}
+	if _, err := store.GetRule("missing"); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("Expected ErrRuleNotFound, got %v", err)
+	}
+	if _, err := store.GetRule(""); !errors.Is(err, ErrInvalidRuleID) {
+		t.Errorf("Expected ErrInvalidRuleID, got %v", err)
+	}
+
+	// Правила упорядочены по имени
+	rules, err := store.ListRules()
+	if err != nil {
+		t.Fatalf("Failed to list rules: %v", err)
+	}
+	if len(rules) != 2 || rules[0].ID != alarm.ID || rules[1].ID != rule.ID {
+		t.Errorf("Unexpected rule order: %+v", rules)
+	}
+
+	// Замена правила
+	rule.Enabled = false
+	if err := store.SaveRule(rule); err != nil {
+		t.Fatalf("Failed to save rule: %v", err)
+	}
+	if got, _ := store.GetRule(rule.ID); got.Enabled {
+		t.Errorf("Unexpected rule after replace: %+v", got)
+	}
+
+	if err := store.DeleteRule(rule.ID); err != nil {
+		t.Fatalf("Failed to delete rule: %v", err)
+	}
+	if err := store.DeleteRule(rule.ID); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("Expected ErrRuleNotFound, got %v", err)
+	}
+}
+
+func testSaveAndDeleteSchedule(t *testing.T, store DeviceStore) {
+	kettle := model.NewSchedule("Чайник", model.ScheduleAction{
+		Type: model.ActionControl, DeviceID: "socket-1", Command: "turn_on", Parameters: map[string]string{"power": "on"},
+	})
+	kettle.Cron = "0 7 * * 1-5"
+	kettle.TimeZone = "Europe/Moscow"
+	kettle.NextRun = time.Date(2026, 5, 5, 4, 0, 0, 0, time.UTC)
+	kettle.LastRun = time.Date(2026, 5, 4, 4, 0, 0, 0, time.UTC)
+	kettle.LastStatus = model.ScheduleFailed
+	kettle.LastError = "device offline"
+	lamp := model.NewSchedule("Выключить лампу", model.ScheduleAction{Type: model.ActionScene, SceneID: "scene-1"})
+	lamp.RunAt = time.Date(2026, 5, 4, 20, 30, 0, 0, time.UTC)
+	lamp.NextRun = lamp.RunAt
+	lamp.MissedRunPolicy = model.MissedRunRunOnce
+	for _, s := range []*model.Schedule{kettle, lamp} {
+		if err := store.SaveSchedule(s); err != nil {
+			t.Fatalf("Failed to save schedule: %v", err)
+		}
+	}
+
+	got, err := store.GetSchedule(kettle.ID)
+	if err != nil {
+		t.Fatalf("Failed to get schedule: %v", err)
+	}
+	if got.Name != kettle.Name || got.Cron != kettle.Cron || got.TimeZone != kettle.TimeZone || !got.RunAt.IsZero() ||
+		!got.NextRun.Equal(kettle.NextRun) || !got.LastRun.Equal(kettle.LastRun) || got.LastStatus != model.ScheduleFailed ||
+		got.LastError != kettle.LastError || got.Action.Parameters["power"] != "on" || got.MissedRunPolicy != model.MissedRunSkip {
+		t.Errorf("Unexpected schedule: %+v", got)
+	}
+
+	// Изменение прочитанного расписания не меняет хранилище
+	got.Action.Parameters["power"] = "off"
+	if got, _ := store.GetSchedule(kettle.ID); got.Action.Parameters["power"] != "on" {
+		t.Errorf("Store changed without SaveSchedule: %+v", got.Action)
+	}
+	if _, err := store.GetSchedule("missing"); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("Expected ErrScheduleNotFound, got %v", err)
+	}
+	if _, err := store.GetSchedule(""); !errors.Is(err, ErrInvalidScheduleID) {
+		t.Errorf("Expected ErrInvalidScheduleID, got %v", err)
+	}
+
+	// Расписания упорядочены по имени
+	schedules, err := store.ListSchedules()
+	if err != nil {
+		t.Fatalf("Failed to list schedules: %v", err)
+	}
+	if len(schedules) != 2 || schedules[0].ID != lamp.ID || schedules[1].ID != kettle.ID {
+		t.Errorf("Unexpected schedule order: %+v", schedules)
+	}
+	if !schedules[0].RunAt.Equal(lamp.RunAt) || schedules[0].Action.SceneID != "scene-1" || !schedules[0].LastRun.IsZero() {
+		t.Errorf("Unexpected one-shot schedule: %+v", schedules[0])
+	}
+
+	// Замена расписания
+	kettle.Paused = true
+	if err := store.SaveSchedule(kettle); err != nil {
+		t.Fatalf("Failed to save schedule: %v", err)
+	}
+	if got, _ := store.GetSchedule(kettle.ID); !got.Paused {
+		t.Errorf("Unexpected schedule after replace: %+v", got)
+	}
+
+	if err := store.DeleteSchedule(kettle.ID); err != nil {
+		t.Fatalf("Failed to delete schedule: %v", err)
+	}
+	if err := store.DeleteSchedule(kettle.ID); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("Expected ErrScheduleNotFound, got %v", err)
+	}
+}
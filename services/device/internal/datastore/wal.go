@@ -0,0 +1,428 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+)
+
+// Формат записи журнала: длина данных (uint32, big endian), CRC-32C данных,
+// затем JSON-запись. Запись, оборванная на конце файла, отбрасывается при
+// восстановлении; повреждение в середине журнала считается ошибкой.
+const (
+	recordHeaderSize = 8
+	maxRecordSize    = 16 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Операции журнала: каждая запись содержит итоговое состояние устройства,
+// комнаты, сцены, правила или расписания, поэтому воспроизведение не зависит от логики методов хранилища
+const (
+	opPut            = "put"
+	opDelete         = "delete"
+	opPutRoom        = "put_room"
+	opDeleteRoom     = "delete_room"
+	opPutScene       = "put_scene"
+	opDeleteScene    = "delete_scene"
+	opPutRule        = "put_rule"
+	opDeleteRule     = "delete_rule"
+	opPutSchedule    = "put_schedule"
+	opDeleteSchedule = "delete_schedule"
+)
+
+// walRecord - запись журнала изменений
+type walRecord struct {
+	Seq      uint64        `json:"seq"`
+	Op       string        `json:"op"`
+	ID       string        `json:"id"`
+	Device   *diskDevice   `json:"device,omitempty"`
+	Room     *diskRoom     `json:"room,omitempty"`
+	Scene    *diskScene    `json:"scene,omitempty"`
+	Rule     *diskRule     `json:"rule,omitempty"`
+	Schedule *diskSchedule `json:"schedule,omitempty"`
+}
+
+// diskDevice - формат устройства на диске, не зависящий от полей model.Device
+type diskDevice struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Model       string      `json:"model"`
+	Room        string      `json:"room"`
+	RoomID      string      `json:"room_id,omitempty"`
+	Status      *diskStatus `json:"status,omitempty"`
+	Tags        []string    `json:"tags"`
+	LastUpdated time.Time   `json:"last_updated"`
+	Version     int64       `json:"version"`
+}
+
+type diskStatus struct {
+	Online         bool              `json:"online"`
+	Parameters     map[string]string `json:"parameters"`
+	BatteryLevel   int32             `json:"battery_level"`
+	SignalStrength float32           `json:"signal_strength"`
+}
+
+func toDisk(d *model.Device) *diskDevice {
+	disk := &diskDevice{
+		ID:          d.ID,
+		Name:        d.Name,
+		Type:        d.Type,
+		Model:       d.Model,
+		Room:        d.Room,
+		RoomID:      d.RoomID,
+		Tags:        d.Tags,
+		LastUpdated: d.LastUpdated,
+		Version:     d.Version,
+	}
+	if d.Status != nil {
+		disk.Status = &diskStatus{
+			Online:         d.Status.Online,
+			Parameters:     d.Status.Parameters,
+			BatteryLevel:   d.Status.BatteryLevel,
+			SignalStrength: d.Status.SignalStrength,
+		}
+	}
+	return disk
+}
+
+func (d *diskDevice) toModel() *model.Device {
+	device := &model.Device{
+		ID:          d.ID,
+		Name:        d.Name,
+		Type:        d.Type,
+		Model:       d.Model,
+		Room:        d.Room,
+		RoomID:      d.RoomID,
+		Tags:        d.Tags,
+		LastUpdated: d.LastUpdated,
+		Version:     d.Version,
+	}
+	if device.Tags == nil {
+		device.Tags = []string{}
+	}
+	if d.Status != nil {
+		device.Status = &model.DeviceStatus{
+			Online:         d.Status.Online,
+			Parameters:     d.Status.Parameters,
+			BatteryLevel:   d.Status.BatteryLevel,
+			SignalStrength: d.Status.SignalStrength,
+		}
+		if device.Status.Parameters == nil {
+			device.Status.Parameters = make(map[string]string)
+		}
+	}
+	return device
+}
+
+// diskRoom - формат комнаты на диске
+type diskRoom struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+	Floor   int32    `json:"floor"`
+	Icon    string   `json:"icon"`
+}
+
+func toDiskRoom(r *model.Room) *diskRoom {
+	return &diskRoom{
+		ID:      r.ID,
+		Name:    r.Name,
+		Aliases: r.Aliases,
+		Floor:   r.Floor,
+		Icon:    r.Icon,
+	}
+}
+
+func (r *diskRoom) toModel() *model.Room {
+	room := &model.Room{
+		ID:      r.ID,
+		Name:    r.Name,
+		Aliases: r.Aliases,
+		Floor:   r.Floor,
+		Icon:    r.Icon,
+	}
+	if room.Aliases == nil {
+		room.Aliases = []string{}
+	}
+	return room
+}
+
+// diskScene - формат сцены на диске
+type diskScene struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Icon    string            `json:"icon"`
+	Targets []diskSceneTarget `json:"targets"`
+}
+
+type diskSceneTarget struct {
+	DeviceID   string            `json:"device_id"`
+	Parameters map[string]string `json:"parameters"`
+}
+
+func toDiskScene(s *model.Scene) *diskScene {
+	disk := &diskScene{
+		ID:      s.ID,
+		Name:    s.Name,
+		Icon:    s.Icon,
+		Targets: make([]diskSceneTarget, 0, len(s.Targets)),
+	}
+	for _, target := range s.Targets {
+		disk.Targets = append(disk.Targets, diskSceneTarget{DeviceID: target.DeviceID, Parameters: target.Parameters})
+	}
+	return disk
+}
+
+func (s *diskScene) toModel() *model.Scene {
+	scene := &model.Scene{
+		ID:      s.ID,
+		Name:    s.Name,
+		Icon:    s.Icon,
+		Targets: make([]model.SceneTarget, 0, len(s.Targets)),
+	}
+	for _, target := range s.Targets {
+		params := target.Parameters
+		if params == nil {
+			params = make(map[string]string)
+		}
+		scene.Targets = append(scene.Targets, model.SceneTarget{DeviceID: target.DeviceID, Parameters: params})
+	}
+	return scene
+}
+
+// diskRule - формат правила автоматизации на диске. Интервалы хранятся в секундах.
+type diskRule struct {
+	ID              string              `json:"id"`
+	Name            string              `json:"name"`
+	Enabled         bool                `json:"enabled"`
+	Triggers        []diskRuleTrigger   `json:"triggers"`
+	Conditions      []diskRuleCondition `json:"conditions"`
+	Actions         []diskRuleAction    `json:"actions"`
+	CooldownSeconds int64               `json:"cooldown_seconds"`
+}
+
+type diskRuleTrigger struct {
+	Type      string   `json:"type"`
+	DeviceID  string   `json:"device_id,omitempty"`
+	Parameter string   `json:"parameter,omitempty"`
+	Value     string   `json:"value,omitempty"`
+	Time      string   `json:"time,omitempty"`
+	Days      []string `json:"days,omitempty"`
+}
+
+type diskRuleCondition struct {
+	Type      string `json:"type"`
+	DeviceID  string `json:"device_id,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+	Operator  string `json:"operator,omitempty"`
+	Value     string `json:"value,omitempty"`
+	After     string `json:"after,omitempty"`
+	Before    string `json:"before,omitempty"`
+}
+
+type diskRuleAction struct {
+	Type         string            `json:"type"`
+	DeviceID     string            `json:"device_id,omitempty"`
+	Command      string            `json:"command,omitempty"`
+	Parameters   map[string]string `json:"parameters,omitempty"`
+	SceneID      string            `json:"scene_id,omitempty"`
+	DelaySeconds int64             `json:"delay_seconds,omitempty"`
+}
+
+func toDiskRule(r *model.Rule) *diskRule {
+	disk := &diskRule{
+		ID:              r.ID,
+		Name:            r.Name,
+		Enabled:         r.Enabled,
+		Triggers:        make([]diskRuleTrigger, 0, len(r.Triggers)),
+		Conditions:      make([]diskRuleCondition, 0, len(r.Conditions)),
+		Actions:         make([]diskRuleAction, 0, len(r.Actions)),
+		CooldownSeconds: int64(r.Cooldown / time.Second),
+	}
+	for _, t := range r.Triggers {
+		disk.Triggers = append(disk.Triggers, diskRuleTrigger(t))
+	}
+	for _, c := range r.Conditions {
+		disk.Conditions = append(disk.Conditions, diskRuleCondition(c))
+	}
+	for _, a := range r.Actions {
+		disk.Actions = append(disk.Actions, diskRuleAction{
+			Type:         a.Type,
+			DeviceID:     a.DeviceID,
+			Command:      a.Command,
+			Parameters:   a.Parameters,
+			SceneID:      a.SceneID,
+			DelaySeconds: int64(a.Delay / time.Second),
+		})
+	}
+	return disk
+}
+
+func (r *diskRule) toModel() *model.Rule {
+	rule := &model.Rule{
+		ID:         r.ID,
+		Name:       r.Name,
+		Enabled:    r.Enabled,
+		Triggers:   make([]model.RuleTrigger, 0, len(r.Triggers)),
+		Conditions: make([]model.RuleCondition, 0, len(r.Conditions)),
+		Actions:    make([]model.RuleAction, 0, len(r.Actions)),
+		Cooldown:   time.Duration(r.CooldownSeconds) * time.Second,
+	}
+	for _, t := range r.Triggers {
+		rule.Triggers = append(rule.Triggers, model.RuleTrigger(t))
+	}
+	for _, c := range r.Conditions {
+		rule.Conditions = append(rule.Conditions, model.RuleCondition(c))
+	}
+	for _, a := range r.Actions {
+		rule.Actions = append(rule.Actions, model.RuleAction{
+			Type:       a.Type,
+			DeviceID:   a.DeviceID,
+			Command:    a.Command,
+			Parameters: a.Parameters,
+			SceneID:    a.SceneID,
+			Delay:      time.Duration(a.DelaySeconds) * time.Second,
+		})
+	}
+	return rule
+}
+
+// diskSchedule - формат расписания на диске вместе с состоянием запусков
+type diskSchedule struct {
+	ID              string             `json:"id"`
+	Name            string             `json:"name"`
+	Paused          bool               `json:"paused"`
+	Action          diskScheduleAction `json:"action"`
+	RunAt           time.Time          `json:"run_at"`
+	Cron            string             `json:"cron,omitempty"`
+	TimeZone        string             `json:"time_zone,omitempty"`
+	MissedRunPolicy string             `json:"missed_run_policy"`
+	NextRun         time.Time          `json:"next_run"`
+	LastRun         time.Time          `json:"last_run"`
+	LastStatus      string             `json:"last_status,omitempty"`
+	LastError       string             `json:"last_error,omitempty"`
+}
+
+type diskScheduleAction struct {
+	Type       string            `json:"type"`
+	DeviceID   string            `json:"device_id,omitempty"`
+	Command    string            `json:"command,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	SceneID    string            `json:"scene_id,omitempty"`
+}
+
+func toDiskSchedule(s *model.Schedule) *diskSchedule {
+	return &diskSchedule{
+		ID:              s.ID,
+		Name:            s.Name,
+		Paused:          s.Paused,
+		Action:          diskScheduleAction(s.Action),
+		RunAt:           s.RunAt,
+		Cron:            s.Cron,
+		TimeZone:        s.TimeZone,
+		MissedRunPolicy: s.MissedRunPolicy,
+		NextRun:         s.NextRun,
+		LastRun:         s.LastRun,
+		LastStatus:      s.LastStatus,
+		LastError:       s.LastError,
+	}
+}
+
+func (s *diskSchedule) toModel() *model.Schedule {
+	return &model.Schedule{
+		ID:              s.ID,
+		Name:            s.Name,
+		Paused:          s.Paused,
+		Action:          model.ScheduleAction(s.Action),
+		RunAt:           s.RunAt,
+		Cron:            s.Cron,
+		TimeZone:        s.TimeZone,
+		MissedRunPolicy: s.MissedRunPolicy,
+		NextRun:         s.NextRun,
+		LastRun:         s.LastRun,
+		LastStatus:      s.LastStatus,
+		LastError:       s.LastError,
+	}
+}
+
+// encodeRecord кодирует запись вместе с заголовком
+func encodeRecord(rec walRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[recordHeaderSize:], payload)
+	return buf, nil
+}
+
+// errCorruptLog означает повреждение журнала не в последней записи
+var errCorruptLog = errors.New("device log is corrupted")
+
+// readLog читает записи журнала и вызывает apply для каждой. Возвращает
+// смещение конца последней целой записи: если оно меньше размера файла,
+// последняя запись оборвана и файл нужно обрезать.
+func readLog(f *os.File, apply func(walRecord) error) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var (
+		offset int64
+		header [recordHeaderSize]byte
+	)
+	for {
+		if _, err := io.ReadFull(f, header[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset, nil
+			}
+			return offset, err
+		}
+
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		end := offset + recordHeaderSize + length
+		if end > size {
+			// Последняя запись записана не полностью
+			return offset, nil
+		}
+		if length > maxRecordSize {
+			return offset, fmt.Errorf("%w: invalid record length %d at offset %d", errCorruptLog, length, offset)
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(f, payload); err != nil {
+			return offset, err
+		}
+
+		var rec walRecord
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) || json.Unmarshal(payload, &rec) != nil {
+			if end == size {
+				// Последняя запись записана не полностью
+				return offset, nil
+			}
+			return offset, fmt.Errorf("%w: bad record at offset %d", errCorruptLog, offset)
+		}
+
+		if err := apply(rec); err != nil {
+			return offset, err
+		}
+		offset = end
+	}
+}
@@ -0,0 +1,111 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+)
+
+// Event описывает изменение устройства в хранилище
+type Event struct {
+	DeviceID string
+	Device   *model.Device // Состояние после изменения (nil - устройство удалено)
+	Time     time.Time
+}
+
+// Deleted сообщает, что устройство удалено
+func (e Event) Deleted() bool {
+	return e.Device == nil
+}
+
+// Bus рассылает изменения устройств подписчикам внутри процесса.
+// Публикация не блокируется: если подписчик не успевает читать, для
+// каждого устройства у него остается только последнее изменение.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// NewBus создает шину изменений
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish рассылает изменение всем подписчикам
+func (b *Bus) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		sub.push(event)
+	}
+}
+
+// Subscribe создает подписку на все изменения. Подписку нужно закрыть Close.
+func (b *Bus) Subscribe() *Subscription {
+	sub := &Subscription{
+		bus:     b,
+		pending: make(map[string]Event),
+		ready:   make(chan struct{}, 1),
+	}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+// Subscription накапливает изменения для одного подписчика
+type Subscription struct {
+	bus *Bus
+
+	mu      sync.Mutex
+	pending map[string]Event // Последнее непрочитанное изменение по ID устройства
+	order   []string         // Порядок первого появления устройств в pending
+	ready   chan struct{}
+}
+
+// push добавляет изменение, заменяя непрочитанное изменение того же устройства
+func (s *Subscription) push(event Event) {
+	s.mu.Lock()
+	if _, ok := s.pending[event.DeviceID]; !ok {
+		s.order = append(s.order, event.DeviceID)
+	}
+	s.pending[event.DeviceID] = event
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Ready возвращает канал, в который приходит сигнал о новых изменениях
+func (s *Subscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Drain возвращает накопленные изменения в порядке поступления
+func (s *Subscription) Drain() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]Event, 0, len(s.order))
+	for _, id := range s.order {
+		events = append(events, s.pending[id])
+	}
+	s.pending = make(map[string]Event)
+	s.order = nil
+	return events
+}
+
+// Close отменяет подписку
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	delete(s.bus.subs, s)
+	s.bus.mu.Unlock()
+}
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+)
+
+func TestBus_CoalescesPendingEvents(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe()
+	defer sub.Close()
+
+	lamp := model.NewDevice("Лампа", model.DeviceTypeLamp, "Philips Hue", "Кухня")
+	socket := model.NewDevice("Розетка", model.DeviceTypeSocket, "TP-Link Kasa", "Кухня")
+
+	bus.Publish(Event{DeviceID: lamp.ID, Device: lamp})
+	bus.Publish(Event{DeviceID: socket.ID, Device: socket})
+	bus.Publish(Event{DeviceID: lamp.ID})
+
+	select {
+	case <-sub.Ready():
+	default:
+		t.Fatal("expected ready signal")
+	}
+
+	// Для лампы остается только последнее изменение, порядок устройств сохраняется
+	events := sub.Drain()
+	if len(events) != 2 || events[0].DeviceID != lamp.ID || !events[0].Deleted() || events[1].DeviceID != socket.ID {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if events := sub.Drain(); len(events) != 0 {
+		t.Errorf("expected no events after drain, got %d", len(events))
+	}
+
+	// После Close изменения не доставляются
+	sub.Close()
+	bus.Publish(Event{DeviceID: lamp.ID})
+	if events := sub.Drain(); len(events) != 0 {
+		t.Errorf("expected no events after Close, got %d", len(events))
+	}
+}
+
+func TestStore_PublishesMutations(t *testing.T) {
+	bus := NewBus()
+	store := NewStore(datastore.NewMemoryStore(), bus)
+	sub := bus.Subscribe()
+	defer sub.Close()
+
+	lamp := model.NewDevice("Лампа", model.DeviceTypeLamp, "Philips Hue", "Кухня")
+	if err := store.SaveDevice(lamp); err != nil {
+		t.Fatalf("SaveDevice failed: %v", err)
+	}
+	events := sub.Drain()
+	if len(events) != 1 || events[0].Device == nil || events[0].Device.Version != lamp.Version {
+		t.Fatalf("unexpected events after save: %+v", events)
+	}
+
+	if err := store.UpdateDeviceParameter(lamp.ID, model.ParamPower, "on"); err != nil {
+		t.Fatalf("UpdateDeviceParameter failed: %v", err)
+	}
+	events = sub.Drain()
+	if len(events) != 1 || events[0].Device.Status.Parameters[model.ParamPower] != "on" {
+		t.Fatalf("unexpected events after parameter update: %+v", events)
+	}
+
+	// Неудачные изменения не публикуются
+	if err := store.DeleteDevice("missing"); err == nil {
+		t.Fatal("expected error for missing device")
+	}
+	if err := store.DeleteDevice(lamp.ID); err != nil {
+		t.Fatalf("DeleteDevice failed: %v", err)
+	}
+	events = sub.Drain()
+	if len(events) != 1 || !events[0].Deleted() || events[0].DeviceID != lamp.ID {
+		t.Fatalf("unexpected events after delete: %+v", events)
+	}
+}
@@ -0,0 +1,89 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+)
+
+// Store публикует в шину успешные изменения хранилища устройств. Все
+// компоненты сервиса должны изменять устройства через него, иначе
+// подписчики не узнают об изменении.
+type Store struct {
+	datastore.DeviceStore
+
+	bus *Bus
+
+	// Изменение и публикация выполняются под одной блокировкой, чтобы
+	// подписчики получали состояния устройства в порядке записи
+	mu sync.Mutex
+}
+
+// NewStore оборачивает хранилище публикацией изменений в bus
+func NewStore(store datastore.DeviceStore, bus *Bus) *Store {
+	return &Store{
+		DeviceStore: store,
+		bus:         bus,
+	}
+}
+
+// SaveDevice сохраняет устройство и публикует его состояние
+func (s *Store) SaveDevice(device *model.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.DeviceStore.SaveDevice(device); err != nil {
+		return err
+	}
+	s.bus.Publish(Event{DeviceID: device.ID, Device: device.Clone(), Time: time.Now()})
+	return nil
+}
+
+// DeleteDevice удаляет устройство и публикует удаление
+func (s *Store) DeleteDevice(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.DeviceStore.DeleteDevice(id); err != nil {
+		return err
+	}
+	s.bus.Publish(Event{DeviceID: id, Time: time.Now()})
+	return nil
+}
+
+// UpdateDeviceStatus обновляет статус устройства и публикует новое состояние
+func (s *Store) UpdateDeviceStatus(id string, status *model.DeviceStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.DeviceStore.UpdateDeviceStatus(id, status); err != nil {
+		return err
+	}
+	s.publishCurrent(id)
+	return nil
+}
+
+// UpdateDeviceParameter обновляет параметр устройства и публикует новое состояние
+func (s *Store) UpdateDeviceParameter(id, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.DeviceStore.UpdateDeviceParameter(id, key, value); err != nil {
+		return err
+	}
+	s.publishCurrent(id)
+	return nil
+}
+
+// publishCurrent публикует состояние устройства, прочитанное после изменения
+func (s *Store) publishCurrent(id string) {
+	device, err := s.DeviceStore.GetDevice(id)
+	if err != nil {
+		log.Printf("Events: failed to read device %s after update: %v", id, err)
+		return
+	}
+	s.bus.Publish(Event{DeviceID: id, Device: device, Time: time.Now()})
+}
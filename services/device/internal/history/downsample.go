@@ -0,0 +1,85 @@
+package history
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Bucket - агрегат изменений параметра за интервал
+type Bucket struct {
+	Parameter    string
+	Start        time.Time // Начало интервала, кратное его длине от начала эпохи Unix
+	Count        int       // Число изменений
+	NumericCount int       // Число числовых значений, по которым считаются Min, Max и Sum
+	Min          float64
+	Max          float64
+	Sum          float64
+	Last         string // Последнее значение в интервале
+}
+
+// Avg возвращает среднее числовых значений (0, если их нет)
+func (b *Bucket) Avg() float64 {
+	if b.NumericCount == 0 {
+		return 0
+	}
+	return b.Sum / float64(b.NumericCount)
+}
+
+// BucketStart возвращает начало интервала длины size, в который попадает t
+func BucketStart(t time.Time, size time.Duration) time.Time {
+	return time.Unix(0, t.UnixNano()-mod(t.UnixNano(), int64(size))).UTC()
+}
+
+// Downsample агрегирует точки в порядке Seq по интервалам длины size.
+// Агрегаты упорядочены по началу интервала и имени параметра.
+func Downsample(points []Point, size time.Duration) []*Bucket {
+	type key struct {
+		start     int64
+		parameter string
+	}
+	buckets := make(map[key]*Bucket)
+	var result []*Bucket
+	for _, p := range points {
+		start := BucketStart(p.Time, size)
+		k := key{start: start.UnixNano(), parameter: p.Parameter}
+		b, ok := buckets[k]
+		if !ok {
+			b = &Bucket{Parameter: p.Parameter, Start: start}
+			buckets[k] = b
+			result = append(result, b)
+		}
+
+		b.Count++
+		b.Last = p.Value
+		v, err := strconv.ParseFloat(p.Value, 64)
+		if err != nil {
+			continue
+		}
+		if b.NumericCount == 0 || v < b.Min {
+			b.Min = v
+		}
+		if b.NumericCount == 0 || v > b.Max {
+			b.Max = v
+		}
+		b.Sum += v
+		b.NumericCount++
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].Start.Equal(result[j].Start) {
+			return result[i].Start.Before(result[j].Start)
+		}
+		return result[i].Parameter < result[j].Parameter
+	})
+	return result
+}
+
+// mod возвращает неотрицательный остаток для времени до 1970 года
+func mod(a, b int64) int64 {
+	r := a % b
+	if r < 0 {
+		r += b
+	}
+	return r
+}
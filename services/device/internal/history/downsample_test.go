@@ -0,0 +1,47 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDownsample(t *testing.T) {
+	points := []Point{
+		{Parameter: "temperature", Value: "21.5", Time: start.Add(10 * time.Second)},
+		{Parameter: "power", Value: "on", Time: start.Add(20 * time.Second)},
+		{Parameter: "temperature", Value: "20", Time: start.Add(30 * time.Second)},
+		{Parameter: "temperature", Value: "22.5", Time: start.Add(50 * time.Second)},
+		{Parameter: "power", Value: "off", Time: start.Add(70 * time.Second)},
+		{Parameter: "temperature", Value: "error", Time: start.Add(80 * time.Second)},
+	}
+
+	buckets := Downsample(points, time.Minute)
+	if len(buckets) != 4 {
+		t.Fatalf("Expected 4 buckets, got %d: %+v", len(buckets), buckets)
+	}
+
+	power, temp := buckets[0], buckets[1]
+	if power.Parameter != "power" || power.Count != 1 || power.NumericCount != 0 || power.Last != "on" {
+		t.Errorf("Unexpected power bucket: %+v", power)
+	}
+	if temp.Parameter != "temperature" || !temp.Start.Equal(start) || temp.Count != 3 || temp.NumericCount != 3 ||
+		temp.Min != 20 || temp.Max != 22.5 || temp.Avg() != 64.0/3 || temp.Last != "22.5" {
+		t.Errorf("Unexpected temperature bucket: %+v", temp)
+	}
+
+	// Нечисловое значение учитывается только в Count и Last
+	if b := buckets[3]; !b.Start.Equal(start.Add(time.Minute)) || b.Count != 1 || b.NumericCount != 0 || b.Avg() != 0 || b.Last != "error" {
+		t.Errorf("Unexpected bucket with non-numeric value: %+v", b)
+	}
+}
+
+func TestBucketStart(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	at := time.Date(2026, 5, 4, 10, 47, 12, 0, moscow)
+	if got, want := BucketStart(at, 15*time.Minute), time.Date(2026, 5, 4, 7, 45, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("BucketStart = %s, want %s", got, want)
+	}
+	if got, want := BucketStart(at, 24*time.Hour), time.Date(2026, 5, 4, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("BucketStart(day) = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,210 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileName - журнал истории в каталоге FileStore
+const fileName = "history.log"
+
+// FileConfig содержит настройки FileStore
+type FileConfig struct {
+	Dir      string // Каталог журнала (тот же, что у datastore.FileStore)
+	Capacity int    // Число точек на устройство (0 - DefaultCapacity)
+}
+
+// FileStore хранит историю как MemoryStore и дописывает изменения в
+// журнал history.log, из которого история восстанавливается при запуске.
+// Журнал перезаписывается текущим содержимым, когда вытесненных точек
+// в нем становится больше, чем хранимых. Запись не синхронизируется с
+// диском: при сбое питания теряются последние точки.
+type FileStore struct {
+	*MemoryStore
+
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	records int // Записей в журнале
+}
+
+// fileRecord - строка журнала: точка или удаление истории устройства
+type fileRecord struct {
+	Seq       int64     `json:"seq,omitempty"`
+	DeviceID  string    `json:"device_id"`
+	Parameter string    `json:"parameter,omitempty"`
+	Value     string    `json:"value,omitempty"`
+	Time      time.Time `json:"time"`
+	Deleted   bool      `json:"deleted,omitempty"`
+}
+
+// NewFileStore восстанавливает историю из каталога config.Dir
+func NewFileStore(config FileConfig) (*FileStore, error) {
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	s := &FileStore{
+		MemoryStore: NewMemoryStore(config.Capacity),
+		path:        filepath.Join(config.Dir, fileName),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	// Перезапись удаляет вытесненные точки и оборванную последнюю строку
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load читает журнал до конца или до первой поврежденной строки
+func (s *FileStore) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec fileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			log.Printf("History: stopping at damaged record in %s: %v", s.path, err)
+			return nil
+		}
+		if rec.Deleted {
+			s.MemoryStore.DeleteDevice(rec.DeviceID)
+			continue
+		}
+		s.MemoryStore.restore(Point{Seq: rec.Seq, DeviceID: rec.DeviceID, Parameter: rec.Parameter, Value: rec.Value, Time: rec.Time})
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("History: stopping at unreadable record in %s: %v", s.path, err)
+	}
+	return nil
+}
+
+// Append записывает точки в память и журнал
+func (s *FileStore) Append(points []Point) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.MemoryStore.append(points)
+	records := make([]fileRecord, 0, len(stored))
+	for _, p := range stored {
+		records = append(records, fileRecord{Seq: p.Seq, DeviceID: p.DeviceID, Parameter: p.Parameter, Value: p.Value, Time: p.Time})
+	}
+	if err := s.write(records); err != nil {
+		return err
+	}
+	if s.records > 2*s.MemoryStore.size()+s.MemoryStore.capacity {
+		return s.compact()
+	}
+	return nil
+}
+
+// DeleteDevice удаляет историю устройства
+func (s *FileStore) DeleteDevice(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.MemoryStore.DeleteDevice(id); err != nil {
+		return err
+	}
+	return s.write([]fileRecord{{DeviceID: id, Deleted: true}})
+}
+
+// Close закрывает журнал
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// write дописывает записи в журнал. Вызывается под s.mu.
+func (s *FileStore) write(records []fileRecord) error {
+	var buf bytes.Buffer
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if _, err := s.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	s.records += len(records)
+	return nil
+}
+
+// compact перезаписывает журнал хранимыми точками. Вызывается под s.mu.
+func (s *FileStore) compact() error {
+	points := s.MemoryStore.all()
+	records := make([]fileRecord, 0, len(points))
+	for _, p := range points {
+		records = append(records, fileRecord{Seq: p.Seq, DeviceID: p.DeviceID, Parameter: p.Parameter, Value: p.Value, Time: p.Time})
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), fileName+".*")
+	if err != nil {
+		return fmt.Errorf("failed to compact history: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	// CreateTemp создает файл с правами 0600, журнал устройств - с 0644
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact history: %w", err)
+	}
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact history: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact history: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to compact history: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to compact history: %w", err)
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	s.records = len(records)
+	return nil
+}
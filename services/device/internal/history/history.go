@@ -0,0 +1,60 @@
+// Package history хранит изменения параметров и состояния в сети устройств,
+// чтобы отвечать на вопросы вроде "какая температура была в спальне ночью"
+// и строить графики.
+package history
+
+import (
+	"time"
+)
+
+// DefaultCapacity - число точек одного устройства в MemoryStore и FileStore
+// по умолчанию
+const DefaultCapacity = 10000
+
+// Point - значение параметра устройства после изменения
+type Point struct {
+	Seq       int64 // Порядковый номер, назначается хранилищем при записи
+	DeviceID  string
+	Parameter string // Параметр устройства или model.ParamOnline
+	Value     string
+	Time      time.Time
+}
+
+// Query - выборка точек одного устройства
+type Query struct {
+	DeviceID   string
+	From       time.Time // Начало периода, включается
+	To         time.Time // Конец периода, не включается
+	Parameters []string  // Параметры (пусто - все)
+	AfterSeq   int64     // Только точки с Seq больше (продолжение страницы)
+	Limit      int       // Максимум точек (0 - без ограничения)
+}
+
+// Store - хранилище истории устройств
+type Store interface {
+	// Append записывает точки. Seq назначается хранилищем в порядке записи,
+	// Seq точек points не используется.
+	Append(points []Point) error
+
+	// Query возвращает точки в порядке Seq
+	Query(q Query) ([]Point, error)
+
+	// DeleteDevice удаляет историю устройства
+	DeleteDevice(id string) error
+}
+
+// matches проверяет точку по условиям запроса, кроме DeviceID и Limit
+func (q Query) matches(p Point) bool {
+	if p.Seq <= q.AfterSeq || p.Time.Before(q.From) || !p.Time.Before(q.To) {
+		return false
+	}
+	if len(q.Parameters) == 0 {
+		return true
+	}
+	for _, param := range q.Parameters {
+		if param == p.Parameter {
+			return true
+		}
+	}
+	return false
+}
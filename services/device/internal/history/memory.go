@@ -0,0 +1,138 @@
+package history
+
+import (
+	"sync"
+)
+
+// MemoryStore хранит последние Capacity точек каждого устройства в
+// кольцевом буфере. История теряется при перезапуске.
+type MemoryStore struct {
+	capacity int
+
+	mu      sync.RWMutex
+	seq     int64
+	devices map[string]*ring
+}
+
+// ring - кольцевой буфер точек устройства в порядке Seq начиная с start
+type ring struct {
+	points []Point
+	start  int
+}
+
+// NewMemoryStore создает хранилище на capacity точек на устройство
+// (0 - DefaultCapacity)
+func NewMemoryStore(capacity int) *MemoryStore {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &MemoryStore{
+		capacity: capacity,
+		devices:  make(map[string]*ring),
+	}
+}
+
+// Append записывает точки, вытесняя самые старые точки устройства
+func (s *MemoryStore) Append(points []Point) error {
+	s.append(points)
+	return nil
+}
+
+// append записывает точки и возвращает их с назначенными Seq
+func (s *MemoryStore) append(points []Point) []Point {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := make([]Point, 0, len(points))
+	for _, p := range points {
+		s.seq++
+		p.Seq = s.seq
+		s.put(p)
+		stored = append(stored, p)
+	}
+	return stored
+}
+
+// Query возвращает точки устройства в порядке Seq
+func (s *MemoryStore) Query(q Query) ([]Point, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []Point{}
+	r, ok := s.devices[q.DeviceID]
+	if !ok {
+		return result, nil
+	}
+	for i := range r.points {
+		p := r.points[(r.start+i)%len(r.points)]
+		if !q.matches(p) {
+			continue
+		}
+		result = append(result, p)
+		if q.Limit > 0 && len(result) == q.Limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// DeleteDevice удаляет историю устройства
+func (s *MemoryStore) DeleteDevice(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.devices, id)
+	return nil
+}
+
+// put добавляет точку с назначенным Seq. Вызывается под s.mu.
+func (s *MemoryStore) put(p Point) {
+	r, ok := s.devices[p.DeviceID]
+	if !ok {
+		r = &ring{}
+		s.devices[p.DeviceID] = r
+	}
+	if len(r.points) < s.capacity {
+		r.points = append(r.points, p)
+		return
+	}
+	r.points[r.start] = p
+	r.start = (r.start + 1) % len(r.points)
+}
+
+// restore добавляет прочитанную с диска точку, сохраняя ее Seq
+func (s *MemoryStore) restore(p Point) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p.Seq > s.seq {
+		s.seq = p.Seq
+	}
+	s.put(p)
+}
+
+// all возвращает все точки для перезаписи FileStore
+func (s *MemoryStore) all() []Point {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []Point
+	for _, r := range s.devices {
+		for i := range r.points {
+			result = append(result, r.points[(r.start+i)%len(r.points)])
+		}
+	}
+	return result
+}
+
+// size возвращает число хранимых точек
+func (s *MemoryStore) size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := 0
+	for _, r := range s.devices {
+		n += len(r.points)
+	}
+	return n
+}
@@ -0,0 +1,130 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// DefaultRetention - срок хранения истории в PostgresStore по умолчанию
+	DefaultRetention = 30 * 24 * time.Hour
+
+	// pruneInterval - период удаления устаревшей истории
+	pruneInterval = time.Hour
+
+	queryTimeout = 5 * time.Second
+)
+
+// PostgresStore хранит историю в таблице device_history. Схема создается
+// миграциями datastore.Migrate; точки старше Retention удаляются раз в час
+// при записи.
+type PostgresStore struct {
+	db        *sql.DB
+	retention time.Duration
+	now       func() time.Time
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+// NewPostgresStore создает хранилище истории в базе db (retention 0 -
+// DefaultRetention)
+func NewPostgresStore(db *sql.DB, retention time.Duration) *PostgresStore {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	return &PostgresStore{db: db, retention: retention, now: time.Now}
+}
+
+// Append записывает точки одним запросом
+func (s *PostgresStore) Append(points []Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+	s.prune()
+
+	var (
+		query strings.Builder
+		args  = make([]interface{}, 0, 4*len(points))
+	)
+	query.WriteString(`INSERT INTO device_history (device_id, parameter, value, recorded_at) VALUES `)
+	for i, p := range points {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4)
+		args = append(args, p.DeviceID, p.Parameter, p.Value, p.Time)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query.String(), args...)
+	return err
+}
+
+// Query возвращает точки устройства в порядке Seq
+func (s *PostgresStore) Query(q Query) ([]Point, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT seq, parameter, value, recorded_at FROM device_history
+WHERE device_id = $1 AND recorded_at >= $2 AND recorded_at < $3 AND seq > $4
+  AND (cardinality($5::text[]) = 0 OR parameter = ANY($5))
+ORDER BY seq
+LIMIT NULLIF($6, 0)`,
+		q.DeviceID, q.From, q.To, q.AfterSeq, pq.Array(q.Parameters), q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []Point{}
+	for rows.Next() {
+		p := Point{DeviceID: q.DeviceID}
+		if err := rows.Scan(&p.Seq, &p.Parameter, &p.Value, &p.Time); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// DeleteDevice удаляет историю устройства
+func (s *PostgresStore) DeleteDevice(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM device_history WHERE device_id = $1`, id)
+	return err
+}
+
+// prune удаляет точки старше срока хранения, если с прошлого удаления
+// прошло больше pruneInterval
+func (s *PostgresStore) prune() {
+	now := s.now()
+
+	s.mu.Lock()
+	if now.Sub(s.lastPruned) < pruneInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPruned = now
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM device_history WHERE recorded_at < $1`, now.Add(-s.retention)); err != nil {
+		log.Printf("History: failed to prune: %v", err)
+	}
+}
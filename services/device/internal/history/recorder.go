@@ -0,0 +1,164 @@
+package history
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+)
+
+// Recorder записывает в историю изменения параметров и состояния в сети
+// устройств, сохраненные через него. Ошибка записи истории не прерывает
+// изменение устройства и только логируется.
+type Recorder struct {
+	datastore.DeviceStore
+
+	history Store
+	now     func() time.Time
+
+	// Чтение состояния до и после изменения выполняется под одной
+	// блокировкой, чтобы изменения не смешивались
+	mu sync.Mutex
+}
+
+// NewRecorder оборачивает хранилище записью изменений в history
+func NewRecorder(store datastore.DeviceStore, history Store) *Recorder {
+	return &Recorder{
+		DeviceStore: store,
+		history:     history,
+		now:         time.Now,
+	}
+}
+
+// SaveDevice сохраняет устройство и записывает изменившиеся параметры.
+// Для нового устройства записываются все параметры.
+func (r *Recorder) SaveDevice(device *model.Device) error {
+	return r.record(device.ID, func() error { return r.DeviceStore.SaveDevice(device) })
+}
+
+// UpdateDeviceStatus обновляет статус устройства и записывает изменения
+func (r *Recorder) UpdateDeviceStatus(id string, status *model.DeviceStatus) error {
+	return r.record(id, func() error { return r.DeviceStore.UpdateDeviceStatus(id, status) })
+}
+
+// UpdateDeviceParameter обновляет параметр устройства и записывает изменение
+func (r *Recorder) UpdateDeviceParameter(id, key, value string) error {
+	return r.record(id, func() error { return r.DeviceStore.UpdateDeviceParameter(id, key, value) })
+}
+
+// DeleteDevice удаляет устройство вместе с историей
+func (r *Recorder) DeleteDevice(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.DeviceStore.DeleteDevice(id); err != nil {
+		return err
+	}
+	if err := r.history.DeleteDevice(id); err != nil {
+		log.Printf("History: failed to delete history of device %s: %v", id, err)
+	}
+	return nil
+}
+
+// AddTestDevices добавляет тестовые устройства и записывает их начальное
+// состояние, чтобы история демонстрационных устройств не была пустой
+func (r *Recorder) AddTestDevices() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing := map[string]bool{}
+	devices, err := r.DeviceStore.ListDevices("", false)
+	if err != nil {
+		log.Printf("History: failed to list devices before seeding: %v", err)
+	}
+	for _, device := range devices {
+		existing[device.ID] = true
+	}
+
+	r.DeviceStore.AddTestDevices()
+
+	devices, err = r.DeviceStore.ListDevices("", false)
+	if err != nil {
+		log.Printf("History: failed to list seeded devices: %v", err)
+		return
+	}
+	now := r.now()
+	var points []Point
+	for _, device := range devices {
+		if !existing[device.ID] {
+			points = append(points, diff(nil, device, now)...)
+		}
+	}
+	if len(points) == 0 {
+		return
+	}
+	if err := r.history.Append(points); err != nil {
+		log.Printf("History: failed to record seeded devices: %v", err)
+	}
+}
+
+// record выполняет изменение устройства id и записывает разницу состояний
+func (r *Recorder) record(id string, change func() error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before, _ := r.DeviceStore.GetDevice(id) // nil для нового устройства
+	if err := change(); err != nil {
+		return err
+	}
+	after, err := r.DeviceStore.GetDevice(id)
+	if err != nil {
+		log.Printf("History: failed to read device %s after update: %v", id, err)
+		return nil
+	}
+
+	points := diff(before, after, r.now())
+	if len(points) == 0 {
+		return nil
+	}
+	if err := r.history.Append(points); err != nil {
+		log.Printf("History: failed to record device %s: %v", id, err)
+	}
+	return nil
+}
+
+// diff возвращает точки для параметров, значение которых изменилось
+// (before nil - новое устройство)
+func diff(before, after *model.Device, now time.Time) []Point {
+	current := values(after)
+	previous := map[string]string{}
+	if before != nil {
+		previous = values(before)
+	}
+
+	names := make([]string, 0, len(current))
+	for name, value := range current {
+		if old, ok := previous[name]; !ok || old != value {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	points := make([]Point, 0, len(names))
+	for _, name := range names {
+		points = append(points, Point{DeviceID: after.ID, Parameter: name, Value: current[name], Time: now})
+	}
+	return points
+}
+
+// values возвращает параметры устройства вместе с model.ParamOnline
+func values(device *model.Device) map[string]string {
+	result := map[string]string{}
+	if device.Status == nil {
+		return result
+	}
+	for k, v := range device.Status.Parameters {
+		result[k] = v
+	}
+	result[model.ParamOnline] = strconv.FormatBool(device.Status.Online)
+	return result
+}
@@ -0,0 +1,79 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+)
+
+func TestRecorder(t *testing.T) {
+	history := NewMemoryStore(0)
+	recorder := NewRecorder(datastore.NewMemoryStore(), history)
+	clock := start
+	recorder.now = func() time.Time { return clock }
+
+	sensor := model.NewDevice("Датчик", model.DeviceTypeSensor, "Aqara", "Спальня")
+	sensor.Status.Parameters[model.ParamTemperature] = "21"
+	if err := recorder.SaveDevice(sensor); err != nil {
+		t.Fatal(err)
+	}
+
+	clock = clock.Add(time.Minute)
+	if err := recorder.UpdateDeviceParameter(sensor.ID, model.ParamTemperature, "20.5"); err != nil {
+		t.Fatal(err)
+	}
+	// Значение не изменилось - точка не записывается
+	if err := recorder.UpdateDeviceParameter(sensor.ID, model.ParamTemperature, "20.5"); err != nil {
+		t.Fatal(err)
+	}
+	clock = clock.Add(time.Minute)
+	status := &model.DeviceStatus{Online: false, Parameters: map[string]string{model.ParamTemperature: "20.5"}}
+	if err := recorder.UpdateDeviceStatus(sensor.ID, status); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := history.Query(Query{DeviceID: sensor.ID, From: start, To: start.Add(time.Hour)})
+	want := []string{"online=true", "temperature=21", "temperature=20.5", "online=false"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d points, got %+v", len(want), got)
+	}
+	for i, p := range got {
+		if p.Parameter+"="+p.Value != want[i] {
+			t.Errorf("point %d = %s=%s, want %s", i, p.Parameter, p.Value, want[i])
+		}
+	}
+	if !got[3].Time.Equal(start.Add(2 * time.Minute)) {
+		t.Errorf("Unexpected point time: %s", got[3].Time)
+	}
+
+	// Ошибка изменения не записывается, история удаляется вместе с устройством
+	if err := recorder.UpdateDeviceParameter("missing", model.ParamTemperature, "1"); err == nil {
+		t.Error("Expected error for missing device")
+	}
+	if err := recorder.DeleteDevice(sensor.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := history.Query(Query{DeviceID: sensor.ID, From: start, To: start.Add(time.Hour)}); len(got) != 0 {
+		t.Errorf("History after DeleteDevice: %+v", got)
+	}
+}
+
+func TestRecorder_AddTestDevices(t *testing.T) {
+	history := NewMemoryStore(0)
+	recorder := NewRecorder(datastore.NewMemoryStore(), history)
+	recorder.now = func() time.Time { return start }
+
+	recorder.AddTestDevices()
+	devices, err := recorder.ListDevices("", false)
+	if err != nil || len(devices) == 0 {
+		t.Fatalf("ListDevices: %d devices, %v", len(devices), err)
+	}
+	for _, device := range devices {
+		got, _ := history.Query(Query{DeviceID: device.ID, From: start, To: start.Add(time.Minute)})
+		if len(got) != len(values(device)) {
+			t.Errorf("device %s: %d points, want %d", device.Name, len(got), len(values(device)))
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+)
+
+var start = time.Date(2026, 5, 4, 0, 0, 0, 0, time.UTC)
+
+// testStore проверяет общее поведение хранилищ истории
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+
+	var points []Point
+	for i := 0; i < 6; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		points = append(points,
+			Point{DeviceID: "sensor-1", Parameter: "temperature", Value: strconv.Itoa(i), Time: at},
+			Point{DeviceID: "sensor-1", Parameter: "humidity", Value: "40", Time: at},
+		)
+	}
+	points = append(points, Point{DeviceID: "lamp-1", Parameter: "power", Value: "on", Time: start})
+	if err := store.Append(points); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	all := Query{DeviceID: "sensor-1", From: start, To: start.Add(time.Hour)}
+	got, err := store.Query(all)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(got) != 12 || got[0].Parameter != "temperature" || got[0].Value != "0" || !got[0].Time.Equal(start) {
+		t.Fatalf("Unexpected points: %+v", got)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Seq <= got[i-1].Seq {
+			t.Fatalf("Points are not ordered by Seq: %+v", got)
+		}
+	}
+
+	// Период, параметр и страницы
+	q := Query{
+		DeviceID:   "sensor-1",
+		From:       start.Add(time.Minute),
+		To:         start.Add(5 * time.Minute),
+		Parameters: []string{"temperature"},
+		Limit:      3,
+	}
+	page, err := store.Query(q)
+	if err != nil || len(page) != 3 || page[0].Value != "1" || page[2].Value != "3" {
+		t.Fatalf("Unexpected first page: %+v %v", page, err)
+	}
+	q.AfterSeq = page[2].Seq
+	page, err = store.Query(q)
+	if err != nil || len(page) != 1 || page[0].Value != "4" {
+		t.Fatalf("Unexpected second page: %+v %v", page, err)
+	}
+
+	if err := store.DeleteDevice("sensor-1"); err != nil {
+		t.Fatalf("DeleteDevice failed: %v", err)
+	}
+	if got, err := store.Query(all); err != nil || len(got) != 0 {
+		t.Errorf("History after DeleteDevice: %+v %v", got, err)
+	}
+	if got, _ := store.Query(Query{DeviceID: "lamp-1", From: start, To: start.Add(time.Hour)}); len(got) != 1 {
+		t.Errorf("DeleteDevice removed other device history: %+v", got)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(0))
+}
+
+func TestMemoryStore_Capacity(t *testing.T) {
+	store := NewMemoryStore(3)
+	for i := 0; i < 5; i++ {
+		store.Append([]Point{{DeviceID: "sensor-1", Parameter: "temperature", Value: strconv.Itoa(i), Time: start.Add(time.Duration(i) * time.Second)}})
+	}
+	got, _ := store.Query(Query{DeviceID: "sensor-1", From: start, To: start.Add(time.Hour)})
+	if len(got) != 3 || got[0].Value != "2" || got[2].Value != "4" {
+		t.Errorf("Expected the last 3 points, got %+v", got)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(FileConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	testStore(t, store)
+}
+
+func TestFileStore_Recover(t *testing.T) {
+	config := FileConfig{Dir: t.TempDir(), Capacity: 4}
+	store, err := NewFileStore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Журнал перезаписывается, когда вытесненных точек становится много
+	for i := 0; i < 20; i++ {
+		point := Point{DeviceID: "sensor-1", Parameter: "temperature", Value: string(rune('a' + i)), Time: start.Add(time.Duration(i) * time.Second)}
+		if err := store.Append([]Point{point}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Append([]Point{{DeviceID: "lamp-1", Parameter: "power", Value: "on", Time: start}})
+	store.DeleteDevice("lamp-1")
+	store.Close()
+
+	// Оборванная последняя строка пропускается
+	f, err := os.OpenFile(filepath.Join(config.Dir, fileName), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":99,"device_id":"sens`)
+	f.Close()
+
+	store, err = NewFileStore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	got, _ := store.Query(Query{DeviceID: "sensor-1", From: start, To: start.Add(time.Hour)})
+	if len(got) != 4 || got[0].Value != "q" || got[3].Value != "t" {
+		t.Errorf("Unexpected points after reopen: %+v", got)
+	}
+	if got, _ := store.Query(Query{DeviceID: "lamp-1", From: start, To: start.Add(time.Hour)}); len(got) != 0 {
+		t.Errorf("Deleted history recovered: %+v", got)
+	}
+
+	// Seq продолжается после восстановленных точек
+	store.Append([]Point{{DeviceID: "sensor-1", Parameter: "temperature", Value: "u", Time: start.Add(time.Minute)}})
+	got, _ = store.Query(Query{DeviceID: "sensor-1", From: start, To: start.Add(time.Hour), AfterSeq: got[3].Seq})
+	if len(got) != 1 || got[0].Value != "u" {
+		t.Errorf("Unexpected points after append: %+v", got)
+	}
+}
+
+// Тест PostgresStore выполняется, если задана DEVICE_TEST_POSTGRES_DSN
+// (см. datastore.TestPostgresStore). Таблица device_history очищается.
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("DEVICE_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("DEVICE_TEST_POSTGRES_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := datastore.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if _, err := db.Exec(`TRUNCATE device_history`); err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, NewPostgresStore(db, 0))
+}
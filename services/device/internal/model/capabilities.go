@@ -0,0 +1,269 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+)
+
+// ParameterKind - тип значения параметра устройства. Значения параметров
+// хранятся строками, тип определяет допустимый формат.
+type ParameterKind string
+
+const (
+	KindEnum      ParameterKind = "enum"      // Одно из Values
+	KindInteger   ParameterKind = "integer"   // Целое число в диапазоне Min..Max
+	KindNumber    ParameterKind = "number"    // Число в диапазоне Min..Max
+	KindColor     ParameterKind = "color"     // Цвет в формате #RRGGBB
+	KindTimestamp ParameterKind = "timestamp" // Unix-время в секундах
+)
+
+// ParameterSpec описывает параметр статуса устройства
+type ParameterSpec struct {
+	Name        string
+	Kind        ParameterKind
+	Description string
+	Unit        string   // Единица измерения (пусто - без единицы)
+	Min, Max    *float64 // Диапазон для integer и number (nil - без ограничения)
+	Values      []string // Допустимые значения для enum
+	ReadOnly    bool     // Параметр сообщает устройство, командой он не задается
+}
+
+// ActionSpec описывает команду, поддерживаемую типом устройства.
+// Команда изменяет параметр Parameter: на фиксированное значение Value
+// (turn_on, turn_off) или на значение из параметров команды (set_level).
+type ActionSpec struct {
+	Name        string
+	Description string
+	Parameter   string
+	Value       string // Фиксированное значение (пусто - из параметров команды)
+}
+
+// TypeSpec описывает возможности типа устройства
+type TypeSpec struct {
+	Type        string
+	Description string
+	Actions     []ActionSpec
+	Parameters  []ParameterSpec
+}
+
+// Action возвращает описание команды типа
+func (t *TypeSpec) Action(name string) (*ActionSpec, bool) {
+	for i := range t.Actions {
+		if t.Actions[i].Name == name {
+			return &t.Actions[i], true
+		}
+	}
+	return nil, false
+}
+
+// Parameter возвращает описание параметра типа
+func (t *TypeSpec) Parameter(name string) (*ParameterSpec, bool) {
+	for i := range t.Parameters {
+		if t.Parameters[i].Name == name {
+			return &t.Parameters[i], true
+		}
+	}
+	return nil, false
+}
+
+// ActionNames возвращает имена поддерживаемых команд
+func (t *TypeSpec) ActionNames() []string {
+	names := make([]string, 0, len(t.Actions))
+	for _, action := range t.Actions {
+		names = append(names, action.Name)
+	}
+	return names
+}
+
+// ToProto конвертирует TypeSpec в protobuf-представление
+func (t *TypeSpec) ToProto() *pb.DeviceType {
+	result := &pb.DeviceType{
+		Type:        t.Type,
+		Description: t.Description,
+		Actions:     make([]*pb.DeviceAction, 0, len(t.Actions)),
+		Parameters:  make([]*pb.DeviceParameter, 0, len(t.Parameters)),
+	}
+	for _, action := range t.Actions {
+		result.Actions = append(result.Actions, &pb.DeviceAction{
+			Name:        action.Name,
+			Description: action.Description,
+			Parameter:   action.Parameter,
+			Value:       action.Value,
+		})
+	}
+	for _, param := range t.Parameters {
+		result.Parameters = append(result.Parameters, &pb.DeviceParameter{
+			Name:        param.Name,
+			Kind:        string(param.Kind),
+			Description: param.Description,
+			Unit:        param.Unit,
+			Min:         param.Min,
+			Max:         param.Max,
+			Values:      param.Values,
+			ReadOnly:    param.ReadOnly,
+		})
+	}
+	return result
+}
+
+var colorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// Validate проверяет значение параметра. Текст ошибки описывает ожидаемый
+// формат и подходит для ответа клиенту.
+func (p *ParameterSpec) Validate(value string) error {
+	switch p.Kind {
+	case KindEnum:
+		for _, v := range p.Values {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(p.Values, ", "))
+
+	case KindInteger:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || !p.inRange(float64(n)) {
+			return fmt.Errorf("must be an integer%s", p.rangeText())
+		}
+
+	case KindNumber:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) || !p.inRange(n) {
+			return fmt.Errorf("must be a number%s", p.rangeText())
+		}
+
+	case KindColor:
+		if !colorPattern.MatchString(value) {
+			return fmt.Errorf("must be a color in #RRGGBB format")
+		}
+
+	case KindTimestamp:
+		if n, err := strconv.ParseInt(value, 10, 64); err != nil || n < 0 {
+			return fmt.Errorf("must be a Unix timestamp in seconds")
+		}
+	}
+	return nil
+}
+
+func (p *ParameterSpec) inRange(n float64) bool {
+	return (p.Min == nil || n >= *p.Min) && (p.Max == nil || n <= *p.Max)
+}
+
+// rangeText описывает диапазон для сообщения об ошибке
+func (p *ParameterSpec) rangeText() string {
+	unit := ""
+	if p.Unit != "" {
+		unit = " " + p.Unit
+	}
+	format := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+
+	switch {
+	case p.Min != nil && p.Max != nil:
+		return fmt.Sprintf(" between %s and %s%s", format(*p.Min), format(*p.Max), unit)
+	case p.Min != nil:
+		return fmt.Sprintf(" not less than %s%s", format(*p.Min), unit)
+	case p.Max != nil:
+		return fmt.Sprintf(" not greater than %s%s", format(*p.Max), unit)
+	}
+	return ""
+}
+
+// Capabilities возвращает описание типа устройства
+func Capabilities(deviceType string) (*TypeSpec, bool) {
+	spec, ok := capabilities[deviceType]
+	return spec, ok
+}
+
+// AllCapabilities возвращает описания всех типов в порядке DeviceTypes
+func AllCapabilities() []*TypeSpec {
+	specs := make([]*TypeSpec, 0, len(DeviceTypes))
+	for _, deviceType := range DeviceTypes {
+		specs = append(specs, capabilities[deviceType])
+	}
+	return specs
+}
+
+func bound(f float64) *float64 { return &f }
+
+// Общие параметры и команды
+var (
+	powerParam = ParameterSpec{Name: ParamPower, Kind: KindEnum, Description: "Питание", Values: []string{"on", "off"}}
+
+	turnOnAction  = ActionSpec{Name: CommandTurnOn, Description: "Включить", Parameter: ParamPower, Value: "on"}
+	turnOffAction = ActionSpec{Name: CommandTurnOff, Description: "Выключить", Parameter: ParamPower, Value: "off"}
+)
+
+// capabilities - реестр возможностей по типам устройств
+var capabilities = map[string]*TypeSpec{
+	DeviceTypeLamp: {
+		Type:        DeviceTypeLamp,
+		Description: "Лампа",
+		Actions: []ActionSpec{
+			turnOnAction,
+			turnOffAction,
+			{Name: CommandSetLevel, Description: "Установить яркость", Parameter: ParamLevel},
+			{Name: CommandSetColor, Description: "Установить цвет", Parameter: ParamColor},
+		},
+		Parameters: []ParameterSpec{
+			powerParam,
+			{Name: ParamLevel, Kind: KindInteger, Description: "Яркость", Unit: "%", Min: bound(0), Max: bound(100)},
+			{Name: ParamColor, Kind: KindColor, Description: "Цвет"},
+		},
+	},
+	DeviceTypeSocket: {
+		Type:        DeviceTypeSocket,
+		Description: "Розетка",
+		Actions:     []ActionSpec{turnOnAction, turnOffAction},
+		Parameters:  []ParameterSpec{powerParam},
+	},
+	DeviceTypeThermostat: {
+		Type:        DeviceTypeThermostat,
+		Description: "Термостат",
+		Actions: []ActionSpec{
+			turnOnAction,
+			turnOffAction,
+			{Name: CommandSetTemp, Description: "Установить температуру", Parameter: ParamTemperature},
+			{Name: CommandSetMode, Description: "Установить режим", Parameter: ParamMode},
+		},
+		Parameters: []ParameterSpec{
+			powerParam,
+			{Name: ParamTemperature, Kind: KindNumber, Description: "Целевая температура", Unit: "°C", Min: bound(5), Max: bound(35)},
+			{Name: ParamMode, Kind: KindEnum, Description: "Режим", Values: []string{"auto", "heat", "cool", "eco"}},
+			{Name: ParamHumidity, Kind: KindNumber, Description: "Влажность", Unit: "%", Min: bound(0), Max: bound(100), ReadOnly: true},
+		},
+	},
+	DeviceTypeSensor: {
+		Type:        DeviceTypeSensor,
+		Description: "Датчик",
+		Parameters: []ParameterSpec{
+			{Name: ParamLastMotion, Kind: KindTimestamp, Description: "Последнее движение", ReadOnly: true},
+			{Name: ParamTemperature, Kind: KindNumber, Description: "Температура", Unit: "°C", ReadOnly: true},
+			{Name: ParamHumidity, Kind: KindNumber, Description: "Влажность", Unit: "%", Min: bound(0), Max: bound(100), ReadOnly: true},
+			{Name: ParamContact, Kind: KindEnum, Description: "Датчик открытия (дверь, окно)", Values: []string{"open", "closed"}, ReadOnly: true},
+		},
+	},
+	DeviceTypeSwitch: {
+		Type:        DeviceTypeSwitch,
+		Description: "Выключатель",
+		Actions:     []ActionSpec{turnOnAction, turnOffAction},
+		Parameters:  []ParameterSpec{powerParam},
+	},
+	DeviceTypeCamera: {
+		Type:        DeviceTypeCamera,
+		Description: "Камера",
+		Actions: []ActionSpec{
+			turnOnAction,
+			turnOffAction,
+			{Name: CommandSetMode, Description: "Установить режим записи", Parameter: ParamMode},
+		},
+		Parameters: []ParameterSpec{
+			powerParam,
+			{Name: ParamMode, Kind: KindEnum, Description: "Режим записи", Values: []string{"continuous", "motion", "schedule"}},
+		},
+	},
+}
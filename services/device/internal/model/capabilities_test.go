@@ -0,0 +1,78 @@
+package model
+
+import "testing"
+
+func TestParameterSpec_Validate(t *testing.T) {
+	lamp, _ := Capabilities(DeviceTypeLamp)
+	thermostat, _ := Capabilities(DeviceTypeThermostat)
+	sensor, _ := Capabilities(DeviceTypeSensor)
+
+	param := func(spec *TypeSpec, name string) *ParameterSpec {
+		p, ok := spec.Parameter(name)
+		if !ok {
+			t.Fatalf("%s has no parameter %s", spec.Type, name)
+		}
+		return p
+	}
+
+	tests := []struct {
+		name  string
+		param *ParameterSpec
+		value string
+		valid bool
+	}{
+		{"LevelInRange", param(lamp, ParamLevel), "80", true},
+		{"LevelBounds", param(lamp, ParamLevel), "0", true},
+		{"LevelNotNumber", param(lamp, ParamLevel), "banana", false},
+		{"LevelFraction", param(lamp, ParamLevel), "50.5", false},
+		{"LevelTooHigh", param(lamp, ParamLevel), "101", false},
+		{"Color", param(lamp, ParamColor), "#FFaa00", true},
+		{"ColorName", param(lamp, ParamColor), "red", false},
+		{"Power", param(lamp, ParamPower), "off", true},
+		{"PowerUnknown", param(lamp, ParamPower), "maybe", false},
+		{"Temperature", param(thermostat, ParamTemperature), "22.5", true},
+		{"TemperatureTooLow", param(thermostat, ParamTemperature), "-3", false},
+		{"TemperatureNaN", param(thermostat, ParamTemperature), "NaN", false},
+		{"Mode", param(thermostat, ParamMode), "eco", true},
+		{"ModeUnknown", param(thermostat, ParamMode), "turbo", false},
+		{"LastMotion", param(sensor, ParamLastMotion), "1714580400", true},
+		{"LastMotionNegative", param(sensor, ParamLastMotion), "-1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.param.Validate(tt.value)
+			if (err == nil) != tt.valid {
+				t.Errorf("Validate(%q) = %v, want valid=%v", tt.value, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCapabilities_Consistent(t *testing.T) {
+	specs := AllCapabilities()
+	if len(specs) != len(DeviceTypes) {
+		t.Fatalf("expected %d types, got %d", len(DeviceTypes), len(specs))
+	}
+
+	for i, spec := range specs {
+		if spec == nil || spec.Type != DeviceTypes[i] {
+			t.Fatalf("missing capabilities for %s", DeviceTypes[i])
+		}
+		for _, action := range spec.Actions {
+			param, ok := spec.Parameter(action.Parameter)
+			if !ok {
+				t.Errorf("%s.%s changes unknown parameter %s", spec.Type, action.Name, action.Parameter)
+				continue
+			}
+			if param.ReadOnly {
+				t.Errorf("%s.%s changes read-only parameter %s", spec.Type, action.Name, action.Parameter)
+			}
+			if action.Value != "" {
+				if err := param.Validate(action.Value); err != nil {
+					t.Errorf("%s.%s sets invalid value %q: %v", spec.Type, action.Name, action.Value, err)
+				}
+			}
+		}
+	}
+}
@@ -18,6 +18,26 @@ const (
 	DeviceTypeCamera     = "camera"
 )
 
+// DeviceTypes - поддерживаемые типы устройств
+var DeviceTypes = []string{
+	DeviceTypeLamp,
+	DeviceTypeSocket,
+	DeviceTypeThermostat,
+	DeviceTypeSensor,
+	DeviceTypeSwitch,
+	DeviceTypeCamera,
+}
+
+// IsKnownType проверяет, что тип устройства поддерживается
+func IsKnownType(deviceType string) bool {
+	for _, t := range DeviceTypes {
+		if t == deviceType {
+			return true
+		}
+	}
+	return false
+}
+
 // Константы для команд
 const (
 	CommandTurnOn    = "turn_on"
@@ -40,6 +60,7 @@ const (
 	ParamColor       = "color"
 	ParamMode        = "mode"
 	ParamLastMotion  = "last_motion"
+	ParamContact     = "contact"
 )
 
 // Device представляет устройство умного дома в системе
@@ -48,10 +69,12 @@ type Device struct {
 	Name        string        // Имя устройства
 	Type        string        // Тип устройства
 	Model       string        // Модель устройства
-	Room        string        // Комната/расположение
+	Room        string        // Комната/расположение (для устройства в комнате RoomID - имя комнаты)
+	RoomID      string        // ID комнаты (пусто - устройство не привязано к комнате)
 	Status      *DeviceStatus // Текущий статус устройства
 	Tags        []string      // Теги устройства
 	LastUpdated time.Time     // Время последнего обновления
+	Version     int64         // Версия записи в хранилище для оптимистичной блокировки (0 - не сохранено)
 }
 
 // DeviceStatus представляет текущий статус устройства
@@ -86,6 +109,31 @@ func NewDeviceStatus() *DeviceStatus {
 	}
 }
 
+// Clone возвращает глубокую копию устройства
+func (d *Device) Clone() *Device {
+	clone := *d
+	clone.Status = d.Status.Clone()
+	if d.Tags != nil {
+		clone.Tags = append([]string{}, d.Tags...)
+	}
+	return &clone
+}
+
+// Clone возвращает глубокую копию статуса (nil для nil)
+func (s *DeviceStatus) Clone() *DeviceStatus {
+	if s == nil {
+		return nil
+	}
+	clone := *s
+	if s.Parameters != nil {
+		clone.Parameters = make(map[string]string, len(s.Parameters))
+		for k, v := range s.Parameters {
+			clone.Parameters[k] = v
+		}
+	}
+	return &clone
+}
+
 // ToProto конвертирует Device в protobuf-представление
 func (d *Device) ToProto() *pb.Device {
 	return &pb.Device{
@@ -96,6 +144,7 @@ func (d *Device) ToProto() *pb.Device {
 		Room:   d.Room,
 		Status: d.Status.ToProto(),
 		Tags:   d.Tags,
+		RoomId: d.RoomID,
 	}
 }
 
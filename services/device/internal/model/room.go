@@ -0,0 +1,66 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+)
+
+// Room представляет комнату дома. Устройство относится к комнате через
+// Device.RoomID.
+type Room struct {
+	ID      string   // Уникальный идентификатор комнаты
+	Name    string   // Отображаемое имя
+	Aliases []string // Другие названия, в том числе падежные формы ("кухне")
+	Floor   int32    // Этаж
+	Icon    string   // Имя значка для интерфейса
+}
+
+// NewRoom создает новую комнату с уникальным ID
+func NewRoom(name string, floor int32, icon string, aliases ...string) *Room {
+	return &Room{
+		ID:      uuid.New().String(),
+		Name:    name,
+		Aliases: append([]string{}, aliases...),
+		Floor:   floor,
+		Icon:    icon,
+	}
+}
+
+// Clone возвращает глубокую копию комнаты
+func (r *Room) Clone() *Room {
+	clone := *r
+	if r.Aliases != nil {
+		clone.Aliases = append([]string{}, r.Aliases...)
+	}
+	return &clone
+}
+
+// Names возвращает имя и псевдонимы комнаты
+func (r *Room) Names() []string {
+	return append([]string{r.Name}, r.Aliases...)
+}
+
+// Matches проверяет, совпадает ли name с именем или псевдонимом комнаты
+// без учета регистра
+func (r *Room) Matches(name string) bool {
+	name = strings.TrimSpace(name)
+	for _, n := range r.Names() {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ToProto конвертирует Room в protobuf-представление
+func (r *Room) ToProto() *pb.Room {
+	return &pb.Room{
+		Id:      r.ID,
+		Name:    r.Name,
+		Aliases: r.Aliases,
+		Floor:   r.Floor,
+		Icon:    r.Icon,
+	}
+}
@@ -0,0 +1,235 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+)
+
+// Типы триггеров правила
+const (
+	TriggerParameterChanged = "parameter_changed"
+	TriggerTime             = "time"
+	TriggerDeviceOffline    = "device_offline"
+)
+
+// Типы условий правила
+const (
+	ConditionDeviceState = "device_state"
+	ConditionTimeWindow  = "time_window"
+)
+
+// Типы действий правила
+const (
+	ActionControl = "control"
+	ActionScene   = "scene"
+	ActionDelay   = "delay"
+)
+
+// ParamOnline - псевдопараметр условия device_state: состояние в сети
+// ("true" или "false")
+const ParamOnline = "online"
+
+// Weekdays - дни недели триггера времени в порядке time.Weekday
+var Weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Rule представляет правило автоматизации: при срабатывании любого
+// триггера и выполнении всех условий действия выполняются по порядку
+type Rule struct {
+	ID         string
+	Name       string
+	Enabled    bool
+	Triggers   []RuleTrigger
+	Conditions []RuleCondition
+	Actions    []RuleAction
+	Cooldown   time.Duration // Минимальный интервал между запусками (0 - без ограничения)
+}
+
+// RuleTrigger - событие, запускающее правило. Используемые поля зависят от Type.
+type RuleTrigger struct {
+	Type      string
+	DeviceID  string   // TriggerParameterChanged, TriggerDeviceOffline
+	Parameter string   // TriggerParameterChanged
+	Value     string   // TriggerParameterChanged: переход к значению (пусто - любое изменение)
+	Time      string   // TriggerTime: HH:MM
+	Days      []string // TriggerTime: дни из Weekdays (пусто - каждый день)
+}
+
+// RuleCondition - условие запуска правила. Используемые поля зависят от Type.
+type RuleCondition struct {
+	Type      string
+	DeviceID  string // ConditionDeviceState
+	Parameter string // ConditionDeviceState: параметр или ParamOnline
+	Operator  string // ConditionDeviceState: eq, ne, gt, gte, lt, lte
+	Value     string // ConditionDeviceState
+	After     string // ConditionTimeWindow: HH:MM
+	Before    string // ConditionTimeWindow: HH:MM
+}
+
+// RuleAction - действие правила. Используемые поля зависят от Type.
+type RuleAction struct {
+	Type       string
+	DeviceID   string            // ActionControl
+	Command    string            // ActionControl: действие команды
+	Parameters map[string]string // ActionControl: параметры команды
+	SceneID    string            // ActionScene
+	Delay      time.Duration     // ActionDelay
+}
+
+// NewRule создает новое правило с уникальным ID
+func NewRule(name string) *Rule {
+	return &Rule{
+		ID:      uuid.New().String(),
+		Name:    name,
+		Enabled: true,
+	}
+}
+
+// Clone возвращает глубокую копию правила
+func (r *Rule) Clone() *Rule {
+	clone := *r
+	clone.Triggers = make([]RuleTrigger, 0, len(r.Triggers))
+	for _, trigger := range r.Triggers {
+		trigger.Days = append([]string{}, trigger.Days...)
+		clone.Triggers = append(clone.Triggers, trigger)
+	}
+	clone.Conditions = append([]RuleCondition{}, r.Conditions...)
+	clone.Actions = make([]RuleAction, 0, len(r.Actions))
+	for _, action := range r.Actions {
+		action.Parameters = copyParameters(action.Parameters)
+		clone.Actions = append(clone.Actions, action)
+	}
+	return &clone
+}
+
+// ToProto конвертирует Rule в protobuf-представление
+func (r *Rule) ToProto() *pb.Rule {
+	result := &pb.Rule{
+		Id:              r.ID,
+		Name:            r.Name,
+		Enabled:         r.Enabled,
+		Triggers:        make([]*pb.RuleTrigger, 0, len(r.Triggers)),
+		Conditions:      make([]*pb.RuleCondition, 0, len(r.Conditions)),
+		Actions:         make([]*pb.RuleAction, 0, len(r.Actions)),
+		CooldownSeconds: int32(r.Cooldown / time.Second),
+	}
+	for _, t := range r.Triggers {
+		result.Triggers = append(result.Triggers, &pb.RuleTrigger{
+			Type:      t.Type,
+			DeviceId:  t.DeviceID,
+			Parameter: t.Parameter,
+			Value:     t.Value,
+			Time:      t.Time,
+			Days:      t.Days,
+		})
+	}
+	for _, c := range r.Conditions {
+		result.Conditions = append(result.Conditions, &pb.RuleCondition{
+			Type:      c.Type,
+			DeviceId:  c.DeviceID,
+			Parameter: c.Parameter,
+			Operator:  c.Operator,
+			Value:     c.Value,
+			After:     c.After,
+			Before:    c.Before,
+		})
+	}
+	for _, a := range r.Actions {
+		action := &pb.RuleAction{
+			Type:         a.Type,
+			DeviceId:     a.DeviceID,
+			SceneId:      a.SceneID,
+			DelaySeconds: int32(a.Delay / time.Second),
+		}
+		if a.Type == ActionControl {
+			action.Command = &pb.Command{DeviceId: a.DeviceID, Action: a.Command, Parameters: a.Parameters}
+		}
+		result.Actions = append(result.Actions, action)
+	}
+	return result
+}
+
+// RuleFromProto конвертирует правило из protobuf-представления
+func RuleFromProto(rule *pb.Rule) *Rule {
+	result := &Rule{
+		ID:       rule.GetId(),
+		Name:     rule.GetName(),
+		Enabled:  rule.GetEnabled(),
+		Cooldown: time.Duration(rule.GetCooldownSeconds()) * time.Second,
+	}
+	result.Triggers = RuleTriggersFromProto(rule.GetTriggers())
+	result.Conditions = RuleConditionsFromProto(rule.GetConditions())
+	result.Actions = RuleActionsFromProto(rule.GetActions())
+	return result
+}
+
+// RuleTriggersFromProto конвертирует триггеры правила
+func RuleTriggersFromProto(triggers []*pb.RuleTrigger) []RuleTrigger {
+	result := make([]RuleTrigger, 0, len(triggers))
+	for _, t := range triggers {
+		result = append(result, RuleTrigger{
+			Type:      t.GetType(),
+			DeviceID:  t.GetDeviceId(),
+			Parameter: t.GetParameter(),
+			Value:     t.GetValue(),
+			Time:      t.GetTime(),
+			Days:      append([]string{}, t.GetDays()...),
+		})
+	}
+	return result
+}
+
+// RuleConditionsFromProto конвертирует условия правила
+func RuleConditionsFromProto(conditions []*pb.RuleCondition) []RuleCondition {
+	result := make([]RuleCondition, 0, len(conditions))
+	for _, c := range conditions {
+		result = append(result, RuleCondition{
+			Type:      c.GetType(),
+			DeviceID:  c.GetDeviceId(),
+			Parameter: c.GetParameter(),
+			Operator:  c.GetOperator(),
+			Value:     c.GetValue(),
+			After:     c.GetAfter(),
+			Before:    c.GetBefore(),
+		})
+	}
+	return result
+}
+
+// RuleActionsFromProto конвертирует действия правила
+func RuleActionsFromProto(actions []*pb.RuleAction) []RuleAction {
+	result := make([]RuleAction, 0, len(actions))
+	for _, a := range actions {
+		result = append(result, RuleAction{
+			Type:       a.GetType(),
+			DeviceID:   a.GetDeviceId(),
+			Command:    a.GetCommand().GetAction(),
+			Parameters: copyParameters(a.GetCommand().GetParameters()),
+			SceneID:    a.GetSceneId(),
+			Delay:      time.Duration(a.GetDelaySeconds()) * time.Second,
+		})
+	}
+	return result
+}
+
+// ParseClock разбирает время суток HH:MM и возвращает число минут от полуночи
+func ParseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil || len(value) != 5 {
+		return 0, fmt.Errorf("must be a time of day in HH:MM format")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func copyParameters(params map[string]string) map[string]string {
+	if params == nil {
+		return nil
+	}
+	result := make(map[string]string, len(params))
+	for k, v := range params {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+)
+
+// SceneParameters - параметры устройства, которые может задавать сцена
+var SceneParameters = []string{ParamPower, ParamLevel, ParamColor, ParamTemperature, ParamMode}
+
+// IsSceneParameter проверяет, что параметр может входить в сцену
+func IsSceneParameter(name string) bool {
+	for _, p := range SceneParameters {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Scene представляет сохраненное состояние нескольких устройств
+// ("Кино", "Доброе утро")
+type Scene struct {
+	ID      string        // Уникальный идентификатор сцены
+	Name    string        // Имя сцены
+	Icon    string        // Имя значка для интерфейса
+	Targets []SceneTarget // Целевые состояния устройств
+}
+
+// SceneTarget - целевое состояние устройства: значения параметров из
+// SceneParameters. Устройство может быть удалено после создания сцены.
+type SceneTarget struct {
+	DeviceID   string
+	Parameters map[string]string
+}
+
+// NewScene создает новую сцену с уникальным ID
+func NewScene(name, icon string, targets ...SceneTarget) *Scene {
+	scene := &Scene{
+		ID:   uuid.New().String(),
+		Name: name,
+		Icon: icon,
+	}
+	scene.Targets = cloneTargets(targets)
+	return scene
+}
+
+// Clone возвращает глубокую копию сцены
+func (s *Scene) Clone() *Scene {
+	clone := *s
+	clone.Targets = cloneTargets(s.Targets)
+	return &clone
+}
+
+func cloneTargets(targets []SceneTarget) []SceneTarget {
+	result := make([]SceneTarget, 0, len(targets))
+	for _, target := range targets {
+		params := make(map[string]string, len(target.Parameters))
+		for k, v := range target.Parameters {
+			params[k] = v
+		}
+		result = append(result, SceneTarget{DeviceID: target.DeviceID, Parameters: params})
+	}
+	return result
+}
+
+// ToProto конвертирует Scene в protobuf-представление
+func (s *Scene) ToProto() *pb.Scene {
+	result := &pb.Scene{
+		Id:      s.ID,
+		Name:    s.Name,
+		Icon:    s.Icon,
+		Targets: make([]*pb.SceneTarget, 0, len(s.Targets)),
+	}
+	for _, target := range s.Targets {
+		result.Targets = append(result.Targets, &pb.SceneTarget{
+			DeviceId:   target.DeviceID,
+			Parameters: target.Parameters,
+		})
+	}
+	return result
+}
+
+// SceneTargetFromProto конвертирует целевое состояние из protobuf-представления
+func SceneTargetFromProto(target *pb.SceneTarget) SceneTarget {
+	params := make(map[string]string, len(target.GetParameters()))
+	for k, v := range target.GetParameters() {
+		params[k] = v
+	}
+	return SceneTarget{DeviceID: target.GetDeviceId(), Parameters: params}
+}
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Политики пропущенного запуска расписания
+const (
+	MissedRunSkip    = "skip"
+	MissedRunRunOnce = "run_once"
+)
+
+// Результаты запуска расписания
+const (
+	ScheduleCompleted = "completed"
+	ScheduleFailed    = "failed"
+	ScheduleMissed    = "missed"
+)
+
+// Schedule представляет расписание: однократный (RunAt) или повторяющийся
+// (Cron) запуск команды устройству или сцены
+type Schedule struct {
+	ID              string
+	Name            string
+	Paused          bool
+	Action          ScheduleAction
+	RunAt           time.Time // Однократный запуск (нулевое - повторяющееся расписание)
+	Cron            string    // Cron-выражение повторяющегося расписания
+	TimeZone        string    // Часовой пояс Cron (пусто - часовой пояс сервиса)
+	MissedRunPolicy string    // MissedRunSkip или MissedRunRunOnce
+
+	NextRun    time.Time // Следующий запуск (нулевое - запусков больше не будет)
+	LastRun    time.Time // Последний запуск
+	LastStatus string    // Schedule* последнего запуска
+	LastError  string    // Ошибка последнего запуска
+}
+
+// ScheduleAction - действие расписания. Используемые поля зависят от Type
+// (ActionControl или ActionScene).
+type ScheduleAction struct {
+	Type       string
+	DeviceID   string
+	Command    string
+	Parameters map[string]string
+	SceneID    string
+}
+
+// NewSchedule создает новое расписание с уникальным ID
+func NewSchedule(name string, action ScheduleAction) *Schedule {
+	return &Schedule{
+		ID:              uuid.New().String(),
+		Name:            name,
+		Action:          action,
+		MissedRunPolicy: MissedRunSkip,
+	}
+}
+
+// Clone возвращает глубокую копию расписания
+func (s *Schedule) Clone() *Schedule {
+	clone := *s
+	clone.Action.Parameters = copyParameters(s.Action.Parameters)
+	return &clone
+}
+
+// ToProto конвертирует Schedule в protobuf-представление
+func (s *Schedule) ToProto() *pb.Schedule {
+	result := &pb.Schedule{
+		Id:     s.ID,
+		Name:   s.Name,
+		Paused: s.Paused,
+		Action: &pb.ScheduleAction{
+			Type:     s.Action.Type,
+			DeviceId: s.Action.DeviceID,
+			SceneId:  s.Action.SceneID,
+		},
+		Cron:            s.Cron,
+		TimeZone:        s.TimeZone,
+		MissedRunPolicy: s.MissedRunPolicy,
+		RunAt:           timestampOrNil(s.RunAt),
+		NextRunTime:     timestampOrNil(s.NextRun),
+		LastRunTime:     timestampOrNil(s.LastRun),
+		LastStatus:      s.LastStatus,
+		LastError:       s.LastError,
+	}
+	if s.Action.Type == ActionControl {
+		result.Action.Command = &pb.Command{DeviceId: s.Action.DeviceID, Action: s.Action.Command, Parameters: s.Action.Parameters}
+	}
+	return result
+}
+
+// ScheduleActionFromProto конвертирует действие расписания из
+// protobuf-представления. Устройство берется из command.device_id, если
+// device_id не задан.
+func ScheduleActionFromProto(action *pb.ScheduleAction) ScheduleAction {
+	deviceID := action.GetDeviceId()
+	if deviceID == "" {
+		deviceID = action.GetCommand().GetDeviceId()
+	}
+	return ScheduleAction{
+		Type:       action.GetType(),
+		DeviceID:   deviceID,
+		Command:    action.GetCommand().GetAction(),
+		Parameters: copyParameters(action.GetCommand().GetParameters()),
+		SceneID:    action.GetSceneId(),
+	}
+}
+
+func timestampOrNil(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
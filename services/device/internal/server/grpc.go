@@ -2,12 +2,22 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
 	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/automation"
 	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/events"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/history"
 	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -17,14 +27,42 @@ import (
 // GRPCServer реализует интерфейс gRPC сервера для Device Service
 type GRPCServer struct {
 	pb.UnimplementedDeviceServiceServer
-	store datastore.DeviceStore
+	store     datastore.DeviceStore
+	bus       *events.Bus
+	rules     *automation.Engine
+	schedules *automation.Scheduler
+	history   history.Store
+
+	// Сериализуют изменения комнат и сцен: уникальность имен проверяется
+	// по списку перед записью
+	roomMu  sync.Mutex
+	sceneMu sync.Mutex
+
+	// Сериализует изменения правил и их передачу движку
+	ruleMu sync.Mutex
 }
 
-// NewGRPCServer создает новый экземпляр gRPC сервера
-func NewGRPCServer(store datastore.DeviceStore) *GRPCServer {
-	return &GRPCServer{
-		store: store,
+// NewGRPCServer создает новый экземпляр gRPC сервера. Изменения store
+// должны публиковаться в bus (events.NewStore), из нее StreamStatuses
+// получает обновления статусов, а движок правил (Automation) - изменения
+// устройств для триггеров. Изменения устройств записываются в history
+// оберткой history.NewRecorder.
+func NewGRPCServer(store datastore.DeviceStore, bus *events.Bus, history history.Store) *GRPCServer {
+	s := &GRPCServer{
+		store:   store,
+		bus:     bus,
+		history: history,
 	}
+	s.rules = automation.NewEngine(automation.Config{
+		Store:    store,
+		Bus:      bus,
+		Executor: s,
+	})
+	s.schedules = automation.NewScheduler(automation.SchedulerConfig{
+		Store:    store,
+		Executor: s,
+	})
+	return s
 }
 
 // GetDevice реализует gRPC метод для получения устройства по ID
@@ -33,120 +71,334 @@ func (s *GRPCServer) GetDevice(ctx context.Context, req *pb.DeviceId) (*pb.GetDe
 
 	device, err := s.store.GetDevice(req.Id)
 	if err != nil {
-		if err == datastore.ErrDeviceNotFound {
-			return nil, status.Errorf(codes.NotFound, "device with ID %s not found", req.Id)
-		}
-		return nil, status.Errorf(codes.Internal, "failed to get device: %v", err)
+		return nil, getDeviceError(req.Id, err)
 	}
 
 	return &pb.GetDeviceResponse{
-		Device: device.ToProto(),
+		Device: s.deviceProto(device),
 	}, nil
 }
 
 // ListDevices реализует gRPC метод для получения списка устройств с фильтрацией
 func (s *GRPCServer) ListDevices(ctx context.Context, req *pb.ListDevicesRequest) (*pb.ListDevicesResponse, error) {
-	log.Printf("ListDevices request with type filter: %s, online only: %v", req.Type, req.OnlineOnly)
+	log.Printf("ListDevices request with type filter: %s, online only: %v, room: %s", req.Type, req.OnlineOnly, req.RoomId)
+
+	if req.RoomId != "" {
+		if _, err := s.store.GetRoom(req.RoomId); err != nil {
+			return nil, getRoomError(req.RoomId, err)
+		}
+	}
 
 	devices, err := s.store.ListDevices(req.Type, req.OnlineOnly)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to list devices: %v", err)
 	}
-
-	protoDevices := make([]*pb.Device, 0, len(devices))
-	for _, device := range devices {
-		protoDevices = append(protoDevices, device.ToProto())
+	if req.RoomId != "" {
+		devices = filterByRoom(devices, req.RoomId)
 	}
 
+	protoDevices := s.devicesProto(devices)
+
 	return &pb.ListDevicesResponse{
 		Devices:    protoDevices,
 		TotalCount: int32(len(protoDevices)),
 	}, nil
 }
 
-// ControlDevice реализует gRPC метод для управления устройством
-func (s *GRPCServer) ControlDevice(ctx context.Context, req *pb.ControlDeviceRequest) (*pb.ControlDeviceResponse, error) {
-	log.Printf("ControlDevice request for ID: %s, action: %s", req.Id, req.Command.Action)
+// ListDeviceTypes реализует gRPC метод для получения возможностей типов устройств
+func (s *GRPCServer) ListDeviceTypes(ctx context.Context, req *pb.ListDeviceTypesRequest) (*pb.ListDeviceTypesResponse, error) {
+	specs := model.AllCapabilities()
+	types := make([]*pb.DeviceType, 0, len(specs))
+	for _, spec := range specs {
+		types = append(types, spec.ToProto())
+	}
+	return &pb.ListDeviceTypesResponse{Types: types}, nil
+}
 
-	// Проверяем существование устройства
-	device, err := s.store.GetDevice(req.Id)
+// CreateDevice реализует gRPC метод для регистрации устройства
+func (s *GRPCServer) CreateDevice(ctx context.Context, req *pb.CreateDeviceRequest) (*pb.CreateDeviceResponse, error) {
+	if req.Device == nil {
+		return nil, apierror.InvalidArgument("device is required",
+			apierror.FieldViolation{Field: "device", Description: "must be set"})
+	}
+
+	log.Printf("CreateDevice request: name: %q, type: %s", req.Device.Name, req.Device.Type)
+
+	violations := validateName(req.Device.Name)
+	if !model.IsKnownType(req.Device.Type) {
+		violations = append(violations, apierror.FieldViolation{
+			Field:       "device.type",
+			Description: "must be one of " + strings.Join(model.DeviceTypes, ", "),
+		})
+	}
+	violations = append(violations, validateTags(req.Device.Tags)...)
+	room, roomViolations, err := s.lookupRoom(req.Device.RoomId)
 	if err != nil {
-		if err == datastore.ErrDeviceNotFound {
-			return nil, status.Errorf(codes.NotFound, "device with ID %s not found", req.Id)
+		return nil, err
+	}
+	violations = append(violations, roomViolations...)
+	if len(violations) > 0 {
+		return nil, apierror.InvalidArgument("invalid device", violations...)
+	}
+
+	device := model.NewDevice(strings.TrimSpace(req.Device.Name), req.Device.Type, req.Device.Model, req.Device.Room)
+	device.Tags = append(device.Tags, req.Device.Tags...)
+	assignRoom(device, room)
+
+	if err := s.store.SaveDevice(device); err != nil {
+		if errors.Is(err, datastore.ErrRoomNotFound) {
+			// Комнату удалили после проверки
+			return nil, apierror.InvalidArgument("invalid device", roomNotFound(req.Device.RoomId))
 		}
-		return nil, status.Errorf(codes.Internal, "failed to get device: %v", err)
+		log.Printf("CreateDevice: failed to save device: %v", err)
+		return nil, apierror.New(codes.Internal, apierror.ReasonDeviceUpdateFailed, "failed to save device")
 	}
 
-	// Проверяем, что устройство онлайн
-	if !device.Status.Online {
-		return &pb.ControlDeviceResponse{
-			Success: false,
-			Status:  "Device is offline",
-			Error:   "Cannot control offline device",
-		}, nil
-	}
-
-	// Обрабатываем команду в зависимости от типа действия
-	switch req.Command.Action {
-	case model.CommandTurnOn:
-		device.UpdateParameterValue(model.ParamPower, "on")
-	case model.CommandTurnOff:
-		device.UpdateParameterValue(model.ParamPower, "off")
-	case model.CommandSetLevel:
-		if level, ok := req.Command.Parameters[model.ParamLevel]; ok {
-			device.UpdateParameterValue(model.ParamLevel, level)
-		} else {
-			return &pb.ControlDeviceResponse{
-				Success: false,
-				Status:  "Missing parameter",
-				Error:   "Level parameter is required for set_level action",
-			}, nil
+	return &pb.CreateDeviceResponse{
+		Device: s.deviceProto(device),
+	}, nil
+}
+
+// updatableFields - поля, которые можно изменить через UpdateDevice
+var updatableFields = []string{"name", "room", "room_id", "model", "tags"}
+
+// populatedFields возвращает изменяемые поля, заполненные в запросе. Пустая
+// маска не сбрасывает остальные поля: без маски room_id отвязывал бы
+// устройство от комнаты при любом изменении.
+func populatedFields(device *pb.Device) []string {
+	var paths []string
+	for _, field := range []struct {
+		path string
+		set  bool
+	}{
+		{"name", device.Name != ""},
+		{"room", device.Room != ""},
+		{"room_id", device.RoomId != ""},
+		{"model", device.Model != ""},
+		{"tags", len(device.Tags) > 0},
+	} {
+		if field.set {
+			paths = append(paths, field.path)
 		}
-	case model.CommandSetTemp:
-		if temp, ok := req.Command.Parameters[model.ParamTemperature]; ok {
-			device.UpdateParameterValue(model.ParamTemperature, temp)
-		} else {
-			return &pb.ControlDeviceResponse{
-				Success: false,
-				Status:  "Missing parameter",
-				Error:   "Temperature parameter is required for set_temperature action",
-			}, nil
+	}
+	return paths
+}
+
+// UpdateDevice реализует gRPC метод для изменения устройства по маске полей
+func (s *GRPCServer) UpdateDevice(ctx context.Context, req *pb.UpdateDeviceRequest) (*pb.UpdateDeviceResponse, error) {
+	if req.Device == nil {
+		return nil, apierror.InvalidArgument("device is required",
+			apierror.FieldViolation{Field: "device", Description: "must be set"})
+	}
+	id := req.Device.Id
+	if id == "" {
+		return nil, apierror.InvalidArgument("device ID is required",
+			apierror.FieldViolation{Field: "device.id", Description: "must not be empty"})
+	}
+
+	paths := req.UpdateMask.GetPaths()
+	if len(paths) == 0 {
+		paths = populatedFields(req.Device)
+	}
+
+	log.Printf("UpdateDevice request for ID: %s, fields: %v", id, paths)
+
+	var (
+		violations []apierror.FieldViolation
+		room       *model.Room
+		moveRoom   bool
+		setRoom    bool
+	)
+	for _, path := range paths {
+		switch path {
+		case "name":
+			violations = append(violations, validateName(req.Device.Name)...)
+		case "tags":
+			violations = append(violations, validateTags(req.Device.Tags)...)
+		case "room_id":
+			var roomViolations []apierror.FieldViolation
+			var err error
+			room, roomViolations, err = s.lookupRoom(req.Device.RoomId)
+			if err != nil {
+				return nil, err
+			}
+			violations = append(violations, roomViolations...)
+			moveRoom = true
+		case "room":
+			setRoom = true
+		case "id", "model":
+			// id совпадает с устройством из пути запроса и не изменяется
+		default:
+			violations = append(violations, apierror.FieldViolation{
+				Field:       "update_mask",
+				Description: fmt.Sprintf("field %q cannot be updated, expected %s", path, strings.Join(updatableFields, ", ")),
+			})
 		}
-	case model.CommandSetColor:
-		if color, ok := req.Command.Parameters[model.ParamColor]; ok {
-			device.UpdateParameterValue(model.ParamColor, color)
-		} else {
-			return &pb.ControlDeviceResponse{
-				Success: false,
-				Status:  "Missing parameter",
-				Error:   "Color parameter is required for set_color action",
-			}, nil
+	}
+	if len(violations) > 0 {
+		return nil, apierror.InvalidArgument("invalid device update", violations...)
+	}
+
+	device, err := s.modifyDevice(id, func(device *model.Device) error {
+		for _, path := range paths {
+			switch path {
+			case "name":
+				device.Name = strings.TrimSpace(req.Device.Name)
+			case "room":
+				device.Room = req.Device.Room
+			case "model":
+				device.Model = req.Device.Model
+			case "tags":
+				device.Tags = append([]string{}, req.Device.Tags...)
+			}
 		}
-	case model.CommandSetMode:
-		if mode, ok := req.Command.Parameters[model.ParamMode]; ok {
-			device.UpdateParameterValue(model.ParamMode, mode)
-		} else {
-			return &pb.ControlDeviceResponse{
-				Success: false,
-				Status:  "Missing parameter",
-				Error:   "Mode parameter is required for set_mode action",
-			}, nil
+		// Имя новой комнаты заменяет room независимо от порядка полей в маске.
+		// room без room_id задает название вручную и отвязывает устройство
+		// от комнаты, иначе deviceProto вернул бы имя прежней комнаты.
+		if moveRoom {
+			device.RoomID = ""
+			assignRoom(device, room)
+		} else if setRoom {
+			device.RoomID = ""
 		}
-	default:
-		return &pb.ControlDeviceResponse{
-			Success: false,
-			Status:  "Unsupported action",
-			Error:   "Action not supported for this device type",
-		}, nil
+		device.LastUpdated = time.Now()
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Обновляем устройство в хранилище
-	if err := s.store.SaveDevice(device); err != nil {
-		return &pb.ControlDeviceResponse{
-			Success: false,
-			Status:  "Internal error",
-			Error:   "Failed to update device state",
-		}, nil
+	return &pb.UpdateDeviceResponse{
+		Device: s.deviceProto(device),
+	}, nil
+}
+
+// lookupRoom читает комнату для привязки устройства. Для пустого id
+// возвращает nil, для несуществующей комнаты - нарушение device.room_id.
+func (s *GRPCServer) lookupRoom(id string) (*model.Room, []apierror.FieldViolation, error) {
+	if id == "" {
+		return nil, nil, nil
+	}
+	room, err := s.store.GetRoom(id)
+	if errors.Is(err, datastore.ErrRoomNotFound) {
+		return nil, []apierror.FieldViolation{roomNotFound(id)}, nil
+	}
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Internal, "failed to get room: %v", err)
+	}
+	return room, nil, nil
+}
+
+func roomNotFound(id string) apierror.FieldViolation {
+	return apierror.FieldViolation{Field: "device.room_id", Description: fmt.Sprintf("room %s does not exist", id)}
+}
+
+// assignRoom привязывает устройство к комнате (nil - не меняет привязку).
+// room устройства получает имя комнаты.
+func assignRoom(device *model.Device, room *model.Room) {
+	if room == nil {
+		return
+	}
+	device.RoomID = room.ID
+	device.Room = room.Name
+}
+
+// deviceProto конвертирует устройство в protobuf-представление. Для
+// устройства в комнате room содержит текущее имя комнаты: при
+// переименовании комнаты устройства не перезаписываются.
+func (s *GRPCServer) deviceProto(device *model.Device) *pb.Device {
+	result := device.ToProto()
+	if device.RoomID != "" {
+		if room, err := s.store.GetRoom(device.RoomID); err == nil {
+			result.Room = room.Name
+		}
+	}
+	return result
+}
+
+// devicesProto конвертирует список устройств, как deviceProto, читая
+// комнаты один раз
+func (s *GRPCServer) devicesProto(devices []*model.Device) []*pb.Device {
+	names := make(map[string]string)
+	rooms, err := s.store.ListRooms()
+	if err != nil {
+		log.Printf("Failed to list rooms: %v", err)
+	}
+	for _, room := range rooms {
+		names[room.ID] = room.Name
+	}
+
+	result := make([]*pb.Device, 0, len(devices))
+	for _, device := range devices {
+		protoDevice := device.ToProto()
+		if name, ok := names[device.RoomID]; ok {
+			protoDevice.Room = name
+		}
+		result = append(result, protoDevice)
+	}
+	return result
+}
+
+// DeleteDevice реализует gRPC метод для удаления устройства
+func (s *GRPCServer) DeleteDevice(ctx context.Context, req *pb.DeviceId) (*pb.Empty, error) {
+	log.Printf("DeleteDevice request for ID: %s", req.Id)
+
+	if err := s.store.DeleteDevice(req.Id); err != nil {
+		return nil, getDeviceError(req.Id, err)
+	}
+	return &pb.Empty{}, nil
+}
+
+// Ограничения полей устройства
+const (
+	maxNameLength = 100
+	maxTags       = 20
+	maxTagLength  = 50
+)
+
+// validateName проверяет имя устройства
+func validateName(name string) []apierror.FieldViolation {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return []apierror.FieldViolation{{Field: "device.name", Description: "must not be empty"}}
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return []apierror.FieldViolation{{Field: "device.name", Description: fmt.Sprintf("must be at most %d characters", maxNameLength)}}
+	}
+	return nil
+}
+
+// validateTags проверяет теги устройства
+func validateTags(tags []string) []apierror.FieldViolation {
+	if len(tags) > maxTags {
+		return []apierror.FieldViolation{{Field: "device.tags", Description: fmt.Sprintf("must contain at most %d tags", maxTags)}}
+	}
+	for i, tag := range tags {
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+			return []apierror.FieldViolation{{
+				Field:       fmt.Sprintf("device.tags[%d]", i),
+				Description: fmt.Sprintf("must be 1 to %d characters", maxTagLength),
+			}}
+		}
+	}
+	return nil
+}
+
+// ControlDevice реализует gRPC метод для управления устройством.
+// Ошибки возвращаются статусом gRPC с причиной из apierror.
+func (s *GRPCServer) ControlDevice(ctx context.Context, req *pb.ControlDeviceRequest) (*pb.ControlDeviceResponse, error) {
+	if req.Command == nil {
+		return nil, apierror.InvalidArgument("command is required",
+			apierror.FieldViolation{Field: "command", Description: "must be set"})
+	}
+
+	log.Printf("ControlDevice request for ID: %s, action: %s", req.Id, req.Command.Action)
+
+	_, err := s.modifyDevice(req.Id, func(device *model.Device) error {
+		return applyCommand(device, req)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &pb.ControlDeviceResponse{
@@ -155,6 +407,143 @@ func (s *GRPCServer) ControlDevice(ctx context.Context, req *pb.ControlDeviceReq
 	}, nil
 }
 
+// maxSaveAttempts ограничивает повторы изменения устройства при конфликте версий
+const maxSaveAttempts = 3
+
+// modifyDevice читает устройство, применяет к нему change и сохраняет.
+// Чтение и запись повторяются, если устройство параллельно изменил другой
+// запрос. Ошибка change возвращается без изменений.
+func (s *GRPCServer) modifyDevice(id string, change func(device *model.Device) error) (*model.Device, error) {
+	for attempt := 1; ; attempt++ {
+		device, err := s.store.GetDevice(id)
+		if err != nil {
+			return nil, getDeviceError(id, err)
+		}
+
+		if err := change(device); err != nil {
+			return nil, err
+		}
+
+		err = s.store.SaveDevice(device)
+		if err == nil {
+			return device, nil
+		}
+		if errors.Is(err, datastore.ErrVersionConflict) {
+			if attempt < maxSaveAttempts {
+				continue
+			}
+			return nil, apierror.Newf(codes.Aborted, apierror.ReasonDeviceConflict,
+				"device %s was modified concurrently, retry the request", id).WithMetadata("device_id", id)
+		}
+		if errors.Is(err, datastore.ErrDeviceNotFound) {
+			return nil, getDeviceError(id, err)
+		}
+		if errors.Is(err, datastore.ErrRoomNotFound) {
+			// Комнату удалили после проверки
+			return nil, apierror.InvalidArgument("invalid device", roomNotFound(device.RoomID))
+		}
+		log.Printf("Failed to save device %s: %v", id, err)
+		return nil, apierror.New(codes.Internal, apierror.ReasonDeviceUpdateFailed, "failed to update device state").
+			WithMetadata("device_id", id)
+	}
+}
+
+// applyCommand применяет команду к прочитанному устройству
+func applyCommand(device *model.Device, req *pb.ControlDeviceRequest) error {
+	action, err := validateCommand(device, req.Command)
+	if err != nil {
+		return err
+	}
+
+	// Проверяем, что устройство онлайн
+	if device.Status == nil || !device.Status.Online {
+		return apierror.Newf(codes.FailedPrecondition, apierror.ReasonDeviceOffline,
+			"device %s is offline", req.Id).WithMetadata("device_id", req.Id)
+	}
+
+	value := action.Value
+	if value == "" {
+		value = req.Command.Parameters[action.Parameter]
+	}
+	device.UpdateParameterValue(action.Parameter, value)
+	return nil
+}
+
+// validateCommand проверяет команду по возможностям типа устройства
+// (model.Capabilities) и возвращает описание действия
+func validateCommand(device *model.Device, cmd *pb.Command) (*model.ActionSpec, error) {
+	spec, ok := model.Capabilities(device.Type)
+	var action *model.ActionSpec
+	if ok {
+		action, ok = spec.Action(cmd.Action)
+	}
+	if !ok {
+		supported := "none"
+		if spec != nil && len(spec.Actions) > 0 {
+			supported = strings.Join(spec.ActionNames(), ", ")
+		}
+		return nil, apierror.Newf(codes.InvalidArgument, apierror.ReasonActionNotSupported,
+			"action %q is not supported for device type %s (supported: %s)", cmd.Action, device.Type, supported).
+			WithMetadata("device_id", device.ID).
+			WithMetadata("device_type", device.Type).
+			WithMetadata("action", cmd.Action)
+	}
+
+	// Команда принимает только параметр, который она изменяет
+	var extra []string
+	for name := range cmd.Parameters {
+		if action.Value != "" || name != action.Parameter {
+			extra = append(extra, name)
+		}
+	}
+	if len(extra) > 0 {
+		sort.Strings(extra)
+		err := apierror.Newf(codes.InvalidArgument, apierror.ReasonInvalidParameter,
+			"action %s does not accept parameters %s", cmd.Action, strings.Join(extra, ", ")).
+			WithMetadata("device_id", device.ID).
+			WithMetadata("action", cmd.Action)
+		for _, name := range extra {
+			err = err.WithViolation("command.parameters."+name, "not accepted by "+cmd.Action)
+		}
+		return nil, err
+	}
+
+	if action.Value != "" {
+		return action, nil
+	}
+
+	value, ok := cmd.Parameters[action.Parameter]
+	if !ok {
+		return nil, apierror.Newf(codes.InvalidArgument, apierror.ReasonMissingParameter,
+			"%s parameter is required for %s action", action.Parameter, cmd.Action).
+			WithMetadata("device_id", device.ID).
+			WithViolation("command.parameters."+action.Parameter, "required for "+cmd.Action)
+	}
+
+	param, _ := spec.Parameter(action.Parameter)
+	if err := param.Validate(value); err != nil {
+		return nil, apierror.Newf(codes.InvalidArgument, apierror.ReasonInvalidParameter,
+			"%s parameter %s, got %q", action.Parameter, err, value).
+			WithMetadata("device_id", device.ID).
+			WithMetadata("action", cmd.Action).
+			WithViolation("command.parameters."+action.Parameter, err.Error())
+	}
+	return action, nil
+}
+
+// getDeviceError преобразует ошибку хранилища в ошибку gRPC
+func getDeviceError(id string, err error) error {
+	if errors.Is(err, datastore.ErrDeviceNotFound) {
+		return apierror.Newf(codes.NotFound, apierror.ReasonDeviceNotFound, "device with ID %s not found", id).
+			WithMetadata("device_id", id)
+	}
+	if errors.Is(err, datastore.ErrInvalidDeviceID) {
+		return apierror.InvalidArgument("device ID is required",
+			apierror.FieldViolation{Field: "id", Description: "must not be empty"})
+	}
+	return status.Errorf(codes.Internal, "failed to get device: %v", err)
+}
+
 // SendCommand реализует gRPC метод для отправки команды на устройство
 func (s *GRPCServer) SendCommand(ctx context.Context, cmd *pb.Command) (*pb.CommandResult, error) {
 	log.Printf("SendCommand request for device ID: %s, action: %s", cmd.DeviceId, cmd.Action)
@@ -162,15 +551,14 @@ func (s *GRPCServer) SendCommand(ctx context.Context, cmd *pb.Command) (*pb.Comm
 	// Проверяем существование устройства
 	device, err := s.store.GetDevice(cmd.DeviceId)
 	if err != nil {
-		if err == datastore.ErrDeviceNotFound {
-			return nil, status.Errorf(codes.NotFound, "device with ID %s not found", cmd.DeviceId)
-		}
-		return nil, status.Errorf(codes.Internal, "failed to get device: %v", err)
+		return nil, getDeviceError(cmd.DeviceId, err)
 	}
 
-	// Обрабатываем команду аналогично ControlDevice
-	// Здесь для примера просто обновляем устройство и возвращаем успешный результат
-	// В реальном приложении здесь был бы код для отправки команды на физическое устройство через MQTT
+	// Команда проверяется так же, как в ControlDevice. Состояние не меняется:
+	// в реальном приложении здесь был бы код для отправки команды на физическое устройство через MQTT
+	if _, err := validateCommand(device, cmd); err != nil {
+		return nil, err
+	}
 
 	// Обновляем время команды, если не задано
 	timeNow := time.Now()
@@ -197,91 +585,144 @@ func (s *GRPCServer) SendCommand(ctx context.Context, cmd *pb.Command) (*pb.Comm
 	return result, nil
 }
 
-// StreamStatuses реализует gRPC метод для потоковой передачи статусов устройств
+// StreamStatuses реализует gRPC метод для потоковой передачи статусов устройств.
+// На каждый запрос подписки отправляются текущие статусы добавленных
+// устройств, затем изменения из шины по мере их записи в хранилище.
 func (s *GRPCServer) StreamStatuses(stream pb.DeviceService_StreamStatusesServer) error {
 	log.Println("StreamStatuses: Starting status stream")
 
-	// Получаем первый запрос для инициализации подписки
-	req, err := stream.Recv()
-	if err == io.EOF {
-		return nil
-	}
-	if err != nil {
-		return status.Errorf(codes.Internal, "failed to receive initial request: %v", err)
-	}
-
-	log.Printf("StreamStatuses: Received subscription request for device ID: %s, subscribe all: %v",
-		req.DeviceId, req.SubscribeAll)
-
-	// Определяем список устройств для мониторинга
-	var deviceIDs []string
-	if req.SubscribeAll {
-		// Мониторим все устройства
-		devices := s.store.GetAllDevices()
-		for _, device := range devices {
-			deviceIDs = append(deviceIDs, device.ID)
-		}
-	} else if req.DeviceId != "" {
-		// Мониторим только одно устройство
-		deviceIDs = append(deviceIDs, req.DeviceId)
-	} else {
-		return status.Errorf(codes.InvalidArgument,
-			"device_id must be specified or subscribe_all must be true")
-	}
+	// Подписка на шину создается до чтения текущих статусов, чтобы не
+	// пропустить изменения между чтением и подпиской
+	sub := s.bus.Subscribe()
+	defer sub.Close()
 
-	// Для простоты демонстрации отправляем статусы раз в 5 секунд
-	// В реальном приложении здесь была бы подписка на Kafka/MQTT
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-
-	// Канал для получения сигнала о завершении стрима
-	done := make(chan struct{})
-
-	// Горутина для прослушивания новых запросов от клиента
+	// Запросы клиента читаются в отдельной горутине
+	requests := make(chan *pb.StatusRequest)
+	recvErr := make(chan error, 1)
 	go func() {
 		for {
-			_, err := stream.Recv()
-			if err == io.EOF {
-				close(done)
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
 				return
 			}
-			if err != nil {
-				log.Printf("StreamStatuses: Error receiving request: %v", err)
-				close(done)
+			select {
+			case requests <- req:
+			case <-stream.Context().Done():
 				return
 			}
 		}
 	}()
 
-	// Основной цикл отправки статусов
+	filter := &statusFilter{devices: make(map[string]struct{})}
+	subscribed := false
+
 	for {
 		select {
-		case <-done:
+		case <-stream.Context().Done():
 			log.Println("StreamStatuses: Client disconnected")
 			return nil
-		case <-ticker.C:
-			// Отправляем текущий статус для каждого устройства в списке
-			for _, id := range deviceIDs {
-				device, err := s.store.GetDevice(id)
-				if err != nil {
-					log.Printf("StreamStatuses: Error getting device %s: %v", id, err)
-					continue
-				}
 
-				now := time.Now()
-				resp := &pb.StatusResponse{
-					DeviceId: device.ID,
-					Status:   device.Status.ToProto(),
-					Time:     timestamppb.New(now),
-				}
+		case err := <-recvErr:
+			if err == io.EOF {
+				log.Println("StreamStatuses: Client closed the stream")
+				return nil
+			}
+			if !subscribed {
+				return status.Errorf(codes.Internal, "failed to receive initial request: %v", err)
+			}
+			log.Printf("StreamStatuses: Error receiving request: %v", err)
+			return nil
+
+		case req := <-requests:
+			log.Printf("StreamStatuses: Received subscription request for device ID: %s, subscribe all: %v, unsubscribe: %v",
+				req.DeviceId, req.SubscribeAll, req.Unsubscribe)
+
+			devices, err := s.updateSubscription(filter, req)
+			if err != nil {
+				return err
+			}
+			subscribed = true
 
-				if err := stream.Send(resp); err != nil {
+			for _, device := range devices {
+				if err := stream.Send(statusResponse(device.ID, device, time.Now())); err != nil {
 					log.Printf("StreamStatuses: Error sending status update: %v", err)
 					return err
 				}
+			}
 
-				log.Printf("StreamStatuses: Status sent for device %s", device.ID)
+		case <-sub.Ready():
+			for _, event := range sub.Drain() {
+				if !filter.match(event.DeviceID) {
+					continue
+				}
+				if err := stream.Send(statusResponse(event.DeviceID, event.Device, event.Time)); err != nil {
+					log.Printf("StreamStatuses: Error sending status update: %v", err)
+					return err
+				}
 			}
 		}
 	}
 }
+
+// statusFilter - устройства, на которые подписан поток статусов
+type statusFilter struct {
+	all     bool
+	devices map[string]struct{}
+}
+
+// match проверяет, подписан ли поток на устройство
+func (f *statusFilter) match(id string) bool {
+	if f.all {
+		return true
+	}
+	_, ok := f.devices[id]
+	return ok
+}
+
+// updateSubscription применяет запрос подписки к фильтру и возвращает
+// устройства, текущие статусы которых нужно отправить
+func (s *GRPCServer) updateSubscription(filter *statusFilter, req *pb.StatusRequest) ([]*model.Device, error) {
+	switch {
+	case req.SubscribeAll && req.Unsubscribe:
+		filter.all = false
+		return nil, nil
+
+	case req.SubscribeAll:
+		filter.all = true
+		return s.store.GetAllDevices(), nil
+
+	case req.DeviceId != "" && req.Unsubscribe:
+		delete(filter.devices, req.DeviceId)
+		return nil, nil
+
+	case req.DeviceId != "":
+		filter.devices[req.DeviceId] = struct{}{}
+		device, err := s.store.GetDevice(req.DeviceId)
+		if err != nil {
+			// Подписка сохраняется, но у неизвестного устройства нет статуса
+			log.Printf("StreamStatuses: Error getting device %s: %v", req.DeviceId, err)
+			return nil, nil
+		}
+		return []*model.Device{device}, nil
+
+	default:
+		return nil, status.Errorf(codes.InvalidArgument,
+			"device_id must be specified or subscribe_all must be true")
+	}
+}
+
+// statusResponse создает сообщение потока статусов. Для удаленного
+// устройства (device == nil) выставляется признак deleted.
+func statusResponse(id string, device *model.Device, t time.Time) *pb.StatusResponse {
+	resp := &pb.StatusResponse{
+		DeviceId: id,
+		Time:     timestamppb.New(t),
+	}
+	if device == nil {
+		resp.Deleted = true
+	} else if device.Status != nil {
+		resp.Status = device.Status.ToProto()
+	}
+	return resp
+}
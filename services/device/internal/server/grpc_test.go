@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/events"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/history"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestCreateDevice(t *testing.T) {
+	tests := []struct {
+		name   string
+		device *pb.Device
+		code   codes.Code
+		field  string
+	}{
+		{"Valid", &pb.Device{Name: " Лампа ", Type: "lamp", Room: "Кухня", Tags: []string{"свет"}}, codes.OK, ""},
+		{"NoDevice", nil, codes.InvalidArgument, "device"},
+		{"EmptyName", &pb.Device{Name: "  ", Type: "lamp"}, codes.InvalidArgument, "device.name"},
+		{"UnknownType", &pb.Device{Name: "Чайник", Type: "kettle"}, codes.InvalidArgument, "device.type"},
+		{"EmptyTag", &pb.Device{Name: "Лампа", Type: "lamp", Tags: []string{""}}, codes.InvalidArgument, "device.tags[0]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			resp, err := s.CreateDevice(context.Background(), &pb.CreateDeviceRequest{Device: tt.device})
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v (err: %v)", code, tt.code, err)
+			}
+			if err != nil {
+				assertViolation(t, err, tt.field)
+				return
+			}
+
+			if resp.Device.Id == "" || resp.Device.Name != "Лампа" || resp.Device.Status == nil {
+				t.Errorf("unexpected device: %+v", resp.Device)
+			}
+			got, err := s.GetDevice(context.Background(), &pb.DeviceId{Id: resp.Device.Id})
+			if err != nil {
+				t.Fatalf("GetDevice failed: %v", err)
+			}
+			if got.Device.Room != "Кухня" || len(got.Device.Tags) != 1 {
+				t.Errorf("unexpected stored device: %+v", got.Device)
+			}
+		})
+	}
+}
+
+func TestUpdateDevice(t *testing.T) {
+	s := newTestServer()
+	created, err := s.CreateDevice(context.Background(), &pb.CreateDeviceRequest{Device: &pb.Device{
+		Name: "Лампа", Type: "lamp", Model: "Philips Hue", Room: "Кухня", Tags: []string{"свет"},
+	}})
+	if err != nil {
+		t.Fatalf("CreateDevice failed: %v", err)
+	}
+	id := created.Device.Id
+
+	// Изменяются только поля из маски
+	resp, err := s.UpdateDevice(context.Background(), &pb.UpdateDeviceRequest{
+		Device:     &pb.Device{Id: id, Name: "Торшер", Room: "Гостиная"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateDevice failed: %v", err)
+	}
+	if resp.Device.Name != "Торшер" || resp.Device.Room != "Кухня" || resp.Device.Model != "Philips Hue" || resp.Device.Type != "lamp" {
+		t.Errorf("unexpected device after masked update: %+v", resp.Device)
+	}
+
+	// Пустая маска изменяет только заполненные поля
+	resp, err = s.UpdateDevice(context.Background(), &pb.UpdateDeviceRequest{
+		Device: &pb.Device{Id: id, Name: "Люстра", Room: "Гостиная"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateDevice without mask failed: %v", err)
+	}
+	if resp.Device.Name != "Люстра" || resp.Device.Room != "Гостиная" || resp.Device.Model != "Philips Hue" || len(resp.Device.Tags) != 1 {
+		t.Errorf("unexpected device after update without mask: %+v", resp.Device)
+	}
+
+	errorTests := []struct {
+		name  string
+		req   *pb.UpdateDeviceRequest
+		code  codes.Code
+		field string
+	}{
+		{"NoID", &pb.UpdateDeviceRequest{Device: &pb.Device{Name: "Лампа"}}, codes.InvalidArgument, "device.id"},
+		{"EmptyName", &pb.UpdateDeviceRequest{
+			Device:     &pb.Device{Id: id},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+		}, codes.InvalidArgument, "device.name"},
+		{"ImmutableField", &pb.UpdateDeviceRequest{
+			Device:     &pb.Device{Id: id, Type: "socket"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"type"}},
+		}, codes.InvalidArgument, "update_mask"},
+		{"NotFound", &pb.UpdateDeviceRequest{
+			Device:     &pb.Device{Id: "missing", Room: "Кухня"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"room"}},
+		}, codes.NotFound, ""},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.UpdateDevice(context.Background(), tt.req)
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v (err: %v)", code, tt.code, err)
+			}
+			if tt.field != "" {
+				assertViolation(t, err, tt.field)
+			}
+		})
+	}
+}
+
+func TestDeleteDevice(t *testing.T) {
+	s := newTestServer()
+	created, err := s.CreateDevice(context.Background(), &pb.CreateDeviceRequest{Device: &pb.Device{Name: "Лампа", Type: "lamp"}})
+	if err != nil {
+		t.Fatalf("CreateDevice failed: %v", err)
+	}
+
+	if _, err := s.DeleteDevice(context.Background(), &pb.DeviceId{Id: created.Device.Id}); err != nil {
+		t.Fatalf("DeleteDevice failed: %v", err)
+	}
+	if _, err := s.GetDevice(context.Background(), &pb.DeviceId{Id: created.Device.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetDevice after delete: %v, want NotFound", err)
+	}
+	if _, err := s.DeleteDevice(context.Background(), &pb.DeviceId{Id: created.Device.Id}); apierror.Reason(err) != apierror.ReasonDeviceNotFound {
+		t.Errorf("repeated DeleteDevice: %v, want %s", err, apierror.ReasonDeviceNotFound)
+	}
+	if _, err := s.DeleteDevice(context.Background(), &pb.DeviceId{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("DeleteDevice without ID: %v, want InvalidArgument", err)
+	}
+}
+
+func newTestServer() *GRPCServer {
+	bus := events.NewBus()
+	hist := history.NewMemoryStore(0)
+	return NewGRPCServer(events.NewStore(history.NewRecorder(datastore.NewMemoryStore(), hist), bus), bus, hist)
+}
+
+func assertViolation(t *testing.T, err error, field string) {
+	t.Helper()
+	for _, v := range apierror.FromError(err).Violations {
+		if v.Field == field {
+			return
+		}
+	}
+	t.Errorf("expected violation for %s, got %v", field, err)
+}
+
+func TestControlDevice_ValidatesCommand(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	created, err := s.CreateDevice(ctx, &pb.CreateDeviceRequest{Device: &pb.Device{Name: "Лампа", Type: "lamp"}})
+	if err != nil {
+		t.Fatalf("CreateDevice failed: %v", err)
+	}
+	id := created.Device.Id
+
+	tests := []struct {
+		name   string
+		cmd    *pb.Command
+		reason string
+		field  string
+	}{
+		{"Valid", &pb.Command{Action: "set_level", Parameters: map[string]string{"level": "40"}}, "", ""},
+		{"UnsupportedAction", &pb.Command{Action: "set_temperature", Parameters: map[string]string{"temperature": "22"}}, apierror.ReasonActionNotSupported, ""},
+		{"InvalidValue", &pb.Command{Action: "set_level", Parameters: map[string]string{"level": "banana"}}, apierror.ReasonInvalidParameter, "command.parameters.level"},
+		{"OutOfRange", &pb.Command{Action: "set_level", Parameters: map[string]string{"level": "150"}}, apierror.ReasonInvalidParameter, "command.parameters.level"},
+		{"MissingParameter", &pb.Command{Action: "set_color"}, apierror.ReasonMissingParameter, "command.parameters.color"},
+		{"ExtraParameter", &pb.Command{Action: "turn_on", Parameters: map[string]string{"level": "10"}}, apierror.ReasonInvalidParameter, "command.parameters.level"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.ControlDevice(ctx, &pb.ControlDeviceRequest{Id: id, Command: tt.cmd})
+			if got := apierror.Reason(err); got != tt.reason {
+				t.Fatalf("reason = %q, want %q (err: %v)", got, tt.reason, err)
+			}
+			if tt.field != "" {
+				assertViolation(t, err, tt.field)
+			}
+
+			// SendCommand проверяет команду так же
+			_, err = s.SendCommand(ctx, &pb.Command{DeviceId: id, Action: tt.cmd.Action, Parameters: tt.cmd.Parameters})
+			if got := apierror.Reason(err); got != tt.reason {
+				t.Errorf("SendCommand reason = %q, want %q (err: %v)", got, tt.reason, err)
+			}
+		})
+	}
+
+	device, err := s.GetDevice(ctx, &pb.DeviceId{Id: id})
+	if err != nil {
+		t.Fatalf("GetDevice failed: %v", err)
+	}
+	if device.Device.Status.Parameters["level"] != "40" {
+		t.Errorf("level = %q, want 40", device.Device.Status.Parameters["level"])
+	}
+}
+
+func TestListDeviceTypes(t *testing.T) {
+	resp, err := newTestServer().ListDeviceTypes(context.Background(), &pb.ListDeviceTypesRequest{})
+	if err != nil {
+		t.Fatalf("ListDeviceTypes failed: %v", err)
+	}
+	if len(resp.Types) != 6 || resp.Types[0].Type != "lamp" {
+		t.Fatalf("unexpected types: %v", resp.Types)
+	}
+	for _, param := range resp.Types[0].Parameters {
+		if param.Name == "level" && (param.GetMin() != 0 || param.GetMax() != 100 || param.Unit != "%" || param.Kind != "integer") {
+			t.Errorf("unexpected level parameter: %v", param)
+		}
+	}
+}
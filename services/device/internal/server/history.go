@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/history"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Ограничения запроса истории устройства
+const (
+	defaultHistoryPeriod   = 24 * time.Hour
+	defaultHistoryPageSize = 500
+	maxHistoryPageSize     = 5000
+	maxHistoryBucket       = 31 * 24 * time.Hour
+)
+
+// maxBucketPagePoints ограничивает число точек, которые читает одна страница
+// агрегатов. Переменная, чтобы тесты могли ее уменьшить.
+var maxBucketPagePoints = 100000
+
+// GetDeviceHistory реализует gRPC метод для получения истории устройства.
+// Страницы точек продолжаются по Seq последней точки, страницы агрегатов -
+// с начала следующего интервала, поэтому новые точки не сдвигают страницы.
+func (s *GRPCServer) GetDeviceHistory(ctx context.Context, req *pb.GetDeviceHistoryRequest) (*pb.GetDeviceHistoryResponse, error) {
+	if _, err := s.store.GetDevice(req.DeviceId); err != nil {
+		return nil, getDeviceError(req.DeviceId, err)
+	}
+
+	var violations []apierror.FieldViolation
+	end := time.Now()
+	if req.EndTime != nil {
+		if err := req.EndTime.CheckValid(); err != nil {
+			violations = append(violations, apierror.FieldViolation{Field: "end_time", Description: "must be a valid timestamp"})
+		}
+		end = req.EndTime.AsTime()
+	}
+	start := end.Add(-defaultHistoryPeriod)
+	if req.StartTime != nil {
+		if err := req.StartTime.CheckValid(); err != nil {
+			violations = append(violations, apierror.FieldViolation{Field: "start_time", Description: "must be a valid timestamp"})
+		}
+		start = req.StartTime.AsTime()
+	}
+	if !start.Before(end) {
+		violations = append(violations, apierror.FieldViolation{Field: "start_time", Description: "must be before end_time"})
+	}
+	for i, param := range req.Parameters {
+		if strings.TrimSpace(param) == "" {
+			violations = append(violations, apierror.FieldViolation{Field: fmt.Sprintf("parameters[%d]", i), Description: "must not be empty"})
+		}
+	}
+	bucket := time.Duration(req.BucketSeconds) * time.Second
+	if bucket < 0 || bucket > maxHistoryBucket {
+		violations = append(violations, apierror.FieldViolation{Field: "bucket_seconds", Description: fmt.Sprintf("must be 0 to %d", int(maxHistoryBucket/time.Second))})
+	}
+	pageSize := int(req.PageSize)
+	if pageSize < 0 || pageSize > maxHistoryPageSize {
+		violations = append(violations, apierror.FieldViolation{Field: "page_size", Description: fmt.Sprintf("must be 0 to %d", maxHistoryPageSize)})
+	}
+	if pageSize == 0 {
+		pageSize = defaultHistoryPageSize
+	}
+	cursor, ok := decodePageToken(req.PageToken, bucket)
+	if !ok {
+		violations = append(violations, apierror.FieldViolation{Field: "page_token", Description: "is invalid or does not match bucket_seconds"})
+	}
+	if len(violations) > 0 {
+		return nil, apierror.InvalidArgument("invalid history request", violations...)
+	}
+
+	query := history.Query{
+		DeviceID:   req.DeviceId,
+		From:       start,
+		To:         end,
+		Parameters: req.Parameters,
+	}
+	if bucket == 0 {
+		return s.historyPoints(query, cursor, pageSize)
+	}
+	return s.historyBuckets(query, bucket, cursor, pageSize)
+}
+
+// historyPoints возвращает страницу точек после точки с Seq = afterSeq
+func (s *GRPCServer) historyPoints(query history.Query, afterSeq int64, pageSize int) (*pb.GetDeviceHistoryResponse, error) {
+	query.AfterSeq = afterSeq
+	query.Limit = pageSize + 1
+	points, err := s.history.Query(query)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to query history: %v", err)
+	}
+
+	resp := &pb.GetDeviceHistoryResponse{}
+	if len(points) > pageSize {
+		points = points[:pageSize]
+		resp.NextPageToken = encodePageToken(points[len(points)-1].Seq, 0)
+	}
+	resp.Points = make([]*pb.HistoryPoint, 0, len(points))
+	for _, p := range points {
+		resp.Points = append(resp.Points, &pb.HistoryPoint{
+			Parameter: p.Parameter,
+			Value:     p.Value,
+			Time:      timestamppb.New(p.Time),
+		})
+	}
+	return resp, nil
+}
+
+// historyBuckets возвращает агрегаты pageSize интервалов начиная с
+// интервала, который начинается в from (unix-наносекунды; 0 - с начала периода).
+// Пустые интервалы в начале страницы пропускаются, чтобы за длинный период
+// без изменений не приходилось листать пустые страницы. Если точек больше
+// maxBucketPagePoints, страница заканчивается раньше.
+func (s *GRPCServer) historyBuckets(query history.Query, bucket time.Duration, from int64, pageSize int) (*pb.GetDeviceHistoryResponse, error) {
+	if from != 0 && time.Unix(0, from).After(query.From) {
+		query.From = time.Unix(0, from)
+	}
+
+	// Точки записываются по мере изменений, поэтому первая по Seq точка
+	// периода - и самая ранняя
+	first := query
+	first.Limit = 1
+	points, err := s.history.Query(first)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to query history: %v", err)
+	}
+	resp := &pb.GetDeviceHistoryResponse{Buckets: []*pb.HistoryBucket{}}
+	if len(points) == 0 {
+		return resp, nil
+	}
+	pageStart := history.BucketStart(points[0].Time, bucket)
+	if pageStart.After(query.From) {
+		query.From = pageStart
+	}
+
+	if pageEnd := pageStart.Add(time.Duration(pageSize) * bucket); pageEnd.Before(query.To) {
+		query.To = pageEnd
+		resp.NextPageToken = encodePageToken(pageEnd.UnixNano(), bucket)
+	}
+
+	query.Limit = maxBucketPagePoints + 1
+	points, err = s.history.Query(query)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to query history: %v", err)
+	}
+	if len(points) > maxBucketPagePoints {
+		// Страница заканчивается перед интервалом первой непрочитанной точки,
+		// чтобы последний интервал не был посчитан по части точек
+		pageEnd := history.BucketStart(points[maxBucketPagePoints].Time, bucket)
+		if !pageEnd.After(pageStart) {
+			return nil, apierror.InvalidArgument("too many points in one interval",
+				apierror.FieldViolation{Field: "bucket_seconds", Description: fmt.Sprintf("interval has more than %d points, use a smaller one", maxBucketPagePoints)})
+		}
+		kept := points[:0]
+		for _, p := range points {
+			if p.Time.Before(pageEnd) {
+				kept = append(kept, p)
+			}
+		}
+		points = kept
+		resp.NextPageToken = encodePageToken(pageEnd.UnixNano(), bucket)
+	}
+
+	buckets := history.Downsample(points, bucket)
+	resp.Buckets = make([]*pb.HistoryBucket, 0, len(buckets))
+	for _, b := range buckets {
+		resp.Buckets = append(resp.Buckets, &pb.HistoryBucket{
+			Parameter:    b.Parameter,
+			StartTime:    timestamppb.New(b.Start),
+			Count:        int32(b.Count),
+			NumericCount: int32(b.NumericCount),
+			Min:          b.Min,
+			Max:          b.Max,
+			Avg:          b.Avg(),
+			Last:         b.Last,
+		})
+	}
+	return resp, nil
+}
+
+// encodePageToken кодирует продолжение страницы: Seq последней точки или
+// начало следующего интервала длины bucket
+func encodePageToken(cursor int64, bucket time.Duration) string {
+	token := fmt.Sprintf("%d:%d", int64(bucket/time.Second), cursor)
+	return base64.RawURLEncoding.EncodeToString([]byte(token))
+}
+
+// decodePageToken возвращает продолжение страницы (0 для пустого токена).
+// Токен другого bucket_seconds недействителен.
+func decodePageToken(token string, bucket time.Duration) (int64, bool) {
+	if token == "" {
+		return 0, true
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, false
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 || parts[0] != strconv.FormatInt(int64(bucket/time.Second), 10) {
+		return 0, false
+	}
+	cursor, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || cursor <= 0 {
+		return 0, false
+	}
+	return cursor, true
+}
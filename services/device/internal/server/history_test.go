@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/history"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestGetDeviceHistory_Validation(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	socket := createDeviceInRoom(t, s, "socket", "")
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		req   *pb.GetDeviceHistoryRequest
+		code  codes.Code
+		field string
+	}{
+		{"Defaults", &pb.GetDeviceHistoryRequest{DeviceId: socket.Id}, codes.OK, ""},
+		{"UnknownDevice", &pb.GetDeviceHistoryRequest{DeviceId: "missing"}, codes.NotFound, ""},
+		{"StartAfterEnd", &pb.GetDeviceHistoryRequest{DeviceId: socket.Id, StartTime: timestamppb.New(now), EndTime: timestamppb.New(now.Add(-time.Hour))}, codes.InvalidArgument, "start_time"},
+		{"EmptyParameter", &pb.GetDeviceHistoryRequest{DeviceId: socket.Id, Parameters: []string{"power", " "}}, codes.InvalidArgument, "parameters[1]"},
+		{"NegativeBucket", &pb.GetDeviceHistoryRequest{DeviceId: socket.Id, BucketSeconds: -60}, codes.InvalidArgument, "bucket_seconds"},
+		{"PageTooLarge", &pb.GetDeviceHistoryRequest{DeviceId: socket.Id, PageSize: 5001}, codes.InvalidArgument, "page_size"},
+		{"InvalidToken", &pb.GetDeviceHistoryRequest{DeviceId: socket.Id, PageToken: "!!"}, codes.InvalidArgument, "page_token"},
+		{"TokenOfOtherBucket", &pb.GetDeviceHistoryRequest{DeviceId: socket.Id, BucketSeconds: 60, PageToken: encodePageToken(1, 0)}, codes.InvalidArgument, "page_token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.GetDeviceHistory(ctx, tt.req)
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v (err: %v)", code, tt.code, err)
+			}
+			if tt.field != "" {
+				assertViolation(t, err, tt.field)
+			}
+		})
+	}
+}
+
+func TestGetDeviceHistory_RecordsChanges(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	socket := createDeviceInRoom(t, s, "socket", "")
+
+	if _, err := s.ControlDevice(ctx, &pb.ControlDeviceRequest{Id: socket.Id, Command: &pb.Command{Action: "turn_on"}}); err != nil {
+		t.Fatalf("ControlDevice: %v", err)
+	}
+	resp, err := s.GetDeviceHistory(ctx, &pb.GetDeviceHistoryRequest{DeviceId: socket.Id, Parameters: []string{"power"}})
+	if err != nil {
+		t.Fatalf("GetDeviceHistory: %v", err)
+	}
+	if n := len(resp.Points); n == 0 || resp.Points[n-1].Value != "on" {
+		t.Fatalf("points = %v, want last power = on", resp.Points)
+	}
+}
+
+func TestGetDeviceHistory_Pages(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	sensor := createDeviceInRoom(t, s, "sensor", "")
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var points []history.Point
+	for i := 0; i < 10; i++ {
+		points = append(points, history.Point{
+			DeviceID:  sensor.Id,
+			Parameter: "temperature",
+			Value:     fmt.Sprint(20 + i),
+			Time:      start.Add(time.Duration(i) * 30 * time.Second),
+		})
+	}
+	if err := s.history.Append(points); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	request := func(bucketSeconds int32) *pb.GetDeviceHistoryRequest {
+		return &pb.GetDeviceHistoryRequest{
+			DeviceId:      sensor.Id,
+			StartTime:     timestamppb.New(start),
+			EndTime:       timestamppb.New(start.Add(5 * time.Minute)),
+			Parameters:    []string{"temperature"},
+			BucketSeconds: bucketSeconds,
+			PageSize:      4,
+		}
+	}
+
+	t.Run("Points", func(t *testing.T) {
+		var values []string
+		for page := request(0); ; {
+			resp, err := s.GetDeviceHistory(ctx, page)
+			if err != nil {
+				t.Fatalf("GetDeviceHistory: %v", err)
+			}
+			if len(resp.Points) > 4 {
+				t.Fatalf("page of %d points, want at most 4", len(resp.Points))
+			}
+			for _, p := range resp.Points {
+				values = append(values, p.Value)
+			}
+			if resp.NextPageToken == "" {
+				break
+			}
+			page.PageToken = resp.NextPageToken
+		}
+		if got := fmt.Sprint(values); got != "[20 21 22 23 24 25 26 27 28 29]" {
+			t.Errorf("values = %s", got)
+		}
+	})
+
+	// Ограничение числа точек на страницу сокращает страницы, но не меняет агрегаты
+	for _, tt := range []struct {
+		name      string
+		maxPoints int
+		pages     int
+	}{
+		{"Buckets", 100000, 2},
+		{"BucketsPointLimit", 3, 5},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(old int) { maxBucketPagePoints = old }(maxBucketPagePoints)
+			maxBucketPagePoints = tt.maxPoints
+
+			// Час до первой точки не дает пустых страниц
+			page := request(60)
+			page.StartTime = timestamppb.New(start.Add(-time.Hour))
+			var avgs []float64
+			pages := 0
+			for {
+				pages++
+				resp, err := s.GetDeviceHistory(ctx, page)
+				if err != nil {
+					t.Fatalf("GetDeviceHistory: %v", err)
+				}
+				for _, b := range resp.Buckets {
+					if b.Count != 2 {
+						t.Errorf("bucket %v count = %d, want 2", b.StartTime.AsTime(), b.Count)
+					}
+					avgs = append(avgs, b.Avg)
+				}
+				if resp.NextPageToken == "" {
+					break
+				}
+				page.PageToken = resp.NextPageToken
+			}
+			if pages != tt.pages {
+				t.Errorf("pages = %d, want %d", pages, tt.pages)
+			}
+			if got := fmt.Sprint(avgs); got != "[20.5 22.5 24.5 26.5 28.5]" {
+				t.Errorf("averages = %s", got)
+			}
+		})
+	}
+
+	t.Run("TooManyPointsInBucket", func(t *testing.T) {
+		defer func(old int) { maxBucketPagePoints = old }(maxBucketPagePoints)
+		maxBucketPagePoints = 1
+
+		_, err := s.GetDeviceHistory(ctx, request(60))
+		if code := status.Code(err); code != codes.InvalidArgument {
+			t.Fatalf("code = %v, want InvalidArgument (err: %v)", code, err)
+		}
+		assertViolation(t, err, "bucket_seconds")
+	})
+}
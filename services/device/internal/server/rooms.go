@@ -0,0 +1,349 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Ограничения полей комнаты
+const (
+	maxAliases     = 20
+	maxAliasLength = 50
+	maxIconLength  = 50
+)
+
+// updatableRoomFields - поля, которые можно изменить через UpdateRoom
+var updatableRoomFields = []string{"name", "aliases", "floor", "icon"}
+
+// ListRooms реализует gRPC метод для получения списка комнат
+func (s *GRPCServer) ListRooms(ctx context.Context, req *pb.ListRoomsRequest) (*pb.ListRoomsResponse, error) {
+	rooms, err := s.store.ListRooms()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list rooms: %v", err)
+	}
+
+	protoRooms := make([]*pb.Room, 0, len(rooms))
+	for _, room := range rooms {
+		protoRooms = append(protoRooms, room.ToProto())
+	}
+
+	return &pb.ListRoomsResponse{
+		Rooms:      protoRooms,
+		TotalCount: int32(len(protoRooms)),
+	}, nil
+}
+
+// GetRoom реализует gRPC метод для получения комнаты по ID
+func (s *GRPCServer) GetRoom(ctx context.Context, req *pb.RoomId) (*pb.GetRoomResponse, error) {
+	room, err := s.store.GetRoom(req.Id)
+	if err != nil {
+		return nil, getRoomError(req.Id, err)
+	}
+	return &pb.GetRoomResponse{Room: room.ToProto()}, nil
+}
+
+// CreateRoom реализует gRPC метод для создания комнаты
+func (s *GRPCServer) CreateRoom(ctx context.Context, req *pb.CreateRoomRequest) (*pb.CreateRoomResponse, error) {
+	if req.Room == nil {
+		return nil, apierror.InvalidArgument("room is required",
+			apierror.FieldViolation{Field: "room", Description: "must be set"})
+	}
+
+	log.Printf("CreateRoom request: name: %q", req.Room.Name)
+
+	var violations []apierror.FieldViolation
+	for _, field := range updatableRoomFields {
+		violations = append(violations, validateRoomField(req.Room, field)...)
+	}
+	if len(violations) > 0 {
+		return nil, apierror.InvalidArgument("invalid room", violations...)
+	}
+
+	room := model.NewRoom(strings.TrimSpace(req.Room.Name), req.Room.Floor, req.Room.Icon, trimAll(req.Room.Aliases)...)
+
+	s.roomMu.Lock()
+	defer s.roomMu.Unlock()
+
+	if err := s.checkRoomNames(room); err != nil {
+		return nil, err
+	}
+	if err := s.store.SaveRoom(room); err != nil {
+		log.Printf("CreateRoom: failed to save room: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to save room: %v", err)
+	}
+
+	return &pb.CreateRoomResponse{Room: room.ToProto()}, nil
+}
+
+// UpdateRoom реализует gRPC метод для изменения комнаты по маске полей
+func (s *GRPCServer) UpdateRoom(ctx context.Context, req *pb.UpdateRoomRequest) (*pb.UpdateRoomResponse, error) {
+	if req.Room == nil {
+		return nil, apierror.InvalidArgument("room is required",
+			apierror.FieldViolation{Field: "room", Description: "must be set"})
+	}
+	id := req.Room.Id
+	if id == "" {
+		return nil, apierror.InvalidArgument("room ID is required",
+			apierror.FieldViolation{Field: "room.id", Description: "must not be empty"})
+	}
+
+	paths := req.UpdateMask.GetPaths()
+	if len(paths) == 0 {
+		paths = updatableRoomFields
+	}
+
+	log.Printf("UpdateRoom request for ID: %s, fields: %v", id, paths)
+
+	var violations []apierror.FieldViolation
+	for _, path := range paths {
+		switch path {
+		case "name", "aliases", "floor", "icon":
+			violations = append(violations, validateRoomField(req.Room, path)...)
+		case "id":
+			// id совпадает с комнатой из пути запроса и не изменяется
+		default:
+			violations = append(violations, apierror.FieldViolation{
+				Field:       "update_mask",
+				Description: fmt.Sprintf("field %q cannot be updated, expected %s", path, strings.Join(updatableRoomFields, ", ")),
+			})
+		}
+	}
+	if len(violations) > 0 {
+		return nil, apierror.InvalidArgument("invalid room update", violations...)
+	}
+
+	s.roomMu.Lock()
+	defer s.roomMu.Unlock()
+
+	room, err := s.store.GetRoom(id)
+	if err != nil {
+		return nil, getRoomError(id, err)
+	}
+	for _, path := range paths {
+		switch path {
+		case "name":
+			room.Name = strings.TrimSpace(req.Room.Name)
+		case "aliases":
+			room.Aliases = trimAll(req.Room.Aliases)
+		case "floor":
+			room.Floor = req.Room.Floor
+		case "icon":
+			room.Icon = req.Room.Icon
+		}
+	}
+	// Новое имя не должно совпадать с псевдонимами, оставшимися без изменений
+	if violations := validateRoomField(room.ToProto(), "aliases"); len(violations) > 0 {
+		return nil, apierror.InvalidArgument("invalid room update", violations...)
+	}
+
+	if err := s.checkRoomNames(room); err != nil {
+		return nil, err
+	}
+	if err := s.store.SaveRoom(room); err != nil {
+		log.Printf("UpdateRoom: failed to save room %s: %v", id, err)
+		return nil, status.Errorf(codes.Internal, "failed to save room: %v", err)
+	}
+
+	return &pb.UpdateRoomResponse{Room: room.ToProto()}, nil
+}
+
+// DeleteRoom реализует gRPC метод для удаления комнаты
+func (s *GRPCServer) DeleteRoom(ctx context.Context, req *pb.RoomId) (*pb.Empty, error) {
+	log.Printf("DeleteRoom request for ID: %s", req.Id)
+
+	if err := s.store.DeleteRoom(req.Id); err != nil {
+		return nil, getRoomError(req.Id, err)
+	}
+	return &pb.Empty{}, nil
+}
+
+// GetRoomSummary реализует gRPC метод для получения сводного состояния комнаты
+func (s *GRPCServer) GetRoomSummary(ctx context.Context, req *pb.RoomId) (*pb.RoomSummary, error) {
+	room, err := s.store.GetRoom(req.Id)
+	if err != nil {
+		return nil, getRoomError(req.Id, err)
+	}
+
+	devices, err := s.store.ListDevices("", false)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list devices: %v", err)
+	}
+
+	return summarizeRoom(room, filterByRoom(devices, room.ID)), nil
+}
+
+// summarizeRoom собирает сводное состояние устройств комнаты. Показания
+// устройств не в сети не учитываются.
+func summarizeRoom(room *model.Room, devices []*model.Device) *pb.RoomSummary {
+	summary := &pb.RoomSummary{
+		Room:          room.ToProto(),
+		OpenSensorIds: []string{},
+	}
+	var temperature, target, humidity average
+
+	for _, device := range devices {
+		summary.DeviceCount++
+		if device.Type == model.DeviceTypeLamp {
+			summary.LightsTotal++
+		}
+		if device.Status == nil || !device.Status.Online {
+			continue
+		}
+		summary.OnlineCount++
+
+		params := device.Status.Parameters
+		switch device.Type {
+		case model.DeviceTypeLamp:
+			if params[model.ParamPower] == "on" {
+				summary.LightsOn++
+			}
+		case model.DeviceTypeSensor:
+			temperature.add(params[model.ParamTemperature])
+			if params[model.ParamContact] == "open" {
+				summary.OpenSensors++
+				summary.OpenSensorIds = append(summary.OpenSensorIds, device.ID)
+			}
+		case model.DeviceTypeThermostat:
+			// У термостата temperature - целевая температура
+			if params[model.ParamPower] != "off" {
+				target.add(params[model.ParamTemperature])
+			}
+		}
+		humidity.add(params[model.ParamHumidity])
+	}
+
+	summary.Temperature = temperature.value()
+	summary.TargetTemperature = target.value()
+	summary.Humidity = humidity.value()
+	return summary
+}
+
+// average вычисляет среднее числовых показаний, пропуская пустые и
+// некорректные значения
+type average struct {
+	sum float64
+	n   int
+}
+
+func (a *average) add(value string) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	a.sum += v
+	a.n++
+}
+
+// value возвращает среднее, округленное до десятых (nil - нет показаний)
+func (a *average) value() *float64 {
+	if a.n == 0 {
+		return nil
+	}
+	v := math.Round(a.sum/float64(a.n)*10) / 10
+	return &v
+}
+
+// filterByRoom возвращает устройства комнаты roomID
+func filterByRoom(devices []*model.Device, roomID string) []*model.Device {
+	result := make([]*model.Device, 0, len(devices))
+	for _, device := range devices {
+		if device.RoomID == roomID {
+			result = append(result, device)
+		}
+	}
+	return result
+}
+
+// checkRoomNames проверяет, что имя и псевдонимы комнаты не заняты другими
+// комнатами: по ним голосовые команды находят комнату. Вызывается под roomMu.
+func (s *GRPCServer) checkRoomNames(room *model.Room) error {
+	rooms, err := s.store.ListRooms()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to list rooms: %v", err)
+	}
+	for _, other := range rooms {
+		if other.ID == room.ID {
+			continue
+		}
+		for _, name := range room.Names() {
+			if other.Matches(name) {
+				return apierror.Newf(codes.AlreadyExists, apierror.ReasonRoomAlreadyExists,
+					"name %q is already used by room %s", name, other.Name).
+					WithMetadata("room_id", other.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// validateRoomField проверяет поле комнаты
+func validateRoomField(room *pb.Room, field string) []apierror.FieldViolation {
+	switch field {
+	case "name":
+		name := strings.TrimSpace(room.Name)
+		if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+			return []apierror.FieldViolation{{Field: "room.name", Description: fmt.Sprintf("must be 1 to %d characters", maxNameLength)}}
+		}
+
+	case "aliases":
+		if len(room.Aliases) > maxAliases {
+			return []apierror.FieldViolation{{Field: "room.aliases", Description: fmt.Sprintf("must contain at most %d aliases", maxAliases)}}
+		}
+		seen := make(map[string]bool, len(room.Aliases))
+		for i, alias := range trimAll(room.Aliases) {
+			field := fmt.Sprintf("room.aliases[%d]", i)
+			if alias == "" || utf8.RuneCountInString(alias) > maxAliasLength {
+				return []apierror.FieldViolation{{Field: field, Description: fmt.Sprintf("must be 1 to %d characters", maxAliasLength)}}
+			}
+			key := strings.ToLower(alias)
+			if seen[key] || strings.EqualFold(alias, strings.TrimSpace(room.Name)) {
+				return []apierror.FieldViolation{{Field: field, Description: "must differ from the room name and other aliases"}}
+			}
+			seen[key] = true
+		}
+
+	case "icon":
+		if utf8.RuneCountInString(room.Icon) > maxIconLength {
+			return []apierror.FieldViolation{{Field: "room.icon", Description: fmt.Sprintf("must be at most %d characters", maxIconLength)}}
+		}
+	}
+	return nil
+}
+
+// trimAll возвращает строки без пробелов по краям
+func trimAll(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		result = append(result, strings.TrimSpace(v))
+	}
+	return result
+}
+
+// getRoomError преобразует ошибку хранилища комнат в ошибку gRPC
+func getRoomError(id string, err error) error {
+	switch {
+	case errors.Is(err, datastore.ErrRoomNotFound):
+		return apierror.Newf(codes.NotFound, apierror.ReasonRoomNotFound, "room with ID %s not found", id).
+			WithMetadata("room_id", id)
+	case errors.Is(err, datastore.ErrInvalidRoomID):
+		return apierror.InvalidArgument("room ID is required",
+			apierror.FieldViolation{Field: "id", Description: "must not be empty"})
+	case errors.Is(err, datastore.ErrRoomNotEmpty):
+		return apierror.Newf(codes.FailedPrecondition, apierror.ReasonRoomNotEmpty,
+			"room %s has devices, move them to another room first", id).WithMetadata("room_id", id)
+	}
+	return status.Errorf(codes.Internal, "failed to get room: %v", err)
+}
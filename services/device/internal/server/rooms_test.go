@@ -0,0 +1,294 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestCreateRoom(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	if _, err := s.CreateRoom(ctx, &pb.CreateRoomRequest{Room: &pb.Room{Name: "Кухня", Aliases: []string{"кухне"}}}); err != nil {
+		t.Fatalf("CreateRoom failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		room   *pb.Room
+		code   codes.Code
+		field  string
+		reason string
+	}{
+		{"Valid", &pb.Room{Name: " Гостиная ", Aliases: []string{" гостиной ", "зал"}, Floor: 2, Icon: "sofa"}, codes.OK, "", ""},
+		{"NoRoom", nil, codes.InvalidArgument, "room", ""},
+		{"EmptyName", &pb.Room{Name: " "}, codes.InvalidArgument, "room.name", ""},
+		{"EmptyAlias", &pb.Room{Name: "Спальня", Aliases: []string{"спальне", ""}}, codes.InvalidArgument, "room.aliases[1]", ""},
+		{"DuplicateAlias", &pb.Room{Name: "Спальня", Aliases: []string{"спальне", "Спальне"}}, codes.InvalidArgument, "room.aliases[1]", ""},
+		{"AliasIsName", &pb.Room{Name: "Спальня", Aliases: []string{"спальня"}}, codes.InvalidArgument, "room.aliases[0]", ""},
+		{"NameTaken", &pb.Room{Name: "кухня"}, codes.AlreadyExists, "", apierror.ReasonRoomAlreadyExists},
+		{"AliasTaken", &pb.Room{Name: "Столовая", Aliases: []string{"Кухне"}}, codes.AlreadyExists, "", apierror.ReasonRoomAlreadyExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.CreateRoom(ctx, &pb.CreateRoomRequest{Room: tt.room})
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v (err: %v)", code, tt.code, err)
+			}
+			if tt.field != "" {
+				assertViolation(t, err, tt.field)
+			}
+			if tt.reason != "" && apierror.Reason(err) != tt.reason {
+				t.Errorf("reason = %q, want %q", apierror.Reason(err), tt.reason)
+			}
+			if err != nil {
+				return
+			}
+
+			if resp.Room.Id == "" || resp.Room.Name != "Гостиная" || len(resp.Room.Aliases) != 2 || resp.Room.Aliases[0] != "гостиной" || resp.Room.Floor != 2 {
+				t.Errorf("unexpected room: %+v", resp.Room)
+			}
+		})
+	}
+
+	rooms, err := s.ListRooms(ctx, &pb.ListRoomsRequest{})
+	if err != nil {
+		t.Fatalf("ListRooms failed: %v", err)
+	}
+	if rooms.TotalCount != 2 || rooms.Rooms[0].Name != "Кухня" || rooms.Rooms[1].Name != "Гостиная" {
+		t.Errorf("unexpected rooms: %v", rooms.Rooms)
+	}
+}
+
+func TestUpdateRoom_RenamesDevices(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	kitchen := createRoom(t, s, "Кухня")
+	createRoom(t, s, "Гостиная")
+	lamp := createDeviceInRoom(t, s, "lamp", kitchen.Id)
+	if lamp.Room != "Кухня" || lamp.RoomId != kitchen.Id {
+		t.Fatalf("unexpected device: %+v", lamp)
+	}
+
+	resp, err := s.UpdateRoom(ctx, &pb.UpdateRoomRequest{
+		Room:       &pb.Room{Id: kitchen.Id, Name: "Кухня-столовая", Floor: 3},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateRoom failed: %v", err)
+	}
+	if resp.Room.Name != "Кухня-столовая" || resp.Room.Floor != 0 {
+		t.Errorf("unexpected room after masked update: %+v", resp.Room)
+	}
+
+	// Устройства показывают текущее имя комнаты
+	got, err := s.GetDevice(ctx, &pb.DeviceId{Id: lamp.Id})
+	if err != nil {
+		t.Fatalf("GetDevice failed: %v", err)
+	}
+	if got.Device.Room != "Кухня-столовая" {
+		t.Errorf("room = %q, want the new room name", got.Device.Room)
+	}
+	list, err := s.ListDevices(ctx, &pb.ListDevicesRequest{})
+	if err != nil {
+		t.Fatalf("ListDevices failed: %v", err)
+	}
+	if len(list.Devices) != 1 || list.Devices[0].Room != "Кухня-столовая" {
+		t.Errorf("unexpected devices: %v", list.Devices)
+	}
+
+	// Имя другой комнаты занято
+	_, err = s.UpdateRoom(ctx, &pb.UpdateRoomRequest{
+		Room:       &pb.Room{Id: kitchen.Id, Aliases: []string{"гостиная"}},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"aliases"}},
+	})
+	if apierror.Reason(err) != apierror.ReasonRoomAlreadyExists {
+		t.Errorf("expected %s, got %v", apierror.ReasonRoomAlreadyExists, err)
+	}
+	_, err = s.UpdateRoom(ctx, &pb.UpdateRoomRequest{
+		Room:       &pb.Room{Id: kitchen.Id, Aliases: []string{"кухне"}},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"aliases"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateRoom failed: %v", err)
+	}
+	// Имя совпадает с прежним псевдонимом
+	_, err = s.UpdateRoom(ctx, &pb.UpdateRoomRequest{
+		Room:       &pb.Room{Id: kitchen.Id, Name: "Кухне"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	assertViolation(t, err, "room.aliases[0]")
+	_, err = s.UpdateRoom(ctx, &pb.UpdateRoomRequest{Room: &pb.Room{Id: "missing", Name: "Чердак"}})
+	if apierror.Reason(err) != apierror.ReasonRoomNotFound {
+		t.Errorf("expected %s, got %v", apierror.ReasonRoomNotFound, err)
+	}
+}
+
+func TestDeviceRoomAssignment(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	kitchen := createRoom(t, s, "Кухня")
+	hall := createRoom(t, s, "Гостиная")
+	lamp := createDeviceInRoom(t, s, "lamp", kitchen.Id)
+	createDeviceInRoom(t, s, "socket", "")
+
+	// Несуществующая комната
+	_, err := s.CreateDevice(ctx, &pb.CreateDeviceRequest{Device: &pb.Device{Name: "Лампа", Type: "lamp", RoomId: "missing"}})
+	assertViolation(t, err, "device.room_id")
+
+	// Перенос в другую комнату
+	resp, err := s.UpdateDevice(ctx, &pb.UpdateDeviceRequest{
+		Device:     &pb.Device{Id: lamp.Id, RoomId: hall.Id, Room: "Кладовка"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"room_id", "room"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateDevice failed: %v", err)
+	}
+	if resp.Device.RoomId != hall.Id || resp.Device.Room != "Гостиная" {
+		t.Errorf("unexpected device after move: %+v", resp.Device)
+	}
+
+	// Фильтр по комнате
+	list, err := s.ListDevices(ctx, &pb.ListDevicesRequest{RoomId: hall.Id})
+	if err != nil {
+		t.Fatalf("ListDevices failed: %v", err)
+	}
+	if list.TotalCount != 1 || list.Devices[0].Id != lamp.Id {
+		t.Errorf("unexpected devices in room: %v", list.Devices)
+	}
+	if list, _ := s.ListDevices(ctx, &pb.ListDevicesRequest{RoomId: kitchen.Id}); list.TotalCount != 0 {
+		t.Errorf("expected empty kitchen, got %v", list.Devices)
+	}
+	if _, err := s.ListDevices(ctx, &pb.ListDevicesRequest{RoomId: "missing"}); apierror.Reason(err) != apierror.ReasonRoomNotFound {
+		t.Errorf("expected %s, got %v", apierror.ReasonRoomNotFound, err)
+	}
+
+	// Изменение без маски не отвязывает устройство от комнаты
+	resp, err = s.UpdateDevice(ctx, &pb.UpdateDeviceRequest{
+		Device: &pb.Device{Id: lamp.Id, Name: "Торшер"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateDevice without mask failed: %v", err)
+	}
+	if resp.Device.Name != "Торшер" || resp.Device.RoomId != hall.Id || resp.Device.Room != "Гостиная" {
+		t.Errorf("update without mask must keep the room: %+v", resp.Device)
+	}
+
+	// Комнату с устройствами удалить нельзя
+	if _, err := s.DeleteRoom(ctx, &pb.RoomId{Id: hall.Id}); apierror.Reason(err) != apierror.ReasonRoomNotEmpty {
+		t.Fatalf("expected %s, got %v", apierror.ReasonRoomNotEmpty, err)
+	}
+	_, err = s.UpdateDevice(ctx, &pb.UpdateDeviceRequest{
+		Device:     &pb.Device{Id: lamp.Id},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"room_id"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateDevice failed: %v", err)
+	}
+	if _, err := s.DeleteRoom(ctx, &pb.RoomId{Id: hall.Id}); err != nil {
+		t.Fatalf("DeleteRoom failed: %v", err)
+	}
+	if _, err := s.GetRoom(ctx, &pb.RoomId{Id: hall.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetRoom after delete: %v, want NotFound", err)
+	}
+
+	// room без room_id задает название вручную и отвязывает устройство
+	socket := createDeviceInRoom(t, s, "socket", kitchen.Id)
+	resp, err = s.UpdateDevice(ctx, &pb.UpdateDeviceRequest{
+		Device:     &pb.Device{Id: socket.Id, Room: "Балкон"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"room"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateDevice failed: %v", err)
+	}
+	if resp.Device.RoomId != "" || resp.Device.Room != "Балкон" {
+		t.Errorf("expected device detached with room Балкон, got %+v", resp.Device)
+	}
+	if list, _ := s.ListDevices(ctx, &pb.ListDevicesRequest{RoomId: kitchen.Id}); list.TotalCount != 0 {
+		t.Errorf("expected empty kitchen, got %v", list.Devices)
+	}
+}
+
+func TestGetRoomSummary(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	room := createRoom(t, s, "Гостиная")
+
+	set := func(id string, params map[string]string, online bool) {
+		t.Helper()
+		status := model.NewDeviceStatus()
+		status.Online = online
+		status.Parameters = params
+		if err := s.store.UpdateDeviceStatus(id, status); err != nil {
+			t.Fatalf("UpdateDeviceStatus failed: %v", err)
+		}
+	}
+	set(createDeviceInRoom(t, s, "lamp", room.Id).Id, map[string]string{"power": "on"}, true)
+	set(createDeviceInRoom(t, s, "lamp", room.Id).Id, map[string]string{"power": "off"}, true)
+	set(createDeviceInRoom(t, s, "lamp", room.Id).Id, map[string]string{"power": "on"}, false)
+	set(createDeviceInRoom(t, s, "sensor", room.Id).Id, map[string]string{"temperature": "21", "humidity": "40"}, true)
+	door := createDeviceInRoom(t, s, "sensor", room.Id)
+	set(door.Id, map[string]string{"temperature": "22.5", "contact": "open"}, true)
+	set(createDeviceInRoom(t, s, "thermostat", room.Id).Id, map[string]string{"power": "on", "temperature": "23", "humidity": "50"}, true)
+	set(createDeviceInRoom(t, s, "sensor", "").Id, map[string]string{"temperature": "30", "contact": "open"}, true)
+
+	summary, err := s.GetRoomSummary(ctx, &pb.RoomId{Id: room.Id})
+	if err != nil {
+		t.Fatalf("GetRoomSummary failed: %v", err)
+	}
+	if summary.Room.Id != room.Id || summary.DeviceCount != 6 || summary.OnlineCount != 5 {
+		t.Errorf("unexpected counts: %v", summary)
+	}
+	if summary.LightsTotal != 3 || summary.LightsOn != 1 {
+		t.Errorf("lights = %d/%d, want 1/3", summary.LightsOn, summary.LightsTotal)
+	}
+	if summary.Temperature == nil || *summary.Temperature != 21.8 {
+		t.Errorf("temperature = %v, want 21.8", summary.Temperature)
+	}
+	if summary.TargetTemperature == nil || *summary.TargetTemperature != 23 {
+		t.Errorf("target temperature = %v, want 23", summary.TargetTemperature)
+	}
+	if summary.Humidity == nil || *summary.Humidity != 45 {
+		t.Errorf("humidity = %v, want 45", summary.Humidity)
+	}
+	if summary.OpenSensors != 1 || len(summary.OpenSensorIds) != 1 || summary.OpenSensorIds[0] != door.Id {
+		t.Errorf("unexpected open sensors: %d %v", summary.OpenSensors, summary.OpenSensorIds)
+	}
+
+	// Комната без показаний
+	empty := createRoom(t, s, "Кладовка")
+	summary, err = s.GetRoomSummary(ctx, &pb.RoomId{Id: empty.Id})
+	if err != nil {
+		t.Fatalf("GetRoomSummary failed: %v", err)
+	}
+	if summary.DeviceCount != 0 || summary.Temperature != nil || summary.Humidity != nil {
+		t.Errorf("unexpected summary of empty room: %v", summary)
+	}
+}
+
+func createRoom(t *testing.T, s *GRPCServer, name string) *pb.Room {
+	t.Helper()
+	resp, err := s.CreateRoom(context.Background(), &pb.CreateRoomRequest{Room: &pb.Room{Name: name}})
+	if err != nil {
+		t.Fatalf("CreateRoom failed: %v", err)
+	}
+	return resp.Room
+}
+
+func createDeviceInRoom(t *testing.T, s *GRPCServer, deviceType, roomID string) *pb.Device {
+	t.Helper()
+	resp, err := s.CreateDevice(context.Background(), &pb.CreateDeviceRequest{Device: &pb.Device{
+		Name: deviceType, Type: deviceType, RoomId: roomID,
+	}})
+	if err != nil {
+		t.Fatalf("CreateDevice failed: %v", err)
+	}
+	return resp.Device
+}
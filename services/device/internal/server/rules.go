@@ -0,0 +1,522 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/automation"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Ограничения правила автоматизации
+const (
+	maxRuleTriggers   = 10
+	maxRuleConditions = 10
+	maxRuleActions    = 20
+	maxRuleDelay      = 24 * time.Hour // Также максимальный cooldown
+)
+
+// updatableRuleFields - поля, которые можно изменить через UpdateRule
+var updatableRuleFields = []string{"name", "enabled", "triggers", "conditions", "actions", "cooldown_seconds"}
+
+// conditionOperators - операторы условия device_state
+var conditionOperators = []string{"eq", "ne", "gt", "gte", "lt", "lte"}
+
+// ListRules реализует gRPC метод для получения списка правил
+func (s *GRPCServer) ListRules(ctx context.Context, req *pb.ListRulesRequest) (*pb.ListRulesResponse, error) {
+	rules, err := s.store.ListRules()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list rules: %v", err)
+	}
+
+	protoRules := make([]*pb.Rule, 0, len(rules))
+	for _, rule := range rules {
+		protoRules = append(protoRules, rule.ToProto())
+	}
+
+	return &pb.ListRulesResponse{
+		Rules:      protoRules,
+		TotalCount: int32(len(protoRules)),
+	}, nil
+}
+
+// GetRule реализует gRPC метод для получения правила по ID
+func (s *GRPCServer) GetRule(ctx context.Context, req *pb.RuleId) (*pb.GetRuleResponse, error) {
+	rule, err := s.store.GetRule(req.Id)
+	if err != nil {
+		return nil, getRuleError(req.Id, err)
+	}
+	return &pb.GetRuleResponse{Rule: rule.ToProto()}, nil
+}
+
+// CreateRule реализует gRPC метод для создания правила
+func (s *GRPCServer) CreateRule(ctx context.Context, req *pb.CreateRuleRequest) (*pb.CreateRuleResponse, error) {
+	if req.Rule == nil {
+		return nil, apierror.InvalidArgument("rule is required",
+			apierror.FieldViolation{Field: "rule", Description: "must be set"})
+	}
+
+	log.Printf("CreateRule request: name: %q, triggers: %d, actions: %d", req.Rule.Name, len(req.Rule.Triggers), len(req.Rule.Actions))
+
+	rule := model.NewRule(strings.TrimSpace(req.Rule.Name))
+	violations, err := s.applyRuleFields(rule, req.Rule, updatableRuleFields)
+	if err != nil {
+		return nil, err
+	}
+	if len(violations) > 0 {
+		return nil, apierror.InvalidArgument("invalid rule", violations...)
+	}
+
+	s.ruleMu.Lock()
+	defer s.ruleMu.Unlock()
+
+	if err := s.store.SaveRule(rule); err != nil {
+		log.Printf("CreateRule: failed to save rule: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to save rule: %v", err)
+	}
+	s.reloadRules()
+
+	return &pb.CreateRuleResponse{Rule: rule.ToProto()}, nil
+}
+
+// UpdateRule реализует gRPC метод для изменения правила по маске полей.
+// Запуск правила, ожидающий отложенных действий, отменяется.
+func (s *GRPCServer) UpdateRule(ctx context.Context, req *pb.UpdateRuleRequest) (*pb.UpdateRuleResponse, error) {
+	if req.Rule == nil {
+		return nil, apierror.InvalidArgument("rule is required",
+			apierror.FieldViolation{Field: "rule", Description: "must be set"})
+	}
+	id := req.Rule.Id
+	if id == "" {
+		return nil, apierror.InvalidArgument("rule ID is required",
+			apierror.FieldViolation{Field: "rule.id", Description: "must not be empty"})
+	}
+
+	paths := req.UpdateMask.GetPaths()
+	if len(paths) == 0 {
+		paths = updatableRuleFields
+	}
+
+	log.Printf("UpdateRule request for ID: %s, fields: %v", id, paths)
+
+	s.ruleMu.Lock()
+	defer s.ruleMu.Unlock()
+
+	rule, err := s.store.GetRule(id)
+	if err != nil {
+		return nil, getRuleError(id, err)
+	}
+	violations, err := s.applyRuleFields(rule, req.Rule, paths)
+	if err != nil {
+		return nil, err
+	}
+	if len(violations) > 0 {
+		return nil, apierror.InvalidArgument("invalid rule update", violations...)
+	}
+
+	if err := s.store.SaveRule(rule); err != nil {
+		log.Printf("UpdateRule: failed to save rule %s: %v", id, err)
+		return nil, status.Errorf(codes.Internal, "failed to save rule: %v", err)
+	}
+	s.reloadRules()
+
+	return &pb.UpdateRuleResponse{Rule: rule.ToProto()}, nil
+}
+
+// DeleteRule реализует gRPC метод для удаления правила
+func (s *GRPCServer) DeleteRule(ctx context.Context, req *pb.RuleId) (*pb.Empty, error) {
+	log.Printf("DeleteRule request for ID: %s", req.Id)
+
+	s.ruleMu.Lock()
+	defer s.ruleMu.Unlock()
+
+	if err := s.store.DeleteRule(req.Id); err != nil {
+		return nil, getRuleError(req.Id, err)
+	}
+	s.reloadRules()
+	return &pb.Empty{}, nil
+}
+
+// EnableRule реализует gRPC метод для включения правила
+func (s *GRPCServer) EnableRule(ctx context.Context, req *pb.RuleId) (*pb.UpdateRuleResponse, error) {
+	return s.setRuleEnabled(req.Id, true)
+}
+
+// DisableRule реализует gRPC метод для выключения правила. Запуск правила,
+// ожидающий отложенных действий, отменяется.
+func (s *GRPCServer) DisableRule(ctx context.Context, req *pb.RuleId) (*pb.UpdateRuleResponse, error) {
+	return s.setRuleEnabled(req.Id, false)
+}
+
+// setRuleEnabled включает или выключает правило
+func (s *GRPCServer) setRuleEnabled(id string, enabled bool) (*pb.UpdateRuleResponse, error) {
+	log.Printf("SetRuleEnabled request for ID: %s, enabled: %t", id, enabled)
+
+	s.ruleMu.Lock()
+	defer s.ruleMu.Unlock()
+
+	rule, err := s.store.GetRule(id)
+	if err != nil {
+		return nil, getRuleError(id, err)
+	}
+	if rule.Enabled != enabled {
+		rule.Enabled = enabled
+		if err := s.store.SaveRule(rule); err != nil {
+			log.Printf("SetRuleEnabled: failed to save rule %s: %v", id, err)
+			return nil, status.Errorf(codes.Internal, "failed to save rule: %v", err)
+		}
+		s.reloadRules()
+	}
+	return &pb.UpdateRuleResponse{Rule: rule.ToProto()}, nil
+}
+
+// ListRuleExecutions реализует gRPC метод для получения журнала запусков
+// правила. Журнал хранится в памяти и очищается при перезапуске сервиса.
+func (s *GRPCServer) ListRuleExecutions(ctx context.Context, req *pb.RuleId) (*pb.ListRuleExecutionsResponse, error) {
+	if _, err := s.store.GetRule(req.Id); err != nil {
+		return nil, getRuleError(req.Id, err)
+	}
+
+	executions := s.rules.Executions(req.Id)
+	resp := &pb.ListRuleExecutionsResponse{Executions: make([]*pb.RuleExecution, 0, len(executions))}
+	for _, e := range executions {
+		execution := &pb.RuleExecution{
+			Time:            timestamppb.New(e.Time),
+			Trigger:         e.Trigger,
+			Status:          e.Status,
+			Error:           e.Error,
+			ActionsExecuted: int32(e.ActionsExecuted),
+		}
+		if !e.FinishedTime.IsZero() {
+			execution.FinishedTime = timestamppb.New(e.FinishedTime)
+		}
+		resp.Executions = append(resp.Executions, execution)
+	}
+	return resp, nil
+}
+
+// Automation возвращает движок правил сервиса. Его нужно запустить Run.
+func (s *GRPCServer) Automation() *automation.Engine {
+	return s.rules
+}
+
+// reloadRules передает движку изменения правил. Вызывается под ruleMu.
+func (s *GRPCServer) reloadRules() {
+	if err := s.rules.Reload(); err != nil {
+		log.Printf("Failed to reload automation rules: %v", err)
+	}
+}
+
+// applyRuleFields проверяет поля paths правила src и переносит их в rule
+func (s *GRPCServer) applyRuleFields(rule *model.Rule, src *pb.Rule, paths []string) ([]apierror.FieldViolation, error) {
+	var violations []apierror.FieldViolation
+	for _, path := range paths {
+		var (
+			v   []apierror.FieldViolation
+			err error
+		)
+		switch path {
+		case "name":
+			v = validateRuleName(src.Name)
+			rule.Name = strings.TrimSpace(src.Name)
+		case "enabled":
+			rule.Enabled = src.Enabled
+		case "triggers":
+			v, err = s.validateRuleTriggers(src.Triggers)
+			rule.Triggers = model.RuleTriggersFromProto(src.Triggers)
+		case "conditions":
+			v, err = s.validateRuleConditions(src.Conditions)
+			rule.Conditions = model.RuleConditionsFromProto(src.Conditions)
+		case "actions":
+			v, err = s.validateRuleActions(src.Actions)
+			rule.Actions = model.RuleActionsFromProto(src.Actions)
+			for i := range rule.Actions {
+				if rule.Actions[i].DeviceID == "" {
+					rule.Actions[i].DeviceID = src.Actions[i].GetCommand().GetDeviceId()
+				}
+			}
+		case "cooldown_seconds":
+			if src.CooldownSeconds < 0 || time.Duration(src.CooldownSeconds)*time.Second > maxRuleDelay {
+				v = []apierror.FieldViolation{{Field: "rule.cooldown_seconds", Description: fmt.Sprintf("must be 0 to %d", int(maxRuleDelay/time.Second))}}
+			}
+			rule.Cooldown = time.Duration(src.CooldownSeconds) * time.Second
+		case "id":
+			// id совпадает с правилом из пути запроса и не изменяется
+		default:
+			v = []apierror.FieldViolation{{
+				Field:       "update_mask",
+				Description: fmt.Sprintf("field %q cannot be updated, expected %s", path, strings.Join(updatableRuleFields, ", ")),
+			}}
+		}
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, v...)
+	}
+	return violations, nil
+}
+
+// validateRuleName проверяет имя правила
+func validateRuleName(name string) []apierror.FieldViolation {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		return []apierror.FieldViolation{{Field: "rule.name", Description: fmt.Sprintf("must be 1 to %d characters", maxNameLength)}}
+	}
+	return nil
+}
+
+// validateRuleTriggers проверяет триггеры правила
+func (s *GRPCServer) validateRuleTriggers(triggers []*pb.RuleTrigger) ([]apierror.FieldViolation, error) {
+	if len(triggers) == 0 || len(triggers) > maxRuleTriggers {
+		return []apierror.FieldViolation{{Field: "rule.triggers", Description: fmt.Sprintf("must contain 1 to %d triggers", maxRuleTriggers)}}, nil
+	}
+
+	var violations []apierror.FieldViolation
+	for i, t := range triggers {
+		field := fmt.Sprintf("rule.triggers[%d]", i)
+		switch t.GetType() {
+		case model.TriggerParameterChanged:
+			device, v, err := s.ruleDevice(t.GetDeviceId(), field+".device_id")
+			if err != nil {
+				return nil, err
+			}
+			if device == nil {
+				violations = append(violations, v...)
+				continue
+			}
+			param, v := deviceParameter(device, t.GetParameter(), field+".parameter")
+			if param == nil {
+				violations = append(violations, v...)
+				continue
+			}
+			if t.GetValue() != "" {
+				if err := param.Validate(t.GetValue()); err != nil {
+					violations = append(violations, apierror.FieldViolation{Field: field + ".value", Description: err.Error()})
+				}
+			}
+		case model.TriggerDeviceOffline:
+			_, v, err := s.ruleDevice(t.GetDeviceId(), field+".device_id")
+			if err != nil {
+				return nil, err
+			}
+			violations = append(violations, v...)
+		case model.TriggerTime:
+			if _, err := model.ParseClock(t.GetTime()); err != nil {
+				violations = append(violations, apierror.FieldViolation{Field: field + ".time", Description: err.Error()})
+			}
+			for j, day := range t.GetDays() {
+				if !contains(model.Weekdays, day) {
+					violations = append(violations, apierror.FieldViolation{
+						Field:       fmt.Sprintf("%s.days[%d]", field, j),
+						Description: "must be one of " + strings.Join(model.Weekdays, ", "),
+					})
+				}
+			}
+		default:
+			violations = append(violations, apierror.FieldViolation{
+				Field:       field + ".type",
+				Description: fmt.Sprintf("must be one of %s, %s, %s", model.TriggerParameterChanged, model.TriggerTime, model.TriggerDeviceOffline),
+			})
+		}
+	}
+	return violations, nil
+}
+
+// validateRuleConditions проверяет условия правила
+func (s *GRPCServer) validateRuleConditions(conditions []*pb.RuleCondition) ([]apierror.FieldViolation, error) {
+	if len(conditions) > maxRuleConditions {
+		return []apierror.FieldViolation{{Field: "rule.conditions", Description: fmt.Sprintf("must contain at most %d conditions", maxRuleConditions)}}, nil
+	}
+
+	var violations []apierror.FieldViolation
+	for i, c := range conditions {
+		field := fmt.Sprintf("rule.conditions[%d]", i)
+		switch c.GetType() {
+		case model.ConditionDeviceState:
+			device, v, err := s.ruleDevice(c.GetDeviceId(), field+".device_id")
+			if err != nil {
+				return nil, err
+			}
+			if device == nil {
+				violations = append(violations, v...)
+				continue
+			}
+			if !contains(conditionOperators, c.GetOperator()) {
+				violations = append(violations, apierror.FieldViolation{
+					Field:       field + ".operator",
+					Description: "must be one of " + strings.Join(conditionOperators, ", "),
+				})
+				continue
+			}
+			numeric := c.GetOperator() != "eq" && c.GetOperator() != "ne"
+			if c.GetParameter() == model.ParamOnline {
+				if numeric {
+					violations = append(violations, apierror.FieldViolation{Field: field + ".operator", Description: "must be eq or ne for online"})
+				} else if c.GetValue() != "true" && c.GetValue() != "false" {
+					violations = append(violations, apierror.FieldViolation{Field: field + ".value", Description: "must be true or false"})
+				}
+				continue
+			}
+			if param, v := deviceParameter(device, c.GetParameter(), field+".parameter"); param == nil {
+				violations = append(violations, v...)
+				continue
+			}
+			if _, err := strconv.ParseFloat(c.GetValue(), 64); numeric && err != nil {
+				violations = append(violations, apierror.FieldViolation{Field: field + ".value", Description: "must be a number for " + c.GetOperator()})
+			}
+		case model.ConditionTimeWindow:
+			after, err := model.ParseClock(c.GetAfter())
+			if err != nil {
+				violations = append(violations, apierror.FieldViolation{Field: field + ".after", Description: err.Error()})
+			}
+			before, err := model.ParseClock(c.GetBefore())
+			if err != nil {
+				violations = append(violations, apierror.FieldViolation{Field: field + ".before", Description: err.Error()})
+			} else if after == before {
+				violations = append(violations, apierror.FieldViolation{Field: field + ".before", Description: "must differ from after"})
+			}
+		default:
+			violations = append(violations, apierror.FieldViolation{
+				Field:       field + ".type",
+				Description: fmt.Sprintf("must be one of %s, %s", model.ConditionDeviceState, model.ConditionTimeWindow),
+			})
+		}
+	}
+	return violations, nil
+}
+
+// validateRuleActions проверяет действия правила. Команды control
+// проверяются так же, как в ControlDevice.
+func (s *GRPCServer) validateRuleActions(actions []*pb.RuleAction) ([]apierror.FieldViolation, error) {
+	if len(actions) == 0 || len(actions) > maxRuleActions {
+		return []apierror.FieldViolation{{Field: "rule.actions", Description: fmt.Sprintf("must contain 1 to %d actions", maxRuleActions)}}, nil
+	}
+
+	var violations []apierror.FieldViolation
+	for i, a := range actions {
+		field := fmt.Sprintf("rule.actions[%d]", i)
+		switch a.GetType() {
+		case model.ActionControl:
+			v, err := s.validateControlAction(a.GetDeviceId(), a.GetCommand(), field)
+			if err != nil {
+				return nil, err
+			}
+			violations = append(violations, v...)
+		case model.ActionScene:
+			v, err := s.validateSceneAction(a.GetSceneId(), field)
+			if err != nil {
+				return nil, err
+			}
+			violations = append(violations, v...)
+		case model.ActionDelay:
+			if a.GetDelaySeconds() < 1 || time.Duration(a.GetDelaySeconds())*time.Second > maxRuleDelay {
+				violations = append(violations, apierror.FieldViolation{Field: field + ".delay_seconds", Description: fmt.Sprintf("must be 1 to %d", int(maxRuleDelay/time.Second))})
+			}
+		default:
+			violations = append(violations, apierror.FieldViolation{
+				Field:       field + ".type",
+				Description: fmt.Sprintf("must be one of %s, %s, %s", model.ActionControl, model.ActionScene, model.ActionDelay),
+			})
+		}
+	}
+	return violations, nil
+}
+
+// validateControlAction проверяет действие control правила или расписания
+// так же, как ControlDevice. Устройство берется из command.device_id, если
+// deviceID не задан.
+func (s *GRPCServer) validateControlAction(deviceID string, command *pb.Command, field string) ([]apierror.FieldViolation, error) {
+	if deviceID == "" {
+		deviceID = command.GetDeviceId()
+	}
+	device, v, err := s.ruleDevice(deviceID, field+".device_id")
+	if err != nil || device == nil {
+		return v, err
+	}
+	if command == nil {
+		return []apierror.FieldViolation{{Field: field + ".command", Description: "must be set"}}, nil
+	}
+	if _, err := validateCommand(device, command); err != nil {
+		return []apierror.FieldViolation{{Field: field + ".command", Description: status.Convert(err).Message()}}, nil
+	}
+	return nil, nil
+}
+
+// validateSceneAction проверяет, что сцена действия существует
+func (s *GRPCServer) validateSceneAction(sceneID, field string) ([]apierror.FieldViolation, error) {
+	if sceneID == "" {
+		return []apierror.FieldViolation{{Field: field + ".scene_id", Description: "must not be empty"}}, nil
+	}
+	_, err := s.store.GetScene(sceneID)
+	if errors.Is(err, datastore.ErrSceneNotFound) {
+		return []apierror.FieldViolation{{Field: field + ".scene_id", Description: fmt.Sprintf("scene %s does not exist", sceneID)}}, nil
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get scene: %v", err)
+	}
+	return nil, nil
+}
+
+// ruleDevice возвращает устройство, на которое ссылается правило, или
+// нарушение для поля field, если его нет
+func (s *GRPCServer) ruleDevice(id, field string) (*model.Device, []apierror.FieldViolation, error) {
+	if id == "" {
+		return nil, []apierror.FieldViolation{{Field: field, Description: "must not be empty"}}, nil
+	}
+	device, err := s.store.GetDevice(id)
+	if errors.Is(err, datastore.ErrDeviceNotFound) {
+		return nil, []apierror.FieldViolation{{Field: field, Description: fmt.Sprintf("device %s does not exist", id)}}, nil
+	}
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Internal, "failed to get device: %v", err)
+	}
+	return device, nil, nil
+}
+
+// deviceParameter возвращает описание параметра устройства по возможностям
+// его типа или нарушение для поля field
+func deviceParameter(device *model.Device, name, field string) (*model.ParameterSpec, []apierror.FieldViolation) {
+	if name == "" {
+		return nil, []apierror.FieldViolation{{Field: field, Description: "must not be empty"}}
+	}
+	if spec, ok := model.Capabilities(device.Type); ok {
+		if param, ok := spec.Parameter(name); ok {
+			return param, nil
+		}
+	}
+	return nil, []apierror.FieldViolation{{Field: field, Description: fmt.Sprintf("is not supported by device type %s", device.Type)}}
+}
+
+// getRuleError преобразует ошибку хранилища правил в ошибку gRPC
+func getRuleError(id string, err error) error {
+	switch {
+	case errors.Is(err, datastore.ErrRuleNotFound):
+		return apierror.Newf(codes.NotFound, apierror.ReasonRuleNotFound, "rule with ID %s not found", id).
+			WithMetadata("rule_id", id)
+	case errors.Is(err, datastore.ErrInvalidRuleID):
+		return apierror.InvalidArgument("rule ID is required",
+			apierror.FieldViolation{Field: "id", Description: "must not be empty"})
+	}
+	return status.Errorf(codes.Internal, "failed to get rule: %v", err)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
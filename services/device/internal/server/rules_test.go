@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/automation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestCreateRule(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	lamp := createDeviceInRoom(t, s, "lamp", "")
+	sensor := createDeviceInRoom(t, s, "sensor", "")
+
+	motion := []*pb.RuleTrigger{{Type: "parameter_changed", DeviceId: sensor.Id, Parameter: "last_motion"}}
+	turnOn := []*pb.RuleAction{{Type: "control", DeviceId: lamp.Id, Command: &pb.Command{Action: "turn_on"}}}
+	rule := func(triggers []*pb.RuleTrigger, conditions []*pb.RuleCondition, actions []*pb.RuleAction) *pb.Rule {
+		return &pb.Rule{Name: "Свет", Enabled: true, Triggers: triggers, Conditions: conditions, Actions: actions}
+	}
+	tests := []struct {
+		name  string
+		rule  *pb.Rule
+		code  codes.Code
+		field string
+	}{
+		{"Valid", &pb.Rule{
+			Name: " Свет по движению ", Enabled: true, CooldownSeconds: 30, Triggers: motion,
+			Conditions: []*pb.RuleCondition{
+				{Type: "time_window", After: "22:00", Before: "06:00"},
+				{Type: "device_state", DeviceId: lamp.Id, Parameter: "online", Operator: "eq", Value: "true"},
+			},
+			Actions: append(turnOn, &pb.RuleAction{Type: "delay", DelaySeconds: 300},
+				&pb.RuleAction{Type: "control", Command: &pb.Command{DeviceId: lamp.Id, Action: "turn_off"}}),
+		}, codes.OK, ""},
+		{"NoRule", nil, codes.InvalidArgument, "rule"},
+		{"EmptyName", &pb.Rule{Triggers: motion, Actions: turnOn}, codes.InvalidArgument, "rule.name"},
+		{"NoTriggers", rule(nil, nil, turnOn), codes.InvalidArgument, "rule.triggers"},
+		{"NoActions", rule(motion, nil, nil), codes.InvalidArgument, "rule.actions"},
+		{"UnknownTrigger", rule([]*pb.RuleTrigger{{Type: "sunrise"}}, nil, turnOn), codes.InvalidArgument, "rule.triggers[0].type"},
+		{"UnknownDevice", rule([]*pb.RuleTrigger{{Type: "device_offline", DeviceId: "missing"}}, nil, turnOn), codes.InvalidArgument, "rule.triggers[0].device_id"},
+		{"UnknownParameter", rule([]*pb.RuleTrigger{{Type: "parameter_changed", DeviceId: sensor.Id, Parameter: "level"}}, nil, turnOn), codes.InvalidArgument, "rule.triggers[0].parameter"},
+		{"InvalidTime", rule([]*pb.RuleTrigger{{Type: "time", Time: "7:00"}}, nil, turnOn), codes.InvalidArgument, "rule.triggers[0].time"},
+		{"InvalidDay", rule([]*pb.RuleTrigger{{Type: "time", Time: "07:00", Days: []string{"monday"}}}, nil, turnOn), codes.InvalidArgument, "rule.triggers[0].days[0]"},
+		{"NumericOperator", rule(motion, []*pb.RuleCondition{{Type: "device_state", DeviceId: lamp.Id, Parameter: "level", Operator: "gt", Value: "high"}}, turnOn), codes.InvalidArgument, "rule.conditions[0].value"},
+		{"EmptyWindow", rule(motion, []*pb.RuleCondition{{Type: "time_window", After: "22:00", Before: "22:00"}}, turnOn), codes.InvalidArgument, "rule.conditions[0].before"},
+		{"UnsupportedCommand", rule(motion, nil, []*pb.RuleAction{{Type: "control", DeviceId: sensor.Id, Command: &pb.Command{Action: "turn_on"}}}), codes.InvalidArgument, "rule.actions[0].command"},
+		{"UnknownScene", rule(motion, nil, []*pb.RuleAction{{Type: "scene", SceneId: "missing"}}), codes.InvalidArgument, "rule.actions[0].scene_id"},
+		{"LongDelay", rule(motion, nil, []*pb.RuleAction{{Type: "delay", DelaySeconds: 90000}}), codes.InvalidArgument, "rule.actions[0].delay_seconds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.CreateRule(ctx, &pb.CreateRuleRequest{Rule: tt.rule})
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v (err: %v)", code, tt.code, err)
+			}
+			if tt.field != "" {
+				assertViolation(t, err, tt.field)
+			}
+			if err != nil {
+				return
+			}
+
+			got := resp.Rule
+			if got.Id == "" || got.Name != "Свет по движению" || !got.Enabled || got.CooldownSeconds != 30 ||
+				len(got.Actions) != 3 || got.Actions[2].DeviceId != lamp.Id || got.Actions[1].DelaySeconds != 300 {
+				t.Errorf("unexpected rule: %+v", got)
+			}
+		})
+	}
+}
+
+func TestUpdateRule(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	lamp := createDeviceInRoom(t, s, "lamp", "")
+	rule := createRule(t, s, &pb.Rule{
+		Name:     "Утро",
+		Enabled:  true,
+		Triggers: []*pb.RuleTrigger{{Type: "time", Time: "07:00"}},
+		Actions:  []*pb.RuleAction{{Type: "control", DeviceId: lamp.Id, Command: &pb.Command{Action: "turn_on"}}},
+	})
+
+	// Изменяются только поля из маски
+	resp, err := s.UpdateRule(ctx, &pb.UpdateRuleRequest{
+		Rule:       &pb.Rule{Id: rule.Id, Name: "Подъем", Triggers: []*pb.RuleTrigger{{Type: "time", Time: "06:30"}}},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "triggers"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateRule failed: %v", err)
+	}
+	if got := resp.Rule; got.Name != "Подъем" || got.Triggers[0].Time != "06:30" || !got.Enabled || len(got.Actions) != 1 {
+		t.Errorf("unexpected rule after update: %+v", got)
+	}
+
+	disabled, err := s.DisableRule(ctx, &pb.RuleId{Id: rule.Id})
+	if err != nil || disabled.Rule.Enabled {
+		t.Fatalf("DisableRule = %+v, %v", disabled, err)
+	}
+	enabled, err := s.EnableRule(ctx, &pb.RuleId{Id: rule.Id})
+	if err != nil || !enabled.Rule.Enabled {
+		t.Fatalf("EnableRule = %+v, %v", enabled, err)
+	}
+
+	if _, err := s.UpdateRule(ctx, &pb.UpdateRuleRequest{
+		Rule:       &pb.Rule{Id: rule.Id},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"actions"}},
+	}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("UpdateRule without actions: code = %v, want InvalidArgument", status.Code(err))
+	}
+
+	if _, err := s.DeleteRule(ctx, &pb.RuleId{Id: rule.Id}); err != nil {
+		t.Fatalf("DeleteRule failed: %v", err)
+	}
+	_, err = s.ListRuleExecutions(ctx, &pb.RuleId{Id: rule.Id})
+	if status.Code(err) != codes.NotFound || apierror.Reason(err) != apierror.ReasonRuleNotFound {
+		t.Errorf("ListRuleExecutions after delete: %v", err)
+	}
+}
+
+func TestAutomation_RunsRuleOnDeviceChange(t *testing.T) {
+	s := newTestServer()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lamp := createDeviceInRoom(t, s, "lamp", "")
+	sensor := createDeviceInRoom(t, s, "sensor", "")
+	rule := createRule(t, s, &pb.Rule{
+		Name:     "Свет по движению",
+		Enabled:  true,
+		Triggers: []*pb.RuleTrigger{{Type: "parameter_changed", DeviceId: sensor.Id, Parameter: "last_motion"}},
+		Actions:  []*pb.RuleAction{{Type: "control", DeviceId: lamp.Id, Command: &pb.Command{Action: "turn_on"}}},
+	})
+
+	go s.Automation().Run(ctx)
+
+	// Движок читает начальное состояние после запуска; повторяем изменение,
+	// пока правило не сработает
+	deadline := time.Now().Add(2 * time.Second)
+	for motion := 1; ; motion++ {
+		if err := s.store.UpdateDeviceParameter(sensor.Id, "last_motion", strconv.Itoa(motion)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		resp, err := s.ListRuleExecutions(ctx, &pb.RuleId{Id: rule.Id})
+		if err != nil {
+			t.Fatalf("ListRuleExecutions failed: %v", err)
+		}
+		if len(resp.Executions) > 0 {
+			if e := resp.Executions[0]; e.Status != automation.StatusCompleted || e.ActionsExecuted != 1 || e.FinishedTime == nil {
+				t.Errorf("unexpected execution: %+v", e)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("rule was not executed")
+		}
+	}
+	assertParameters(t, s, lamp.Id, map[string]string{"power": "on"})
+}
+
+func createRule(t *testing.T, s *GRPCServer, rule *pb.Rule) *pb.Rule {
+	t.Helper()
+	resp, err := s.CreateRule(context.Background(), &pb.CreateRuleRequest{Rule: rule})
+	if err != nil {
+		t.Fatalf("CreateRule failed: %v", err)
+	}
+	return resp.Rule
+}
@@ -0,0 +1,531 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxSceneTargets ограничивает число устройств в сцене
+const maxSceneTargets = 50
+
+// updatableSceneFields - поля, которые можно изменить через UpdateScene
+var updatableSceneFields = []string{"name", "icon", "targets"}
+
+// errUnchanged возвращается из изменения устройства, если устройство уже
+// в состоянии сцены и сохранять его не нужно
+var errUnchanged = errors.New("device is already in the scene state")
+
+// ListScenes реализует gRPC метод для получения списка сцен
+func (s *GRPCServer) ListScenes(ctx context.Context, req *pb.ListScenesRequest) (*pb.ListScenesResponse, error) {
+	scenes, err := s.store.ListScenes()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list scenes: %v", err)
+	}
+
+	protoScenes := make([]*pb.Scene, 0, len(scenes))
+	for _, scene := range scenes {
+		protoScenes = append(protoScenes, scene.ToProto())
+	}
+
+	return &pb.ListScenesResponse{
+		Scenes:     protoScenes,
+		TotalCount: int32(len(protoScenes)),
+	}, nil
+}
+
+// GetScene реализует gRPC метод для получения сцены по ID
+func (s *GRPCServer) GetScene(ctx context.Context, req *pb.SceneId) (*pb.GetSceneResponse, error) {
+	scene, err := s.store.GetScene(req.Id)
+	if err != nil {
+		return nil, getSceneError(req.Id, err)
+	}
+	return &pb.GetSceneResponse{Scene: scene.ToProto()}, nil
+}
+
+// CreateScene реализует gRPC метод для создания сцены. Цели сцены
+// составляются из scene.targets и текущего состояния устройств
+// capture_device_ids.
+func (s *GRPCServer) CreateScene(ctx context.Context, req *pb.CreateSceneRequest) (*pb.CreateSceneResponse, error) {
+	if req.Scene == nil {
+		return nil, apierror.InvalidArgument("scene is required",
+			apierror.FieldViolation{Field: "scene", Description: "must be set"})
+	}
+
+	log.Printf("CreateScene request: name: %q, targets: %d, capture: %v", req.Scene.Name, len(req.Scene.Targets), req.CaptureDeviceIds)
+
+	violations := validateSceneName(req.Scene.Name)
+	violations = append(violations, validateSceneIcon(req.Scene.Icon)...)
+
+	seen := make(map[string]bool)
+	targets, targetViolations, err := s.sceneTargets(req.Scene.Targets, seen)
+	if err != nil {
+		return nil, err
+	}
+	violations = append(violations, targetViolations...)
+
+	captured, captureViolations, err := s.captureTargets(req.CaptureDeviceIds, seen)
+	if err != nil {
+		return nil, err
+	}
+	violations = append(violations, captureViolations...)
+	targets = append(targets, captured...)
+
+	if len(targetViolations) == 0 && len(captureViolations) == 0 {
+		violations = append(violations, validateTargetCount(len(targets))...)
+	}
+	if len(violations) > 0 {
+		return nil, apierror.InvalidArgument("invalid scene", violations...)
+	}
+
+	scene := model.NewScene(strings.TrimSpace(req.Scene.Name), req.Scene.Icon, targets...)
+
+	s.sceneMu.Lock()
+	defer s.sceneMu.Unlock()
+
+	if err := s.checkSceneName(scene); err != nil {
+		return nil, err
+	}
+	if err := s.store.SaveScene(scene); err != nil {
+		log.Printf("CreateScene: failed to save scene: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to save scene: %v", err)
+	}
+
+	return &pb.CreateSceneResponse{Scene: scene.ToProto()}, nil
+}
+
+// UpdateScene реализует gRPC метод для изменения сцены по маске полей
+func (s *GRPCServer) UpdateScene(ctx context.Context, req *pb.UpdateSceneRequest) (*pb.UpdateSceneResponse, error) {
+	if req.Scene == nil {
+		return nil, apierror.InvalidArgument("scene is required",
+			apierror.FieldViolation{Field: "scene", Description: "must be set"})
+	}
+	id := req.Scene.Id
+	if id == "" {
+		return nil, apierror.InvalidArgument("scene ID is required",
+			apierror.FieldViolation{Field: "scene.id", Description: "must not be empty"})
+	}
+
+	paths := req.UpdateMask.GetPaths()
+	if len(paths) == 0 {
+		paths = updatableSceneFields
+	}
+
+	log.Printf("UpdateScene request for ID: %s, fields: %v", id, paths)
+
+	var (
+		violations []apierror.FieldViolation
+		targets    []model.SceneTarget
+	)
+	for _, path := range paths {
+		switch path {
+		case "name":
+			violations = append(violations, validateSceneName(req.Scene.Name)...)
+		case "icon":
+			violations = append(violations, validateSceneIcon(req.Scene.Icon)...)
+		case "targets":
+			var targetViolations []apierror.FieldViolation
+			var err error
+			targets, targetViolations, err = s.sceneTargets(req.Scene.Targets, make(map[string]bool))
+			if err != nil {
+				return nil, err
+			}
+			if len(targetViolations) == 0 {
+				targetViolations = validateTargetCount(len(targets))
+			}
+			violations = append(violations, targetViolations...)
+		case "id":
+			// id совпадает со сценой из пути запроса и не изменяется
+		default:
+			violations = append(violations, apierror.FieldViolation{
+				Field:       "update_mask",
+				Description: fmt.Sprintf("field %q cannot be updated, expected %s", path, strings.Join(updatableSceneFields, ", ")),
+			})
+		}
+	}
+	if len(violations) > 0 {
+		return nil, apierror.InvalidArgument("invalid scene update", violations...)
+	}
+
+	s.sceneMu.Lock()
+	defer s.sceneMu.Unlock()
+
+	scene, err := s.store.GetScene(id)
+	if err != nil {
+		return nil, getSceneError(id, err)
+	}
+	for _, path := range paths {
+		switch path {
+		case "name":
+			scene.Name = strings.TrimSpace(req.Scene.Name)
+		case "icon":
+			scene.Icon = req.Scene.Icon
+		case "targets":
+			scene.Targets = targets
+		}
+	}
+
+	if err := s.checkSceneName(scene); err != nil {
+		return nil, err
+	}
+	if err := s.store.SaveScene(scene); err != nil {
+		log.Printf("UpdateScene: failed to save scene %s: %v", id, err)
+		return nil, status.Errorf(codes.Internal, "failed to save scene: %v", err)
+	}
+
+	return &pb.UpdateSceneResponse{Scene: scene.ToProto()}, nil
+}
+
+// DeleteScene реализует gRPC метод для удаления сцены
+func (s *GRPCServer) DeleteScene(ctx context.Context, req *pb.SceneId) (*pb.Empty, error) {
+	log.Printf("DeleteScene request for ID: %s", req.Id)
+
+	if err := s.store.DeleteScene(req.Id); err != nil {
+		return nil, getSceneError(req.Id, err)
+	}
+	return &pb.Empty{}, nil
+}
+
+// ActivateScene реализует gRPC метод для активации сцены. Устройства
+// переводятся в состояние сцены параллельно; ошибка одного устройства не
+// останавливает остальные. С rollback_on_failure при любой ошибке
+// измененные устройства возвращаются в прежнее состояние.
+func (s *GRPCServer) ActivateScene(ctx context.Context, req *pb.ActivateSceneRequest) (*pb.ActivateSceneResponse, error) {
+	log.Printf("ActivateScene request for ID: %s, rollback on failure: %v", req.Id, req.RollbackOnFailure)
+
+	scene, err := s.store.GetScene(req.Id)
+	if err != nil {
+		return nil, getSceneError(req.Id, err)
+	}
+
+	results := make([]*pb.SceneTargetResult, len(scene.Targets))
+	previous := make([]map[string]string, len(scene.Targets))
+
+	var wg sync.WaitGroup
+	for i, target := range scene.Targets {
+		wg.Add(1)
+		go func(i int, target model.SceneTarget) {
+			defer wg.Done()
+			results[i], previous[i] = s.applyTarget(target)
+		}(i, target)
+	}
+	wg.Wait()
+
+	resp := &pb.ActivateSceneResponse{
+		SceneId: scene.ID,
+		Success: true,
+		Results: results,
+	}
+	for _, result := range results {
+		if !result.Success {
+			resp.Success = false
+		}
+	}
+	if !resp.Success && req.RollbackOnFailure {
+		resp.RolledBack = s.rollbackTargets(results, previous)
+	}
+
+	log.Printf("ActivateScene %s: success: %v, rolled back: %v", scene.ID, resp.Success, resp.RolledBack)
+	return resp, nil
+}
+
+// applyTarget переводит устройство в состояние цели сцены. Возвращает
+// результат и прежние значения измененных параметров (пустая строка -
+// параметра не было).
+func (s *GRPCServer) applyTarget(target model.SceneTarget) (*pb.SceneTargetResult, map[string]string) {
+	result := &pb.SceneTargetResult{DeviceId: target.DeviceID}
+
+	var previous map[string]string
+	_, err := s.modifyDevice(target.DeviceID, func(device *model.Device) error {
+		// При конфликте версий изменение повторяется с новым состоянием
+		previous = make(map[string]string)
+
+		if device.Status == nil || !device.Status.Online {
+			return apierror.Newf(codes.FailedPrecondition, apierror.ReasonDeviceOffline,
+				"device %s is offline", device.ID).WithMetadata("device_id", device.ID)
+		}
+		if violations := validateSceneParameters(device, target.Parameters, "parameters"); len(violations) > 0 {
+			return apierror.Newf(codes.InvalidArgument, apierror.ReasonInvalidParameter,
+				"%s: %s", violations[0].Field, violations[0].Description).WithMetadata("device_id", device.ID)
+		}
+
+		for name, value := range target.Parameters {
+			current := device.Status.Parameters[name]
+			if current == value {
+				continue
+			}
+			previous[name] = current
+			device.UpdateParameterValue(name, value)
+		}
+		if len(previous) == 0 {
+			return errUnchanged
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, errUnchanged):
+		result.Success = true
+		return result, nil
+	case err != nil:
+		apiErr := apierror.FromError(err)
+		result.ErrorReason = apiErr.Reason
+		result.Error = apiErr.Message
+		return result, nil
+	}
+
+	result.Success = true
+	result.Changed = true
+	return result, previous
+}
+
+// rollbackTargets возвращает измененные устройства в прежнее состояние и
+// отмечает их в results. Возвращает true, если отменены все изменения.
+func (s *GRPCServer) rollbackTargets(results []*pb.SceneTargetResult, previous []map[string]string) bool {
+	var wg sync.WaitGroup
+	for i, result := range results {
+		if !result.Changed {
+			continue
+		}
+		wg.Add(1)
+		go func(result *pb.SceneTargetResult, values map[string]string) {
+			defer wg.Done()
+			_, err := s.modifyDevice(result.DeviceId, func(device *model.Device) error {
+				restoreParameters(device, values)
+				return nil
+			})
+			if err != nil {
+				log.Printf("ActivateScene: failed to roll back device %s: %v", result.DeviceId, err)
+				return
+			}
+			result.RolledBack = true
+		}(result, previous[i])
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.Changed && !result.RolledBack {
+			return false
+		}
+	}
+	return true
+}
+
+// restoreParameters возвращает параметрам устройства прежние значения
+// (пустая строка удаляет параметр)
+func restoreParameters(device *model.Device, values map[string]string) {
+	if device.Status == nil {
+		device.Status = model.NewDeviceStatus()
+	}
+	for name, value := range values {
+		if value == "" {
+			delete(device.Status.Parameters, name)
+			continue
+		}
+		device.Status.Parameters[name] = value
+	}
+	device.LastUpdated = time.Now()
+}
+
+// sceneTargets проверяет цели сцены из запроса. Устройства целей должны
+// существовать и не повторяться (seen - уже добавленные устройства).
+func (s *GRPCServer) sceneTargets(targets []*pb.SceneTarget, seen map[string]bool) ([]model.SceneTarget, []apierror.FieldViolation, error) {
+	var (
+		result     []model.SceneTarget
+		violations []apierror.FieldViolation
+	)
+	for i, target := range targets {
+		field := fmt.Sprintf("scene.targets[%d]", i)
+		id := target.GetDeviceId()
+		if id == "" {
+			violations = append(violations, apierror.FieldViolation{Field: field + ".device_id", Description: "must not be empty"})
+			continue
+		}
+		if seen[id] {
+			violations = append(violations, apierror.FieldViolation{Field: field + ".device_id", Description: fmt.Sprintf("device %s is already in the scene", id)})
+			continue
+		}
+		seen[id] = true
+
+		device, err := s.store.GetDevice(id)
+		if errors.Is(err, datastore.ErrDeviceNotFound) {
+			violations = append(violations, apierror.FieldViolation{Field: field + ".device_id", Description: fmt.Sprintf("device %s does not exist", id)})
+			continue
+		}
+		if err != nil {
+			return nil, nil, status.Errorf(codes.Internal, "failed to get device: %v", err)
+		}
+
+		if len(target.GetParameters()) == 0 {
+			violations = append(violations, apierror.FieldViolation{Field: field + ".parameters", Description: "must not be empty"})
+			continue
+		}
+		if v := validateSceneParameters(device, target.Parameters, field+".parameters"); len(v) > 0 {
+			violations = append(violations, v...)
+			continue
+		}
+		result = append(result, model.SceneTargetFromProto(target))
+	}
+	return result, violations, nil
+}
+
+// captureTargets составляет цели сцены из текущего состояния устройств:
+// в цель входят заданные параметры из model.SceneParameters, которые можно
+// изменить командой
+func (s *GRPCServer) captureTargets(ids []string, seen map[string]bool) ([]model.SceneTarget, []apierror.FieldViolation, error) {
+	var (
+		result     []model.SceneTarget
+		violations []apierror.FieldViolation
+	)
+	for i, id := range ids {
+		field := fmt.Sprintf("capture_device_ids[%d]", i)
+		if id == "" {
+			violations = append(violations, apierror.FieldViolation{Field: field, Description: "must not be empty"})
+			continue
+		}
+		if seen[id] {
+			violations = append(violations, apierror.FieldViolation{Field: field, Description: fmt.Sprintf("device %s is already in the scene", id)})
+			continue
+		}
+		seen[id] = true
+
+		device, err := s.store.GetDevice(id)
+		if errors.Is(err, datastore.ErrDeviceNotFound) {
+			violations = append(violations, apierror.FieldViolation{Field: field, Description: fmt.Sprintf("device %s does not exist", id)})
+			continue
+		}
+		if err != nil {
+			return nil, nil, status.Errorf(codes.Internal, "failed to get device: %v", err)
+		}
+
+		target := model.SceneTarget{DeviceID: id, Parameters: make(map[string]string)}
+		spec, ok := model.Capabilities(device.Type)
+		for _, name := range model.SceneParameters {
+			if !ok || device.Status == nil {
+				break
+			}
+			param, found := spec.Parameter(name)
+			if !found || param.ReadOnly {
+				continue
+			}
+			if value := device.Status.Parameters[name]; value != "" && param.Validate(value) == nil {
+				target.Parameters[name] = value
+			}
+		}
+		if len(target.Parameters) == 0 {
+			violations = append(violations, apierror.FieldViolation{Field: field, Description: fmt.Sprintf("device %s has no state to capture", id)})
+			continue
+		}
+		result = append(result, target)
+	}
+	return result, violations, nil
+}
+
+// validateSceneParameters проверяет параметры цели сцены по возможностям
+// типа устройства
+func validateSceneParameters(device *model.Device, params map[string]string, field string) []apierror.FieldViolation {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	spec, ok := model.Capabilities(device.Type)
+	var violations []apierror.FieldViolation
+	for _, name := range names {
+		paramField := field + "." + name
+		if !model.IsSceneParameter(name) {
+			violations = append(violations, apierror.FieldViolation{
+				Field:       paramField,
+				Description: "must be one of " + strings.Join(model.SceneParameters, ", "),
+			})
+			continue
+		}
+		var param *model.ParameterSpec
+		if ok {
+			param, _ = spec.Parameter(name)
+		}
+		if param == nil || param.ReadOnly {
+			violations = append(violations, apierror.FieldViolation{
+				Field:       paramField,
+				Description: fmt.Sprintf("is not supported by device type %s", device.Type),
+			})
+			continue
+		}
+		if err := param.Validate(params[name]); err != nil {
+			violations = append(violations, apierror.FieldViolation{Field: paramField, Description: err.Error()})
+		}
+	}
+	return violations
+}
+
+// validateTargetCount проверяет число устройств сцены
+func validateTargetCount(n int) []apierror.FieldViolation {
+	if n == 0 {
+		return []apierror.FieldViolation{{Field: "scene.targets", Description: "must contain at least one device"}}
+	}
+	if n > maxSceneTargets {
+		return []apierror.FieldViolation{{Field: "scene.targets", Description: fmt.Sprintf("must contain at most %d devices", maxSceneTargets)}}
+	}
+	return nil
+}
+
+// validateSceneName проверяет имя сцены
+func validateSceneName(name string) []apierror.FieldViolation {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		return []apierror.FieldViolation{{Field: "scene.name", Description: fmt.Sprintf("must be 1 to %d characters", maxNameLength)}}
+	}
+	return nil
+}
+
+// validateSceneIcon проверяет значок сцены
+func validateSceneIcon(icon string) []apierror.FieldViolation {
+	if utf8.RuneCountInString(icon) > maxIconLength {
+		return []apierror.FieldViolation{{Field: "scene.icon", Description: fmt.Sprintf("must be at most %d characters", maxIconLength)}}
+	}
+	return nil
+}
+
+// checkSceneName проверяет, что имя сцены не занято другой сценой без
+// учета регистра: по имени сцену находят голосовые команды. Вызывается
+// под sceneMu.
+func (s *GRPCServer) checkSceneName(scene *model.Scene) error {
+	scenes, err := s.store.ListScenes()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to list scenes: %v", err)
+	}
+	for _, other := range scenes {
+		if other.ID != scene.ID && strings.EqualFold(other.Name, scene.Name) {
+			return apierror.Newf(codes.AlreadyExists, apierror.ReasonSceneAlreadyExists,
+				"scene %q already exists", other.Name).WithMetadata("scene_id", other.ID)
+		}
+	}
+	return nil
+}
+
+// getSceneError преобразует ошибку хранилища сцен в ошибку gRPC
+func getSceneError(id string, err error) error {
+	switch {
+	case errors.Is(err, datastore.ErrSceneNotFound):
+		return apierror.Newf(codes.NotFound, apierror.ReasonSceneNotFound, "scene with ID %s not found", id).
+			WithMetadata("scene_id", id)
+	case errors.Is(err, datastore.ErrInvalidSceneID):
+		return apierror.InvalidArgument("scene ID is required",
+			apierror.FieldViolation{Field: "id", Description: "must not be empty"})
+	}
+	return status.Errorf(codes.Internal, "failed to get scene: %v", err)
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestCreateScene(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	lamp := createDeviceInRoom(t, s, "lamp", "")
+	sensor := createDeviceInRoom(t, s, "sensor", "")
+	if _, err := s.CreateScene(ctx, &pb.CreateSceneRequest{Scene: &pb.Scene{Name: "Ночь", Targets: []*pb.SceneTarget{
+		{DeviceId: lamp.Id, Parameters: map[string]string{"power": "off"}},
+	}}}); err != nil {
+		t.Fatalf("CreateScene failed: %v", err)
+	}
+
+	target := func(id string, params map[string]string) []*pb.SceneTarget {
+		return []*pb.SceneTarget{{DeviceId: id, Parameters: params}}
+	}
+	tests := []struct {
+		name   string
+		scene  *pb.Scene
+		code   codes.Code
+		field  string
+		reason string
+	}{
+		{"Valid", &pb.Scene{Name: " Кино ", Icon: "film", Targets: target(lamp.Id, map[string]string{"power": "on", "level": "20"})}, codes.OK, "", ""},
+		{"NoScene", nil, codes.InvalidArgument, "scene", ""},
+		{"EmptyName", &pb.Scene{Name: " ", Targets: target(lamp.Id, map[string]string{"power": "on"})}, codes.InvalidArgument, "scene.name", ""},
+		{"NoTargets", &pb.Scene{Name: "Пусто"}, codes.InvalidArgument, "scene.targets", ""},
+		{"UnknownDevice", &pb.Scene{Name: "Кино", Targets: target("missing", map[string]string{"power": "on"})}, codes.InvalidArgument, "scene.targets[0].device_id", ""},
+		{"NotSceneParameter", &pb.Scene{Name: "Кино", Targets: target(lamp.Id, map[string]string{"last_motion": "1"})}, codes.InvalidArgument, "scene.targets[0].parameters.last_motion", ""},
+		{"ReadOnlyParameter", &pb.Scene{Name: "Кино", Targets: target(sensor.Id, map[string]string{"temperature": "20"})}, codes.InvalidArgument, "scene.targets[0].parameters.temperature", ""},
+		{"InvalidValue", &pb.Scene{Name: "Кино", Targets: target(lamp.Id, map[string]string{"level": "150"})}, codes.InvalidArgument, "scene.targets[0].parameters.level", ""},
+		{"NameTaken", &pb.Scene{Name: "ночь", Targets: target(lamp.Id, map[string]string{"power": "on"})}, codes.AlreadyExists, "", apierror.ReasonSceneAlreadyExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.CreateScene(ctx, &pb.CreateSceneRequest{Scene: tt.scene})
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v (err: %v)", code, tt.code, err)
+			}
+			if tt.field != "" {
+				assertViolation(t, err, tt.field)
+			}
+			if tt.reason != "" && apierror.Reason(err) != tt.reason {
+				t.Errorf("reason = %q, want %q", apierror.Reason(err), tt.reason)
+			}
+			if err != nil {
+				return
+			}
+
+			if resp.Scene.Id == "" || resp.Scene.Name != "Кино" || len(resp.Scene.Targets) != 1 || resp.Scene.Targets[0].Parameters["level"] != "20" {
+				t.Errorf("unexpected scene: %+v", resp.Scene)
+			}
+			if _, err := s.DeleteScene(ctx, &pb.SceneId{Id: resp.Scene.Id}); err != nil {
+				t.Fatalf("DeleteScene failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateScene_CapturesDevices(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	lamp := createDeviceInRoom(t, s, "lamp", "")
+	thermostat := createDeviceInRoom(t, s, "thermostat", "")
+	sensor := createDeviceInRoom(t, s, "sensor", "")
+	for id, params := range map[string]map[string]string{
+		lamp.Id:       {"power": "on", "level": "35", "color": "#FFAA00"},
+		thermostat.Id: {"power": "on", "temperature": "21", "mode": "eco", "humidity": "40"},
+		sensor.Id:     {"temperature": "20"},
+	} {
+		for key, value := range params {
+			if err := s.store.UpdateDeviceParameter(id, key, value); err != nil {
+				t.Fatalf("UpdateDeviceParameter failed: %v", err)
+			}
+		}
+	}
+
+	// Состояние датчика не задается командами
+	_, err := s.CreateScene(ctx, &pb.CreateSceneRequest{Scene: &pb.Scene{Name: "Вечер"}, CaptureDeviceIds: []string{lamp.Id, sensor.Id}})
+	assertViolation(t, err, "capture_device_ids[1]")
+
+	// Устройство не может быть в сцене дважды
+	_, err = s.CreateScene(ctx, &pb.CreateSceneRequest{
+		Scene:            &pb.Scene{Name: "Вечер", Targets: []*pb.SceneTarget{{DeviceId: lamp.Id, Parameters: map[string]string{"power": "off"}}}},
+		CaptureDeviceIds: []string{lamp.Id},
+	})
+	assertViolation(t, err, "capture_device_ids[0]")
+
+	resp, err := s.CreateScene(ctx, &pb.CreateSceneRequest{Scene: &pb.Scene{Name: "Вечер"}, CaptureDeviceIds: []string{lamp.Id, thermostat.Id}})
+	if err != nil {
+		t.Fatalf("CreateScene failed: %v", err)
+	}
+	targets := resp.Scene.Targets
+	if len(targets) != 2 || targets[0].DeviceId != lamp.Id || targets[1].DeviceId != thermostat.Id {
+		t.Fatalf("unexpected targets: %v", targets)
+	}
+	if p := targets[0].Parameters; len(p) != 3 || p["level"] != "35" || p["color"] != "#FFAA00" {
+		t.Errorf("unexpected lamp target: %v", p)
+	}
+	// Влажность термостата только для чтения и в сцену не входит
+	if p := targets[1].Parameters; len(p) != 3 || p["temperature"] != "21" || p["mode"] != "eco" {
+		t.Errorf("unexpected thermostat target: %v", p)
+	}
+}
+
+func TestActivateScene(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	lamp := createDeviceInRoom(t, s, "lamp", "")
+	socket := createDeviceInRoom(t, s, "socket", "")
+	offline := createDeviceInRoom(t, s, "lamp", "")
+	if err := s.store.UpdateDeviceParameter(socket.Id, "power", "off"); err != nil {
+		t.Fatalf("UpdateDeviceParameter failed: %v", err)
+	}
+	scene := createScene(t, s, "Кино",
+		&pb.SceneTarget{DeviceId: lamp.Id, Parameters: map[string]string{"power": "on", "level": "20"}},
+		&pb.SceneTarget{DeviceId: socket.Id, Parameters: map[string]string{"power": "off"}})
+
+	resp, err := s.ActivateScene(ctx, &pb.ActivateSceneRequest{Id: scene.Id})
+	if err != nil {
+		t.Fatalf("ActivateScene failed: %v", err)
+	}
+	if !resp.Success || len(resp.Results) != 2 {
+		t.Fatalf("unexpected response: %v", resp)
+	}
+	if r := resp.Results[0]; r.DeviceId != lamp.Id || !r.Success || !r.Changed {
+		t.Errorf("unexpected lamp result: %v", r)
+	}
+	// Розетка уже выключена
+	if r := resp.Results[1]; !r.Success || r.Changed {
+		t.Errorf("unexpected socket result: %v", r)
+	}
+	assertParameters(t, s, lamp.Id, map[string]string{"power": "on", "level": "20"})
+
+	// Ошибка одного устройства не останавливает остальные
+	setOffline(t, s, offline.Id)
+	if _, err := s.UpdateScene(ctx, &pb.UpdateSceneRequest{Scene: &pb.Scene{Id: scene.Id, Targets: []*pb.SceneTarget{
+		{DeviceId: lamp.Id, Parameters: map[string]string{"level": "50"}},
+		{DeviceId: offline.Id, Parameters: map[string]string{"power": "on"}},
+	}}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"targets"}}}); err != nil {
+		t.Fatalf("UpdateScene failed: %v", err)
+	}
+	resp, err = s.ActivateScene(ctx, &pb.ActivateSceneRequest{Id: scene.Id})
+	if err != nil {
+		t.Fatalf("ActivateScene failed: %v", err)
+	}
+	if resp.Success || resp.RolledBack {
+		t.Errorf("unexpected response: %v", resp)
+	}
+	if r := resp.Results[1]; r.Success || r.ErrorReason != apierror.ReasonDeviceOffline {
+		t.Errorf("unexpected offline result: %v", r)
+	}
+	assertParameters(t, s, lamp.Id, map[string]string{"power": "on", "level": "50"})
+
+	if _, err := s.ActivateScene(ctx, &pb.ActivateSceneRequest{Id: "missing"}); apierror.Reason(err) != apierror.ReasonSceneNotFound {
+		t.Errorf("expected %s, got %v", apierror.ReasonSceneNotFound, err)
+	}
+}
+
+func TestActivateScene_RollsBack(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	lamp := createDeviceInRoom(t, s, "lamp", "")
+	thermostat := createDeviceInRoom(t, s, "thermostat", "")
+	deleted := createDeviceInRoom(t, s, "socket", "")
+	if err := s.store.UpdateDeviceParameter(lamp.Id, "level", "80"); err != nil {
+		t.Fatalf("UpdateDeviceParameter failed: %v", err)
+	}
+	scene := createScene(t, s, "Доброе утро",
+		&pb.SceneTarget{DeviceId: lamp.Id, Parameters: map[string]string{"power": "on", "level": "100"}},
+		&pb.SceneTarget{DeviceId: thermostat.Id, Parameters: map[string]string{"temperature": "22"}},
+		&pb.SceneTarget{DeviceId: deleted.Id, Parameters: map[string]string{"power": "on"}})
+	if _, err := s.DeleteDevice(ctx, &pb.DeviceId{Id: deleted.Id}); err != nil {
+		t.Fatalf("DeleteDevice failed: %v", err)
+	}
+
+	resp, err := s.ActivateScene(ctx, &pb.ActivateSceneRequest{Id: scene.Id, RollbackOnFailure: true})
+	if err != nil {
+		t.Fatalf("ActivateScene failed: %v", err)
+	}
+	if resp.Success || !resp.RolledBack {
+		t.Fatalf("unexpected response: %v", resp)
+	}
+	if r := resp.Results[2]; r.Success || r.ErrorReason != apierror.ReasonDeviceNotFound {
+		t.Errorf("unexpected result of deleted device: %v", r)
+	}
+	for _, r := range resp.Results[:2] {
+		if !r.Changed || !r.RolledBack {
+			t.Errorf("unexpected result: %v", r)
+		}
+	}
+
+	// Параметры, которых не было до активации, удаляются
+	assertParameters(t, s, lamp.Id, map[string]string{"level": "80"})
+	assertParameters(t, s, thermostat.Id, map[string]string{})
+}
+
+func createScene(t *testing.T, s *GRPCServer, name string, targets ...*pb.SceneTarget) *pb.Scene {
+	t.Helper()
+	resp, err := s.CreateScene(context.Background(), &pb.CreateSceneRequest{Scene: &pb.Scene{Name: name, Targets: targets}})
+	if err != nil {
+		t.Fatalf("CreateScene failed: %v", err)
+	}
+	return resp.Scene
+}
+
+func setOffline(t *testing.T, s *GRPCServer, id string) {
+	t.Helper()
+	status := model.NewDeviceStatus()
+	status.Online = false
+	if err := s.store.UpdateDeviceStatus(id, status); err != nil {
+		t.Fatalf("UpdateDeviceStatus failed: %v", err)
+	}
+}
+
+func assertParameters(t *testing.T, s *GRPCServer, id string, want map[string]string) {
+	t.Helper()
+	device, err := s.store.GetDevice(id)
+	if err != nil {
+		t.Fatalf("GetDevice failed: %v", err)
+	}
+	got := device.Status.Parameters
+	if len(got) != len(want) {
+		t.Errorf("device %s parameters = %v, want %v", id, got, want)
+		return
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("device %s parameters = %v, want %v", id, got, want)
+			return
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/automation"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/datastore"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxRunIn ограничивает run_in_seconds однократного расписания
+const maxRunIn = 365 * 24 * time.Hour
+
+// ListSchedules реализует gRPC метод для получения списка расписаний
+func (s *GRPCServer) ListSchedules(ctx context.Context, req *pb.ListSchedulesRequest) (*pb.ListSchedulesResponse, error) {
+	schedules, err := s.store.ListSchedules()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list schedules: %v", err)
+	}
+
+	protoSchedules := make([]*pb.Schedule, 0, len(schedules))
+	for _, schedule := range schedules {
+		protoSchedules = append(protoSchedules, schedule.ToProto())
+	}
+
+	return &pb.ListSchedulesResponse{
+		Schedules:  protoSchedules,
+		TotalCount: int32(len(protoSchedules)),
+	}, nil
+}
+
+// GetSchedule реализует gRPC метод для получения расписания по ID
+func (s *GRPCServer) GetSchedule(ctx context.Context, req *pb.ScheduleId) (*pb.GetScheduleResponse, error) {
+	schedule, err := s.store.GetSchedule(req.Id)
+	if err != nil {
+		return nil, getScheduleError(req.Id, err)
+	}
+	return &pb.GetScheduleResponse{Schedule: schedule.ToProto()}, nil
+}
+
+// CreateSchedule реализует gRPC метод для создания расписания
+func (s *GRPCServer) CreateSchedule(ctx context.Context, req *pb.CreateScheduleRequest) (*pb.CreateScheduleResponse, error) {
+	if req.Schedule == nil {
+		return nil, apierror.InvalidArgument("schedule is required",
+			apierror.FieldViolation{Field: "schedule", Description: "must be set"})
+	}
+
+	src := req.Schedule
+	log.Printf("CreateSchedule request: name: %q, action: %s, cron: %q", src.Name, src.GetAction().GetType(), src.Cron)
+
+	violations, err := s.validateScheduleAction(src.Action)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(src.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		violations = append(violations, apierror.FieldViolation{Field: "schedule.name", Description: fmt.Sprintf("must be 1 to %d characters", maxNameLength)})
+	}
+	violations = append(violations, validateScheduleTiming(req)...)
+	if src.TimeZone != "" {
+		if _, err := time.LoadLocation(src.TimeZone); err != nil {
+			violations = append(violations, apierror.FieldViolation{Field: "schedule.time_zone", Description: "must be an IANA time zone, e.g. Europe/Moscow"})
+		}
+	}
+	if src.MissedRunPolicy != "" && src.MissedRunPolicy != model.MissedRunSkip && src.MissedRunPolicy != model.MissedRunRunOnce {
+		violations = append(violations, apierror.FieldViolation{
+			Field:       "schedule.missed_run_policy",
+			Description: fmt.Sprintf("must be one of %s, %s", model.MissedRunSkip, model.MissedRunRunOnce),
+		})
+	}
+	if len(violations) > 0 {
+		return nil, apierror.InvalidArgument("invalid schedule", violations...)
+	}
+
+	schedule := model.NewSchedule(name, model.ScheduleActionFromProto(src.Action))
+	schedule.Cron = strings.TrimSpace(src.Cron)
+	schedule.TimeZone = src.TimeZone
+	if src.MissedRunPolicy != "" {
+		schedule.MissedRunPolicy = src.MissedRunPolicy
+	}
+	switch {
+	case req.RunInSeconds > 0:
+		schedule.RunAt = time.Now().Add(time.Duration(req.RunInSeconds) * time.Second).Truncate(time.Second)
+	case src.RunAt != nil:
+		schedule.RunAt = src.RunAt.AsTime()
+	}
+
+	created, err := s.schedules.Add(schedule)
+	if err != nil {
+		log.Printf("CreateSchedule: failed to save schedule: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to save schedule: %v", err)
+	}
+	return &pb.CreateScheduleResponse{Schedule: created.ToProto()}, nil
+}
+
+// DeleteSchedule реализует gRPC метод для удаления расписания
+func (s *GRPCServer) DeleteSchedule(ctx context.Context, req *pb.ScheduleId) (*pb.Empty, error) {
+	log.Printf("DeleteSchedule request for ID: %s", req.Id)
+
+	if err := s.schedules.Delete(req.Id); err != nil {
+		return nil, getScheduleError(req.Id, err)
+	}
+	return &pb.Empty{}, nil
+}
+
+// PauseSchedule реализует gRPC метод для приостановки расписания
+func (s *GRPCServer) PauseSchedule(ctx context.Context, req *pb.ScheduleId) (*pb.PauseScheduleResponse, error) {
+	log.Printf("PauseSchedule request for ID: %s", req.Id)
+
+	schedule, err := s.schedules.Pause(req.Id)
+	if err != nil {
+		return nil, getScheduleError(req.Id, err)
+	}
+	return &pb.PauseScheduleResponse{Schedule: schedule.ToProto()}, nil
+}
+
+// ResumeSchedule реализует gRPC метод для возобновления расписания
+func (s *GRPCServer) ResumeSchedule(ctx context.Context, req *pb.ScheduleId) (*pb.ResumeScheduleResponse, error) {
+	log.Printf("ResumeSchedule request for ID: %s", req.Id)
+
+	schedule, err := s.schedules.Resume(req.Id)
+	if err != nil {
+		return nil, getScheduleError(req.Id, err)
+	}
+	return &pb.ResumeScheduleResponse{Schedule: schedule.ToProto()}, nil
+}
+
+// Scheduler возвращает планировщик сервиса. Его нужно запустить Run.
+func (s *GRPCServer) Scheduler() *automation.Scheduler {
+	return s.schedules
+}
+
+// validateScheduleAction проверяет действие расписания так же, как
+// действия правил
+func (s *GRPCServer) validateScheduleAction(action *pb.ScheduleAction) ([]apierror.FieldViolation, error) {
+	const field = "schedule.action"
+	switch action.GetType() {
+	case model.ActionControl:
+		return s.validateControlAction(action.GetDeviceId(), action.GetCommand(), field)
+	case model.ActionScene:
+		return s.validateSceneAction(action.GetSceneId(), field)
+	}
+	return []apierror.FieldViolation{{
+		Field:       field + ".type",
+		Description: fmt.Sprintf("must be one of %s, %s", model.ActionControl, model.ActionScene),
+	}}, nil
+}
+
+// validateScheduleTiming проверяет, что задано ровно одно из run_at, cron
+// или run_in_seconds
+func validateScheduleTiming(req *pb.CreateScheduleRequest) []apierror.FieldViolation {
+	src := req.Schedule
+	set := 0
+	for _, ok := range []bool{src.RunAt != nil, strings.TrimSpace(src.Cron) != "", req.RunInSeconds != 0} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return []apierror.FieldViolation{{Field: "schedule", Description: "exactly one of run_at, cron or run_in_seconds must be set"}}
+	}
+
+	switch {
+	case src.RunAt != nil:
+		if err := src.RunAt.CheckValid(); err != nil || !src.RunAt.AsTime().After(time.Now()) {
+			return []apierror.FieldViolation{{Field: "schedule.run_at", Description: "must be in the future"}}
+		}
+	case req.RunInSeconds != 0:
+		if req.RunInSeconds < 0 || time.Duration(req.RunInSeconds)*time.Second > maxRunIn {
+			return []apierror.FieldViolation{{Field: "run_in_seconds", Description: fmt.Sprintf("must be 1 to %d", int(maxRunIn/time.Second))}}
+		}
+	default:
+		cron, err := automation.ParseCron(src.Cron)
+		if err != nil {
+			return []apierror.FieldViolation{{Field: "schedule.cron", Description: err.Error()}}
+		}
+		if cron.Next(time.Now(), time.UTC).IsZero() {
+			return []apierror.FieldViolation{{Field: "schedule.cron", Description: "never matches a date"}}
+		}
+	}
+	return nil
+}
+
+// getScheduleError преобразует ошибку хранилища расписаний в ошибку gRPC
+func getScheduleError(id string, err error) error {
+	switch {
+	case errors.Is(err, datastore.ErrScheduleNotFound):
+		return apierror.Newf(codes.NotFound, apierror.ReasonScheduleNotFound, "schedule with ID %s not found", id).
+			WithMetadata("schedule_id", id)
+	case errors.Is(err, datastore.ErrInvalidScheduleID):
+		return apierror.InvalidArgument("schedule ID is required",
+			apierror.FieldViolation{Field: "id", Description: "must not be empty"})
+	}
+	return status.Errorf(codes.Internal, "failed to get schedule: %v", err)
+}
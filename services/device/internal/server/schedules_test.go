@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestCreateSchedule(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	socket := createDeviceInRoom(t, s, "socket", "")
+
+	turnOn := &pb.ScheduleAction{Type: "control", Command: &pb.Command{DeviceId: socket.Id, Action: "turn_on"}}
+	future := timestamppb.New(time.Now().Add(time.Hour))
+	tests := []struct {
+		name     string
+		schedule *pb.Schedule
+		runIn    int32
+		code     codes.Code
+		field    string
+	}{
+		{"Cron", &pb.Schedule{Name: " Чайник ", Action: turnOn, Cron: "0 7 * * 1-5", TimeZone: "Europe/Moscow", MissedRunPolicy: "run_once"}, 0, codes.OK, ""},
+		{"RunAt", &pb.Schedule{Name: "Чайник", Action: turnOn, RunAt: future}, 0, codes.OK, ""},
+		{"RunIn", &pb.Schedule{Name: "Чайник", Action: turnOn}, 1800, codes.OK, ""},
+		{"NoSchedule", nil, 0, codes.InvalidArgument, "schedule"},
+		{"EmptyName", &pb.Schedule{Action: turnOn, Cron: "@daily"}, 0, codes.InvalidArgument, "schedule.name"},
+		{"NoTiming", &pb.Schedule{Name: "Чайник", Action: turnOn}, 0, codes.InvalidArgument, "schedule"},
+		{"CronAndRunIn", &pb.Schedule{Name: "Чайник", Action: turnOn, Cron: "@daily"}, 60, codes.InvalidArgument, "schedule"},
+		{"PastRunAt", &pb.Schedule{Name: "Чайник", Action: turnOn, RunAt: timestamppb.New(time.Now().Add(-time.Minute))}, 0, codes.InvalidArgument, "schedule.run_at"},
+		{"NegativeRunIn", &pb.Schedule{Name: "Чайник", Action: turnOn}, -5, codes.InvalidArgument, "run_in_seconds"},
+		{"InvalidCron", &pb.Schedule{Name: "Чайник", Action: turnOn, Cron: "0 25 * * *"}, 0, codes.InvalidArgument, "schedule.cron"},
+		{"NeverMatches", &pb.Schedule{Name: "Чайник", Action: turnOn, Cron: "0 0 31 feb *"}, 0, codes.InvalidArgument, "schedule.cron"},
+		{"InvalidTimeZone", &pb.Schedule{Name: "Чайник", Action: turnOn, Cron: "@daily", TimeZone: "Mars/Olympus"}, 0, codes.InvalidArgument, "schedule.time_zone"},
+		{"InvalidPolicy", &pb.Schedule{Name: "Чайник", Action: turnOn, Cron: "@daily", MissedRunPolicy: "all"}, 0, codes.InvalidArgument, "schedule.missed_run_policy"},
+		{"UnknownAction", &pb.Schedule{Name: "Чайник", Action: &pb.ScheduleAction{Type: "delay"}, Cron: "@daily"}, 0, codes.InvalidArgument, "schedule.action.type"},
+		{"UnknownDevice", &pb.Schedule{Name: "Чайник", Action: &pb.ScheduleAction{Type: "control", DeviceId: "missing", Command: &pb.Command{Action: "turn_on"}}, Cron: "@daily"}, 0, codes.InvalidArgument, "schedule.action.device_id"},
+		{"UnknownScene", &pb.Schedule{Name: "Чайник", Action: &pb.ScheduleAction{Type: "scene", SceneId: "missing"}, Cron: "@daily"}, 0, codes.InvalidArgument, "schedule.action.scene_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.CreateSchedule(ctx, &pb.CreateScheduleRequest{Schedule: tt.schedule, RunInSeconds: tt.runIn})
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v (err: %v)", code, tt.code, err)
+			}
+			if tt.field != "" {
+				assertViolation(t, err, tt.field)
+			}
+			if err != nil {
+				return
+			}
+
+			got := resp.Schedule
+			if got.Id == "" || got.Name != "Чайник" || got.Paused || got.Action.DeviceId != socket.Id || got.NextRunTime == nil {
+				t.Errorf("unexpected schedule: %+v", got)
+			}
+			if tt.runIn > 0 && !got.RunAt.AsTime().Equal(got.NextRunTime.AsTime()) {
+				t.Errorf("run_at = %v, next_run_time = %v", got.RunAt, got.NextRunTime)
+			}
+		})
+	}
+
+	list, err := s.ListSchedules(ctx, &pb.ListSchedulesRequest{})
+	if err != nil || list.TotalCount != 3 {
+		t.Errorf("ListSchedules = %v, %v; want 3 schedules", list, err)
+	}
+}
+
+func TestPauseResumeDeleteSchedule(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	socket := createDeviceInRoom(t, s, "socket", "")
+
+	created, err := s.CreateSchedule(ctx, &pb.CreateScheduleRequest{Schedule: &pb.Schedule{
+		Name:   "Чайник",
+		Action: &pb.ScheduleAction{Type: "control", DeviceId: socket.Id, Command: &pb.Command{Action: "turn_on"}},
+		Cron:   "@hourly",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := created.Schedule.Id
+
+	paused, err := s.PauseSchedule(ctx, &pb.ScheduleId{Id: id})
+	if err != nil || !paused.Schedule.Paused {
+		t.Fatalf("PauseSchedule = %v, %v", paused, err)
+	}
+	resumed, err := s.ResumeSchedule(ctx, &pb.ScheduleId{Id: id})
+	if err != nil || resumed.Schedule.Paused || resumed.Schedule.NextRunTime == nil {
+		t.Fatalf("ResumeSchedule = %v, %v", resumed, err)
+	}
+
+	if _, err := s.DeleteSchedule(ctx, &pb.ScheduleId{Id: id}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.GetSchedule(ctx, &pb.ScheduleId{Id: id})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("GetSchedule after delete: %v", err)
+	}
+	if reason := apierror.Reason(err); reason != apierror.ReasonScheduleNotFound {
+		t.Errorf("reason = %q, want %q", reason, apierror.ReasonScheduleNotFound)
+	}
+	if _, err := s.PauseSchedule(ctx, &pb.ScheduleId{Id: id}); status.Code(err) != codes.NotFound {
+		t.Errorf("PauseSchedule after delete: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
+	"github.com/velvetriddles/mini-smart-home/services/device/internal/model"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startStream запускает сервер на bufconn и открывает поток статусов
+func startStream(t *testing.T, s *GRPCServer) pb.DeviceService_StreamStatusesClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterDeviceServiceServer(server, s)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	stream, err := pb.NewDeviceServiceClient(conn).StreamStatuses(ctx)
+	if err != nil {
+		t.Fatalf("StreamStatuses failed: %v", err)
+	}
+	return stream
+}
+
+func recvStatus(t *testing.T, stream pb.DeviceService_StreamStatusesClient) *pb.StatusResponse {
+	t.Helper()
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	return resp
+}
+
+func TestStreamStatuses_SubscribeAll(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	lamp, err := s.CreateDevice(ctx, &pb.CreateDeviceRequest{Device: &pb.Device{Name: "Лампа", Type: "lamp"}})
+	if err != nil {
+		t.Fatalf("CreateDevice failed: %v", err)
+	}
+
+	stream := startStream(t, s)
+	if err := stream.Send(&pb.StatusRequest{SubscribeAll: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Начальный снимок
+	if resp := recvStatus(t, stream); resp.DeviceId != lamp.Device.Id || resp.Status == nil {
+		t.Fatalf("unexpected snapshot: %v", resp)
+	}
+
+	// Изменение приходит сразу
+	if _, err := s.ControlDevice(ctx, &pb.ControlDeviceRequest{Id: lamp.Device.Id, Command: &pb.Command{Action: model.CommandTurnOff}}); err != nil {
+		t.Fatalf("ControlDevice failed: %v", err)
+	}
+	if resp := recvStatus(t, stream); resp.DeviceId != lamp.Device.Id || resp.Status.Parameters[model.ParamPower] != "off" {
+		t.Fatalf("unexpected update: %v", resp)
+	}
+
+	// Созданные и удаленные устройства попадают в подписку на все устройства
+	socket, err := s.CreateDevice(ctx, &pb.CreateDeviceRequest{Device: &pb.Device{Name: "Розетка", Type: "socket"}})
+	if err != nil {
+		t.Fatalf("CreateDevice failed: %v", err)
+	}
+	if resp := recvStatus(t, stream); resp.DeviceId != socket.Device.Id || resp.Deleted {
+		t.Fatalf("unexpected create event: %v", resp)
+	}
+	if _, err := s.DeleteDevice(ctx, &pb.DeviceId{Id: lamp.Device.Id}); err != nil {
+		t.Fatalf("DeleteDevice failed: %v", err)
+	}
+	if resp := recvStatus(t, stream); resp.DeviceId != lamp.Device.Id || !resp.Deleted || resp.Status != nil {
+		t.Fatalf("unexpected delete event: %v", resp)
+	}
+}
+
+func TestStreamStatuses_ChangeSubscription(t *testing.T) {
+	s := newTestServer()
+	ctx := context.Background()
+	lamp, err := s.CreateDevice(ctx, &pb.CreateDeviceRequest{Device: &pb.Device{Name: "Лампа", Type: "lamp"}})
+	if err != nil {
+		t.Fatalf("CreateDevice failed: %v", err)
+	}
+	socket, err := s.CreateDevice(ctx, &pb.CreateDeviceRequest{Device: &pb.Device{Name: "Розетка", Type: "socket"}})
+	if err != nil {
+		t.Fatalf("CreateDevice failed: %v", err)
+	}
+	turnOn := func(id string) {
+		t.Helper()
+		if _, err := s.ControlDevice(ctx, &pb.ControlDeviceRequest{Id: id, Command: &pb.Command{Action: model.CommandTurnOn}}); err != nil {
+			t.Fatalf("ControlDevice failed: %v", err)
+		}
+	}
+
+	stream := startStream(t, s)
+	if err := stream.Send(&pb.StatusRequest{DeviceId: lamp.Device.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if resp := recvStatus(t, stream); resp.DeviceId != lamp.Device.Id {
+		t.Fatalf("unexpected snapshot: %v", resp)
+	}
+
+	// Изменения других устройств не приходят
+	turnOn(socket.Device.Id)
+	turnOn(lamp.Device.Id)
+	if resp := recvStatus(t, stream); resp.DeviceId != lamp.Device.Id {
+		t.Fatalf("expected lamp update, got %v", resp)
+	}
+
+	// Последующий запрос добавляет устройство в подписку
+	if err := stream.Send(&pb.StatusRequest{DeviceId: socket.Device.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if resp := recvStatus(t, stream); resp.DeviceId != socket.Device.Id {
+		t.Fatalf("expected socket snapshot, got %v", resp)
+	}
+
+	// Отписка от лампы
+	if err := stream.Send(&pb.StatusRequest{DeviceId: lamp.Device.Id, Unsubscribe: true}); err != nil {
+		t.Fatal(err)
+	}
+	// Следующий запрос обрабатывается после отписки, его снимок подтверждает ее применение
+	if err := stream.Send(&pb.StatusRequest{DeviceId: socket.Device.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if resp := recvStatus(t, stream); resp.DeviceId != socket.Device.Id {
+		t.Fatalf("expected socket snapshot, got %v", resp)
+	}
+	turnOn(lamp.Device.Id)
+	turnOn(socket.Device.Id)
+	if resp := recvStatus(t, stream); resp.DeviceId != socket.Device.Id {
+		t.Fatalf("expected socket update after unsubscribing lamp, got %v", resp)
+	}
+}
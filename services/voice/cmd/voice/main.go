@@ -14,11 +14,13 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
+	"github.com/velvetriddles/mini-smart-home/libs/sysstatus"
+	"github.com/velvetriddles/mini-smart-home/libs/tlsutil"
 	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
 	"github.com/velvetriddles/mini-smart-home/services/voice/internal/server"
 )
@@ -29,6 +31,10 @@ var (
 	deviceAddr = flag.String("device-addr", "localhost:9200", "Device service address")
 	authAddr   = flag.String("auth-addr", "localhost:9100", "Auth service address")
 	logLevel   = flag.String("log-level", getEnv("LOG_LEVEL", "info"), "Уровень логирования (debug, info, warn, error)")
+
+	// mTLS для gRPC-сервера и клиентов Device и Auth: --tls-ca, --tls-cert, --tls-key
+	// (или TLS_CA_FILE, TLS_CERT_FILE, TLS_KEY_FILE)
+	tlsConfig = tlsutil.RegisterFlags(flag.CommandLine, "")
 )
 
 func main() {
@@ -52,21 +58,36 @@ func main() {
 		*authAddr = envAuthAddr
 	}
 
+	// Учетные данные gRPC: mTLS с общим CA, если заданы сертификаты.
+	// Тот же сертификат Voice предъявляет как клиент сервисам Device и Auth.
+	serverCreds, err := tlsConfig.ServerOption()
+	if err != nil {
+		log.Fatalf("Неверная конфигурация TLS: %v", err)
+	}
+	clientCreds, err := tlsConfig.DialOption()
+	if err != nil {
+		log.Fatalf("Неверная конфигурация TLS: %v", err)
+	}
+
 	// Создаем gRPC соединения с сервисами устройств и аутентификации
-	deviceConn, err := grpc.Dial(*deviceAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	deviceConn, err := grpc.Dial(*deviceAddr, clientCreds)
 	if err != nil {
 		log.Fatalf("Не удалось подключиться к Device Service: %v", err)
 	}
 	defer deviceConn.Close()
 
-	authConn, err := grpc.Dial(*authAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	authConn, err := grpc.Dial(*authAddr, clientCreds)
 	if err != nil {
 		log.Fatalf("Не удалось подключиться к Auth Service: %v", err)
 	}
 	defer authConn.Close()
 
-	// Инициализируем gRPC сервер
-	grpcServer := grpc.NewServer()
+	// Инициализируем gRPC сервер. Интерцепторы добавляют ErrorInfo ко всем ошибкам.
+	grpcServer := grpc.NewServer(
+		serverCreds,
+		grpc.UnaryInterceptor(apierror.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(apierror.StreamServerInterceptor()),
+	)
 	voiceServer := server.NewGRPCServer(deviceConn, authConn)
 
 	// Регистрируем сервисы
@@ -80,6 +101,12 @@ func main() {
 	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
 	healthpb.RegisterHealthServer(grpcServer, healthServer)
 
+	// Регистрируем System Service: версия, время работы и доступность сервисов, к которым обращается Voice
+	pb.RegisterSystemServiceServer(grpcServer, sysstatus.NewServer("voice",
+		sysstatus.Dependency{Name: "device-service", Check: sysstatus.GRPCHealth(deviceConn)},
+		sysstatus.Dependency{Name: "auth-service", Check: sysstatus.GRPCHealth(authConn)},
+	))
+
 	// Запускаем HTTP сервер для метрик и health check
 	http.Handle("/metrics", promhttp.Handler())
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -7,6 +7,7 @@ import (
 	"log"
 	"strings"
 
+	"github.com/velvetriddles/mini-smart-home/libs/apierror"
 	pb "github.com/velvetriddles/mini-smart-home/proto_generated/smarthome/v1"
 	"github.com/velvetriddles/mini-smart-home/services/voice/internal/model"
 	"github.com/velvetriddles/mini-smart-home/services/voice/internal/nlu"
@@ -40,19 +41,19 @@ func (s *GRPCServer) RecognizeCommand(stream pb.VoiceService_RecognizeCommandSer
 	// Получаем метаданные запроса для извлечения токена авторизации
 	md, ok := metadata.FromIncomingContext(stream.Context())
 	if !ok {
-		return status.Error(codes.Unauthenticated, "метаданные не найдены")
+		return apierror.New(codes.Unauthenticated, apierror.ReasonTokenMissing, "request metadata is missing")
 	}
 
 	// Извлекаем токен из метаданных
 	authHeader, ok := md["authorization"]
 	if !ok || len(authHeader) == 0 {
-		return status.Error(codes.Unauthenticated, "токен авторизации не найден")
+		return apierror.New(codes.Unauthenticated, apierror.ReasonTokenMissing, "authorization token is missing")
 	}
 
 	// Проверяем формат токена (Bearer token)
 	tokenParts := strings.Split(authHeader[0], " ")
-	if len(tokenParts) != 2 || strings.ToLower(tokenParts[0]) != "bearer" {
-		return status.Error(codes.Unauthenticated, "неверный формат токена")
+	if len(tokenParts) != 2 || strings.ToLower(tokenParts[0]) != "bearer" || tokenParts[1] == "" {
+		return apierror.New(codes.Unauthenticated, apierror.ReasonTokenInvalid, "authorization header must be 'Bearer <token>'")
 	}
 	token := tokenParts[1]
 
@@ -62,10 +63,14 @@ func (s *GRPCServer) RecognizeCommand(stream pb.VoiceService_RecognizeCommandSer
 	})
 	if err != nil {
 		log.Printf("Ошибка при проверке токена: %v", err)
-		return status.Error(codes.Unauthenticated, "ошибка проверки токена")
+		return apierror.New(codes.Unavailable, apierror.ReasonUnavailable, "failed to validate token")
 	}
 	if !validateResp.Valid {
-		return status.Error(codes.Unauthenticated, "недействительный токен")
+		reason := validateResp.Error
+		if reason == "" {
+			reason = apierror.ReasonTokenInvalid
+		}
+		return apierror.New(codes.Unauthenticated, reason, "invalid authorization token")
 	}
 
 	// Основной цикл обработки потока
@@ -76,7 +81,7 @@ func (s *GRPCServer) RecognizeCommand(stream pb.VoiceService_RecognizeCommandSer
 		}
 		if err != nil {
 			log.Printf("Ошибка при получении команды: %v", err)
-			return status.Error(codes.Internal, "ошибка получения команды")
+			return status.Error(codes.Internal, "failed to receive command")
 		}
 
 		// Сохраняем токен для текущей сессии
@@ -97,21 +102,21 @@ func (s *GRPCServer) RecognizeCommand(stream pb.VoiceService_RecognizeCommandSer
 				SessionId:    req.SessionId,
 				ResponseText: "Обработка аудио-данных пока не поддерживается.",
 				Successful:   false,
-				Error:        "audio_not_supported",
+				Error:        apierror.ReasonAudioNotSupported,
 			}
 		default:
 			response = &pb.VoiceResponse{
 				SessionId:    req.SessionId,
 				ResponseText: "Неизвестный тип входных данных.",
 				Successful:   false,
-				Error:        "invalid_input_type",
+				Error:        apierror.ReasonInvalidInput,
 			}
 		}
 
 		// Отправляем ответ
 		if err := stream.Send(response); err != nil {
 			log.Printf("Ошибка при отправке ответа: %v", err)
-			return status.Error(codes.Internal, "ошибка отправки ответа")
+			return status.Error(codes.Internal, "failed to send response")
 		}
 	}
 }
@@ -155,7 +160,7 @@ func (s *GRPCServer) handleTextCommand(ctx context.Context, text string, session
 			SessionId:    sessionID,
 			ResponseText: "Извините, я не понимаю эту команду.",
 			Successful:   false,
-			Error:        "intent_not_recognized",
+			Error:        apierror.ReasonIntentNotRecognized,
 			RecognizedIntent: &pb.Intent{
 				Name:       intent.Name,
 				Confidence: intent.Confidence,
@@ -197,7 +202,7 @@ func (s *GRPCServer) handleTextCommand(ctx context.Context, text string, session
 	default:
 		responseText = "Интент распознан, но обработка пока не реализована."
 		successful = false
-		errorMsg = "intent_handling_not_implemented"
+		errorMsg = apierror.ReasonIntentNotImplemented
 	}
 
 	return &pb.VoiceResponse{
@@ -214,7 +219,7 @@ func (s *GRPCServer) handleDeviceControlIntent(ctx context.Context, intent *mode
 	// Получаем тип устройства из интента
 	deviceEntity, deviceExists := intent.Entities[model.EntityDevice]
 	if !deviceExists {
-		return "Не удалось определить, какое устройство нужно " + actionVerbFromIntent(intent.Name) + ".", false, "missing_device_entity"
+		return "Не удалось определить, какое устройство нужно " + actionVerbFromIntent(intent.Name) + ".", false, apierror.ReasonMissingEntity
 	}
 
 	// Получаем комнату из интента (если есть)
@@ -229,36 +234,44 @@ func (s *GRPCServer) handleDeviceControlIntent(ctx context.Context, intent *mode
 	// 2. Ищем первое устройство, соответствующее типу и комнате
 	// 3. Отправляем команду на это устройство
 
+	// Комната ищется по имени и псевдонимам ("кухне" - псевдоним комнаты "Кухня")
+	var room *pb.Room
+	if roomExists {
+		room = s.findRoom(ctx, roomEntity.Value)
+	}
+
 	// Получаем список устройств
 	devicesResp, err := s.deviceClient.ListDevices(ctx, &pb.ListDevicesRequest{
 		Type:       deviceEntity.Value, // Фильтруем по типу
 		OnlineOnly: true,               // Только онлайн устройства
+		RoomId:     room.GetId(),       // Фильтруем по комнате, если она найдена
 	})
 	if err != nil {
 		log.Printf("Ошибка при получении списка устройств: %v", err)
-		return "Не удалось получить список устройств.", false, "device_service_error"
+		return "Не удалось получить список устройств.", false, apierror.ReasonDeviceServiceFailed
 	}
 
 	if len(devicesResp.Devices) == 0 {
-		return fmt.Sprintf("Устройство типа '%s'%s не найдено или недоступно.", deviceEntity.Value, roomDescription), false, "device_not_found"
+		return fmt.Sprintf("Устройство типа '%s'%s не найдено или недоступно.", deviceEntity.Value, roomDescription), false, apierror.ReasonDeviceNotFound
 	}
 
 	// Ищем устройство, соответствующее комнате (если указана)
 	var targetDevice *pb.Device
-	if roomExists {
+	if room != nil || !roomExists {
+		// Если комната найдена или не указана, берем первое устройство из списка
+		targetDevice = devicesResp.Devices[0]
+	} else {
+		// Комнаты с таким именем нет: сравниваем с расположением устройства
 		for _, device := range devicesResp.Devices {
 			if strings.EqualFold(device.Room, roomEntity.Value) {
 				targetDevice = device
 				break
 			}
 		}
-	} else {
-		// Если комната не указана, берем первое устройство из списка
-		targetDevice = devicesResp.Devices[0]
 	}
 
 	if targetDevice == nil {
-		return fmt.Sprintf("Устройство типа '%s'%s не найдено или недоступно.", deviceEntity.Value, roomDescription), false, "device_not_found"
+		return fmt.Sprintf("Устройство типа '%s'%s не найдено или недоступно.", deviceEntity.Value, roomDescription), false, apierror.ReasonDeviceNotFound
 	}
 
 	// Определяем действие
@@ -268,7 +281,7 @@ func (s *GRPCServer) handleDeviceControlIntent(ctx context.Context, intent *mode
 	}
 
 	// Отправляем команду на устройство
-	controlResp, err := s.deviceClient.ControlDevice(ctx, &pb.ControlDeviceRequest{
+	_, err = s.deviceClient.ControlDevice(ctx, &pb.ControlDeviceRequest{
 		Id: targetDevice.Id,
 		Command: &pb.Command{
 			DeviceId:   targetDevice.Id,
@@ -278,16 +291,37 @@ func (s *GRPCServer) handleDeviceControlIntent(ctx context.Context, intent *mode
 	})
 	if err != nil {
 		log.Printf("Ошибка при отправке команды: %v", err)
-		return fmt.Sprintf("Не удалось %s устройство.", actionVerbFromIntent(intent.Name)), false, "control_device_error"
-	}
-
-	if !controlResp.Success {
-		return fmt.Sprintf("Не удалось %s устройство: %s", actionVerbFromIntent(intent.Name), controlResp.Error), false, controlResp.Error
+		reason := apierror.Reason(err)
+		if reason == apierror.ReasonDeviceOffline {
+			return fmt.Sprintf("Не удалось %s устройство: оно не в сети.", actionVerbFromIntent(intent.Name)), false, reason
+		}
+		return fmt.Sprintf("Не удалось %s устройство.", actionVerbFromIntent(intent.Name)), false, reason
 	}
 
 	return fmt.Sprintf("Устройство '%s'%s успешно %s.", targetDevice.Name, roomDescription, actionParticiplePastFromIntent(intent.Name)), true, ""
 }
 
+// findRoom ищет комнату по имени или псевдониму без учета регистра.
+// Возвращает nil, если комната не найдена или список комнат недоступен.
+func (s *GRPCServer) findRoom(ctx context.Context, name string) *pb.Room {
+	resp, err := s.deviceClient.ListRooms(ctx, &pb.ListRoomsRequest{})
+	if err != nil {
+		log.Printf("Ошибка при получении списка комнат: %v", err)
+		return nil
+	}
+	for _, room := range resp.Rooms {
+		if strings.EqualFold(room.Name, name) {
+			return room
+		}
+		for _, alias := range room.Aliases {
+			if strings.EqualFold(alias, name) {
+				return room
+			}
+		}
+	}
+	return nil
+}
+
 // handleGetTemperatureIntent обрабатывает интент запроса температуры
 func (s *GRPCServer) handleGetTemperatureIntent(ctx context.Context, intent *model.Intent, sessionID string) (string, bool, string) {
 	// Получаем комнату из интента
@@ -307,7 +341,7 @@ func (s *GRPCServer) handleSetTemperatureIntent(ctx context.Context, intent *mod
 	// Получаем значение температуры из интента
 	valueEntity, valueExists := intent.Entities[model.EntityValue]
 	if !valueExists {
-		return "Не удалось определить, какую температуру нужно установить.", false, "missing_temperature_value"
+		return "Не удалось определить, какую температуру нужно установить.", false, apierror.ReasonMissingEntity
 	}
 
 	// Получаем комнату из интента
@@ -0,0 +1,3 @@
+// Настройки для dev-сервера Vite. В сборке, которую раздает API Gateway,
+// этот файл заменяется ответом шлюза на /config.js (флаг --web-api-base-url).
+window.__SMARTHOME_CONFIG__ = { apiBaseUrl: '' };
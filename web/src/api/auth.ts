@@ -1,10 +1,11 @@
 // API-функции для аутентификации
+import { apiUrl } from './config';
 
 /**
  * Выполняет вход в систему
  */
 export async function login(email: string, password: string) {
-  const response = await fetch('/api/v1/auth/login', {
+  const response = await fetch(apiUrl('/api/v1/auth/login'), {
     method: 'POST',
     headers: {
       'Content-Type': 'application/json',
@@ -24,7 +25,7 @@ export async function login(email: string, password: string) {
  * Выполняет выход из системы
  */
 export async function logout(token: string) {
-  const response = await fetch('/api/v1/auth/logout', {
+  const response = await fetch(apiUrl('/api/v1/auth/logout'), {
     method: 'POST',
     headers: {
       'Content-Type': 'application/json',
@@ -44,7 +45,7 @@ export async function logout(token: string) {
  * Обновляет токен доступа
  */
 export async function refreshToken(refreshToken: string) {
-  const response = await fetch('/api/v1/auth/refresh', {
+  const response = await fetch(apiUrl('/api/v1/auth/refresh'), {
     method: 'POST',
     headers: {
       'Content-Type': 'application/json',
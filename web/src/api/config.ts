@@ -0,0 +1,21 @@
+// Настройки клиента, которые API Gateway отдает в /config.js при запуске
+
+interface RuntimeConfig {
+  apiBaseUrl?: string;
+}
+
+declare global {
+  interface Window {
+    __SMARTHOME_CONFIG__?: RuntimeConfig;
+  }
+}
+
+// Базовый URL API; пустая строка - тот же origin, что и у интерфейса
+export const apiBaseUrl = (window.__SMARTHOME_CONFIG__?.apiBaseUrl ?? '').replace(/\/+$/, '');
+
+/**
+ * Возвращает полный URL запроса к API
+ */
+export function apiUrl(path: string): string {
+  return apiBaseUrl + path;
+}
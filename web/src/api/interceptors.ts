@@ -1,4 +1,5 @@
 import { refreshToken } from './auth';
+import { apiUrl } from './config';
 
 // Хранилище для refresh токена
 let refreshTokenValue: string | null = null;
@@ -34,7 +35,7 @@ export async function fetchWithTokenRefresh<T>(
     }
 
     // Делаем запрос
-    const response = await fetch(url, options);
+    const response = await fetch(apiUrl(url), options);
     
     // Если 401 Unauthorized и у нас есть refresh токен
     if (response.status === 401 && refreshTokenValue) {
@@ -49,7 +50,7 @@ export async function fetchWithTokenRefresh<T>(
         };
         
         // Повторяем запрос с новым токеном
-        const newResponse = await fetch(url, options);
+        const newResponse = await fetch(apiUrl(url), options);
         
         if (!newResponse.ok) {
           throw new Error(`HTTP error: ${newResponse.status} ${newResponse.statusText}`);